@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Hobrus/hobrusmetrics.git/pkg/client"
+	"github.com/Hobrus/hobrusmetrics.git/pkg/ddsketch"
+)
+
+// Config — параметры нагрузки.
+type Config struct {
+	// Agents — число виртуальных агентов.
+	Agents int
+	// Metrics — число метрик одного агента; половина gauge, половина counter.
+	Metrics int
+	// Batch — метрик в одном запросе; 1 — отправка по одной.
+	Batch int
+	// Interval — период отправки одного агента.
+	Interval time.Duration
+	// Duration — длительность прогона.
+	Duration time.Duration
+	// Timeout — таймаут одного запроса; 0 — без таймаута.
+	Timeout time.Duration
+	// Seed задаёт генератор значений и сдвиги агентов, чтобы прогоны были воспроизводимы.
+	Seed int64
+}
+
+// Validate проверяет параметры.
+func (c Config) Validate() error {
+	switch {
+	case c.Agents <= 0:
+		return errors.New("agents must be positive")
+	case c.Metrics <= 0:
+		return errors.New("metrics must be positive")
+	case c.Batch <= 0:
+		return errors.New("batch must be positive")
+	case c.Interval <= 0:
+		return errors.New("interval must be positive")
+	case c.Duration <= 0:
+		return errors.New("duration must be positive")
+	}
+	return nil
+}
+
+// Report — итоги прогона.
+type Report struct {
+	Duration    time.Duration    `json:"duration_ns"`
+	Requests    int64            `json:"requests"`
+	Errors      int64            `json:"errors"`
+	ErrorRate   float64          `json:"error_rate"`
+	MetricsSent int64            `json:"metrics_sent"`
+	RPS         float64          `json:"requests_per_second"`
+	MPS         float64          `json:"metrics_per_second"`
+	Latency     LatencyReport    `json:"latency_ms"`
+	ErrorKinds  map[string]int64 `json:"error_kinds,omitempty"`
+}
+
+// LatencyReport — квантили задержки запросов в миллисекундах.
+type LatencyReport struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// stats собирает результаты запросов всех агентов. Задержки хранятся в DDSketch:
+// память не растёт с числом запросов, квантили точны до 1%.
+type stats struct {
+	mu          sync.Mutex
+	requests    int64
+	errors      int64
+	metricsSent int64
+	latency     *ddsketch.Sketch
+	maxLatency  time.Duration
+	errorKinds  map[string]int64
+}
+
+func newStats() *stats {
+	sk, _ := ddsketch.New(ddsketch.DefaultRelativeAccuracy, ddsketch.DefaultMaxBins)
+	return &stats{latency: sk, errorKinds: make(map[string]int64)}
+}
+
+func (s *stats) record(metrics int, took time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	s.latency.Add(float64(took) / float64(time.Millisecond))
+	s.maxLatency = max(s.maxLatency, took)
+	if err != nil {
+		s.errors++
+		s.errorKinds[errorKind(err)]++
+		return
+	}
+	s.metricsSent += int64(metrics)
+}
+
+// errorKind группирует ошибки для отчёта: по коду ответа сервера или по классу ошибки.
+func errorKind(err error) string {
+	var apiErr *client.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		return "http_" + strconv.Itoa(apiErr.Status)
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "transport"
+	}
+}
+
+func (s *stats) report(elapsed time.Duration) Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := Report{
+		Duration:    elapsed,
+		Requests:    s.requests,
+		Errors:      s.errors,
+		MetricsSent: s.metricsSent,
+		Latency:     LatencyReport{Max: float64(s.maxLatency) / float64(time.Millisecond)},
+		ErrorKinds:  s.errorKinds,
+	}
+	if s.requests > 0 {
+		r.ErrorRate = float64(s.errors) / float64(s.requests)
+		r.Latency.P50, _ = s.latency.Quantile(0.5)
+		r.Latency.P90, _ = s.latency.Quantile(0.9)
+		r.Latency.P99, _ = s.latency.Quantile(0.99)
+	}
+	if secs := elapsed.Seconds(); secs > 0 {
+		r.RPS = float64(s.requests) / secs
+		r.MPS = float64(s.metricsSent) / secs
+	}
+	return r
+}
+
+// virtualAgent — набор метрик одного агента. Имена уникальны для агента,
+// поэтому агенты не пишут в общие метрики.
+type virtualAgent struct {
+	gauges  []string
+	counter []string
+	rnd     *rand.Rand
+}
+
+func newVirtualAgent(id, metrics int, seed int64) *virtualAgent {
+	a := &virtualAgent{rnd: rand.New(rand.NewSource(seed + int64(id)))}
+	for i := 0; i < metrics; i++ {
+		name := fmt.Sprintf("loadgen_%d_%d", id, i)
+		if i%2 == 0 {
+			a.gauges = append(a.gauges, name)
+		} else {
+			a.counter = append(a.counter, name)
+		}
+	}
+	return a
+}
+
+// snapshot возвращает очередные значения всех метрик агента.
+func (a *virtualAgent) snapshot() []client.Metric {
+	batch := make([]client.Metric, 0, len(a.gauges)+len(a.counter))
+	for _, name := range a.gauges {
+		batch = append(batch, client.Gauge(name, a.rnd.Float64()*1000))
+	}
+	for _, name := range a.counter {
+		batch = append(batch, client.Counter(name, 1))
+	}
+	sort.Slice(batch, func(i, j int) bool { return batch[i].ID < batch[j].ID })
+	return batch
+}
+
+// send отправляет снимок пакетами по cfg.Batch метрик.
+func (a *virtualAgent) send(ctx context.Context, c *client.Client, cfg Config, st *stats) {
+	metrics := a.snapshot()
+	for start := 0; start < len(metrics); start += cfg.Batch {
+		chunk := metrics[start:min(start+cfg.Batch, len(metrics))]
+		began := time.Now()
+		err := a.sendChunk(ctx, c, cfg.Timeout, chunk)
+		if ctx.Err() != nil {
+			// Запрос прерван окончанием прогона и в статистику не входит.
+			return
+		}
+		st.record(len(chunk), time.Since(began), err)
+	}
+}
+
+func (a *virtualAgent) sendChunk(ctx context.Context, c *client.Client, timeout time.Duration, chunk []client.Metric) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if len(chunk) > 1 {
+		_, err := c.Batch(ctx, chunk)
+		return err
+	}
+	m := chunk[0]
+	if m.MType == client.GaugeType {
+		return c.Gauge(ctx, m.ID, *m.Value)
+	}
+	return c.Counter(ctx, m.ID, *m.Delta)
+}
+
+// Run запускает виртуальных агентов на cfg.Duration и возвращает отчёт.
+// Агенты стартуют со случайным сдвигом внутри интервала, чтобы не отправлять всё разом.
+func Run(ctx context.Context, cfg Config, c *client.Client) (Report, error) {
+	if err := cfg.Validate(); err != nil {
+		return Report{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	st := newStats()
+	offsets := rand.New(rand.NewSource(cfg.Seed))
+	started := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Agents; i++ {
+		agent := newVirtualAgent(i, cfg.Metrics, cfg.Seed)
+		offset := time.Duration(offsets.Int63n(int64(cfg.Interval)))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(offset):
+			}
+			ticker := time.NewTicker(cfg.Interval)
+			defer ticker.Stop()
+			for {
+				agent.send(ctx, c, cfg, st)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return st.report(time.Since(started)), nil
+}
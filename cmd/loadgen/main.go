@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/handlers"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+	"github.com/Hobrus/hobrusmetrics.git/pkg/client"
+)
+
+// Коды завершения loadgen.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+	// exitErrorBudget — доля ошибок превысила -max-error-rate.
+	exitErrorBudget = 3
+)
+
+// Генератор нагрузки на сервер метрик. Точка входа.
+func main() {
+	if code := run(os.Args[1:], os.Stdout, os.Stderr); code != exitOK {
+		exit(code)
+	}
+}
+
+// exit завершает процесс с кодом возврата (вынесено из main ради статического анализатора noosexit).
+func exit(code int) {
+	os.Exit(code)
+}
+
+// run разбирает флаги, проводит прогон и печатает отчёт; возвращает код завершения.
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var cfg Config
+	address := fs.String("a", "", "target server address; empty — in-process server")
+	key := fs.String("k", "", "signing key")
+	gzip := fs.Bool("gzip", false, "compress request bodies")
+	output := fs.String("o", "text", "report format: text or json")
+	maxErrorRate := fs.Float64("max-error-rate", 1, "exit with code 3 if the error rate is above (0..1)")
+	fs.IntVar(&cfg.Agents, "agents", 100, "number of virtual agents")
+	fs.IntVar(&cfg.Metrics, "metrics", 20, "metrics per agent (half gauges, half counters)")
+	fs.IntVar(&cfg.Batch, "batch", 0, "metrics per request; 1 — one by one, 0 — all metrics of an agent")
+	fs.DurationVar(&cfg.Interval, "interval", time.Second, "report interval of each agent")
+	fs.DurationVar(&cfg.Duration, "duration", 10*time.Second, "test duration")
+	fs.DurationVar(&cfg.Timeout, "timeout", 5*time.Second, "request timeout")
+	fs.Int64Var(&cfg.Seed, "seed", 1, "random seed for values and start offsets")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if cfg.Batch == 0 {
+		cfg.Batch = cfg.Metrics
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(stderr, "unsupported report format %q\n", *output)
+		return exitUsage
+	}
+
+	opts := client.Options{Key: *key, Gzip: *gzip, RetryIntervals: []time.Duration{}}
+	if *address == "" {
+		opts.Transport = client.NewHandlerTransport(inProcessServer(*key))
+	} else {
+		transport, err := client.NewHTTPTransport(*address, httpClient(cfg.Agents))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+		opts.Transport = transport
+	}
+	c, err := client.New(*address, opts)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report, err := Run(ctx, cfg, c)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+	} else {
+		printReport(stdout, cfg, report)
+	}
+	if report.ErrorRate > *maxErrorRate {
+		return exitErrorBudget
+	}
+	return exitOK
+}
+
+// httpClient возвращает HTTP-клиент, который держит открытым соединение на каждого
+// виртуального агента: с двумя соединениями клиента по умолчанию прогон измерял бы
+// установку соединений, а не пропускную способность сервера.
+func httpClient(agents int) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = agents
+	transport.MaxIdleConnsPerHost = agents
+	return &http.Client{Transport: transport}
+}
+
+// inProcessServer собирает сервер в памяти с тем же набором middleware, что cmd/server.
+// Прогон против него не зависит от сети и воспроизводим.
+func inProcessServer(key string) *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	ms := &service.MetricsService{Storage: repository.NewMemStorage()}
+	router := gin.New()
+	router.Use(gin.Recovery())
+	if key != "" {
+		router.Use(middleware.HashRequestMiddleware(key))
+		router.Use(middleware.HashResponseMiddleware(key))
+	}
+	router.Use(middleware.GzipMiddleware())
+	h := handlers.NewHandler(ms)
+	h.SetupRoutes(router)
+	h.SetupAdminRoutes(router, "", logrus.New())
+	return router
+}
+
+func printReport(w io.Writer, cfg Config, r Report) {
+	fmt.Fprintf(w, "agents=%d metrics=%d batch=%d interval=%s duration=%s\n",
+		cfg.Agents, cfg.Metrics, cfg.Batch, cfg.Interval, r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "requests:   %d (%.1f/s)\n", r.Requests, r.RPS)
+	fmt.Fprintf(w, "metrics:    %d (%.1f/s)\n", r.MetricsSent, r.MPS)
+	fmt.Fprintf(w, "errors:     %d (%.2f%%)\n", r.Errors, r.ErrorRate*100)
+	kinds := make([]string, 0, len(r.ErrorKinds))
+	for k := range r.ErrorKinds {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	for _, k := range kinds {
+		fmt.Fprintf(w, "  %-10s %d\n", k, r.ErrorKinds[k])
+	}
+	fmt.Fprintf(w, "latency ms: p50=%.2f p90=%.2f p99=%.2f max=%.2f\n",
+		r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRun_InProcess(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"-agents", "5", "-metrics", "4", "-batch", "3", "-interval", "20ms", "-duration", "200ms", "-k", "secret", "-gzip", "-o", "json"}
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run failed: code=%d stderr=%s", code, stderr.String())
+	}
+	var report Report
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("report must be JSON: %v", err)
+	}
+	if report.Requests == 0 || report.Errors != 0 {
+		t.Fatalf("expected successful requests, got %+v", report)
+	}
+	// Четыре метрики пакетами по три: в запросе одна или три метрики.
+	if report.MetricsSent < report.Requests || report.MetricsSent > report.Requests*3 {
+		t.Fatalf("unexpected batch sizes: %d metrics in %d requests", report.MetricsSent, report.Requests)
+	}
+	if report.Latency.P50 <= 0 || report.Latency.P99 < report.Latency.P50 {
+		t.Fatalf("unexpected latency quantiles: %+v", report.Latency)
+	}
+}
+
+func TestRun_ErrorBudget(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"-a", "127.0.0.1:1", "-agents", "2", "-interval", "20ms", "-duration", "100ms", "-max-error-rate", "0.5"}
+	if code := run(args, &stdout, &stderr); code != exitErrorBudget {
+		t.Fatalf("expected error budget exit code, got %d (stderr=%s)", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "transport") {
+		t.Fatalf("report must list error kinds: %q", stdout.String())
+	}
+}
+
+func TestRun_Usage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-agents", "0"}, &stdout, &stderr); code != exitUsage {
+		t.Fatalf("expected usage exit code, got %d", code)
+	}
+}
+
+func TestHTTPClient_ScalesIdleConnections(t *testing.T) {
+	transport := httpClient(3000).Transport.(*http.Transport)
+	if transport.MaxIdleConnsPerHost != 3000 || transport.MaxIdleConns != 3000 {
+		t.Fatalf("expected an idle connection per agent, got %d per host, %d total",
+			transport.MaxIdleConnsPerHost, transport.MaxIdleConns)
+	}
+}
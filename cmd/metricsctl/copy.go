@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+// runCopy копирует все метрики из одного хранилища в другое без запущенного сервера.
+// Источник и приёмник задаются путём к файлу хранения или DSN PostgreSQL.
+func runCopy(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("copy", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	from := fs.String("from", "", "source: file path or PostgreSQL DSN")
+	to := fs.String("to", "", "destination: file path or PostgreSQL DSN")
+	replace := fs.Bool("replace", false, "replace destination contents instead of merging")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *from == "" || *to == "" {
+		fmt.Fprintln(stderr, "both -from and -to are required")
+		fs.Usage()
+		return exitUsage
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(stderr)
+
+	src, closeSrc, err := openStorage(*from, true, logger)
+	if err != nil {
+		fmt.Fprintf(stderr, "open source: %v\n", err)
+		return exitError
+	}
+	defer closeSrc()
+
+	dst, closeDst, err := openStorage(*to, false, logger)
+	if err != nil {
+		fmt.Fprintf(stderr, "open destination: %v\n", err)
+		return exitError
+	}
+
+	data := (&service.MetricsService{Storage: src}).Snapshot()
+	if err := (&service.MetricsService{Storage: dst}).RestoreSnapshot(data, *replace); err != nil {
+		closeDst()
+		fmt.Fprintf(stderr, "restore: %v\n", err)
+		return exitError
+	}
+	if err := dst.Shutdown(); err != nil {
+		closeDst()
+		fmt.Fprintf(stderr, "flush destination: %v\n", err)
+		return exitError
+	}
+	closeDst()
+
+	fmt.Fprintf(stdout, "copied %d gauges and %d counters\n", len(data.Gauges), len(data.Counters))
+	return exitOK
+}
+
+// isDSN сообщает, похоже ли описание хранилища на DSN PostgreSQL.
+func isDSN(spec string) bool {
+	return strings.HasPrefix(spec, "postgres://") ||
+		strings.HasPrefix(spec, "postgresql://") ||
+		strings.Contains(spec, "host=")
+}
+
+// openStorage открывает хранилище по описанию. Источник-файл обязан существовать.
+// Возвращаемая функция освобождает ресурсы (соединение с БД).
+func openStorage(spec string, source bool, logger *logrus.Logger) (repository.Storage, func(), error) {
+	if isDSN(spec) {
+		db, err := repository.NewDBConnection(spec)
+		if err != nil {
+			return nil, nil, err
+		}
+		ps, err := repository.NewPostgresStorage(db)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		return ps, db.Close, nil
+	}
+
+	_, statErr := os.Stat(spec)
+	if source && statErr != nil {
+		return nil, nil, statErr
+	}
+	// Нулевой интервал: без фонового сохранения, запись на диск — при Restore и Shutdown.
+	fs, err := repository.NewFileBackedStorage(spec, 0, false, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	if statErr == nil {
+		if err := fs.LoadFromFile(); err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", spec, err)
+		}
+	}
+	return fs, func() {}, nil
+}
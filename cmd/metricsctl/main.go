@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/pkg/buildinfo"
+)
+
+// Коды завершения metricsctl.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+	// exitNotFound — запрошенная метрика не найдена.
+	exitNotFound = 3
+	// exitUnavailable — сервер недоступен, не ответил вовремя или ответил 5xx.
+	exitUnavailable = 4
+	// exitCheckFailed — значение метрики вне диапазона -min/-max (get).
+	exitCheckFailed = 5
+)
+
+// command описывает подкоманду metricsctl.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string, stdout, stderr io.Writer) int
+}
+
+// commands возвращает список доступных подкоманд.
+func commands() []command {
+	return []command{
+		{name: "push", usage: "push gauge and counter values to the server", run: runPush},
+		{name: "get", usage: "print a metric value; -min/-max turn it into a health check", run: runGet},
+		{name: "list", usage: "list metrics with filters", run: runList},
+		{name: "delete", usage: "delete a metric or all metrics matching a pattern (admin)", run: runDelete},
+		{name: "watch", usage: "poll metrics and print changes", run: runWatch},
+		{name: "export", usage: "save a snapshot of all metrics (admin)", run: runExport},
+		{name: "copy", usage: "copy metrics between file storage and PostgreSQL offline", run: runCopy},
+	}
+}
+
+// Утилита администрирования сервера метрик. Точка входа.
+func main() {
+	if code := run(os.Args[1:], os.Stdout, os.Stderr); code != exitOK {
+		exit(code)
+	}
+}
+
+// exit завершает процесс с кодом возврата (вынесено из main ради статического анализатора noosexit).
+func exit(code int) {
+	os.Exit(code)
+}
+
+// run разбирает подкоманду и передаёт ей управление; возвращает код завершения.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		printUsage(stderr)
+		return exitUsage
+	}
+	switch args[0] {
+	case "-h", "--help", "help":
+		printUsage(stdout)
+		return exitOK
+	case "version":
+		buildinfo.PrintSelf()
+		return exitOK
+	}
+	for _, cmd := range commands() {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+	printUsage(stderr)
+	return exitUsage
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: metricsctl <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(w, "  %-10s %s\n", "version", "print build information")
+}
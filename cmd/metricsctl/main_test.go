@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
+
+func writeSnapshotFile(t *testing.T, path string, data models.MetricsData) {
+	t.Helper()
+	b, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func readSnapshotFile(t *testing.T, path string) models.MetricsData {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var data models.MetricsData
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	return data
+}
+
+func TestRun_Usage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run(nil, &stdout, &stderr); code != exitUsage {
+		t.Fatalf("expected usage exit code, got %d", code)
+	}
+	if code := run([]string{"nope"}, &stdout, &stderr); code != exitUsage {
+		t.Fatalf("expected usage exit code for unknown command, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "copy") {
+		t.Fatalf("usage must list commands: %q", stderr.String())
+	}
+}
+
+func TestCopy_FileToFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.json")
+	dst := filepath.Join(dir, "dst.json")
+
+	writeSnapshotFile(t, src, models.MetricsData{
+		Gauges:   map[string]string{"Alloc": "1.5"},
+		Counters: map[string]int64{"PollCount": 5},
+	})
+	writeSnapshotFile(t, dst, models.MetricsData{
+		Gauges:   map[string]string{"Keep": "2"},
+		Counters: map[string]int64{"PollCount": 100},
+	})
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"copy", "-from", src, "-to", dst}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("copy failed: code=%d stderr=%s", code, stderr.String())
+	}
+	got := readSnapshotFile(t, dst)
+	if got.Gauges["Alloc"] != "1.5" || got.Gauges["Keep"] != "2" {
+		t.Fatalf("merge must keep existing gauges: %+v", got.Gauges)
+	}
+	if got.Counters["PollCount"] != 5 {
+		t.Fatalf("counter must be copied as is, got %d", got.Counters["PollCount"])
+	}
+
+	if code := run([]string{"copy", "-from", src, "-to", dst, "-replace"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("copy -replace failed: code=%d stderr=%s", code, stderr.String())
+	}
+	got = readSnapshotFile(t, dst)
+	if _, ok := got.Gauges["Keep"]; ok {
+		t.Fatalf("replace must drop metrics missing in source")
+	}
+}
+
+func TestCopy_MissingSource(t *testing.T) {
+	dir := t.TempDir()
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"copy", "-from", filepath.Join(dir, "none.json"), "-to", filepath.Join(dir, "dst.json")}, &stdout, &stderr)
+	if code != exitError {
+		t.Fatalf("expected error exit code, got %d", code)
+	}
+}
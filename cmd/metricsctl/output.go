@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Hobrus/hobrusmetrics.git/pkg/client"
+)
+
+// Форматы вывода.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+func addOutputFlag(fs *flag.FlagSet) *string {
+	return fs.String("o", formatTable, "output format: table, json or csv")
+}
+
+func parseFormat(s string) (string, error) {
+	switch s {
+	case formatTable, formatJSON, formatCSV:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unsupported output format %q: use table, json or csv", s)
+	}
+}
+
+// metricValue форматирует значение метрики; у составных метрик значения нет.
+func metricValue(m client.Metric) string {
+	switch {
+	case m.Delta != nil:
+		return strconv.FormatInt(*m.Delta, 10)
+	case m.Value != nil:
+		return strconv.FormatFloat(*m.Value, 'f', -1, 64)
+	default:
+		return "-"
+	}
+}
+
+func numericValue(m client.Metric) (float64, bool) {
+	switch {
+	case m.Delta != nil:
+		return float64(*m.Delta), true
+	case m.Value != nil:
+		return *m.Value, true
+	default:
+		return 0, false
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// writeEntries выводит метрики таблицей, JSON-массивом или CSV с заголовком.
+func writeEntries(w io.Writer, format string, entries []client.Entry) error {
+	switch format {
+	case formatJSON:
+		if entries == nil {
+			entries = []client.Entry{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"type", "name", "value", "updated_at"})
+		for _, e := range entries {
+			_ = cw.Write([]string{e.MType, e.ID, metricValue(e.Metric), formatTime(e.UpdatedAt)})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TYPE\tNAME\tVALUE\tUPDATED")
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.MType, e.ID, metricValue(e.Metric), formatTime(e.UpdatedAt))
+		}
+		return tw.Flush()
+	}
+}
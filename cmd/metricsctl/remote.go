@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hobrus/hobrusmetrics.git/pkg/client"
+)
+
+// remoteOptions — общие флаги подкоманд, работающих с запущенным сервером.
+type remoteOptions struct {
+	address string
+	key     string
+	token   string
+	gzip    bool
+	timeout time.Duration
+}
+
+// addRemoteFlags регистрирует общие флаги; значения по умолчанию берутся
+// из тех же переменных окружения, что у сервера и агента.
+func addRemoteFlags(fs *flag.FlagSet) *remoteOptions {
+	o := &remoteOptions{}
+	fs.StringVar(&o.address, "a", envOr("ADDRESS", "localhost:8080"), "server address (env ADDRESS)")
+	fs.StringVar(&o.key, "k", os.Getenv("KEY"), "signing key (env KEY)")
+	fs.StringVar(&o.token, "token", os.Getenv("ADMIN_KEY"), "admin key for delete and export (env ADMIN_KEY)")
+	fs.BoolVar(&o.gzip, "gzip", false, "compress request bodies")
+	fs.DurationVar(&o.timeout, "timeout", 10*time.Second, "request timeout")
+	return o
+}
+
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// client создаёт клиент сервера. Повторы отключены: скрипт сам решает, повторять ли вызов.
+func (o *remoteOptions) client() (*client.Client, error) {
+	return client.New(o.address, client.Options{
+		Key:            o.key,
+		Token:          o.token,
+		Gzip:           o.gzip,
+		RetryIntervals: []time.Duration{},
+	})
+}
+
+func (o *remoteOptions) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), o.timeout)
+}
+
+// failure печатает ошибку и возвращает соответствующий ей код завершения.
+func failure(stderr io.Writer, err error) int {
+	fmt.Fprintf(stderr, "error: %v\n", err)
+	var apiErr *client.APIError
+	switch {
+	case errors.Is(err, client.ErrNotFound):
+		return exitNotFound
+	case errors.As(err, &apiErr):
+		if apiErr.Status >= http.StatusInternalServerError {
+			return exitUnavailable
+		}
+		return exitError
+	case errors.Is(err, client.ErrInvalidSignature):
+		return exitError
+	default:
+		// Сетевые ошибки и истёкший таймаут.
+		return exitUnavailable
+	}
+}
+
+// runPush записывает метрики: тройками "тип имя значение" в аргументах или пакетом из JSON-файла.
+func runPush(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("push", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: metricsctl push [flags] <type> <name> <value> [<type> <name> <value>...]")
+		fmt.Fprintln(stderr, "       metricsctl push [flags] -f <file|->")
+		fs.PrintDefaults()
+	}
+	remote := addRemoteFlags(fs)
+	file := fs.String("f", "", "JSON array of metrics to push ('-' for stdin)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	var batch []client.Metric
+	if *file != "" {
+		if fs.NArg() > 0 {
+			fmt.Fprintln(stderr, "-f cannot be combined with positional metrics")
+			return exitUsage
+		}
+		var err error
+		if batch, err = readBatch(*file); err != nil {
+			fmt.Fprintf(stderr, "read %s: %v\n", *file, err)
+			return exitUsage
+		}
+	} else {
+		if fs.NArg() == 0 || fs.NArg()%3 != 0 {
+			fs.Usage()
+			return exitUsage
+		}
+		for i := 0; i < fs.NArg(); i += 3 {
+			m, err := parseMetric(fs.Arg(i), fs.Arg(i+1), fs.Arg(i+2))
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return exitUsage
+			}
+			batch = append(batch, m)
+		}
+	}
+
+	c, err := remote.client()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	ctx, cancel := remote.context()
+	defer cancel()
+	if len(batch) == 1 {
+		m := batch[0]
+		if m.MType == client.GaugeType {
+			err = c.Gauge(ctx, m.ID, *m.Value)
+		} else {
+			err = c.Counter(ctx, m.ID, *m.Delta)
+		}
+	} else {
+		_, err = c.Batch(ctx, batch)
+	}
+	if err != nil {
+		return failure(stderr, err)
+	}
+	return exitOK
+}
+
+// parseMetric разбирает тройку "тип имя значение".
+func parseMetric(metricType, name, value string) (client.Metric, error) {
+	switch strings.ToLower(metricType) {
+	case client.GaugeType:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return client.Metric{}, fmt.Errorf("invalid gauge value %q", value)
+		}
+		return client.Gauge(name, v), nil
+	case client.CounterType:
+		d, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return client.Metric{}, fmt.Errorf("invalid counter value %q", value)
+		}
+		return client.Counter(name, d), nil
+	default:
+		return client.Metric{}, fmt.Errorf("unsupported metric type %q: use gauge or counter", metricType)
+	}
+}
+
+// readBatch читает JSON-массив метрик из файла или stdin. Каждая метрика должна быть
+// gauge со значением value или counter с приращением delta.
+func readBatch(path string) ([]client.Metric, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var batch []client.Metric
+	if err := json.NewDecoder(r).Decode(&batch); err != nil {
+		return nil, err
+	}
+	if len(batch) == 0 {
+		return nil, errors.New("no metrics")
+	}
+	for i, m := range batch {
+		switch {
+		case m.ID == "":
+			return nil, fmt.Errorf("metric %d: id is required", i+1)
+		case m.MType == client.GaugeType && m.Value == nil:
+			return nil, fmt.Errorf("metric %d (%s): gauge requires value", i+1, m.ID)
+		case m.MType == client.CounterType && m.Delta == nil:
+			return nil, fmt.Errorf("metric %d (%s): counter requires delta", i+1, m.ID)
+		case m.MType != client.GaugeType && m.MType != client.CounterType:
+			return nil, fmt.Errorf("metric %d (%s): unsupported metric type %q: use gauge or counter", i+1, m.ID, m.MType)
+		}
+	}
+	return batch, nil
+}
+
+// runGet печатает значение метрики. С -min и -max работает как проверка:
+// значение вне диапазона даёт код exitCheckFailed.
+func runGet(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: metricsctl get [flags] <type> <name>")
+		fs.PrintDefaults()
+	}
+	remote := addRemoteFlags(fs)
+	output := addOutputFlag(fs)
+	minValue := fs.Float64("min", 0, "fail with exit code 5 if the value is below")
+	maxValue := fs.Float64("max", 0, "fail with exit code 5 if the value is above")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return exitUsage
+	}
+	format, err := parseFormat(*output)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	c, err := remote.client()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	ctx, cancel := remote.context()
+	defer cancel()
+
+	m, err := c.Get(ctx, strings.ToLower(fs.Arg(0)), fs.Arg(1))
+	if err != nil {
+		return failure(stderr, err)
+	}
+	if format == formatTable {
+		fmt.Fprintln(stdout, metricValue(m))
+	} else if err := writeEntries(stdout, format, []client.Entry{{Metric: m}}); err != nil {
+		return failure(stderr, err)
+	}
+
+	value, ok := numericValue(m)
+	set := setFlags(fs)
+	if (set["min"] || set["max"]) && !ok {
+		fmt.Fprintf(stderr, "check failed: %s %s has no numeric value\n", m.MType, m.ID)
+		return exitCheckFailed
+	}
+	if set["min"] && value < *minValue {
+		fmt.Fprintf(stderr, "check failed: %s = %v is below %v\n", m.ID, value, *minValue)
+		return exitCheckFailed
+	}
+	if set["max"] && value > *maxValue {
+		fmt.Fprintf(stderr, "check failed: %s = %v is above %v\n", m.ID, value, *maxValue)
+		return exitCheckFailed
+	}
+	return exitOK
+}
+
+// setFlags возвращает имена флагов, заданных в командной строке.
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// listFilter — флаги фильтрации списка метрик (list и watch).
+type listFilter struct {
+	types string
+	name  string
+	regex string
+	sort  string
+}
+
+func addListFlags(fs *flag.FlagSet) *listFilter {
+	f := &listFilter{}
+	fs.StringVar(&f.types, "type", "", "comma-separated metric types")
+	fs.StringVar(&f.name, "name", "", "name glob pattern")
+	fs.StringVar(&f.regex, "regex", "", "name regular expression")
+	fs.StringVar(&f.sort, "sort", "", "sort field: type, name, updated; prefix '-' for descending")
+	return f
+}
+
+// listPageSize — размер страницы при постраничном чтении списка.
+const listPageSize = 500
+
+// listAll читает список метрик постранично; limit > 0 ограничивает число элементов.
+func listAll(ctx context.Context, c *client.Client, f *listFilter, limit int) ([]client.Entry, error) {
+	opts := client.ListOptions{Name: f.name, Regex: f.regex, Sort: f.sort, Limit: listPageSize}
+	if f.types != "" {
+		opts.Types = strings.Split(f.types, ",")
+	}
+	var entries []client.Entry
+	for {
+		if limit > 0 {
+			opts.Limit = min(listPageSize, limit-len(entries))
+		}
+		page, err := c.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page.Items...)
+		if page.NextCursor == "" || (limit > 0 && len(entries) >= limit) {
+			return entries, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// runList печатает список метрик.
+func runList(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	remote := addRemoteFlags(fs)
+	output := addOutputFlag(fs)
+	filter := addListFlags(fs)
+	limit := fs.Int("limit", 0, "maximum number of metrics (0 — all)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	format, err := parseFormat(*output)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	c, err := remote.client()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	ctx, cancel := remote.context()
+	defer cancel()
+
+	entries, err := listAll(ctx, c, filter, *limit)
+	if err != nil {
+		return failure(stderr, err)
+	}
+	if err := writeEntries(stdout, format, entries); err != nil {
+		return failure(stderr, err)
+	}
+	return exitOK
+}
+
+// runDelete удаляет одну метрику или все метрики по шаблону имени.
+func runDelete(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: metricsctl delete [flags] <type> <name>")
+		fmt.Fprintln(stderr, "       metricsctl delete [flags] -pattern <glob> [-type <type>]")
+		fs.PrintDefaults()
+	}
+	remote := addRemoteFlags(fs)
+	pattern := fs.String("pattern", "", "delete all metrics whose names match the glob")
+	metricType := fs.String("type", "", "metric type for -pattern (empty — any)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if (*pattern == "") == (fs.NArg() == 0) || (*pattern == "" && fs.NArg() != 2) {
+		fs.Usage()
+		return exitUsage
+	}
+	c, err := remote.client()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	ctx, cancel := remote.context()
+	defer cancel()
+
+	if *pattern == "" {
+		if err := c.Delete(ctx, strings.ToLower(fs.Arg(0)), fs.Arg(1)); err != nil {
+			return failure(stderr, err)
+		}
+		fmt.Fprintf(stdout, "deleted %s %s\n", strings.ToLower(fs.Arg(0)), fs.Arg(1))
+		return exitOK
+	}
+	deleted, err := c.DeleteMatching(ctx, *metricType, *pattern)
+	if err != nil {
+		return failure(stderr, err)
+	}
+	for _, ref := range deleted {
+		fmt.Fprintf(stdout, "deleted %s %s\n", ref.MType, ref.ID)
+	}
+	return exitOK
+}
+
+// runExport сохраняет снимок всех метрик в файл или выводит его в stdout.
+func runExport(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	remote := addRemoteFlags(fs)
+	format := fs.String("format", client.SnapshotJSON, "snapshot format: json or ndjson")
+	out := fs.String("out", "", "output file (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *format != client.SnapshotJSON && *format != client.SnapshotNDJSON {
+		fmt.Fprintf(stderr, "unsupported snapshot format %q\n", *format)
+		return exitUsage
+	}
+	c, err := remote.client()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	ctx, cancel := remote.context()
+	defer cancel()
+
+	w := stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(stderr, "create %s: %v\n", *out, err)
+			return exitError
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := c.Export(ctx, *format, w); err != nil {
+		return failure(stderr, err)
+	}
+	return exitOK
+}
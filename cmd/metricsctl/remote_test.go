@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/handlers"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+const (
+	testKey      = "secret"
+	testAdminKey = "admin"
+)
+
+// startServer запускает сервер с подписью и сжатием, как cmd/server, и возвращает
+// общие флаги подключения к нему.
+func startServer(t *testing.T) (*service.MetricsService, []string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ms := &service.MetricsService{Storage: repository.NewMemStorage()}
+	router := gin.New()
+	router.Use(middleware.HashRequestMiddleware(testKey))
+	router.Use(middleware.HashResponseMiddleware(testKey))
+	router.Use(middleware.GzipMiddleware())
+	h := handlers.NewHandler(ms)
+	h.SetupRoutes(router)
+	h.SetupAdminRoutes(router, testAdminKey, logrus.New())
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return ms, []string{"-a", srv.URL, "-k", testKey, "-token", testAdminKey, "-gzip"}
+}
+
+func runCmd(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func cmdArgs(name string, common []string, rest ...string) []string {
+	args := append([]string{name}, common...)
+	return append(args, rest...)
+}
+
+func TestPushAndGet(t *testing.T) {
+	ms, common := startServer(t)
+
+	if code, _, stderr := runCmd(t, cmdArgs("push", common, "gauge", "Alloc", "1.5", "counter", "PollCount", "3")...); code != exitOK {
+		t.Fatalf("push failed: code=%d stderr=%s", code, stderr)
+	}
+	if code, _, stderr := runCmd(t, cmdArgs("push", common, "counter", "PollCount", "2")...); code != exitOK {
+		t.Fatalf("push failed: code=%d stderr=%s", code, stderr)
+	}
+	if v, _ := ms.GetMetricValue("counter", "PollCount"); v != "5" {
+		t.Fatalf("expected counter 5, got %s", v)
+	}
+
+	code, stdout, _ := runCmd(t, cmdArgs("get", common, "gauge", "Alloc")...)
+	if code != exitOK || strings.TrimSpace(stdout) != "1.5" {
+		t.Fatalf("get: code=%d stdout=%q", code, stdout)
+	}
+	code, stdout, _ = runCmd(t, cmdArgs("get", common, "-o", "json", "counter", "PollCount")...)
+	if code != exitOK || !strings.Contains(stdout, `"delta": 5`) {
+		t.Fatalf("get -o json: code=%d stdout=%q", code, stdout)
+	}
+}
+
+func TestPushFileValidation(t *testing.T) {
+	_, common := startServer(t)
+	cases := map[string]string{
+		"missing value": `[{"id":"x","type":"gauge"}]`,
+		"missing delta": `[{"id":"x","type":"counter","value":1}]`,
+		"unknown type":  `[{"id":"x","type":"histogram","value":1}]`,
+		"missing id":    `[{"type":"gauge","value":1}]`,
+	}
+	for name, body := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "batch.json")
+			if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if code, _, stderr := runCmd(t, cmdArgs("push", common, "-f", path)...); code != exitUsage || !strings.Contains(stderr, "metric 1") {
+				t.Fatalf("expected exit code %d with an error about metric 1, got %d (stderr=%s)", exitUsage, code, stderr)
+			}
+		})
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	ms, common := startServer(t)
+	if err := ms.UpdateMetric("gauge", "Load", "0.9"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"not found", cmdArgs("get", common, "gauge", "Missing"), exitNotFound},
+		{"within range", cmdArgs("get", common, "-min", "0", "-max", "1", "gauge", "Load"), exitOK},
+		{"above max", cmdArgs("get", common, "-max", "0.5", "gauge", "Load"), exitCheckFailed},
+		{"bad value", cmdArgs("push", common, "gauge", "Load", "x"), exitUsage},
+		{"bad format", cmdArgs("list", common, "-o", "xml"), exitUsage},
+		{"wrong key", cmdArgs("push", common, "-k", "other", "gauge", "Load", "1"), exitError},
+		{"no admin key", cmdArgs("delete", common, "-token", "", "gauge", "Load"), exitError},
+		{"unavailable", []string{"get", "-a", "127.0.0.1:1", "gauge", "Load"}, exitUnavailable},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if code, _, stderr := runCmd(t, tc.args...); code != tc.want {
+				t.Fatalf("expected exit code %d, got %d (stderr=%s)", tc.want, code, stderr)
+			}
+		})
+	}
+}
+
+func TestListFormats(t *testing.T) {
+	ms, common := startServer(t)
+	for _, name := range []string{"b", "a", "c"} {
+		if err := ms.UpdateMetric("gauge", name, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ms.UpdateMetric("counter", "n", "4"); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, _ := runCmd(t, cmdArgs("list", common, "-o", "csv", "-type", "gauge", "-sort", "name")...)
+	if code != exitOK {
+		t.Fatalf("list failed: %d", code)
+	}
+	records, err := csv.NewReader(strings.NewReader(stdout)).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(records) != 4 || records[0][0] != "type" || records[1][1] != "a" || records[3][1] != "c" {
+		t.Fatalf("unexpected csv: %v", records)
+	}
+
+	code, stdout, _ = runCmd(t, cmdArgs("list", common, "-o", "json", "-limit", "2")...)
+	if code != exitOK {
+		t.Fatalf("list failed: %d", code)
+	}
+	var entries []map[string]any
+	if err := json.Unmarshal([]byte(stdout), &entries); err != nil || len(entries) != 2 {
+		t.Fatalf("expected 2 JSON entries, got %q (%v)", stdout, err)
+	}
+
+	code, stdout, _ = runCmd(t, cmdArgs("list", common, "-name", "n")...)
+	if code != exitOK || !strings.HasPrefix(stdout, "TYPE") || !strings.Contains(stdout, "counter  n") {
+		t.Fatalf("unexpected table: %q", stdout)
+	}
+}
+
+func TestDeleteAndExport(t *testing.T) {
+	ms, common := startServer(t)
+	for _, name := range []string{"tmp.a", "tmp.b", "keep"} {
+		if err := ms.UpdateMetric("gauge", name, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	code, stdout, stderr := runCmd(t, cmdArgs("delete", common, "-pattern", "tmp.*")...)
+	if code != exitOK || strings.Count(stdout, "deleted") != 2 {
+		t.Fatalf("delete -pattern: code=%d stdout=%q stderr=%s", code, stdout, stderr)
+	}
+	if code, _, _ := runCmd(t, cmdArgs("delete", common, "gauge", "tmp.a")...); code != exitNotFound {
+		t.Fatalf("expected not found for deleted metric, got %d", code)
+	}
+
+	code, stdout, stderr = runCmd(t, cmdArgs("export", common)...)
+	if code != exitOK {
+		t.Fatalf("export: code=%d stderr=%s", code, stderr)
+	}
+	var data models.MetricsData
+	if err := json.Unmarshal([]byte(stdout), &data); err != nil {
+		t.Fatalf("export must print a JSON snapshot: %v", err)
+	}
+	if len(data.Gauges) != 1 || data.Gauges["keep"] != "1" {
+		t.Fatalf("unexpected snapshot: %+v", data.Gauges)
+	}
+}
+
+func TestWatchPrintsChanges(t *testing.T) {
+	ms, common := startServer(t)
+	if err := ms.UpdateMetric("gauge", "Alloc", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	prev := map[metricKey]observed{{"gauge", "Alloc"}: {value: "1"}, {"gauge", "Gone"}: {value: "2"}}
+	cur := map[metricKey]observed{{"gauge", "Alloc"}: {value: "3"}, {"counter", "New"}: {value: "1"}}
+	changes := diffEntries(prev, cur)
+	want := []change{
+		{Op: opAdded, MType: "counter", ID: "New", Value: "1"},
+		{Op: opChanged, MType: "gauge", ID: "Alloc", Value: "3", Previous: "1"},
+		{Op: opRemoved, MType: "gauge", ID: "Gone", Previous: "2"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("change %d: expected %+v, got %+v", i, want[i], changes[i])
+		}
+	}
+
+	code, stdout, stderr := runCmd(t, cmdArgs("watch", common, "-count", "1", "-interval", "10ms")...)
+	if code != exitOK || strings.TrimSpace(stdout) != "+ gauge Alloc 1" {
+		t.Fatalf("watch: code=%d stdout=%q stderr=%s", code, stdout, stderr)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// Виды изменений в выводе watch.
+const (
+	opAdded   = "added"
+	opChanged = "changed"
+	opRemoved = "removed"
+)
+
+// change — изменение метрики между двумя опросами.
+type change struct {
+	Op       string `json:"op"`
+	MType    string `json:"type"`
+	ID       string `json:"id"`
+	Value    string `json:"value,omitempty"`
+	Previous string `json:"previous,omitempty"`
+}
+
+type metricKey struct{ mtype, id string }
+
+// observed — состояние метрики на момент опроса.
+type observed struct {
+	value     string
+	updatedAt time.Time
+}
+
+// diffEntries сравнивает два опроса. Значение gauge и counter сравнивается как есть,
+// составные метрики без скалярного значения считаются изменёнными при смене времени обновления.
+func diffEntries(prev, cur map[metricKey]observed) []change {
+	var changes []change
+	for k, c := range cur {
+		p, ok := prev[k]
+		switch {
+		case !ok:
+			changes = append(changes, change{Op: opAdded, MType: k.mtype, ID: k.id, Value: c.value})
+		case p.value != c.value || (c.value == "-" && !p.updatedAt.Equal(c.updatedAt)):
+			changes = append(changes, change{Op: opChanged, MType: k.mtype, ID: k.id, Value: c.value, Previous: p.value})
+		}
+	}
+	for k, p := range prev {
+		if _, ok := cur[k]; !ok {
+			changes = append(changes, change{Op: opRemoved, MType: k.mtype, ID: k.id, Previous: p.value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].MType != changes[j].MType {
+			return changes[i].MType < changes[j].MType
+		}
+		return changes[i].ID < changes[j].ID
+	})
+	return changes
+}
+
+// changeWriter выводит изменения в выбранном формате по мере появления.
+type changeWriter struct {
+	format string
+	w      io.Writer
+	csv    *csv.Writer
+}
+
+func newChangeWriter(w io.Writer, format string) *changeWriter {
+	cw := &changeWriter{format: format, w: w}
+	if format == formatCSV {
+		cw.csv = csv.NewWriter(w)
+		_ = cw.csv.Write([]string{"op", "type", "name", "value", "previous"})
+		cw.csv.Flush()
+	}
+	return cw
+}
+
+func (cw *changeWriter) write(changes []change) error {
+	switch cw.format {
+	case formatJSON:
+		enc := json.NewEncoder(cw.w)
+		for _, c := range changes {
+			if err := enc.Encode(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	case formatCSV:
+		for _, c := range changes {
+			_ = cw.csv.Write([]string{c.Op, c.MType, c.ID, c.Value, c.Previous})
+		}
+		cw.csv.Flush()
+		return cw.csv.Error()
+	default:
+		for _, c := range changes {
+			switch c.Op {
+			case opAdded:
+				fmt.Fprintf(cw.w, "+ %s %s %s\n", c.MType, c.ID, c.Value)
+			case opChanged:
+				fmt.Fprintf(cw.w, "~ %s %s %s -> %s\n", c.MType, c.ID, c.Previous, c.Value)
+			case opRemoved:
+				fmt.Fprintf(cw.w, "- %s %s\n", c.MType, c.ID)
+			}
+		}
+		return nil
+	}
+}
+
+// runWatch периодически опрашивает список метрик и печатает изменения.
+// Первый опрос выводит все метрики как добавленные.
+func runWatch(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	remote := addRemoteFlags(fs)
+	output := addOutputFlag(fs)
+	filter := addListFlags(fs)
+	interval := fs.Duration("interval", 5*time.Second, "poll interval")
+	count := fs.Int("count", 0, "number of polls (0 — until interrupted)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	format, err := parseFormat(*output)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	if *interval <= 0 {
+		fmt.Fprintln(stderr, "-interval must be positive")
+		return exitUsage
+	}
+	c, err := remote.client()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	out := newChangeWriter(stdout, format)
+	var (
+		prev    map[metricKey]observed
+		lastErr error
+	)
+	for poll := 1; ; poll++ {
+		pollCtx, cancel := context.WithTimeout(ctx, remote.timeout)
+		entries, err := listAll(pollCtx, c, filter, 0)
+		cancel()
+		switch {
+		case ctx.Err() != nil:
+			return exitOK
+		case err != nil:
+			// Ошибка опроса не прерывает наблюдение; код завершения отражает последний опрос.
+			fmt.Fprintf(stderr, "error: %v\n", err)
+			lastErr = err
+		default:
+			lastErr = nil
+			cur := make(map[metricKey]observed, len(entries))
+			for _, e := range entries {
+				cur[metricKey{e.MType, e.ID}] = observed{value: metricValue(e.Metric), updatedAt: e.UpdatedAt}
+			}
+			if err := out.write(diffEntries(prev, cur)); err != nil {
+				return failure(stderr, err)
+			}
+			prev = cur
+		}
+
+		if *count > 0 && poll >= *count {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return exitOK
+		case <-time.After(*interval):
+		}
+	}
+	if lastErr != nil {
+		return failure(io.Discard, lastErr)
+	}
+	return exitOK
+}
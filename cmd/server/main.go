@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
+	"io/fs"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -14,9 +17,11 @@ import (
 	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/config"
 	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/handlers"
 	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
 	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
 	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
 	"github.com/Hobrus/hobrusmetrics.git/internal/pkg/buildinfo"
+	"github.com/Hobrus/hobrusmetrics.git/pkg/hll"
 
 	_ "net/http/pprof"
 )
@@ -74,8 +79,177 @@ func main() {
 		}
 	}
 
-	metricsService := &service.MetricsService{Storage: storage}
+	conflictPolicy, err := repository.ParseConflictPolicy(cfg.TypeConflictPolicy)
+	if err != nil {
+		logger.Fatalf("Invalid type conflict policy: %v", err)
+	}
+	storage.SetConflictPolicy(conflictPolicy)
+
+	histogramBuckets, err := models.ParseBuckets(cfg.HistogramBuckets)
+	if err != nil {
+		logger.Fatalf("Invalid histogram buckets: %v", err)
+	}
+
+	if _, err := models.NewSketch(cfg.SketchAccuracy, cfg.SketchMaxBins); err != nil {
+		logger.Fatalf("Invalid sketch settings: %v", err)
+	}
+
+	if cfg.SetPrecision < hll.MinPrecision || cfg.SetPrecision > hll.MaxPrecision {
+		logger.Fatalf("Invalid set precision: must be in [%d, %d], got %d", hll.MinPrecision, hll.MaxPrecision, cfg.SetPrecision)
+	}
+
+	metricsService := &service.MetricsService{
+		Storage:          storage,
+		HistogramBuckets: histogramBuckets,
+		SketchAccuracy:   cfg.SketchAccuracy,
+		SketchMaxBins:    cfg.SketchMaxBins,
+		SetPrecision:     uint8(cfg.SetPrecision),
+		Events:           service.NewBroker(cfg.StreamHistory),
+		MaxBatchSize:     cfg.MaxBatchSize,
+	}
+	if cfg.HistorySize > 0 {
+		metricsService.History = service.NewHistory(cfg.HistorySize, cfg.HistoryResolution)
+	}
+	if cfg.CounterRateWindow > 0 {
+		rates := service.NewCounterRates(cfg.CounterRateWindow)
+		if cfg.CounterRatesFile != "" {
+			if err := rates.Load(cfg.CounterRatesFile, time.Now()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				logger.Warnf("Failed to load counter observations, rates start from scratch: %v", err)
+			}
+		}
+		// Восстановленные хранилищем значения — точка отсчёта, а не прирост.
+		rates.Seed(storage.GetAllCounters(), time.Now())
+		metricsService.Rates = rates
+	}
+	if cfg.RelabelConfig != "" {
+		rules, err := service.LoadRelabelRules(cfg.RelabelConfig)
+		if err != nil {
+			logger.Fatalf("Failed to load relabel rules: %v", err)
+		}
+		if metricsService.Relabel, err = service.NewRelabelPipeline(rules); err != nil {
+			logger.Fatalf("Invalid relabel rules in %s: %v", cfg.RelabelConfig, err)
+		}
+		logger.Infof("Relabeling metrics on ingest with %d rules from %s", len(rules), cfg.RelabelConfig)
+	}
+	seriesLimits, err := service.ParseSeriesLimits(cfg.SeriesLimits)
+	if err != nil {
+		logger.Fatalf("Invalid series limits: %v", err)
+	}
+	cardinality := service.CardinalityLimits{
+		MaxSeries:          cfg.MaxSeries,
+		MaxSeriesPerClient: cfg.MaxSeriesPerClient,
+		Patterns:           seriesLimits,
+		Action:             cfg.SeriesLimitAction,
+		SampleRate:         cfg.SeriesSampleRate,
+	}
+	if cardinality.Enabled() {
+		if metricsService.Cardinality, err = service.NewCardinalityGuard(cardinality); err != nil {
+			logger.Fatalf("Invalid series limits: %v", err)
+		}
+		logger.Infof("Limiting series (%s over the limit)", cfg.SeriesLimitAction)
+	}
 	handler := handlers.NewHandler(metricsService)
+	handler.StreamHeartbeat = cfg.StreamHeartbeat
+	var authenticator middleware.Authenticator
+	if cfg.TokenAuth {
+		var tokenStore repository.TokenStore
+		if dbConn != nil {
+			logger.Info("Using PostgreSQL token store")
+			tokenStore, err = repository.NewPostgresTokenStore(dbConn)
+		} else {
+			logger.Infof("Using token store at file=%s", cfg.TokensFile)
+			tokenStore, err = repository.NewFileTokenStore(cfg.TokensFile)
+		}
+		if err != nil {
+			logger.Fatalf("Failed to initialize token store: %v", err)
+		}
+		if cfg.AdminKey == "" {
+			logger.Warn("Token authentication is enabled without an admin key: only existing admin tokens can manage tokens")
+		}
+		tokens := service.NewTokenService(tokenStore)
+		handler.EnableTokenAuth(tokens, cfg.AdminKey)
+		authenticator = tokens
+	}
+	var limiter *middleware.RateLimiter
+	if cfg.RateLimit > 0 {
+		limiter = middleware.NewRateLimiter(cfg.RateLimit, cfg.RateBurst)
+	}
+	identify, err := middleware.ClientIdentity(cfg.RateLimitBy, authenticator, cfg.AdminKey, limiter)
+	if err != nil {
+		logger.Fatalf("Invalid rate limit settings: %v", err)
+	}
+	// Лимит рядов на клиента считается по токену целиком: иначе новый X-Agent-ID
+	// в каждом запросе давал бы новый лимит.
+	seriesBy := cfg.RateLimitBy
+	if strings.EqualFold(seriesBy, middleware.ClientByAgent) {
+		seriesBy = middleware.ClientByToken
+	}
+	if handler.ClientID, err = middleware.ClientIdentity(seriesBy, authenticator, cfg.AdminKey, limiter); err != nil {
+		logger.Fatalf("Invalid rate limit settings: %v", err)
+	}
+
+	retentionRules, err := service.ParseRetentionRules(cfg.RetentionRules)
+	if err != nil {
+		logger.Fatalf("Invalid retention rules: %v", err)
+	}
+	retention := service.RetentionPolicy{DefaultTTL: cfg.RetentionTTL, Rules: retentionRules}
+	var janitor *service.Janitor
+	if retention.Enabled() {
+		logger.Infof("Expiring stale gauges every %s", cfg.RetentionInterval)
+		janitor = service.NewJanitor(metricsService, retention, cfg.RetentionInterval, logger)
+		janitor.Start()
+	}
+
+	var evaluator *service.RuleEvaluator
+	if cfg.RecordingRules != "" {
+		specs, err := service.LoadRecordingRules(cfg.RecordingRules)
+		if err != nil {
+			logger.Fatalf("Failed to load recording rules: %v", err)
+		}
+		rules, err := service.NewRecordingRules(specs)
+		if err != nil {
+			logger.Fatalf("Invalid recording rules in %s: %v", cfg.RecordingRules, err)
+		}
+		if cfg.RecordingInterval <= 0 {
+			logger.Fatalf("Invalid recording interval %s", cfg.RecordingInterval)
+		}
+		logger.Infof("Evaluating %d recording rules every %s", rules.Len(), cfg.RecordingInterval)
+		evaluator = service.NewRuleEvaluator(metricsService, rules, cfg.RecordingInterval, logger)
+		evaluator.Start()
+	}
+
+	var alerting *service.Alerting
+	if cfg.AlertRules != "" {
+		alertConfig, err := service.LoadAlertingConfig(cfg.AlertRules)
+		if err != nil {
+			logger.Fatalf("Failed to load alert rules: %v", err)
+		}
+		if cfg.AlertInterval <= 0 {
+			logger.Fatalf("Invalid alert interval %s", cfg.AlertInterval)
+		}
+		var alertStore repository.AlertStore
+		switch {
+		case dbConn != nil:
+			logger.Info("Using PostgreSQL alert store")
+			alertStore, err = repository.NewPostgresAlertStore(dbConn)
+		case cfg.AlertsFile != "":
+			logger.Infof("Using alert store at file=%s", cfg.AlertsFile)
+			alertStore, err = repository.NewFileAlertStore(cfg.AlertsFile)
+		default:
+			logger.Warn("Alert state and silences are kept in memory and will be lost on restart")
+			alertStore = repository.NewMemAlertStore()
+		}
+		if err != nil {
+			logger.Fatalf("Failed to initialize alert store: %v", err)
+		}
+		alerting, err = service.NewAlerting(metricsService, alertConfig, alertStore, cfg.AlertInterval, logger)
+		if err != nil {
+			logger.Fatalf("Invalid alert rules in %s: %v", cfg.AlertRules, err)
+		}
+		logger.Infof("Evaluating %d alert rules every %s", alerting.Len(), cfg.AlertInterval)
+		handler.Alerts = alerting
+		alerting.Start()
+	}
 
 	// Запускаем pprof-сервер на localhost:6060
 	go func() {
@@ -84,11 +258,16 @@ func main() {
 		}
 	}()
 
-	// Изменили порядок middleware: сначала Recovery, Logging и (при наличии ключа) хэширование,
-	// затем GzipMiddleware – чтобы подпись вычислялась от распакованного тела.
+	// Изменили порядок middleware: сначала Recovery, Logging, ограничения частоты и размера запросов,
+	// затем (при наличии ключа) хэширование и GzipMiddleware – чтобы подпись вычислялась от распакованного тела.
 	router := gin.New()
 	router.Use(gin.Recovery())
 	router.Use(middleware.LoggingMiddleware(logger))
+	if limiter != nil {
+		logger.Infof("Limiting clients (by %s) to %g requests/s, burst %d", cfg.RateLimitBy, cfg.RateLimit, cfg.RateBurst)
+		router.Use(middleware.RateLimitMiddleware(limiter, identify))
+	}
+	router.Use(middleware.BodyLimitMiddleware(cfg.MaxBodySize, cfg.MaxDecompressedSize))
 	if cfg.Key != "" {
 		router.Use(middleware.HashRequestMiddleware(cfg.Key))
 		router.Use(middleware.HashResponseMiddleware(cfg.Key))
@@ -96,6 +275,7 @@ func main() {
 	router.Use(middleware.GzipMiddleware())
 
 	handler.SetupRoutes(router)
+	handler.SetupAdminRoutes(router, cfg.AdminKey, logger)
 
 	router.GET("/ping", func(c *gin.Context) {
 		if dbConn == nil {
@@ -117,6 +297,8 @@ func main() {
 		Addr:    cfg.ServerAddress,
 		Handler: router,
 	}
+	// Shutdown ждёт завершения активных запросов: закрываем подписки, чтобы открытые потоки событий завершились.
+	srv.RegisterOnShutdown(metricsService.Events.Close)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -132,6 +314,22 @@ func main() {
 			logger.Errorf("Server shutdown error: %v", err)
 		}
 
+		if janitor != nil {
+			janitor.Stop()
+		}
+		if evaluator != nil {
+			evaluator.Stop()
+		}
+		if alerting != nil {
+			alerting.Stop()
+		}
+
+		if metricsService.Rates != nil && cfg.CounterRatesFile != "" {
+			if err := metricsService.Rates.Save(cfg.CounterRatesFile); err != nil {
+				logger.Errorf("Failed to save counter observations: %v", err)
+			}
+		}
+
 		if err := storage.Shutdown(); err != nil {
 			logger.Errorf("Failed to save metrics during shutdown: %v", err)
 		}
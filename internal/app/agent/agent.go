@@ -23,6 +23,8 @@ func NewAgent() *Agent {
 	metrics := collector.NewMetrics()
 	// Передаём ключ в конструктор Sender
 	localSender := sender.NewSender(cfg.ServerAddress, cfg.Key)
+	localSender.Token = cfg.Token
+	localSender.AgentID = cfg.AgentID
 
 	return &Agent{
 		Config:  cfg,
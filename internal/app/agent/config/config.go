@@ -13,17 +13,23 @@ type Config struct {
 	PollInterval   time.Duration
 	// Ключ для подписи
 	Key string
+	// API-токен агента (роль writer), если на сервере включена аутентификация по токенам
+	Token string
+	// Идентификатор агента (по умолчанию — имя хоста)
+	AgentID string
 	// Максимальное число одновременно выполняемых исходящих запросов
 	RateLimit int
 }
 
 // NewConfig читает флаги и переменные окружения и возвращает конфигурацию агента.
 func NewConfig() *Config {
+	hostname, _ := os.Hostname()
 	cfg := &Config{
 		ServerAddress:  "localhost:8080",
 		ReportInterval: 10 * time.Second,
 		PollInterval:   2 * time.Second,
 		Key:            "",
+		AgentID:        hostname,
 		RateLimit:      5, // значение по умолчанию (можно изменить)
 	}
 
@@ -31,6 +37,8 @@ func NewConfig() *Config {
 	reportInterval := flag.Int("r", int(cfg.ReportInterval.Seconds()), "Report interval in seconds")
 	pollInterval := flag.Int("p", int(cfg.PollInterval.Seconds()), "Poll interval in seconds")
 	flag.StringVar(&cfg.Key, "k", cfg.Key, "Key for HMAC SHA256 signing")
+	flag.StringVar(&cfg.Token, "t", cfg.Token, "API token sent as Authorization: Bearer")
+	flag.StringVar(&cfg.AgentID, "id", cfg.AgentID, "Agent ID sent in the X-Agent-ID header")
 	flag.IntVar(&cfg.RateLimit, "l", cfg.RateLimit, "Maximum number of concurrent outgoing requests (rate limit)")
 	flag.Parse()
 
@@ -54,6 +62,12 @@ func NewConfig() *Config {
 	if envKey := os.Getenv("KEY"); envKey != "" {
 		cfg.Key = envKey
 	}
+	if envToken := os.Getenv("TOKEN"); envToken != "" {
+		cfg.Token = envToken
+	}
+	if envAgentID := os.Getenv("AGENT_ID"); envAgentID != "" {
+		cfg.AgentID = envAgentID
+	}
 	if envRateLimit := os.Getenv("RATE_LIMIT"); envRateLimit != "" {
 		if rl, err := strconv.Atoi(envRateLimit); err == nil {
 			cfg.RateLimit = rl
@@ -29,6 +29,11 @@ type Sender struct {
 	Client        *http.Client
 	// Поле ключа для подписи.
 	Key string
+	// Token — API-токен агента, передаётся в заголовке Authorization: Bearer.
+	Token string
+	// AgentID — идентификатор агента в заголовке X-Agent-ID (сервер может ограничивать
+	// частоту запросов по нему).
+	AgentID string
 }
 
 // NewSender создаёт новый экземпляр отправителя.
@@ -40,6 +45,16 @@ func NewSender(serverAddress, key string) *Sender {
 	}
 }
 
+// setIdentity добавляет к запросу API-токен и идентификатор агента, если они заданы.
+func (s *Sender) setIdentity(req *http.Request) {
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	if s.AgentID != "" {
+		req.Header.Set("X-Agent-ID", s.AgentID)
+	}
+}
+
 // computeHMAC вычисляет HMAC‑SHA256 от data с использованием key и возвращает base64 строку.
 func computeHMAC(data []byte, key string) string {
 	h := hmac.New(sha256.New, []byte(key))
@@ -132,6 +147,7 @@ func (s *Sender) Send(metrics map[string]interface{}) {
 		if hashHeader != "" {
 			req.Header.Set("HashSHA256", hashHeader)
 		}
+		s.setIdentity(req)
 
 		resp, err := s.sendRequestWithRetry(req)
 		if err != nil {
@@ -193,6 +209,7 @@ func (s *Sender) SendBatch(metrics map[string]interface{}) {
 	if hashHeader != "" {
 		req.Header.Set("HashSHA256", hashHeader)
 	}
+	s.setIdentity(req)
 
 	resp, err := s.sendRequestWithRetry(req)
 	if err != nil {
@@ -52,3 +52,23 @@ func TestCompressData(t *testing.T) {
 }
 
 
+
+func TestSenderSendsIdentity(t *testing.T) {
+    var auth []string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        _, _ = io.Copy(io.Discard, r.Body)
+        auth = append(auth, r.Header.Get("Authorization")+" "+r.Header.Get("X-Agent-ID"))
+        w.WriteHeader(http.StatusOK)
+    }))
+    defer srv.Close()
+
+    s := NewSender(srv.Listener.Addr().String(), "")
+    s.Token = "hm_agent"
+    s.AgentID = "host-1"
+    s.Send(map[string]interface{}{"g": float64(1)})
+    s.SendBatch(map[string]interface{}{"g": float64(1)})
+
+    if len(auth) != 2 || auth[0] != "Bearer hm_agent host-1" || auth[1] != "Bearer hm_agent host-1" {
+        t.Fatalf("expected the token and agent ID on every request, got %q", auth)
+    }
+}
@@ -16,6 +16,77 @@ type Config struct {
 	DatabaseDSN string
 	// Новый параметр ключа для подписи:
 	Key string
+	// Ключ администратора для маршрутов /admin (пустой — административный API отключён)
+	AdminKey string
+	// Аутентификация по API-токенам на всех маршрутах. Токены хранятся в PostgreSQL,
+	// а без базы данных — в файле TokensFile
+	TokenAuth  bool
+	TokensFile string
+
+	// Срок жизни gauge без обновлений (0 — без ограничения)
+	RetentionTTL time.Duration
+	// Правила срока жизни по шаблонам имён: "CPUutilization*=1h,Tmp*=5m"
+	RetentionRules string
+	// Периодичность запуска очистки устаревших метрик
+	RetentionInterval time.Duration
+
+	// Политика совпадения имён gauge и counter: separate, reject или overwrite
+	TypeConflictPolicy string
+
+	// Границы корзин гистограмм через запятую (пусто — границы по умолчанию)
+	HistogramBuckets string
+	// Относительная точность и ограничение числа корзин скетчей квантилей
+	SketchAccuracy float64
+	SketchMaxBins  int
+	// Точность HyperLogLog для метрик set (4..16)
+	SetPrecision int
+
+	// Сколько последних событий потока /api/v1/stream хранится для переподключений
+	StreamHistory int
+	// Период пульса в потоке событий
+	StreamHeartbeat time.Duration
+
+	// Число точек истории gauge и counter на метрику (0 — история не ведётся) и шаг точек
+	HistorySize       int
+	HistoryResolution time.Duration
+
+	// Ограничения размера тела запроса в байтах: по сети и после распаковки gzip
+	MaxBodySize         int64
+	MaxDecompressedSize int64
+	// Максимальное число элементов пакета (0 — без ограничения)
+	MaxBatchSize int
+	// Частота запросов одного клиента в секунду (0 — без ограничения) и допустимый всплеск
+	RateLimit float64
+	RateBurst int
+	// Как определяется клиент для ограничения частоты: ip, token или agent
+	RateLimitBy string
+
+	// Ограничения числа рядов: всего, на клиента (0 — без ограничения) и по шаблонам имён
+	MaxSeries          int
+	MaxSeriesPerClient int
+	SeriesLimits       string
+	// Что делать с новыми рядами сверх ограничения: reject или sample, и доля сохраняемых при sample
+	SeriesLimitAction string
+	SeriesSampleRate  float64
+
+	// JSON-файл с правилами переразметки метрик при записи (пусто — без переразметки)
+	RelabelConfig string
+
+	// JSON-файл с правилами записи производных метрик (пусто — без правил) и период их вычисления
+	RecordingRules    string
+	RecordingInterval time.Duration
+
+	// Окно наблюдений counter для rate и increase (0 — не ведутся) и файл, в котором
+	// наблюдения сохраняются при остановке (пусто — не сохраняются)
+	CounterRateWindow time.Duration
+	CounterRatesFile  string
+
+	// JSON-файл с правилами оповещений и подавления (пусто — оповещения выключены) и период
+	// их вычисления. Оповещения и заглушки хранятся в базе данных, а без неё — в файле AlertsFile
+	// (пусто — только в памяти)
+	AlertRules    string
+	AlertInterval time.Duration
+	AlertsFile    string
 }
 
 // NewConfig читает флаги и переменные окружения и возвращает конфигурацию сервера.
@@ -27,6 +98,39 @@ func NewConfig() *Config {
 		Restore:         true,
 		DatabaseDSN:     "",
 		Key:             "",
+		AdminKey:        "",
+		TokensFile:      "/tmp/metrics-tokens.json",
+
+		RetentionInterval: time.Minute,
+
+		TypeConflictPolicy: "separate",
+
+		SketchAccuracy: 0.01,
+		SketchMaxBins:  2048,
+		SetPrecision:   14,
+
+		StreamHistory:   1024,
+		StreamHeartbeat: 15 * time.Second,
+
+		HistorySize:       360,
+		HistoryResolution: 10 * time.Second,
+
+		MaxBodySize:         10 << 20,
+		MaxDecompressedSize: 50 << 20,
+		MaxBatchSize:        10000,
+		RateBurst:           100,
+		RateLimitBy:         "ip",
+
+		SeriesLimitAction: "reject",
+		SeriesSampleRate:  0.1,
+
+		RecordingInterval: 10 * time.Second,
+
+		CounterRateWindow: time.Hour,
+		CounterRatesFile:  "/tmp/metrics-counter-rates.json",
+
+		AlertInterval: 15 * time.Second,
+		AlertsFile:    "/tmp/metrics-alerts.json",
 	}
 
 	flag.StringVar(&cfg.ServerAddress, "a", cfg.ServerAddress, "HTTP server address")
@@ -36,6 +140,40 @@ func NewConfig() *Config {
 	flag.StringVar(&cfg.DatabaseDSN, "d", cfg.DatabaseDSN, "Database DSN for PostgreSQL connection")
 	// Добавляем флаг для ключа:
 	flag.StringVar(&cfg.Key, "k", cfg.Key, "Key for HMAC SHA256 signing")
+	flag.StringVar(&cfg.AdminKey, "admin-key", cfg.AdminKey, "Admin API key (empty disables /admin routes)")
+	flag.BoolVar(&cfg.TokenAuth, "token-auth", cfg.TokenAuth, "Require API tokens on all routes")
+	flag.StringVar(&cfg.TokensFile, "tokens-file", cfg.TokensFile, "File with hashed API tokens (used without a database)")
+	flag.DurationVar(&cfg.RetentionTTL, "retention-ttl", cfg.RetentionTTL, "Expire gauges not updated for this long (0 disables)")
+	flag.StringVar(&cfg.RetentionRules, "retention-rules", cfg.RetentionRules, "Per-pattern retention, e.g. \"CPUutilization*=1h,Tmp*=5m\"")
+	flag.DurationVar(&cfg.RetentionInterval, "retention-interval", cfg.RetentionInterval, "How often stale metrics are expired")
+	flag.StringVar(&cfg.TypeConflictPolicy, "type-conflict", cfg.TypeConflictPolicy, "Gauge/counter name clash policy: separate, reject or overwrite")
+	flag.StringVar(&cfg.HistogramBuckets, "histogram-buckets", cfg.HistogramBuckets, "Histogram bucket bounds, e.g. \"0.1,0.5,1,5\"")
+	flag.Float64Var(&cfg.SketchAccuracy, "sketch-accuracy", cfg.SketchAccuracy, "Relative accuracy of quantile sketches")
+	flag.IntVar(&cfg.SketchMaxBins, "sketch-max-bins", cfg.SketchMaxBins, "Maximum number of bins per quantile sketch")
+	flag.IntVar(&cfg.SetPrecision, "set-precision", cfg.SetPrecision, "HyperLogLog precision of set metrics (4..16)")
+	flag.IntVar(&cfg.StreamHistory, "stream-history", cfg.StreamHistory, "Events kept for resuming /api/v1/stream")
+	flag.DurationVar(&cfg.StreamHeartbeat, "stream-heartbeat", cfg.StreamHeartbeat, "Heartbeat period of the event stream")
+	flag.IntVar(&cfg.HistorySize, "history-size", cfg.HistorySize, "Points of gauge/counter history kept per metric (0 disables)")
+	flag.DurationVar(&cfg.HistoryResolution, "history-resolution", cfg.HistoryResolution, "Interval between history points")
+	flag.Int64Var(&cfg.MaxBodySize, "max-body-size", cfg.MaxBodySize, "Maximum request body size in bytes as sent over the wire")
+	flag.Int64Var(&cfg.MaxDecompressedSize, "max-decompressed-size", cfg.MaxDecompressedSize, "Maximum request body size in bytes after gzip decompression")
+	flag.IntVar(&cfg.MaxBatchSize, "max-batch-size", cfg.MaxBatchSize, "Maximum number of items in a batch (0 disables)")
+	flag.Float64Var(&cfg.RateLimit, "rate-limit", cfg.RateLimit, "Requests per second allowed per client (0 disables)")
+	flag.IntVar(&cfg.RateBurst, "rate-burst", cfg.RateBurst, "Request burst allowed per client")
+	flag.StringVar(&cfg.RateLimitBy, "rate-limit-by", cfg.RateLimitBy, "Client identity for rate limiting and series limits: ip, token or agent")
+	flag.IntVar(&cfg.MaxSeries, "max-series", cfg.MaxSeries, "Maximum number of series on the server (0 disables)")
+	flag.IntVar(&cfg.MaxSeriesPerClient, "max-series-per-client", cfg.MaxSeriesPerClient, "Maximum number of series created by one client (0 disables)")
+	flag.StringVar(&cfg.SeriesLimits, "series-limits", cfg.SeriesLimits, "Per-pattern series limits, e.g. \"app.*=1000,tmp.*=50\"")
+	flag.StringVar(&cfg.SeriesLimitAction, "series-limit-action", cfg.SeriesLimitAction, "New series over a limit: reject or sample")
+	flag.Float64Var(&cfg.SeriesSampleRate, "series-sample-rate", cfg.SeriesSampleRate, "Share of new series over a limit kept in sample mode")
+	flag.StringVar(&cfg.RelabelConfig, "relabel-config", cfg.RelabelConfig, "JSON file with relabel rules applied to metrics on ingest")
+	flag.StringVar(&cfg.RecordingRules, "recording-rules", cfg.RecordingRules, "JSON file with recording rules for derived gauges")
+	flag.DurationVar(&cfg.RecordingInterval, "recording-interval", cfg.RecordingInterval, "How often recording rules are evaluated")
+	flag.DurationVar(&cfg.CounterRateWindow, "counter-rate-window", cfg.CounterRateWindow, "Longest window for counter rate and increase (0 disables)")
+	flag.StringVar(&cfg.CounterRatesFile, "counter-rates-file", cfg.CounterRatesFile, "File where counter observations are kept across restarts (empty disables)")
+	flag.StringVar(&cfg.AlertRules, "alert-rules", cfg.AlertRules, "JSON file with alert and inhibit rules")
+	flag.DurationVar(&cfg.AlertInterval, "alert-interval", cfg.AlertInterval, "How often alert rules are evaluated")
+	flag.StringVar(&cfg.AlertsFile, "alerts-file", cfg.AlertsFile, "File with alert state and silences (used without a database; empty keeps them in memory)")
 	flag.Parse()
 
 	if envAddress := os.Getenv("ADDRESS"); envAddress != "" {
@@ -67,5 +205,181 @@ func NewConfig() *Config {
 		cfg.Key = envKey
 	}
 
+	if envAdminKey := os.Getenv("ADMIN_KEY"); envAdminKey != "" {
+		cfg.AdminKey = envAdminKey
+	}
+
+	if envTokenAuth := os.Getenv("TOKEN_AUTH"); envTokenAuth != "" {
+		cfg.TokenAuth, _ = strconv.ParseBool(envTokenAuth)
+	}
+
+	if envTokensFile := os.Getenv("TOKENS_FILE"); envTokensFile != "" {
+		cfg.TokensFile = envTokensFile
+	}
+
+	if envTTL := os.Getenv("RETENTION_TTL"); envTTL != "" {
+		if ttl, err := time.ParseDuration(envTTL); err == nil {
+			cfg.RetentionTTL = ttl
+		}
+	}
+
+	if envRules := os.Getenv("RETENTION_RULES"); envRules != "" {
+		cfg.RetentionRules = envRules
+	}
+
+	if envInterval := os.Getenv("RETENTION_INTERVAL"); envInterval != "" {
+		if ri, err := time.ParseDuration(envInterval); err == nil && ri > 0 {
+			cfg.RetentionInterval = ri
+		}
+	}
+
+	if envPolicy := os.Getenv("TYPE_CONFLICT_POLICY"); envPolicy != "" {
+		cfg.TypeConflictPolicy = envPolicy
+	}
+
+	if envBuckets := os.Getenv("HISTOGRAM_BUCKETS"); envBuckets != "" {
+		cfg.HistogramBuckets = envBuckets
+	}
+
+	if envAccuracy := os.Getenv("SKETCH_ACCURACY"); envAccuracy != "" {
+		if a, err := strconv.ParseFloat(envAccuracy, 64); err == nil {
+			cfg.SketchAccuracy = a
+		}
+	}
+
+	if envMaxBins := os.Getenv("SKETCH_MAX_BINS"); envMaxBins != "" {
+		if n, err := strconv.Atoi(envMaxBins); err == nil && n > 0 {
+			cfg.SketchMaxBins = n
+		}
+	}
+
+	if envPrecision := os.Getenv("SET_PRECISION"); envPrecision != "" {
+		if n, err := strconv.Atoi(envPrecision); err == nil {
+			cfg.SetPrecision = n
+		}
+	}
+
+	if envHistory := os.Getenv("STREAM_HISTORY"); envHistory != "" {
+		if n, err := strconv.Atoi(envHistory); err == nil && n > 0 {
+			cfg.StreamHistory = n
+		}
+	}
+
+	if envHeartbeat := os.Getenv("STREAM_HEARTBEAT"); envHeartbeat != "" {
+		if hb, err := time.ParseDuration(envHeartbeat); err == nil && hb > 0 {
+			cfg.StreamHeartbeat = hb
+		}
+	}
+
+	if envHistorySize := os.Getenv("HISTORY_SIZE"); envHistorySize != "" {
+		if n, err := strconv.Atoi(envHistorySize); err == nil && n >= 0 {
+			cfg.HistorySize = n
+		}
+	}
+
+	if envResolution := os.Getenv("HISTORY_RESOLUTION"); envResolution != "" {
+		if r, err := time.ParseDuration(envResolution); err == nil && r > 0 {
+			cfg.HistoryResolution = r
+		}
+	}
+
+	if envMaxBody := os.Getenv("MAX_BODY_SIZE"); envMaxBody != "" {
+		if n, err := strconv.ParseInt(envMaxBody, 10, 64); err == nil && n > 0 {
+			cfg.MaxBodySize = n
+		}
+	}
+
+	if envMaxDecompressed := os.Getenv("MAX_DECOMPRESSED_SIZE"); envMaxDecompressed != "" {
+		if n, err := strconv.ParseInt(envMaxDecompressed, 10, 64); err == nil && n > 0 {
+			cfg.MaxDecompressedSize = n
+		}
+	}
+
+	if envMaxBatch := os.Getenv("MAX_BATCH_SIZE"); envMaxBatch != "" {
+		if n, err := strconv.Atoi(envMaxBatch); err == nil && n >= 0 {
+			cfg.MaxBatchSize = n
+		}
+	}
+
+	if envRate := os.Getenv("RATE_LIMIT"); envRate != "" {
+		if r, err := strconv.ParseFloat(envRate, 64); err == nil && r >= 0 {
+			cfg.RateLimit = r
+		}
+	}
+
+	if envBurst := os.Getenv("RATE_BURST"); envBurst != "" {
+		if n, err := strconv.Atoi(envBurst); err == nil && n > 0 {
+			cfg.RateBurst = n
+		}
+	}
+
+	if envRateBy := os.Getenv("RATE_LIMIT_BY"); envRateBy != "" {
+		cfg.RateLimitBy = envRateBy
+	}
+
+	if envMaxSeries := os.Getenv("MAX_SERIES"); envMaxSeries != "" {
+		if n, err := strconv.Atoi(envMaxSeries); err == nil && n >= 0 {
+			cfg.MaxSeries = n
+		}
+	}
+
+	if envPerClient := os.Getenv("MAX_SERIES_PER_CLIENT"); envPerClient != "" {
+		if n, err := strconv.Atoi(envPerClient); err == nil && n >= 0 {
+			cfg.MaxSeriesPerClient = n
+		}
+	}
+
+	if envSeriesLimits := os.Getenv("SERIES_LIMITS"); envSeriesLimits != "" {
+		cfg.SeriesLimits = envSeriesLimits
+	}
+
+	if envAction := os.Getenv("SERIES_LIMIT_ACTION"); envAction != "" {
+		cfg.SeriesLimitAction = envAction
+	}
+
+	if envSampleRate := os.Getenv("SERIES_SAMPLE_RATE"); envSampleRate != "" {
+		if r, err := strconv.ParseFloat(envSampleRate, 64); err == nil && r >= 0 && r <= 1 {
+			cfg.SeriesSampleRate = r
+		}
+	}
+
+	if envRelabel := os.Getenv("RELABEL_CONFIG"); envRelabel != "" {
+		cfg.RelabelConfig = envRelabel
+	}
+
+	if envRules := os.Getenv("RECORDING_RULES"); envRules != "" {
+		cfg.RecordingRules = envRules
+	}
+
+	if envRulesInterval := os.Getenv("RECORDING_INTERVAL"); envRulesInterval != "" {
+		if d, err := time.ParseDuration(envRulesInterval); err == nil && d > 0 {
+			cfg.RecordingInterval = d
+		}
+	}
+
+	if envRateWindow := os.Getenv("COUNTER_RATE_WINDOW"); envRateWindow != "" {
+		if d, err := time.ParseDuration(envRateWindow); err == nil && d >= 0 {
+			cfg.CounterRateWindow = d
+		}
+	}
+
+	if envRatesFile := os.Getenv("COUNTER_RATES_FILE"); envRatesFile != "" {
+		cfg.CounterRatesFile = envRatesFile
+	}
+
+	if envAlertRules := os.Getenv("ALERT_RULES"); envAlertRules != "" {
+		cfg.AlertRules = envAlertRules
+	}
+
+	if envAlertInterval := os.Getenv("ALERT_INTERVAL"); envAlertInterval != "" {
+		if d, err := time.ParseDuration(envAlertInterval); err == nil && d > 0 {
+			cfg.AlertInterval = d
+		}
+	}
+
+	if envAlertsFile := os.Getenv("ALERTS_FILE"); envAlertsFile != "" {
+		cfg.AlertsFile = envAlertsFile
+	}
+
 	return cfg
 }
@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+// Форматы снимка, поддерживаемые административным API.
+const (
+	snapshotFormatJSON   = "json"
+	snapshotFormatNDJSON = "ndjson"
+
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// SetupAdminRoutes регистрирует административные маршруты, защищённые ключом администратора.
+// При пустом adminKey маршруты регистрируются, но отвечают 403. Если включена аутентификация
+// по токенам, маршруты доступны и с токеном роли admin.
+// Все обращения к ним записываются в лог.
+func (h *Handler) SetupAdminRoutes(router *gin.Engine, adminKey string, logger *logrus.Logger) {
+	guard := []gin.HandlerFunc{middleware.AdminAuditMiddleware(logger)}
+	if h.authorize == nil {
+		guard = append(guard, middleware.AdminAuthMiddleware(adminKey))
+	}
+
+	h.registerAPIRoutes(router, true, guard...)
+	guard = append(guard, h.guard(models.RoleAdmin)...)
+
+	// Прежние административные маршруты — псевдонимы операций /api/v1.
+	router.DELETE("/value/:type/:name", append(guard, h.deleteMetricHandler)...)
+
+	admin := router.Group("/admin", guard...)
+	admin.GET("/snapshot", h.exportSnapshotHandler)
+	admin.POST("/snapshot", h.importSnapshotHandler)
+	admin.DELETE("/metrics", h.deleteMetricsHandler)
+	admin.POST("/counters/:name/reset", h.resetCounterHandler)
+}
+
+// deleteMetricHandler удаляет одну метрику по типу и имени.
+func (h *Handler) deleteMetricHandler(c *gin.Context) {
+	err := h.ms.DeleteMetric(c.Param("type"), c.Param("name"))
+	switch {
+	case err == nil:
+		c.Status(http.StatusOK)
+	case errors.Is(err, service.ErrMetricNotFound):
+		writeLegacyError(c, err, http.StatusNotFound, "")
+	case errors.Is(err, service.ErrUnsupportedType):
+		writeLegacyError(c, err, http.StatusBadRequest, err.Error())
+	default:
+		writeLegacyError(c, err, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// deleteMetricsHandler удаляет все метрики, подходящие под шаблон ?pattern= (и, опционально, ?type=).
+func (h *Handler) deleteMetricsHandler(c *gin.Context) {
+	removed, err := h.ms.DeleteMetrics(c.Query("type"), c.Query("pattern"))
+	if err != nil {
+		// Метрики, удалённые до сбоя, перечисляются в поле deleted.
+		p := middleware.NewProblemBody(c, err)
+		if removed != nil {
+			p.Extensions = map[string]any{"deleted": removed}
+		}
+		middleware.WriteProblemBody(c, p)
+		return
+	}
+	if removed == nil {
+		removed = []service.MetricRef{}
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": removed})
+}
+
+// resetCounterHandler обнуляет counter.
+func (h *Handler) resetCounterHandler(c *gin.Context) {
+	if err := h.ms.ResetCounter(c.Param("name")); err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("name"), "type": service.CounterMetric, "delta": 0})
+}
+
+// listTokensHandler отвечает списком API-токенов без секретов.
+func (h *Handler) listTokensHandler(c *gin.Context) {
+	if h.tokens == nil {
+		middleware.WriteProblem(c, service.ErrAuthDisabled)
+		return
+	}
+	tokens, err := h.tokens.List()
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// issueTokenHandler выдаёт токен; секрет есть только в этом ответе.
+func (h *Handler) issueTokenHandler(c *gin.Context) {
+	if h.tokens == nil {
+		middleware.WriteProblem(c, service.ErrAuthDisabled)
+		return
+	}
+	var req service.TokenRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		middleware.WriteProblem(c, middleware.ErrInvalidJSON)
+		return
+	}
+	issued, err := h.tokens.Issue(req)
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, issued)
+}
+
+// revokeTokenHandler отзывает токен.
+func (h *Handler) revokeTokenHandler(c *gin.Context) {
+	if h.tokens == nil {
+		middleware.WriteProblem(c, service.ErrAuthDisabled)
+		return
+	}
+	if err := h.tokens.Revoke(c.Param("id")); err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// snapshotFormat определяет формат снимка по параметру format или заголовку.
+func snapshotFormat(c *gin.Context, header string) string {
+	if f := strings.ToLower(c.Query("format")); f != "" {
+		return f
+	}
+	if strings.Contains(c.GetHeader(header), ndjsonContentType) {
+		return snapshotFormatNDJSON
+	}
+	return snapshotFormatJSON
+}
+
+// exportSnapshotHandler отдаёт полный снимок метрик одним объектом (JSON) или построчно (NDJSON).
+// Оба формата кодируются по одной метрике, не собирая ответ целиком в памяти.
+func (h *Handler) exportSnapshotHandler(c *gin.Context) {
+	data := h.ms.Snapshot()
+
+	switch snapshotFormat(c, "Accept") {
+	case snapshotFormatJSON:
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := writeSnapshotJSON(c.Writer, data); err != nil {
+			logrus.WithError(err).Warn("snapshot export interrupted")
+		}
+	case snapshotFormatNDJSON:
+		items, err := data.Items()
+		if err != nil {
+			middleware.WriteProblem(c, err)
+			return
+		}
+		c.Header("Content-Type", ndjsonContentType)
+		c.Status(http.StatusOK)
+		enc := json.NewEncoder(c.Writer)
+		for _, item := range items {
+			if err := enc.Encode(item); err != nil {
+				return
+			}
+		}
+	default:
+		middleware.WriteProblem(c, invalidRequest("unsupported snapshot format"))
+	}
+}
+
+// writeSnapshotJSON пишет снимок в том же виде, что и json.Marshal(data),
+// кодируя каждую метрику отдельно. Ключи упорядочены, пустые необязательные поля опускаются.
+func writeSnapshotJSON(w io.Writer, data models.MetricsData) error {
+	s := &jsonStream{w: bufio.NewWriter(w)}
+	s.write(`{"gauges":`)
+	streamMap(s, data.Gauges, encodeValue[string](s))
+	s.write(`,"counters":`)
+	streamMap(s, data.Counters, encodeValue[int64](s))
+	streamField(s, "gauges_updated_at", data.GaugesUpdatedAt, encodeValue[time.Time](s))
+	streamField(s, "counters_updated_at", data.CountersUpdatedAt, encodeValue[time.Time](s))
+	streamField(s, "composites", data.Composites, func(values map[string]json.RawMessage) {
+		streamMap(s, values, encodeValue[json.RawMessage](s))
+	})
+	streamField(s, "composites_updated_at", data.CompositesUpdatedAt, func(values map[string]time.Time) {
+		streamMap(s, values, encodeValue[time.Time](s))
+	})
+	s.write("}")
+	if s.err != nil {
+		return s.err
+	}
+	return s.w.Flush()
+}
+
+// jsonStream запоминает первую ошибку записи, чтобы не проверять каждый фрагмент.
+type jsonStream struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (s *jsonStream) write(p string) {
+	if s.err == nil {
+		_, s.err = s.w.WriteString(p)
+	}
+}
+
+func (s *jsonStream) encode(v any) {
+	if s.err != nil {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		s.err = err
+		return
+	}
+	_, s.err = s.w.Write(b)
+}
+
+func encodeValue[V any](s *jsonStream) func(V) {
+	return func(v V) { s.encode(v) }
+}
+
+// streamField пишет поле объекта с omitempty: пустой словарь пропускается.
+func streamField[V any](s *jsonStream, name string, m map[string]V, value func(V)) {
+	if len(m) == 0 {
+		return
+	}
+	s.write(",")
+	s.encode(name)
+	s.write(":")
+	streamMap(s, m, value)
+}
+
+func streamMap[V any](s *jsonStream, m map[string]V, value func(V)) {
+	if m == nil {
+		s.write("null")
+		return
+	}
+	s.write("{")
+	for i, key := range slices.Sorted(maps.Keys(m)) {
+		if i > 0 {
+			s.write(",")
+		}
+		s.encode(key)
+		s.write(":")
+		value(m[key])
+		if s.err != nil {
+			return
+		}
+	}
+	s.write("}")
+}
+
+// importSnapshotHandler восстанавливает метрики из снимка.
+// Параметр mode: merge (по умолчанию) или replace.
+func (h *Handler) importSnapshotHandler(c *gin.Context) {
+	var replace bool
+	switch mode := strings.ToLower(c.DefaultQuery("mode", "merge")); mode {
+	case "merge":
+	case "replace":
+		replace = true
+	default:
+		middleware.WriteProblem(c, invalidRequest("mode must be merge or replace"))
+		return
+	}
+
+	var (
+		data models.MetricsData
+		err  error
+	)
+	switch snapshotFormat(c, "Content-Type") {
+	case snapshotFormatJSON:
+		data, err = decodeSnapshotJSON(c.Request.Body)
+	case snapshotFormatNDJSON:
+		data, err = decodeSnapshotNDJSON(c.Request.Body)
+	default:
+		err = errors.New("unsupported snapshot format")
+	}
+	if err != nil {
+		middleware.WriteProblem(c, service.ErrInvalidSnapshot.With(err))
+		return
+	}
+
+	if err := h.ms.RestoreSnapshot(data, replace); err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	composites := 0
+	for _, values := range data.Composites {
+		composites += len(values)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"gauges":     len(data.Gauges),
+		"counters":   len(data.Counters),
+		"composites": composites,
+		"replace":    replace,
+	})
+}
+
+// decodeSnapshotJSON читает снимок в формате models.MetricsData.
+func decodeSnapshotJSON(r io.Reader) (models.MetricsData, error) {
+	data := models.NewMetricsData()
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return data, errors.New("invalid JSON format")
+	}
+	if data.Gauges == nil {
+		data.Gauges = make(map[string]string)
+	}
+	if data.Counters == nil {
+		data.Counters = make(map[string]int64)
+	}
+	if data.Composites == nil {
+		data.Composites = make(map[string]map[string]json.RawMessage)
+	}
+	if data.CompositesUpdatedAt == nil {
+		data.CompositesUpdatedAt = make(map[string]map[string]time.Time)
+	}
+	return data, nil
+}
+
+// decodeSnapshotNDJSON читает снимок, где каждая строка — отдельная метрика.
+func decodeSnapshotNDJSON(r io.Reader) (models.MetricsData, error) {
+	data := models.NewMetricsData()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var m models.Metrics
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			return data, errors.New("invalid NDJSON line")
+		}
+		if err := data.Add(m); err != nil {
+			return data, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return data, err
+	}
+	return data, nil
+}
+
+// relabelDryRunHandler применяет правила переразметки из запроса (или настроенные на сервере)
+// к примерам метрик и возвращает результат, ничего не записывая.
+func (h *Handler) relabelDryRunHandler(c *gin.Context) {
+	var req service.RelabelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.WriteProblem(c, middleware.ErrInvalidJSON)
+		return
+	}
+	results, err := h.ms.RelabelDryRun(req)
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// defaultCardinalityTop — число клиентов в отчёте о рядах по умолчанию.
+const defaultCardinalityTop = 10
+
+// cardinalityHandler отвечает отчётом о числе рядов и клиентах, создавших больше всего рядов.
+func (h *Handler) cardinalityHandler(c *gin.Context) {
+	top := defaultCardinalityTop
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			middleware.WriteProblem(c, service.ErrInvalidQuery.With(errors.New("limit must be a non-negative integer")))
+			return
+		}
+		top = n
+	}
+	rep, err := h.ms.CardinalityReport(top)
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rep)
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+const testAdminKey = "secret"
+
+func setupAdminRouter(adminKey string) (*gin.Engine, *service.MetricsService) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	ms := &service.MetricsService{Storage: repository.NewMemStorage()}
+	h := NewHandler(ms)
+	h.SetupRoutes(router)
+	h.SetupAdminRoutes(router, adminKey, logrus.New())
+	return router, ms
+}
+
+func adminRequest(method, url string, body []byte) *http.Request {
+	req, _ := http.NewRequest(method, url, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAdminKey)
+	return req
+}
+
+func TestAdminRoutes_Auth(t *testing.T) {
+	router, _ := setupAdminRouter("")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodGet, "/admin/snapshot", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	router, _ = setupAdminRouter(testAdminKey)
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/admin/snapshot", nil)
+	req.Header.Set("X-Admin-Key", "wrong")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestSnapshotExportJSONAndNDJSON(t *testing.T) {
+	router, ms := setupAdminRouter(testAdminKey)
+	require.NoError(t, ms.UpdateMetric("gauge", "Alloc", "1.5"))
+	require.NoError(t, ms.UpdateMetric("counter", "PollCount", "3"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodGet, "/admin/snapshot", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var data models.MetricsData
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &data))
+	assert.Equal(t, "1.5", data.Gauges["Alloc"])
+	assert.Equal(t, int64(3), data.Counters["PollCount"])
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodGet, "/admin/snapshot?format=ndjson", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ndjsonContentType, w.Header().Get("Content-Type"))
+	var lines int
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var m models.Metrics
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &m))
+		lines++
+	}
+	assert.Equal(t, 2, lines)
+}
+
+func TestSnapshotExportJSONMatchesMarshal(t *testing.T) {
+	router, ms := setupAdminRouter(testAdminKey)
+	require.NoError(t, ms.UpdateMetric("gauge", "Alloc", "1.5"))
+	require.NoError(t, ms.UpdateMetric("gauge", "<b>", "2"))
+	require.NoError(t, ms.UpdateMetric("counter", "PollCount", "3"))
+	require.NoError(t, ms.UpdateMetric("histogram", "latency", "12"))
+	require.NoError(t, ms.UpdateMetric("set", "users", "carol"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodGet, "/admin/snapshot", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	want, err := json.Marshal(ms.Snapshot())
+	require.NoError(t, err)
+	assert.Equal(t, string(want), w.Body.String())
+
+	var empty bytes.Buffer
+	require.NoError(t, writeSnapshotJSON(&empty, models.NewMetricsData()))
+	assert.Equal(t, `{"gauges":{},"counters":{}}`, empty.String())
+}
+
+func TestSnapshotImportMergeAndReplace(t *testing.T) {
+	router, ms := setupAdminRouter(testAdminKey)
+	require.NoError(t, ms.UpdateMetric("gauge", "Old", "1"))
+	require.NoError(t, ms.UpdateMetric("counter", "PollCount", "10"))
+
+	body := []byte(`{"gauges":{"Alloc":"2.5"},"counters":{"PollCount":4}}`)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodPost, "/admin/snapshot", body))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	all := ms.GetAllMetrics()
+	assert.Equal(t, "1", all["Old"])
+	assert.Equal(t, "2.5", all["Alloc"])
+	assert.Equal(t, "4", all["PollCount"], "counter from snapshot must replace, not accumulate")
+
+	ndjson := strings.Join([]string{
+		`{"id":"Fresh","type":"gauge","value":7}`,
+		`{"id":"Hits","type":"counter","delta":2}`,
+	}, "\n")
+	w = httptest.NewRecorder()
+	req := adminRequest(http.MethodPost, "/admin/snapshot?mode=replace", []byte(ndjson))
+	req.Header.Set("Content-Type", ndjsonContentType)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	all = ms.GetAllMetrics()
+	assert.Equal(t, map[string]string{"Fresh": "7", "Hits": "2"}, all)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodPost, "/admin/snapshot", []byte(`{"gauges":{"Bad":"x"}}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "7", ms.GetAllMetrics()["Fresh"], "invalid snapshot must not be applied")
+}
+
+func TestDeleteAndResetRoutes(t *testing.T) {
+	router, ms := setupAdminRouter(testAdminKey)
+	require.NoError(t, ms.UpdateMetric("gauge", "CPUutilization1", "10"))
+	require.NoError(t, ms.UpdateMetric("gauge", "CPUutilization2", "20"))
+	require.NoError(t, ms.UpdateMetric("gauge", "Alloc", "1"))
+	require.NoError(t, ms.UpdateMetric("counter", "PollCount", "5"))
+
+	// Без ключа удалять нельзя.
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodDelete, "/value/gauge/Alloc", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodDelete, "/value/gauge/Alloc", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, err := ms.GetMetricValue("gauge", "Alloc")
+	assert.Error(t, err)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodDelete, "/value/gauge/Alloc", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodDelete, "/admin/metrics?pattern=CPUutilization*&type=gauge", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Deleted []service.MetricRef `json:"deleted"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Deleted, 2)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodDelete, "/admin/metrics", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code, "pattern is mandatory")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodPost, "/admin/counters/PollCount/reset", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	v, err := ms.GetMetricValue("counter", "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, "0", v)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodPost, "/admin/counters/Missing/reset", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDeleteCompositeMetrics(t *testing.T) {
+	router, ms := setupAdminRouter(testAdminKey)
+	values := map[string]string{"histogram": "12", "summary": "12", "sketch": "12", "set": "carol"}
+	require.ElementsMatch(t, models.CompositeTypes(), slices.Collect(maps.Keys(values)))
+	exists := func(mtype, name string) bool {
+		_, err := ms.GetMetricValue(mtype, name)
+		return err == nil
+	}
+	for mtype, v := range values {
+		for _, name := range []string{"lat", "lat2", "lat3"} {
+			require.NoError(t, ms.UpdateMetric(mtype, name, v))
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, adminRequest(http.MethodDelete, "/value/"+mtype+"/lat", nil))
+		assert.Equal(t, http.StatusOK, w.Code, "%s: %s", mtype, w.Body.String())
+		assert.False(t, exists(mtype, "lat"), mtype)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, adminRequest(http.MethodDelete, APIPrefix+"/metrics/"+mtype+"/lat2", nil))
+		assert.Equal(t, http.StatusOK, w.Code, "%s: %s", mtype, w.Body.String())
+		assert.False(t, exists(mtype, "lat2"), mtype)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, adminRequest(http.MethodDelete, "/admin/metrics?pattern=lat*&type="+mtype, nil))
+		require.Equal(t, http.StatusOK, w.Code, "%s: %s", mtype, w.Body.String())
+		var resp struct {
+			Deleted []service.MetricRef `json:"deleted"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, []service.MetricRef{{ID: "lat3", MType: mtype}}, resp.Deleted)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+// listAlertsHandler отвечает списком активных оповещений. Токену с областью действия видны
+// только оповещения о метриках из неё (по метке metric); оповещения без метрики скрыты.
+func (h *Handler) listAlertsHandler(c *gin.Context) {
+	if h.Alerts == nil {
+		middleware.WriteProblem(c, service.ErrAlertsDisabled)
+		return
+	}
+	alerts := h.Alerts.Alerts()
+	if allow := allowedNames(c); allow != nil {
+		alerts = slices.DeleteFunc(alerts, func(a service.AlertView) bool {
+			metric, ok := a.Labels[service.AlertMetricLabel]
+			return !ok || !allow(metric)
+		})
+	}
+	c.JSON(http.StatusOK, alerts)
+}
+
+// listSilencesHandler отвечает списком заглушек.
+func (h *Handler) listSilencesHandler(c *gin.Context) {
+	if h.Alerts == nil {
+		middleware.WriteProblem(c, service.ErrAlertsDisabled)
+		return
+	}
+	c.JSON(http.StatusOK, h.Alerts.Silences())
+}
+
+// createSilenceHandler создаёт заглушку. Без created_by автором считается токен запроса.
+func (h *Handler) createSilenceHandler(c *gin.Context) {
+	if h.Alerts == nil {
+		middleware.WriteProblem(c, service.ErrAlertsDisabled)
+		return
+	}
+	var req service.SilenceRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		middleware.WriteProblem(c, middleware.ErrInvalidJSON)
+		return
+	}
+	if token, ok := middleware.TokenFromContext(c); ok && req.CreatedBy == "" {
+		req.CreatedBy = token.Name
+		if req.CreatedBy == "" {
+			req.CreatedBy = token.ID
+		}
+	}
+	silence, err := h.Alerts.CreateSilence(req)
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, silence)
+}
+
+// deleteSilenceHandler удаляет заглушку.
+func (h *Handler) deleteSilenceHandler(c *gin.Context) {
+	if h.Alerts == nil {
+		middleware.WriteProblem(c, service.ErrAlertsDisabled)
+		return
+	}
+	if err := h.Alerts.DeleteSilence(c.Param("id")); err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
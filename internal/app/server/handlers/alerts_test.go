@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+func TestAlertHandlers(t *testing.T) {
+	router, _ := setupAdminRouter(testAdminKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, APIPrefix+"/alerts", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), service.CodeAlertsDisabled)
+
+	gin.SetMode(gin.TestMode)
+	router = gin.New()
+	ms := &service.MetricsService{Storage: repository.NewMemStorage()}
+	require.NoError(t, ms.UpdateMetric("gauge", `up{host="a"}`, "0"))
+	alerting, err := service.NewAlerting(ms, service.AlertingConfig{Rules: []service.AlertRule{{Name: "HostDown", Expr: "up == 0"}}},
+		repository.NewMemAlertStore(), time.Second, logrus.New())
+	require.NoError(t, err)
+	require.NoError(t, alerting.Evaluate(time.Now()))
+	h := NewHandler(ms)
+	h.Alerts = alerting
+	h.SetupRoutes(router)
+	h.SetupAdminRoutes(router, testAdminKey, logrus.New())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodPost, APIPrefix+"/admin/silences",
+		[]byte(`{"matchers":[{"label":"host","value":"a"}],"duration":"2h","created_by":"ops"}`)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var silence models.Silence
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &silence))
+	assert.Equal(t, "ops", silence.CreatedBy)
+	assert.Equal(t, 2*time.Hour, silence.EndsAt.Sub(silence.StartsAt))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, APIPrefix+"/alerts", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var alerts []service.AlertView
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &alerts))
+	require.Len(t, alerts, 1)
+	assert.Equal(t, models.AlertFiring, alerts[0].State)
+	assert.Equal(t, []string{silence.ID}, alerts[0].SilencedBy)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, APIPrefix+"/admin/silences/"+silence.ID, nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(http.MethodDelete, APIPrefix+"/admin/silences/"+silence.ID, nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, APIPrefix+"/silences", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, "[]", w.Body.String())
+}
+
+func TestAlertHandlers_TokenScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &service.MetricsService{Storage: repository.NewMemStorage()}
+	require.NoError(t, ms.UpdateMetric("gauge", "app.up", "0"))
+	require.NoError(t, ms.UpdateMetric("gauge", "db.up", "0"))
+	alerting, err := service.NewAlerting(ms, service.AlertingConfig{Rules: []service.AlertRule{
+		{Name: "AppDown", Expr: "app.up == 0"},
+		{Name: "DBDown", Expr: "db.up == 0"},
+		{Name: "Always", Expr: "1"},
+	}}, repository.NewMemAlertStore(), time.Second, logrus.New())
+	require.NoError(t, err)
+	require.NoError(t, alerting.Evaluate(time.Now()))
+
+	router := gin.New()
+	h := NewHandler(ms)
+	h.Alerts = alerting
+	secret := scopedReader(t, h, "app.")
+	h.SetupRoutes(router)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, APIPrefix+"/alerts", nil)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var alerts []service.AlertView
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &alerts))
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "AppDown", alerts[0].Rule)
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+// APIPrefix — префикс версионированного API.
+const APIPrefix = "/api/v1"
+
+// route — маршрут /api/v1: метод, путь относительно APIPrefix в синтаксисе gin,
+// обработчик, роль токена, необходимая для вызова, и описание в OpenAPI.
+// Маршруты роли admin требуют ключа администратора или токена администратора.
+type route struct {
+	method  string
+	path    string
+	handler gin.HandlerFunc
+	role    models.Role
+	op      operation
+}
+
+// apiRoutes перечисляет все операции /api/v1. По этой же таблице строится документ OpenAPI,
+// поэтому описание не расходится с зарегистрированными маршрутами.
+func (h *Handler) apiRoutes() []route {
+	metricParams := []parameter{pathParam("type", "Тип метрики"), pathParam("name", "Имя метрики")}
+	return []route{
+		{http.MethodGet, "/metrics", h.listMetricsHandler, models.RoleReader, operation{
+			ID: "listMetrics", Summary: "Список метрик с фильтрацией, сортировкой и постраничным выводом",
+			Parameters: []parameter{
+				queryParam("type", "Типы метрик через запятую"),
+				queryParam("name", "Шаблон имени (glob)"),
+				queryParam("regex", "Регулярное выражение для имени"),
+				queryParam("sort", "Поле сортировки: type, name, updated; \"-\" — по убыванию"),
+				queryParam("limit", "Размер страницы"),
+				queryParam("cursor", "Курсор следующей страницы из заголовка X-Next-Cursor"),
+			},
+			Responses: responses(ok("MetricEntryList"), problem(http.StatusBadRequest)),
+		}},
+		{http.MethodPost, "/metrics", h.updateBatchHandler, models.RoleWriter, operation{
+			ID: "updateMetrics", Summary: "Пакетное обновление метрик",
+			Parameters:  []parameter{queryParam("mode", "Режим пакета: atomic или partial")},
+			RequestBody: "MetricList",
+			// Без mode ответ — массив обновлённых метрик, с mode — BatchResult, в том числе при отказе пакета.
+			Responses: responses(ok("MetricList"), ok("BatchResult"), response(http.StatusMultiStatus, "BatchResult"),
+				problem(http.StatusBadRequest), response(http.StatusBadRequest, "BatchResult"),
+				problem(http.StatusConflict), response(http.StatusConflict, "BatchResult"),
+				problem(http.StatusUnprocessableEntity), response(http.StatusUnprocessableEntity, "BatchResult"),
+				problem(http.StatusInternalServerError), response(http.StatusInternalServerError, "BatchResult")),
+		}},
+		{http.MethodDelete, "/metrics", h.deleteMetricsHandler, models.RoleAdmin, operation{
+			ID: "deleteMetrics", Summary: "Удаление метрик по шаблону имени",
+			Parameters: []parameter{queryParam("pattern", "Шаблон имени (glob)"), queryParam("type", "Тип метрики")},
+			Responses: responses(ok("DeletedMetrics"), problem(http.StatusBadRequest),
+				problem(http.StatusUnauthorized), problem(http.StatusForbidden), problem(http.StatusInternalServerError)),
+		}},
+		{http.MethodPost, "/metrics/values", h.valuesBatchHandler, models.RoleReader, operation{
+			ID: "getMetrics", Summary: "Значения нескольких метрик; ненайденные пропускаются",
+			RequestBody: "MetricRefList",
+			Responses:   responses(ok("MetricList"), problem(http.StatusBadRequest)),
+		}},
+		{http.MethodGet, "/metrics/:type/:name", h.getMetricV1Handler, models.RoleReader, operation{
+			ID: "getMetric", Summary: "Значение одной метрики",
+			Parameters: metricParams,
+			Responses:  responses(ok("Metric"), problem(http.StatusBadRequest), problem(http.StatusNotFound)),
+		}},
+		{http.MethodPost, "/metrics/:type/:name", h.updateMetricV1Handler, models.RoleWriter, operation{
+			ID: "updateMetric", Summary: "Обновление одной метрики; id и type берутся из пути",
+			Parameters:  metricParams,
+			RequestBody: "Metric",
+			Responses: responses(ok("Metric"), problem(http.StatusBadRequest), problem(http.StatusConflict),
+				problem(http.StatusUnprocessableEntity), problem(http.StatusInternalServerError)),
+		}},
+		{http.MethodDelete, "/metrics/:type/:name", h.deleteMetricHandler, models.RoleAdmin, operation{
+			ID: "deleteMetric", Summary: "Удаление одной метрики",
+			Parameters: metricParams,
+			Responses: responses(empty(http.StatusOK), problem(http.StatusBadRequest), problem(http.StatusUnauthorized),
+				problem(http.StatusForbidden), problem(http.StatusNotFound), problem(http.StatusInternalServerError)),
+		}},
+		{http.MethodGet, "/metrics/:type/:name/quantiles", h.quantilesV1Handler, models.RoleReader, operation{
+			ID: "getQuantiles", Summary: "Оценки квантилей скетча",
+			Parameters: append(metricParams, queryParam("q", "Квантили через запятую, например 0.5,0.99")),
+			Responses:  responses(ok("Quantiles"), problem(http.StatusBadRequest), problem(http.StatusNotFound)),
+		}},
+		{http.MethodGet, "/metrics/:type/:name/history", h.historyHandler, models.RoleReader, operation{
+			ID: "getHistory", Summary: "Последние значения gauge или counter",
+			Parameters: append(metricParams, queryParam("window", "Период, например 15m (по умолчанию — вся история)")),
+			Responses: responses(ok("History"), problem(http.StatusBadRequest), problem(http.StatusNotFound),
+				problem(http.StatusServiceUnavailable)),
+		}},
+		{http.MethodGet, "/metrics/:type/:name/rate", h.rateHandler, models.RoleReader, operation{
+			ID: "getCounterRate", Summary: "Прирост и скорость counter за окно",
+			Parameters: append(metricParams, queryParam("window", "Окно, например 1m (по умолчанию 5m)")),
+			Responses: responses(ok("CounterRate"), problem(http.StatusBadRequest), problem(http.StatusNotFound),
+				problem(http.StatusUnprocessableEntity), problem(http.StatusServiceUnavailable)),
+		}},
+		{http.MethodGet, "/query", h.queryHandler, models.RoleReader, operation{
+			ID: "query", Summary: "Вычисление выражения над метриками",
+			Parameters: []parameter{queryParam("expr", "Выражение, например max(CPUutilization* > 80)")},
+			Responses: responses(ok("QueryResult"), problem(http.StatusBadRequest),
+				problem(http.StatusUnprocessableEntity), problem(http.StatusServiceUnavailable)),
+		}},
+		{http.MethodGet, "/alerts", h.listAlertsHandler, models.RoleReader, operation{
+			ID: "listAlerts", Summary: "Активные оповещения с заглушками и подавлением",
+			Responses: responses(ok("AlertList"), problem(http.StatusServiceUnavailable)),
+		}},
+		{http.MethodGet, "/silences", h.listSilencesHandler, models.RoleReader, operation{
+			ID: "listSilences", Summary: "Заглушки оповещений",
+			Responses: responses(ok("SilenceList"), problem(http.StatusServiceUnavailable)),
+		}},
+		{http.MethodGet, "/stream", h.streamHandler, models.RoleReader, operation{
+			ID: "streamEvents", Summary: "Поток изменений метрик (Server-Sent Events)",
+			Parameters: []parameter{
+				queryParam("type", "Типы метрик через запятую"),
+				queryParam("name", "Шаблон имени (glob)"),
+				queryParam("regex", "Регулярное выражение для имени"),
+				queryParam("last_event_id", "Продолжить после события; то же, что заголовок Last-Event-ID"),
+			},
+			Responses: responses(responseSpec{Status: http.StatusOK, Schema: "StreamEvent", ContentType: "text/event-stream"},
+				problem(http.StatusBadRequest), problem(http.StatusServiceUnavailable)),
+		}},
+		{http.MethodGet, "/admin/snapshot", h.exportSnapshotHandler, models.RoleAdmin, operation{
+			ID: "exportSnapshot", Summary: "Снимок всех метрик (JSON или NDJSON)",
+			Parameters: []parameter{queryParam("format", "json или ndjson")},
+			Responses: responses(ok("Snapshot"), problem(http.StatusBadRequest), problem(http.StatusUnauthorized),
+				problem(http.StatusForbidden), problem(http.StatusInternalServerError)),
+		}},
+		{http.MethodPost, "/admin/snapshot", h.importSnapshotHandler, models.RoleAdmin, operation{
+			ID: "importSnapshot", Summary: "Восстановление метрик из снимка",
+			Parameters:  []parameter{queryParam("mode", "merge или replace"), queryParam("format", "json или ndjson")},
+			RequestBody: "Snapshot",
+			Responses: responses(ok("ImportResult"), problem(http.StatusBadRequest), problem(http.StatusConflict),
+				problem(http.StatusUnauthorized), problem(http.StatusForbidden)),
+		}},
+		{http.MethodPost, "/admin/counters/:name/reset", h.resetCounterHandler, models.RoleAdmin, operation{
+			ID: "resetCounter", Summary: "Обнуление counter",
+			Parameters: []parameter{pathParam("name", "Имя counter")},
+			Responses: responses(ok("Metric"), problem(http.StatusUnauthorized), problem(http.StatusForbidden),
+				problem(http.StatusNotFound), problem(http.StatusInternalServerError)),
+		}},
+		{http.MethodGet, "/admin/tokens", h.listTokensHandler, models.RoleAdmin, operation{
+			ID: "listTokens", Summary: "Список API-токенов",
+			Responses: responses(ok("TokenList"), problem(http.StatusUnauthorized), problem(http.StatusForbidden),
+				problem(http.StatusInternalServerError), problem(http.StatusServiceUnavailable)),
+		}},
+		{http.MethodPost, "/admin/tokens", h.issueTokenHandler, models.RoleAdmin, operation{
+			ID: "issueToken", Summary: "Выдача API-токена; секрет возвращается только в этом ответе",
+			RequestBody: "TokenRequest",
+			Responses: responses(response(http.StatusCreated, "IssuedToken"), problem(http.StatusBadRequest),
+				problem(http.StatusUnauthorized), problem(http.StatusForbidden),
+				problem(http.StatusInternalServerError), problem(http.StatusServiceUnavailable)),
+		}},
+		{http.MethodDelete, "/admin/tokens/:id", h.revokeTokenHandler, models.RoleAdmin, operation{
+			ID: "revokeToken", Summary: "Отзыв API-токена",
+			Parameters: []parameter{pathParam("id", "Идентификатор токена")},
+			Responses: responses(empty(http.StatusNoContent), problem(http.StatusUnauthorized), problem(http.StatusForbidden),
+				problem(http.StatusNotFound), problem(http.StatusInternalServerError), problem(http.StatusServiceUnavailable)),
+		}},
+		{http.MethodPost, "/admin/silences", h.createSilenceHandler, models.RoleAdmin, operation{
+			ID: "createSilence", Summary: "Заглушка оповещений по условиям на метки до заданного времени",
+			RequestBody: "SilenceRequest",
+			Responses: responses(response(http.StatusCreated, "Silence"), problem(http.StatusBadRequest),
+				problem(http.StatusUnauthorized), problem(http.StatusForbidden),
+				problem(http.StatusInternalServerError), problem(http.StatusServiceUnavailable)),
+		}},
+		{http.MethodDelete, "/admin/silences/:id", h.deleteSilenceHandler, models.RoleAdmin, operation{
+			ID: "deleteSilence", Summary: "Удаление заглушки",
+			Parameters: []parameter{pathParam("id", "Идентификатор заглушки")},
+			Responses: responses(empty(http.StatusNoContent), problem(http.StatusUnauthorized), problem(http.StatusForbidden),
+				problem(http.StatusNotFound), problem(http.StatusInternalServerError), problem(http.StatusServiceUnavailable)),
+		}},
+		{http.MethodPost, "/admin/relabel/dry-run", h.relabelDryRunHandler, models.RoleAdmin, operation{
+			ID: "relabelDryRun", Summary: "Проверка правил переразметки на примерах метрик без записи",
+			RequestBody: "RelabelRequest",
+			Responses: responses(ok("RelabelResultList"), problem(http.StatusBadRequest), problem(http.StatusUnauthorized),
+				problem(http.StatusForbidden)),
+		}},
+		{http.MethodGet, "/admin/cardinality", h.cardinalityHandler, models.RoleAdmin, operation{
+			ID: "getCardinality", Summary: "Число рядов, ограничения и клиенты, создавшие больше всего рядов",
+			Parameters: []parameter{queryParam("limit", "Число клиентов в ответе (по умолчанию 10, 0 — все)")},
+			Responses: responses(ok("CardinalityReport"), problem(http.StatusBadRequest), problem(http.StatusUnauthorized),
+				problem(http.StatusForbidden), problem(http.StatusServiceUnavailable)),
+		}},
+	}
+}
+
+// registerAPIRoutes регистрирует операции /api/v1: административные при admin, иначе остальные.
+// Перед обработчиком выполняются guard и проверка токена роли маршрута.
+func (h *Handler) registerAPIRoutes(router *gin.Engine, admin bool, guard ...gin.HandlerFunc) {
+	api := router.Group(APIPrefix)
+	for _, r := range h.apiRoutes() {
+		if (r.role == models.RoleAdmin) != admin {
+			continue
+		}
+		chain := append(guard[:len(guard):len(guard)], h.guard(r.role)...)
+		api.Handle(r.method, r.path, append(chain, r.handler)...)
+	}
+}
+
+// metricFromPath возвращает ссылку на метрику из параметров пути /api/v1/metrics/:type/:name.
+func metricFromPath(c *gin.Context) middleware.MetricsJSON {
+	return middleware.MetricsJSON{ID: c.Param("name"), MType: middleware.MetricType(strings.ToLower(c.Param("type")))}
+}
+
+// getMetricV1Handler отвечает значением метрики в JSON.
+func (h *Handler) getMetricV1Handler(c *gin.Context) {
+	middleware.GetMetricJSON(c, h.ms, metricFromPath(c))
+}
+
+// updateMetricV1Handler обновляет метрику значением из тела запроса. Имя и тип берутся
+// из пути; если они указаны и в теле, то должны совпадать.
+func (h *Handler) updateMetricV1Handler(c *gin.Context) {
+	var metric middleware.MetricsJSON
+	if err := json.NewDecoder(c.Request.Body).Decode(&metric); err != nil {
+		middleware.WriteProblem(c, middleware.ErrInvalidJSON)
+		return
+	}
+	ref := metricFromPath(c)
+	if (metric.ID != "" && metric.ID != ref.ID) || (metric.MType != "" && !strings.EqualFold(string(metric.MType), string(ref.MType))) {
+		middleware.WriteProblem(c, invalidRequest("id and type in the body must match the path"))
+		return
+	}
+	metric.ID, metric.MType = ref.ID, ref.MType
+	middleware.UpdateMetricJSON(c, h.writer(c), metric)
+}
+
+// quantilesV1Handler отвечает оценками квантилей скетча: {"id", "type", "quantiles": {"0.5": 12}}.
+func (h *Handler) quantilesV1Handler(c *gin.Context) {
+	ref := metricFromPath(c)
+	if string(ref.MType) != service.SketchMetric {
+		middleware.WriteProblem(c, service.ErrUnsupportedType.With(errors.New("quantiles are supported only for sketch metrics")))
+		return
+	}
+	qs, err := parseQuantiles(c.Query("q"))
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	values, err := h.ms.Quantiles(ref.ID, qs)
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	quantiles := make(map[string]float64, len(qs))
+	for i, q := range qs {
+		quantiles[strconv.FormatFloat(q, 'g', -1, 64)] = values[i]
+	}
+	c.JSON(http.StatusOK, gin.H{"id": ref.ID, "type": ref.MType, "quantiles": quantiles})
+}
+
+// parseQuantiles разбирает список квантилей "0.5,0.99"; каждый должен лежать в [0, 1].
+func parseQuantiles(raw string) ([]float64, error) {
+	var qs []float64
+	for _, part := range strings.Split(raw, ",") {
+		q, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || q < 0 || q > 1 {
+			return nil, service.ErrInvalidValue.With(fmt.Errorf("invalid quantile %q", part))
+		}
+		qs = append(qs, q)
+	}
+	return qs, nil
+}
+
+// parseWindow разбирает длительность окна запроса; пустая строка — 0 (окно по умолчанию).
+func parseWindow(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return 0, invalidRequest(fmt.Sprintf("invalid window %q", raw))
+	}
+	return d, nil
+}
+
+// historyHandler отвечает точками истории метрики: {"id", "type", "resolution_ms", "samples": [{"t", "v"}]}.
+func (h *Handler) historyHandler(c *gin.Context) {
+	ref := metricFromPath(c)
+	window, err := parseWindow(c.Query("window"))
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	samples, err := h.ms.MetricHistory(string(ref.MType), ref.ID, window)
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id": ref.ID, "type": ref.MType,
+		"resolution_ms": h.ms.History.Resolution().Milliseconds(),
+		"samples":       samples,
+	})
+}
+
+// rateHandler отвечает приростом и средней скоростью counter за окно ?window.
+func (h *Handler) rateHandler(c *gin.Context) {
+	ref := metricFromPath(c)
+	if ref.MType != service.CounterMetric {
+		middleware.WriteProblem(c, service.ErrUnsupportedType.With(errors.New("rate is available only for counter metrics")))
+		return
+	}
+	window, err := parseWindow(c.Query("window"))
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	rate, err := h.ms.CounterRate(ref.ID, window)
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rate)
+}
+
+// queryHandler отвечает результатом выражения ?expr; синтаксические ошибки указывают позицию.
+// Выражение видит только метрики из области действия токена.
+func (h *Handler) queryHandler(c *gin.Context) {
+	res, err := h.ms.Query(c.Query("expr"), allowedNames(c))
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+func TestTokenAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store, err := repository.NewFileTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+	ms := &service.MetricsService{Storage: repository.NewMemStorage()}
+	require.NoError(t, ms.UpdateMetric("gauge", "app.Alloc", "1"))
+	require.NoError(t, ms.UpdateMetric("gauge", "db.Conns", "2"))
+
+	router := gin.New()
+	h := NewHandler(ms)
+	h.EnableTokenAuth(service.NewTokenService(store), testAdminKey)
+	h.SetupRoutes(router)
+	h.SetupAdminRoutes(router, testAdminKey, logrus.New())
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	issue := func(body string) service.IssuedToken {
+		w := do(http.MethodPost, APIPrefix+"/admin/tokens", testAdminKey, body)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var issued service.IssuedToken
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &issued))
+		require.NotEmpty(t, issued.Token)
+		return issued
+	}
+
+	reader := issue(`{"name":"grafana","role":"reader"}`)
+	writer := issue(`{"name":"agent-1","role":"writer","prefixes":["app."]}`)
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, APIPrefix+"/metrics", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, APIPrefix+"/metrics", "hm_unknown", "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, APIPrefix+"/openapi.json", "", "").Code, "the spec stays public")
+
+	// reader читает, но не пишет и не администрирует.
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/value/gauge/db.Conns", reader.Token, "").Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/update/gauge/db.Conns/3", reader.Token, "").Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, APIPrefix+"/admin/snapshot", reader.Token, "").Code)
+
+	// writer с префиксом видит и пишет только свои метрики.
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/update/gauge/app.Alloc/5", writer.Token, "").Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/update/gauge/db.Conns/5", writer.Token, "").Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/update/", writer.Token, `{"id":"db.Conns","type":"gauge","value":1}`).Code)
+	assert.Equal(t, http.StatusForbidden,
+		do(http.MethodPost, "/updates/", writer.Token, `[{"id":"app.A","type":"gauge","value":1},{"id":"db.B","type":"gauge","value":1}]`).Code)
+	_, err = ms.GetMetricValue("gauge", "app.A")
+	assert.Error(t, err, "a batch with a foreign metric must be rejected as a whole")
+
+	w := do(http.MethodGet, APIPrefix+"/metrics", writer.Token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "app.Alloc")
+	assert.NotContains(t, w.Body.String(), "db.Conns")
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, APIPrefix+"/metrics/gauge/db.Conns", writer.Token, "").Code)
+
+	// Управление токенами.
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, APIPrefix+"/admin/tokens", testAdminKey, `{"role":"root"}`).Code)
+	assert.Equal(t, http.StatusBadRequest,
+		do(http.MethodPost, APIPrefix+"/admin/tokens", testAdminKey, `{"role":"admin","prefixes":["app."]}`).Code)
+	admin := issue(`{"name":"ops","role":"admin"}`)
+	w = do(http.MethodGet, APIPrefix+"/admin/tokens", admin.Token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"agent-1"`)
+	assert.NotContains(t, w.Body.String(), writer.Token)
+	assert.NotContains(t, w.Body.String(), "hash")
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, APIPrefix+"/admin/tokens/"+writer.ID, admin.Token, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, APIPrefix+"/admin/tokens/"+writer.ID, admin.Token, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/update/gauge/app.Alloc/6", writer.Token, "").Code)
+}
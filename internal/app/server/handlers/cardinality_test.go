@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+func TestCardinalityLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	guard, err := service.NewCardinalityGuard(service.CardinalityLimits{MaxSeriesPerClient: 2})
+	require.NoError(t, err)
+	ms := &service.MetricsService{Storage: repository.NewMemStorage(), Cardinality: guard}
+
+	store, err := repository.NewFileTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+	tokens := service.NewTokenService(store)
+	secrets := make(map[string]string)
+	var agentA string
+	for _, name := range []string{"a", "b"} {
+		issued, err := tokens.Issue(service.TokenRequest{Name: name, Role: "writer"})
+		require.NoError(t, err)
+		secrets[name] = issued.Token
+		if name == "a" {
+			agentA = issued.ID
+		}
+	}
+
+	router := gin.New()
+	h := NewHandler(ms)
+	h.EnableTokenAuth(tokens, testAdminKey)
+	h.ClientID, err = middleware.ClientIdentity(middleware.ClientByToken, tokens, testAdminKey, nil)
+	require.NoError(t, err)
+	h.SetupRoutes(router)
+	h.SetupAdminRoutes(router, testAdminKey, logrus.New())
+
+	requests := 0
+	do := func(agent, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+secrets[agent])
+		requests++
+		req.Header.Set(middleware.AgentIDHeader, fmt.Sprintf("agent-%d", requests))
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Новый X-Agent-ID в каждом запросе не сбрасывает лимит токена.
+	assert.Equal(t, http.StatusOK, do("a", http.MethodPost, "/update/gauge/a1/1", "").Code)
+	assert.Equal(t, http.StatusOK, do("a", http.MethodPost, "/update/", `{"id":"a2","type":"gauge","value":1}`).Code)
+	w := do("a", http.MethodPost, "/update/gauge/a3/1", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+	w = do("a", http.MethodPost, APIPrefix+"/metrics/gauge/a3", `{"value":1}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), service.CodeCardinalityLimit)
+
+	// Другой агент пишет в существующие ряды и создаёт свои.
+	assert.Equal(t, http.StatusOK, do("b", http.MethodPost, "/updates/", `[{"id":"a1","type":"gauge","value":2},{"id":"b1","type":"counter","delta":1}]`).Code)
+
+	req := adminRequest(http.MethodGet, APIPrefix+"/admin/cardinality?limit=1", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var rep service.CardinalityReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rep))
+	assert.Equal(t, 3, rep.Series)
+	require.Len(t, rep.Clients, 1)
+	assert.Equal(t, service.ClientCardinality{Client: "token:" + agentA, Series: 2, Rejected: 2}, rep.Clients[0])
+}
+
+func TestCardinalityLimits_SpoofedHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	guard, err := service.NewCardinalityGuard(service.CardinalityLimits{MaxSeriesPerClient: 2})
+	require.NoError(t, err)
+	ms := &service.MetricsService{Storage: repository.NewMemStorage(), Cardinality: guard}
+
+	router := gin.New()
+	h := NewHandler(ms)
+	h.ClientID, err = middleware.ClientIdentity(middleware.ClientByToken, nil, "", nil)
+	require.NoError(t, err)
+	h.SetupRoutes(router)
+
+	// Без проверенного токена клиент — адрес, какие бы заголовки он ни присылал.
+	for i := 1; i <= 3; i++ {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/update/gauge/m%d/1", i), nil)
+		req.Header.Set(middleware.AgentIDHeader, fmt.Sprintf("agent-%d", i))
+		req.Header.Set(middleware.TokenHeader, fmt.Sprintf("forged-%d", i))
+		router.ServeHTTP(w, req)
+		want := http.StatusOK
+		if i == 3 {
+			want = http.StatusUnprocessableEntity
+		}
+		assert.Equal(t, want, w.Code, "request %d: %s", i, w.Body.String())
+	}
+	rep := guard.Report(1, ms.Storage.ListMetricInfo)
+	require.Len(t, rep.Clients, 1)
+	assert.Equal(t, service.ClientCardinality{Client: "ip:192.0.2.1", Series: 2, Rejected: 1}, rep.Clients[0])
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+func setupCompositeRouter() (*gin.Engine, *service.MetricsService) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	ms := &service.MetricsService{Storage: repository.NewMemStorage(), HistogramBuckets: []float64{0.1, 1}}
+	NewHandler(ms).SetupRoutes(router)
+	return router, ms
+}
+
+func postJSON(t *testing.T, router *gin.Engine, path string, payload any) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(payload)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHistogramUpdate(t *testing.T) {
+	router, _ := setupCompositeRouter()
+
+	v := 0.05
+	rr := postJSON(t, router, "/update/", middleware.MetricsJSON{ID: "Latency", MType: middleware.HistogramMetric, Value: &v})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	h := models.NewHistogram([]float64{0.1, 1})
+	h.Observe(0.5)
+	h.Observe(3)
+	rr = postJSON(t, router, "/update/", middleware.MetricsJSON{
+		ID: "Latency", MType: middleware.HistogramMetric,
+		CompositeFields: models.CompositeFields{Histogram: h},
+	})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var got middleware.MetricsJSON
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	require.NotNil(t, got.Histogram)
+	assert.Equal(t, uint64(3), got.Histogram.Count)
+	assert.Equal(t, []uint64{1, 1, 1}, got.Histogram.Counts)
+
+	// Другие границы корзин не объединяются с сохранённой гистограммой.
+	rr = postJSON(t, router, "/update/", middleware.MetricsJSON{
+		ID: "Latency", MType: middleware.HistogramMetric,
+		CompositeFields: models.CompositeFields{Histogram: models.NewHistogram([]float64{5})},
+	})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = postJSON(t, router, "/value/", middleware.MetricsJSON{ID: "Latency", MType: middleware.HistogramMetric})
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Equal(t, uint64(3), got.Histogram.Count)
+}
+
+func TestSummaryViaPathAndBatch(t *testing.T) {
+	router, _ := setupCompositeRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/update/summary/Size/4", nil))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	v := 2.0
+	rr = postJSON(t, router, "/updates/", []middleware.MetricsJSON{
+		{ID: "Size", MType: middleware.SummaryMetric, Value: &v},
+		{ID: "Size", MType: middleware.SummaryMetric, CompositeFields: models.CompositeFields{
+			Summary: &models.Summary{Count: 2, Sum: 10, Min: 1, Max: 9},
+		}},
+	})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/value/summary/Size", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "count=4 sum=16 min=1 max=9 avg=4", rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, strings.Contains(rr.Body.String(), ">count=4 sum=16 min=1 max=9 avg=4<"), rr.Body.String())
+}
+
+func TestCompositeSnapshotRoundTrip(t *testing.T) {
+	_, ms := setupCompositeRouter()
+	require.NoError(t, ms.UpdateMetric("histogram", "Latency", "0.5"))
+
+	data := ms.Snapshot()
+	require.Contains(t, data.Composites[models.HistogramType], "Latency")
+	require.Contains(t, data.CompositesUpdatedAt[models.HistogramType], "Latency")
+
+	items, err := data.Items()
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.NotNil(t, items[0].Histogram)
+
+	restored := &service.MetricsService{Storage: repository.NewMemStorage()}
+	require.NoError(t, restored.RestoreSnapshot(data, true))
+	c, err := restored.GetComposite(models.HistogramType, "Latency")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), c.(*models.Histogram).Count)
+}
+
+func TestSketchQuantiles(t *testing.T) {
+	router, _ := setupCompositeRouter()
+
+	// Два агента присылают сериализованные скетчи, сервер объединяет их при приёме пакета.
+	var batch []middleware.MetricsJSON
+	for agent := 0; agent < 2; agent++ {
+		s, err := models.NewSketch(0.01, 0)
+		require.NoError(t, err)
+		for i := 1; i <= 50; i++ {
+			s.Add(float64(agent*50 + i))
+		}
+		batch = append(batch, middleware.MetricsJSON{
+			ID: "Latency", MType: middleware.SketchMetric,
+			CompositeFields: models.CompositeFields{Sketch: s},
+		})
+	}
+	rr := postJSON(t, router, "/updates/", batch)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/value/sketch/Latency?q=0,0.5,1", nil))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var q0, q50, q100 float64
+	_, err := fmt.Sscanf(rr.Body.String(), "0=%g 0.5=%g 1=%g", &q0, &q50, &q100)
+	require.NoError(t, err, rr.Body.String())
+	assert.Equal(t, 1.0, q0)
+	assert.InEpsilon(t, 50.0, q50, 0.011)
+	assert.Equal(t, 100.0, q100)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/value/sketch/Latency?q=2", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/value/sketch/Missing?q=0.5", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/value/histogram/Latency?q=0.5", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Скетч с другой точностью не объединяется с сохранённым.
+	other, _ := models.NewSketch(0.05, 0)
+	other.Add(1)
+	rr = postJSON(t, router, "/update/", middleware.MetricsJSON{
+		ID: "Latency", MType: middleware.SketchMetric,
+		CompositeFields: models.CompositeFields{Sketch: other},
+	})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestSetMembersAndMerge(t *testing.T) {
+	router, _ := setupCompositeRouter()
+
+	rr := postJSON(t, router, "/update/", middleware.MetricsJSON{
+		ID: "Users", MType: middleware.SetMetric, Members: []string{"alice", "bob", "alice"},
+	})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/update/set/Users/carol", nil))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// Агент присылает сериализованный скетч другой точности: сервер понижает точность при объединении.
+	agent, err := models.NewSet(10)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		agent.Add(fmt.Sprintf("user-%d", i))
+	}
+	rr = postJSON(t, router, "/updates/", []middleware.MetricsJSON{
+		{ID: "Users", MType: middleware.SetMetric, CompositeFields: models.CompositeFields{Set: agent}},
+		{ID: "Users", MType: middleware.SetMetric, Members: []string{"bob", "dave"}},
+	})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	rr = postJSON(t, router, "/value/", middleware.MetricsJSON{ID: "Users", MType: middleware.SetMetric})
+	require.Equal(t, http.StatusOK, rr.Code)
+	var got struct {
+		Set struct {
+			Precision     uint8   `json:"precision"`
+			Estimate      uint64  `json:"estimate"`
+			RelativeError float64 `json:"relative_error"`
+		} `json:"set"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Equal(t, uint8(10), got.Set.Precision)
+	assert.InDelta(t, 104, got.Set.Estimate, 5)
+	assert.Greater(t, got.Set.RelativeError, 0.0)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/value/set/Users", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, strings.HasPrefix(rr.Body.String(), "estimate="), rr.Body.String())
+	assert.Contains(t, rr.Body.String(), "error=3.25%")
+
+	// Число вместо элементов для set не принимается.
+	v := 1.0
+	rr = postJSON(t, router, "/update/", middleware.MetricsJSON{ID: "Users", MType: middleware.SetMetric, Value: &v})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+// Дашборд — встроенные HTML-страницы со списком метрик и страницей одной метрики.
+// Страницы рендерятся на сервере; встроенный скрипт добавляет сортировку, поиск
+// и автообновление (перезапрашивает ту же страницу и заменяет содержимое),
+// поэтому форматирование значений существует в одном месте, а внешние ресурсы не нужны.
+
+// unit — единица измерения значения метрики.
+type unit int
+
+const (
+	unitNone unit = iota
+	unitBytes
+	// unitPercent — значение уже в процентах (0..100).
+	unitPercent
+	// unitFraction — доля 0..1, выводится в процентах.
+	unitFraction
+	unitNanoseconds
+)
+
+// exactUnits — единицы метрик агента, которые не выводятся из суффикса имени.
+var exactUnits = map[string]unit{
+	"GCCPUFraction": unitFraction,
+	"NextGC":        unitBytes,
+	"PauseTotalNs":  unitNanoseconds,
+}
+
+// suffixUnits — единицы по суффиксу имени: HeapAlloc, StackSys, TotalMemory, ...
+var suffixUnits = []struct {
+	suffix string
+	unit   unit
+}{
+	{"Bytes", unitBytes}, {"Memory", unitBytes}, {"Sys", unitBytes}, {"Alloc", unitBytes},
+	{"Inuse", unitBytes}, {"Idle", unitBytes}, {"Released", unitBytes},
+	{"Percent", unitPercent}, {"Fraction", unitFraction}, {"Ratio", unitFraction}, {"Ns", unitNanoseconds},
+}
+
+// metricUnit угадывает единицу измерения по имени метрики.
+func metricUnit(name string) unit {
+	if u, ok := exactUnits[name]; ok {
+		return u
+	}
+	if strings.HasPrefix(name, "CPUutilization") {
+		return unitPercent
+	}
+	for _, s := range suffixUnits {
+		if strings.HasSuffix(name, s.suffix) {
+			return s.unit
+		}
+	}
+	return unitNone
+}
+
+var byteUnits = []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// formatValue выводит число с учётом единицы: "1.5 MiB", "42.0%", "1.25ms".
+func formatValue(v float64, u unit) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	switch u {
+	case unitBytes:
+		if math.Abs(v) < 1024 {
+			return strconv.FormatFloat(v, 'f', -1, 64) + " B"
+		}
+		i := -1
+		for math.Abs(v) >= 1024 && i < len(byteUnits)-1 {
+			v /= 1024
+			i++
+		}
+		return strconv.FormatFloat(v, 'f', 1, 64) + " " + byteUnits[i]
+	case unitPercent:
+		return strconv.FormatFloat(v, 'f', 1, 64) + "%"
+	case unitFraction:
+		return strconv.FormatFloat(v*100, 'f', 2, 64) + "%"
+	case unitNanoseconds:
+		d := time.Duration(v)
+		switch {
+		case d >= time.Second:
+			d = d.Round(time.Millisecond)
+		case d >= time.Millisecond:
+			d = d.Round(time.Microsecond)
+		}
+		return d.String()
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// dashboardRow — строка списка метрик.
+type dashboardRow struct {
+	Type  string
+	Name  string
+	Value string
+	// Raw — точное значение без единиц (подсказка к ячейке).
+	Raw string
+	// Sort — числовое значение для сортировки; пусто у составных метрик.
+	Sort    string
+	Updated time.Time
+	Link    string
+}
+
+func newDashboardRow(e models.MetricEntry) dashboardRow {
+	row := dashboardRow{
+		Type:    e.MType,
+		Name:    e.ID,
+		Updated: e.UpdatedAt,
+		Link:    "/dashboard/" + url.PathEscape(e.MType) + "/" + url.PathEscape(e.ID),
+	}
+	var v float64
+	switch {
+	case e.Value != nil:
+		v = *e.Value
+		row.Raw = strconv.FormatFloat(v, 'g', -1, 64)
+	case e.Delta != nil:
+		v = float64(*e.Delta)
+		row.Raw = strconv.FormatInt(*e.Delta, 10)
+	default:
+		if c, ok := e.Composite(e.MType); ok {
+			row.Value = c.String()
+			row.Raw = row.Value
+		}
+		return row
+	}
+	row.Value = formatValue(v, metricUnit(e.ID))
+	row.Sort = row.Raw
+	return row
+}
+
+// dashboardPage — данные страницы списка метрик.
+type dashboardPage struct {
+	Rows  []dashboardRow
+	Types []string
+	Now   time.Time
+}
+
+// dashboardHandler отдаёт страницу со списком метрик.
+func (h *Handler) dashboardHandler(c *gin.Context) {
+	entries := h.ms.ListMetrics()
+	page := dashboardPage{Rows: make([]dashboardRow, 0, len(entries)), Now: time.Now().UTC()}
+	seen := make(map[string]bool)
+	allow := allowedNames(c)
+	for _, e := range entries {
+		if allow != nil && !allow(e.ID) {
+			continue
+		}
+		page.Rows = append(page.Rows, newDashboardRow(e))
+		if !seen[e.MType] {
+			seen[e.MType] = true
+			page.Types = append(page.Types, e.MType)
+		}
+	}
+	renderPage(c, http.StatusOK, "dashboard.html", page)
+}
+
+// detail — поле составной метрики на странице метрики.
+type detail struct {
+	Name, Value string
+}
+
+// bucketBar — корзина гистограммы; Percent — доля от самой полной корзины.
+type bucketBar struct {
+	Label   string
+	Count   uint64
+	Percent float64
+}
+
+// sparkline — график истории метрики в виде SVG-ломаной.
+type sparkline struct {
+	Width, Height int
+	Points        string
+	Min, Max      string
+	From, To      time.Time
+	Count         int
+}
+
+// Размер графика в единицах viewBox.
+const (
+	sparklineWidth  = 600
+	sparklineHeight = 120
+)
+
+// newSparkline строит ломаную по точкам истории; для одной точки рисуется горизонтальная линия.
+func newSparkline(samples []service.Sample, u unit) *sparkline {
+	if len(samples) == 0 {
+		return nil
+	}
+	lo, hi := samples[0].Value, samples[0].Value
+	for _, s := range samples {
+		lo, hi = math.Min(lo, s.Value), math.Max(hi, s.Value)
+	}
+	from, to := samples[0].Time, samples[len(samples)-1].Time
+	y := func(v float64) float64 {
+		if hi == lo {
+			return sparklineHeight / 2
+		}
+		return (1 - (v-lo)/(hi-lo)) * sparklineHeight
+	}
+	var points string
+	if span := to.Sub(from); span <= 0 {
+		// Одна точка (или все в один момент): горизонтальная линия через весь график.
+		points = fmt.Sprintf("0,%.1f %d,%.1f", y(samples[len(samples)-1].Value), sparklineWidth, y(samples[len(samples)-1].Value))
+	} else {
+		parts := make([]string, len(samples))
+		for i, s := range samples {
+			x := float64(s.Time.Sub(from)) / float64(span) * sparklineWidth
+			parts[i] = fmt.Sprintf("%.1f,%.1f", x, y(s.Value))
+		}
+		points = strings.Join(parts, " ")
+	}
+	return &sparkline{
+		Width: sparklineWidth, Height: sparklineHeight,
+		Points: points,
+		Min:    formatValue(lo, u), Max: formatValue(hi, u),
+		From: from.UTC(), To: to.UTC(),
+		Count: len(samples),
+	}
+}
+
+// metricPage — данные страницы одной метрики.
+type metricPage struct {
+	Row     dashboardRow
+	Details []detail
+	Buckets []bucketBar
+	Spark   *sparkline
+	// HistoryNote объясняет отсутствие графика.
+	HistoryNote string
+	Now         time.Time
+}
+
+// metricPageHandler отдаёт страницу одной метрики: значение, поля составной метрики
+// и график по истории, если сервер её ведёт.
+func (h *Handler) metricPageHandler(c *gin.Context) {
+	mtype, name := strings.ToLower(c.Param("type")), c.Param("name")
+	var (
+		entry models.MetricEntry
+		found bool
+	)
+	for _, e := range h.ms.ListMetrics() {
+		if e.MType == mtype && e.ID == name {
+			entry, found = e, true
+			break
+		}
+	}
+	if !found {
+		renderPage(c, http.StatusNotFound, "notfound.html", gin.H{"Type": mtype, "Name": name})
+		return
+	}
+
+	page := metricPage{Row: newDashboardRow(entry), Now: time.Now().UTC()}
+	if comp, ok := entry.Composite(mtype); ok {
+		page.Details, page.Buckets = compositeDetails(comp)
+	}
+	samples, err := h.ms.MetricHistory(mtype, name, 0)
+	switch {
+	case errors.Is(err, service.ErrHistoryDisabled):
+		page.HistoryNote = "History is disabled on this server."
+	case err != nil:
+		page.HistoryNote = "History is kept only for gauge and counter metrics."
+	default:
+		page.Spark = newSparkline(samples, metricUnit(name))
+		if page.Spark == nil {
+			page.HistoryNote = "No history yet."
+		}
+	}
+	renderPage(c, http.StatusOK, "metric.html", page)
+}
+
+// compositeDetails раскладывает краткое представление составной метрики ("count=3 sum=0.6 ...")
+// на поля; для гистограммы дополнительно возвращает корзины.
+func compositeDetails(c models.Composite) ([]detail, []bucketBar) {
+	var details []detail
+	for _, field := range strings.Fields(c.String()) {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		// Кумулятивные корзины гистограммы показываются отдельно.
+		if _, isHist := c.(*models.Histogram); isHist && k != "count" && k != "sum" {
+			continue
+		}
+		details = append(details, detail{Name: k, Value: v})
+	}
+
+	hist, ok := c.(*models.Histogram)
+	if !ok {
+		return details, nil
+	}
+	var top uint64
+	for _, n := range hist.Counts {
+		top = max(top, n)
+	}
+	bars := make([]bucketBar, len(hist.Counts))
+	for i, n := range hist.Counts {
+		label := "+Inf"
+		if i < len(hist.Bounds) {
+			label = "≤ " + strconv.FormatFloat(hist.Bounds[i], 'g', -1, 64)
+		}
+		bars[i] = bucketBar{Label: label, Count: n}
+		if top > 0 {
+			bars[i].Percent = float64(n) / float64(top) * 100
+		}
+	}
+	return details, bars
+}
+
+// renderPage выполняет шаблон страницы дашборда. Страница собирается в буфер,
+// чтобы ошибка шаблона не оставила клиенту половину документа.
+func renderPage(c *gin.Context, status int, name string, data any) {
+	var buf bytes.Buffer
+	if err := getTemplate().ExecuteTemplate(&buf, name, data); err != nil {
+		c.String(http.StatusInternalServerError, "Error rendering template")
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
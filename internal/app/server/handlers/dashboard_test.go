@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+func TestFormatValue(t *testing.T) {
+	cases := []struct {
+		name string
+		v    float64
+		want string
+	}{
+		{"HeapAlloc", 1536 * 1024, "1.5 MiB"},
+		{"StackSys", 512, "512 B"},
+		{"TotalMemory", 8 << 30, "8.0 GiB"},
+		{"CPUutilization3", 42.25, "42.2%"},
+		{"GCCPUFraction", 0.0123, "1.23%"},
+		{"PauseTotalNs", 1234567, "1.235ms"},
+		{"HeapObjects", 1200, "1200"},
+		{"RandomValue", 0.5, "0.5"},
+	}
+	for _, tc := range cases {
+		if got := formatValue(tc.v, metricUnit(tc.name)); got != tc.want {
+			t.Errorf("%s=%g: expected %q, got %q", tc.name, tc.v, tc.want, got)
+		}
+	}
+}
+
+func TestNewSparkline(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newSparkline([]service.Sample{
+		{Time: t0, Value: 1},
+		{Time: t0.Add(time.Minute), Value: 3},
+		{Time: t0.Add(2 * time.Minute), Value: 2},
+	}, unitNone)
+	require.NotNil(t, s)
+	assert.Equal(t, "0.0,120.0 300.0,0.0 600.0,60.0", s.Points)
+	assert.Equal(t, "1", s.Min)
+	assert.Equal(t, "3", s.Max)
+
+	s = newSparkline([]service.Sample{{Time: t0, Value: 5}}, unitNone)
+	assert.Equal(t, "0,60.0 600,60.0", s.Points)
+	assert.Nil(t, newSparkline(nil, unitNone))
+}
+
+func TestMetricPage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &service.MetricsService{Storage: repository.NewMemStorage(), History: service.NewHistory(10, time.Millisecond)}
+	router := gin.New()
+	NewHandler(ms).SetupRoutes(router)
+
+	require.NoError(t, ms.UpdateMetric("gauge", "HeapAlloc", "1024"))
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, ms.UpdateMetric("gauge", "HeapAlloc", "2048"))
+	require.NoError(t, ms.UpdateMetric("histogram", "Latency", "0.3"))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/dashboard/gauge/HeapAlloc")
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "2.0 KiB")
+	assert.Contains(t, body, "<polyline")
+	assert.Contains(t, body, "2 points")
+	assert.NotContains(t, body, "https://", "dashboard must not load external resources")
+
+	w = get("/dashboard/histogram/Latency")
+	require.Equal(t, http.StatusOK, w.Code)
+	body = w.Body.String()
+	assert.Contains(t, body, "<dt>count</dt><dd>1</dd>")
+	assert.Contains(t, body, `class="bar" style="width: 100.0%"`)
+	assert.Contains(t, body, "History is kept only for gauge and counter metrics.")
+
+	w = get("/dashboard/gauge/Missing")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "does not exist")
+}
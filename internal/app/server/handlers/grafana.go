@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+// GrafanaPrefix — префикс маршрутов, совместимых с источником данных Grafana JSON (SimpleJSON).
+const GrafanaPrefix = "/grafana"
+
+// Цель запроса Grafana имеет вид "[тип:]шаблон", например "gauge:CPUutilization*" или "Alloc".
+// Без типа подходят gauge и counter — только у них есть числовые ряды.
+
+// grafanaRange — интервал времени панели.
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type grafanaTarget struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	// Type — "timeserie" (по умолчанию) или "table".
+	Type string `json:"type"`
+}
+
+type grafanaQuery struct {
+	Range         grafanaRange    `json:"range"`
+	MaxDataPoints int             `json:"maxDataPoints"`
+	Targets       []grafanaTarget `json:"targets"`
+}
+
+// grafanaSeries — временной ряд ответа: точки [значение, время в мс].
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type grafanaTable struct {
+	Type    string          `json:"type"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]any         `json:"rows"`
+}
+
+type grafanaAnnotationQuery struct {
+	Range      grafanaRange `json:"range"`
+	Annotation struct {
+		Name  string `json:"name"`
+		Query string `json:"query"`
+	} `json:"annotation"`
+}
+
+// setupGrafanaRoutes регистрирует маршруты источника данных Grafana JSON:
+// проверку подключения, поиск метрик, запрос рядов и аннотации.
+func (h *Handler) setupGrafanaRoutes(router *gin.Engine) {
+	g := router.Group(GrafanaPrefix, h.guard(models.RoleReader)...)
+	g.GET("/", func(c *gin.Context) { c.String(http.StatusOK, "OK") })
+	g.POST("/search", h.grafanaSearchHandler)
+	g.POST("/query", h.grafanaQueryHandler)
+	g.POST("/annotations", h.grafanaAnnotationsHandler)
+}
+
+// parseGrafanaTarget разбирает цель "[тип:]шаблон" в параметры списка метрик.
+func parseGrafanaTarget(target string) (service.ListOptions, error) {
+	target = strings.TrimSpace(target)
+	opts := service.ListOptions{Types: []string{service.GaugeMetric, service.CounterMetric}}
+	if mtype, name, ok := strings.Cut(target, ":"); ok {
+		mtype = strings.ToLower(strings.TrimSpace(mtype))
+		if mtype != service.GaugeMetric && mtype != service.CounterMetric && !models.IsComposite(mtype) {
+			return opts, service.ErrUnsupportedType.With(fmt.Errorf("unsupported type %q in target %q", mtype, target))
+		}
+		opts.Types, target = []string{mtype}, strings.TrimSpace(name)
+	}
+	if target == "" {
+		target = "*"
+	}
+	opts.Name = target
+	return opts, nil
+}
+
+// grafanaTargetName возвращает цель "тип:имя" метрики. Тип различает gauge и counter
+// с одним именем; parseGrafanaTarget разбирает цель обратно.
+func grafanaTargetName(e models.MetricEntry) string {
+	return e.MType + ":" + e.ID
+}
+
+// grafanaSearchHandler отвечает списком целей "тип:имя". Поле target запроса —
+// подстрока или шаблон имени; пустое значение возвращает все метрики.
+func (h *Handler) grafanaSearchHandler(c *gin.Context) {
+	var req struct {
+		Target string `json:"target"`
+	}
+	if err := decodeOptionalJSON(c, &req); err != nil {
+		middleware.WriteProblem(c, middleware.ErrInvalidJSON)
+		return
+	}
+	filter := strings.TrimSpace(req.Target)
+	if filter != "" && !strings.ContainsAny(filter, "*?[:") {
+		filter = "*" + filter + "*"
+	}
+	opts, err := parseGrafanaTarget(filter)
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	if !strings.Contains(filter, ":") {
+		opts.Types = nil
+	}
+	opts.Allow = allowedNames(c)
+	page, err := h.ms.QueryMetrics(opts)
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	targets := make([]string, 0, len(page.Items))
+	for _, e := range page.Items {
+		targets = append(targets, grafanaTargetName(e))
+	}
+	c.JSON(http.StatusOK, targets)
+}
+
+// grafanaQueryHandler отвечает рядами (или таблицами) для целей панели.
+// Точки рядов берутся из истории сервера; если истории нет, ряд состоит из текущего значения.
+func (h *Handler) grafanaQueryHandler(c *gin.Context) {
+	var req grafanaQuery
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		middleware.WriteProblem(c, middleware.ErrInvalidJSON)
+		return
+	}
+	now := time.Now()
+	if req.Range.To.IsZero() {
+		req.Range.To = now
+	}
+
+	result := make([]any, 0, len(req.Targets))
+	for _, t := range req.Targets {
+		opts, err := parseGrafanaTarget(t.Target)
+		if err != nil {
+			middleware.WriteProblem(c, err)
+			return
+		}
+		opts.Allow = allowedNames(c)
+		page, err := h.ms.QueryMetrics(opts)
+		if err != nil {
+			middleware.WriteProblem(c, err)
+			return
+		}
+		if t.Type == "table" {
+			result = append(result, grafanaMetricsTable(page.Items))
+			continue
+		}
+		for _, e := range page.Items {
+			points, err := h.grafanaPoints(e, req.Range, now)
+			if err != nil {
+				middleware.WriteProblem(c, err)
+				return
+			}
+			result = append(result, grafanaSeries{Target: grafanaTargetName(e), Datapoints: downsample(points, req.MaxDataPoints)})
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// grafanaPoints возвращает точки метрики в интервале r. Составные метрики рядов не имеют.
+func (h *Handler) grafanaPoints(e models.MetricEntry, r grafanaRange, now time.Time) ([][2]float64, error) {
+	var current float64
+	switch {
+	case e.Value != nil:
+		current = *e.Value
+	case e.Delta != nil:
+		current = float64(*e.Delta)
+	default:
+		return [][2]float64{}, nil
+	}
+
+	samples, err := h.ms.MetricHistory(e.MType, e.ID, 0)
+	switch {
+	case errors.Is(err, service.ErrHistoryDisabled), errors.Is(err, service.ErrMetricNotFound):
+		samples = nil
+	case err != nil:
+		return nil, err
+	}
+	points := make([][2]float64, 0, len(samples)+1)
+	for _, s := range samples {
+		if !s.Time.Before(r.From) && !s.Time.After(r.To) {
+			points = append(points, [2]float64{s.Value, float64(s.Time.UnixMilli())})
+		}
+	}
+	if len(samples) == 0 && !now.Before(r.From) && !now.After(r.To) {
+		points = append(points, [2]float64{current, float64(now.UnixMilli())})
+	}
+	return points, nil
+}
+
+// downsample прореживает ряд до limit точек, оставляя последнюю точку каждой группы.
+func downsample(points [][2]float64, limit int) [][2]float64 {
+	if limit <= 0 || len(points) <= limit {
+		return points
+	}
+	step := (len(points) + limit - 1) / limit
+	out := make([][2]float64, 0, limit)
+	for end := step; ; end += step {
+		if end >= len(points) {
+			return append(out, points[len(points)-1])
+		}
+		out = append(out, points[end-1])
+	}
+}
+
+// grafanaMetricsTable выводит метрики таблицей: тип, имя, значение и время обновления.
+func grafanaMetricsTable(entries []models.MetricEntry) grafanaTable {
+	table := grafanaTable{
+		Type: "table",
+		Columns: []grafanaColumn{
+			{Text: "Type", Type: "string"}, {Text: "Name", Type: "string"},
+			{Text: "Value", Type: "string"}, {Text: "Updated", Type: "time"},
+		},
+		Rows: make([][]any, 0, len(entries)),
+	}
+	for _, e := range entries {
+		row := newDashboardRow(e)
+		table.Rows = append(table.Rows, []any{e.MType, e.ID, row.Raw, e.UpdatedAt.UnixMilli()})
+	}
+	return table
+}
+
+// grafanaAnnotationsHandler отмечает на графиках удаления метрик и восстановления снимков
+// из истории событий сервера. Запрос аннотации — цель "[тип:]шаблон" для отбора удалений.
+func (h *Handler) grafanaAnnotationsHandler(c *gin.Context) {
+	var req grafanaAnnotationQuery
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		middleware.WriteProblem(c, middleware.ErrInvalidJSON)
+		return
+	}
+	type annotation struct {
+		Annotation any      `json:"annotation"`
+		Time       int64    `json:"time"`
+		Title      string   `json:"title"`
+		Text       string   `json:"text,omitempty"`
+		Tags       []string `json:"tags"`
+	}
+	annotations := []annotation{}
+	if h.ms.Events == nil {
+		c.JSON(http.StatusOK, annotations)
+		return
+	}
+	opts, err := parseGrafanaTarget(req.Annotation.Query)
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	if !strings.Contains(req.Annotation.Query, ":") {
+		opts.Types = nil
+	}
+	match, err := service.EventFilter(opts.Types, opts.Name, "")
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	match = allowedEvents(c, match)
+	events := h.ms.Events.Recent(func(e service.Event) bool {
+		if e.Kind == service.EventUpdate || e.Time.Before(req.Range.From) {
+			return false
+		}
+		if !req.Range.To.IsZero() && e.Time.After(req.Range.To) {
+			return false
+		}
+		return match(e)
+	})
+	for _, e := range events {
+		a := annotation{Annotation: req.Annotation, Time: e.Time.UnixMilli(), Tags: []string{e.Kind}}
+		if e.Kind == service.EventReset {
+			a.Title = "metrics restored from a snapshot"
+		} else {
+			a.Title = fmt.Sprintf("%s %s deleted", e.Metric.MType, e.Metric.ID)
+			a.Tags = append(a.Tags, string(e.Metric.MType))
+		}
+		annotations = append(annotations, a)
+	}
+	c.JSON(http.StatusOK, annotations)
+}
+
+// decodeOptionalJSON разбирает тело запроса, если оно есть.
+func decodeOptionalJSON(c *gin.Context, v any) error {
+	err := json.NewDecoder(c.Request.Body).Decode(v)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
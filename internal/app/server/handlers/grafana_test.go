@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+func TestGrafanaDatasource(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &service.MetricsService{
+		Storage: repository.NewMemStorage(),
+		History: service.NewHistory(10, time.Nanosecond),
+		Events:  service.NewBroker(0),
+	}
+	router := gin.New()
+	NewHandler(ms).SetupRoutes(router)
+
+	require.NoError(t, ms.UpdateMetric("gauge", "CPU1", "10"))
+	require.NoError(t, ms.UpdateMetric("gauge", "CPU1", "20"))
+	require.NoError(t, ms.UpdateMetric("gauge", "CPU2", "5"))
+	require.NoError(t, ms.UpdateMetric("counter", "PollCount", "3"))
+	require.NoError(t, ms.UpdateMetric("histogram", "Latency", "0.3"))
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/grafana/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = post("/grafana/search", `{"target":"cpu"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String(), "search is case-sensitive like the rest of the API")
+	w = post("/grafana/search", `{"target":"CPU"}`)
+	assert.JSONEq(t, `["gauge:CPU1","gauge:CPU2"]`, w.Body.String())
+	w = post("/grafana/search", ``)
+	assert.JSONEq(t, `["counter:PollCount","gauge:CPU1","gauge:CPU2","histogram:Latency"]`, w.Body.String())
+
+	from := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339Nano)
+	to := time.Now().Add(time.Minute).UTC().Format(time.RFC3339Nano)
+	rng := fmt.Sprintf(`"range":{"from":%q,"to":%q}`, from, to)
+
+	w = post("/grafana/query", `{`+rng+`,"maxDataPoints":100,"targets":[{"target":"gauge:CPU*","refId":"A"},{"target":"PollCount","refId":"B"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var series []grafanaSeries
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &series))
+	require.Len(t, series, 3)
+	assert.Equal(t, "gauge:CPU1", series[0].Target)
+	require.Len(t, series[0].Datapoints, 2)
+	assert.Equal(t, 20.0, series[0].Datapoints[1][0])
+	assert.Equal(t, "counter:PollCount", series[2].Target)
+
+	// gauge и counter с одним именем — разные ряды; цель из ответа запрашивает ровно один из них.
+	require.NoError(t, ms.UpdateMetric("counter", "CPU1", "7"))
+	w = post("/grafana/query", `{`+rng+`,"targets":[{"target":"CPU1"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	series = nil
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &series))
+	require.Len(t, series, 2)
+	assert.ElementsMatch(t, []string{"counter:CPU1", "gauge:CPU1"}, []string{series[0].Target, series[1].Target})
+	w = post("/grafana/query", `{`+rng+`,"targets":[{"target":"counter:CPU1"}]}`)
+	series = nil
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &series))
+	require.Len(t, series, 1)
+	assert.Equal(t, "counter:CPU1", series[0].Target)
+	assert.Equal(t, 7.0, series[0].Datapoints[len(series[0].Datapoints)-1][0])
+	require.NoError(t, ms.DeleteMetric("counter", "CPU1"))
+
+	w = post("/grafana/query", `{`+rng+`,"targets":[{"target":"histogram:*","type":"table"}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var tables []grafanaTable
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tables))
+	require.Len(t, tables, 1)
+	require.Len(t, tables[0].Rows, 1)
+	assert.Equal(t, "Latency", tables[0].Rows[0][1])
+
+	w = post("/grafana/query", `{`+rng+`,"targets":[{"target":"bogus:x"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = post("/grafana/query", `{`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	require.NoError(t, ms.DeleteMetric("gauge", "CPU2"))
+	require.NoError(t, ms.DeleteMetric("counter", "PollCount"))
+	w = post("/grafana/annotations", `{`+rng+`,"annotation":{"name":"deletes","query":"gauge:*"}}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var annotations []struct {
+		Title string   `json:"title"`
+		Tags  []string `json:"tags"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &annotations))
+	require.Len(t, annotations, 1)
+	assert.Equal(t, "gauge CPU2 deleted", annotations[0].Title)
+	assert.Equal(t, []string{service.EventDelete, "gauge"}, annotations[0].Tags)
+}
+
+func TestDownsample(t *testing.T) {
+	points := make([][2]float64, 10)
+	for i := range points {
+		points[i] = [2]float64{float64(i), float64(i)}
+	}
+	got := downsample(points, 3)
+	require.Len(t, got, 3)
+	assert.Equal(t, [][2]float64{{3, 3}, {7, 7}, {9, 9}}, got)
+	assert.Len(t, downsample(points, 0), 10)
+}
@@ -2,23 +2,46 @@ package handlers
 
 import (
 	"embed"
+	"errors"
 	"html/template"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
 	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
 )
 
-// Встроенные html-шаблоны страницы метрик.
+// Встроенные html-шаблоны дашборда.
 //
 //go:embed template/*.html
 var templatesFS embed.FS
 
 type Handler struct {
 	ms *service.MetricsService
+
+	// StreamHeartbeat — период пульса в потоке /api/v1/stream (0 — DefaultStreamHeartbeat).
+	StreamHeartbeat time.Duration
+	// ClientID определяет клиента, за которым учитываются созданные им ряды
+	// (см. middleware.ClientIdentity; nil — по адресу клиента). Клиент не должен
+	// зависеть от заголовков, которые он может менять, — иначе лимит легко сбросить.
+	ClientID func(c *gin.Context) string
+	// Alerts — оповещения и заглушки (nil — оповещения выключены).
+	Alerts *service.Alerting
+
+	// tokens и authorize заданы, если включена аутентификация по API-токенам (см. EnableTokenAuth).
+	tokens    *service.TokenService
+	authorize func(role models.Role) gin.HandlerFunc
+
+	// Документ OpenAPI строится при первом запросе.
+	openAPIOnce sync.Once
+	openAPIDoc  []byte
+	openAPIErr  error
 }
 
 // Handler предоставляет HTTP-обработчики для работы с метриками.
@@ -27,15 +50,60 @@ func NewHandler(ms *service.MetricsService) *Handler {
 	return &Handler{ms: ms}
 }
 
-// SetupRoutes регистрирует HTTP-маршруты сервиса метрик.
+// EnableTokenAuth включает аутентификацию по API-токенам на всех маршрутах, кроме документа
+// OpenAPI. Ключ администратора adminKey действует как токен роли admin.
+// Вызывается до SetupRoutes и SetupAdminRoutes.
+func (h *Handler) EnableTokenAuth(tokens *service.TokenService, adminKey string) {
+	h.tokens = tokens
+	h.authorize = func(role models.Role) gin.HandlerFunc {
+		return middleware.TokenAuthMiddleware(tokens, adminKey, role)
+	}
+}
+
+// guard возвращает проверку токена роли role; без аутентификации по токенам — пустой список.
+func (h *Handler) guard(role models.Role) []gin.HandlerFunc {
+	if h.authorize == nil {
+		return nil
+	}
+	return []gin.HandlerFunc{h.authorize(role)}
+}
+
+// writer возвращает сервис, который пишет от имени клиента запроса c: учитывает
+// за ним новые ряды и передаёт его правилам переразметки.
+func (h *Handler) writer(c *gin.Context) *service.MetricsService {
+	if h.ms.Cardinality == nil && h.ms.Relabel == nil {
+		return h.ms
+	}
+	if h.ClientID == nil {
+		return h.ms.ForClient("ip:" + c.ClientIP())
+	}
+	return h.ms.ForClient(h.ClientID(c))
+}
+
+// SetupRoutes регистрирует HTTP-маршруты сервиса метрик: операции /api/v1, документ OpenAPI
+// и прежние маршруты, которые остаются тонкими псевдонимами тех же обработчиков.
 func (h *Handler) SetupRoutes(router *gin.Engine) {
-	router.POST("/update/:type/:name/:value", h.updateHandler)
-	router.GET("/value/:type/:name", h.getValueHandler)
-	router.GET("/", h.getAllMetricsHandler)
+	h.registerAPIRoutes(router, false)
+	router.GET(APIPrefix+"/openapi.json", h.openAPIHandler)
+
+	read := router.Group("", h.guard(models.RoleReader)...)
+	write := router.Group("", h.guard(models.RoleWriter)...)
+
+	write.POST("/update/:type/:name/:value", h.updateHandler)
+	read.GET("/value/:type/:name", h.getValueHandler)
+	read.GET("/", h.dashboardHandler)
+	read.GET("/dashboard/:type/:name", h.metricPageHandler)
+	h.setupGrafanaRoutes(router)
 
-	router.POST("/update/", middleware.JSONUpdateMiddleware(h.ms))
-	router.POST("/value/", middleware.JSONValueMiddleware(h.ms))
-	router.POST("/updates/", h.updateBatchHandler)
+	write.POST("/update/", h.updateJSONHandler)
+	read.POST("/value/", middleware.JSONValueMiddleware(h.ms))
+	write.POST("/updates/", h.updateBatchHandler)
+	read.POST("/values/", h.valuesBatchHandler)
+}
+
+// updateJSONHandler обрабатывает POST /update/ от имени клиента запроса.
+func (h *Handler) updateJSONHandler(c *gin.Context) {
+	middleware.JSONUpdateMiddleware(h.writer(c))(c)
 }
 
 // updateHandler обрабатывает обновление одной метрики через path-параметры.
@@ -44,9 +112,9 @@ func (h *Handler) updateHandler(c *gin.Context) {
 	metricName := c.Param("name")
 	metricValue := c.Param("value")
 
-	err := h.ms.UpdateMetric(metricType, metricName, metricValue)
+	err := h.writer(c).UpdateMetric(metricType, metricName, metricValue)
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		writeLegacyError(c, err, updateErrorStatus(err), err.Error())
 		return
 	}
 
@@ -54,27 +122,92 @@ func (h *Handler) updateHandler(c *gin.Context) {
 }
 
 // getValueHandler возвращает значение одной метрики по типу и имени.
+// Для скетча параметр ?q=0.5,0.99 возвращает оценки квантилей вида "0.5=12 0.99=40".
 func (h *Handler) getValueHandler(c *gin.Context) {
 	metricType := c.Param("type")
 	metricName := c.Param("name")
 
+	if q, ok := c.GetQuery("q"); ok {
+		h.quantilesHandler(c, metricType, metricName, q)
+		return
+	}
+	if w, ok := c.GetQuery("rate"); ok {
+		h.counterRateHandler(c, metricType, metricName, w, false)
+		return
+	}
+	if w, ok := c.GetQuery("increase"); ok {
+		h.counterRateHandler(c, metricType, metricName, w, true)
+		return
+	}
+
 	value, err := h.ms.GetMetricValue(metricType, metricName)
 	if err != nil {
-		c.Status(http.StatusNotFound)
+		writeLegacyError(c, err, http.StatusNotFound, "")
 		return
 	}
 
 	c.String(http.StatusOK, value)
 }
 
-// getAllMetricsHandler возвращает HTML-страницу со всеми метриками.
-func (h *Handler) getAllMetricsHandler(c *gin.Context) {
-	metrics := h.ms.GetAllMetrics()
+// quantilesHandler отвечает оценками квантилей скетча в порядке запроса.
+func (h *Handler) quantilesHandler(c *gin.Context, metricType, metricName, rawQs string) {
+	if strings.ToLower(metricType) != service.SketchMetric {
+		err := service.ErrUnsupportedType.With(errors.New("quantiles are supported only for sketch metrics"))
+		writeLegacyError(c, err, http.StatusBadRequest, err.Error())
+		return
+	}
+	qs, err := parseQuantiles(rawQs)
+	if err != nil {
+		writeLegacyError(c, err, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	values, err := h.ms.Quantiles(metricName, qs)
+	switch {
+	case errors.Is(err, service.ErrMetricNotFound):
+		writeLegacyError(c, err, http.StatusNotFound, "")
+		return
+	case err != nil:
+		writeLegacyError(c, err, http.StatusBadRequest, err.Error())
+		return
+	}
+	parts := make([]string, len(qs))
+	for i, q := range qs {
+		parts[i] = strconv.FormatFloat(q, 'g', -1, 64) + "=" + strconv.FormatFloat(values[i], 'g', -1, 64)
+	}
+	c.String(http.StatusOK, strings.Join(parts, " "))
+}
 
-	c.Header("Content-Type", "text/html")
-	if err := getTemplate().Execute(c.Writer, metrics); err != nil {
-		c.String(http.StatusInternalServerError, "Error rendering template")
+// counterRateHandler отвечает скоростью counter в секунду или, если increase, приростом
+// за окно rawWindow (пусто — окно по умолчанию).
+func (h *Handler) counterRateHandler(c *gin.Context, metricType, metricName, rawWindow string, increase bool) {
+	if strings.ToLower(metricType) != service.CounterMetric {
+		err := service.ErrUnsupportedType.With(errors.New("rate is available only for counter metrics"))
+		writeLegacyError(c, err, http.StatusBadRequest, err.Error())
+		return
+	}
+	window, err := parseWindow(rawWindow)
+	if err == nil {
+		var rate service.CounterRate
+		if rate, err = h.ms.CounterRate(metricName, window); err == nil {
+			value := rate.Rate
+			if increase {
+				value = rate.Increase
+			}
+			c.String(http.StatusOK, strconv.FormatFloat(value, 'g', -1, 64))
+			return
+		}
 	}
+	status := http.StatusBadRequest
+	var pe middleware.ProblemError
+	if errors.As(err, &pe) {
+		status = pe.ProblemStatus()
+	}
+	text := err.Error()
+	if status == http.StatusNotFound {
+		text = ""
+	}
+	writeLegacyError(c, err, status, text)
 }
 
 var (
@@ -82,19 +215,47 @@ var (
 	tmplCompiled *template.Template
 )
 
-// getTemplate компилирует и кэширует встроенный HTML-шаблон для страницы метрик.
+// getTemplate компилирует и кэширует встроенные HTML-шаблоны дашборда.
 func getTemplate() *template.Template {
 	tmplOnce.Do(func() {
-		tmplCompiled = template.Must(template.ParseFS(templatesFS, "template/metrics.html"))
+		tmplCompiled = template.Must(template.ParseFS(templatesFS, "template/*.html"))
 	})
 	return tmplCompiled
 }
 
 // updateBatchHandler принимает массив метрик и выполняет пакетное обновление.
+//
+// Без параметра mode ответ — массив обновлённых метрик или одна ошибка на весь пакет.
+// С ?mode=atomic или ?mode=partial ответ содержит результат для каждого элемента
+// (см. service.BatchResult).
 func (h *Handler) updateBatchHandler(c *gin.Context) {
+	var mode service.BatchMode
+	if raw, ok := c.GetQuery("mode"); ok {
+		var err error
+		if mode, err = service.ParseBatchMode(raw); err != nil {
+			middleware.WriteProblem(c, invalidRequest(err.Error()))
+			return
+		}
+	}
+
 	var metricsBatch []middleware.MetricsJSON
 	if err := c.ShouldBindJSON(&metricsBatch); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON format"})
+		middleware.WriteProblem(c, middleware.ErrInvalidJSON)
+		return
+	}
+	if err := h.ms.CheckBatchSize(len(metricsBatch)); err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	for _, m := range metricsBatch {
+		if !middleware.AllowsMetric(c, m.ID) {
+			middleware.WriteProblem(c, middleware.ScopeError(m.ID))
+			return
+		}
+	}
+	if mode != "" {
+		res := h.writer(c).ApplyBatch(metricsBatch, mode)
+		c.JSON(batchStatus(res), res)
 		return
 	}
 	if len(metricsBatch) == 0 {
@@ -102,10 +263,157 @@ func (h *Handler) updateBatchHandler(c *gin.Context) {
 		return
 	}
 
-	updated, err := h.ms.UpdateMetricsBatch(metricsBatch)
+	updated, err := h.writer(c).UpdateMetricsBatch(metricsBatch)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		middleware.WriteProblem(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, updated)
 }
+
+// valuesBatchHandler принимает массив {id, type} и возвращает значения найденных метрик
+// в порядке запроса; ненайденные метрики в ответ не попадают.
+func (h *Handler) valuesBatchHandler(c *gin.Context) {
+	var refs []service.MetricRef
+	if err := c.ShouldBindJSON(&refs); err != nil {
+		middleware.WriteProblem(c, middleware.ErrInvalidJSON)
+		return
+	}
+	if err := h.ms.CheckBatchSize(len(refs)); err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	// Метрики вне области действия токена считаются ненайденными.
+	allowed := refs[:0]
+	for _, ref := range refs {
+		if middleware.AllowsMetric(c, ref.ID) {
+			allowed = append(allowed, ref)
+		}
+	}
+	c.JSON(http.StatusOK, h.ms.GetMetrics(allowed))
+}
+
+// listMetricsHandler возвращает метрики с типом, значением и временем последнего обновления.
+//
+// Параметры запроса: type (можно несколько или через запятую), name (glob), regex,
+// sort (type, name, updated; "-" — по убыванию), limit и cursor. Если есть следующая
+// страница, её курсор передаётся в заголовке X-Next-Cursor.
+func (h *Handler) listMetricsHandler(c *gin.Context) {
+	opts := service.ListOptions{
+		Name:      c.Query("name"),
+		NameRegex: c.Query("regex"),
+		Sort:      c.Query("sort"),
+		Cursor:    c.Query("cursor"),
+		Allow:     allowedNames(c),
+	}
+	for _, t := range c.QueryArray("type") {
+		for _, part := range strings.Split(t, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				opts.Types = append(opts.Types, part)
+			}
+		}
+	}
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			middleware.WriteProblem(c, service.ErrInvalidQuery.With(errors.New("limit must be a non-negative integer")))
+			return
+		}
+		opts.Limit = limit
+	}
+
+	page, err := h.ms.QueryMetrics(opts)
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	if page.NextCursor != "" {
+		c.Header("X-Next-Cursor", page.NextCursor)
+	}
+	c.JSON(http.StatusOK, page.Items)
+}
+
+// allowedNames возвращает фильтр имён по области действия токена запроса (nil — без ограничений).
+func allowedNames(c *gin.Context) func(string) bool {
+	token, ok := middleware.TokenFromContext(c)
+	if !ok || len(token.Prefixes) == 0 {
+		return nil
+	}
+	return token.Covers
+}
+
+// allowedEvents ограничивает фильтр событий match областью действия токена запроса.
+// События reset не относятся к конкретной метрике и проходят всегда.
+func allowedEvents(c *gin.Context, match func(service.Event) bool) func(service.Event) bool {
+	allow := allowedNames(c)
+	if allow == nil {
+		return match
+	}
+	return func(e service.Event) bool {
+		return (e.Kind == service.EventReset || allow(e.Metric.ID)) && (match == nil || match(e))
+	}
+}
+
+// batchStatus выбирает HTTP-статус результата пакета: 200 — все элементы применены,
+// 207 — частично применённый пакет. Отклонённый атомарный пакет получает статус
+// по самой серьёзной ошибке: сбой хранилища — 500, конфликт типов — 409, иначе 400.
+func batchStatus(res service.BatchResult) int {
+	if res.Failed == 0 && res.Error == nil {
+		return http.StatusOK
+	}
+	if res.Mode == service.BatchPartial && res.Applied > 0 {
+		return http.StatusMultiStatus
+	}
+	codes := make(map[string]bool)
+	if res.Error != nil {
+		codes[res.Error.Code] = true
+	}
+	for _, r := range res.Results {
+		if r.Error != nil {
+			codes[r.Error.Code] = true
+		}
+	}
+	switch {
+	case codes[service.CodeStorageError]:
+		return http.StatusInternalServerError
+	case codes[service.CodeTypeConflict]:
+		return http.StatusConflict
+	case codes[service.CodeCardinalityLimit]:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// writeLegacyError отвечает на ошибку маршрута с параметрами в пути. Для совместимости
+// ответ по умолчанию — текст text (или пустое тело) со статусом status; маршруты /api/v1
+// и клиенты, принимающие JSON (заголовок Accept), получают application/problem+json.
+func writeLegacyError(c *gin.Context, err error, status int, text string) {
+	if middleware.WantsProblem(c) || strings.HasPrefix(c.FullPath(), APIPrefix) {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	if text == "" {
+		c.Status(status)
+		return
+	}
+	c.String(status, text)
+}
+
+// invalidRequest — ошибка некорректных параметров запроса.
+func invalidRequest(detail string) error {
+	return middleware.NewProblem(http.StatusBadRequest, middleware.CodeInvalidRequest, "invalid request", detail)
+}
+
+// updateErrorStatus выбирает HTTP-статус для ошибки записи метрики:
+// конфликт типов — 409, превышение лимита рядов — 422, остальные ошибки валидации — 400.
+func updateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrTypeConflict):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrCardinalityLimit):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusBadRequest
+	}
+}
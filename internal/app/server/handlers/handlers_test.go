@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
 	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
 	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
 
@@ -115,6 +119,35 @@ func TestGetValueHandler(t *testing.T) {
 	}
 }
 
+func TestGetValueHandler_CounterRate(t *testing.T) {
+	router, ms := setupRouter()
+	ms.Rates = service.NewCounterRates(time.Hour)
+	_ = ms.UpdateMetric("counter", "PollCount", "10")
+	_ = ms.UpdateMetric("counter", "PollCount", "5")
+	_ = ms.UpdateMetric("gauge", "Alloc", "1")
+
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	w := get("/value/counter/PollCount?increase=5m")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "15", w.Body.String())
+
+	w = get("/value/counter/PollCount?rate=")
+	require.Equal(t, http.StatusOK, w.Code)
+	rate, err := strconv.ParseFloat(w.Body.String(), 64)
+	require.NoError(t, err)
+	assert.Positive(t, rate)
+
+	assert.Equal(t, http.StatusBadRequest, get("/value/counter/PollCount?rate=soon").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/value/counter/PollCount?rate=2h").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/value/gauge/Alloc?rate=1m").Code)
+	assert.Equal(t, http.StatusNotFound, get("/value/counter/Nope?increase=1m").Code)
+}
+
 func TestGetAllMetricsHandler(t *testing.T) {
 	router, ms := setupRouter()
 
@@ -127,8 +160,8 @@ func TestGetAllMetricsHandler(t *testing.T) {
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Contains(t, w.Body.String(), "Alloc: 123.45")
-	assert.Contains(t, w.Body.String(), "PollCount: 10")
+	assert.Contains(t, w.Body.String(), `data-name="Alloc" data-value="123.45"`)
+	assert.Contains(t, w.Body.String(), `data-name="PollCount" data-value="10"`)
 }
 
 func TestMetricsServiceIntegration(t *testing.T) {
@@ -152,10 +185,28 @@ func TestMetricsServiceIntegration(t *testing.T) {
 	req, _ = http.NewRequest(http.MethodGet, "/", nil)
 	router.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Contains(t, w.Body.String(), "TestMetric: 42")
+	assert.Contains(t, w.Body.String(), `data-name="TestMetric" data-value="42"`)
 
 	// Verify the metric is stored correctly
 	value, err := ms.GetMetricValue("gauge", "TestMetric")
 	require.NoError(t, err)
 	assert.Equal(t, "42", value)
 }
+
+func TestListMetricsHandler(t *testing.T) {
+	router, ms := setupRouter()
+	require.NoError(t, ms.UpdateMetric("gauge", "Alloc", "1.5"))
+	require.NoError(t, ms.UpdateMetric("counter", "PollCount", "2"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/metrics", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var entries []models.MetricEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.Len(t, entries, 2)
+	assert.Equal(t, "PollCount", entries[0].ID)
+	assert.Equal(t, "Alloc", entries[1].ID)
+	assert.False(t, entries[1].UpdatedAt.IsZero())
+}
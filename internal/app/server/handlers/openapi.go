@@ -0,0 +1,409 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+	"github.com/Hobrus/hobrusmetrics.git/internal/pkg/buildinfo"
+)
+
+// operation описывает операцию /api/v1 для документа OpenAPI.
+// RequestBody и схемы ответов — имена схем из openAPISchemas.
+type operation struct {
+	ID          string
+	Summary     string
+	Parameters  []parameter
+	RequestBody string
+	Responses   []responseSpec
+}
+
+// parameter — параметр пути или запроса.
+type parameter struct {
+	Name        string
+	In          string
+	Description string
+}
+
+// responseSpec — ответ операции: статус, схема тела и тип содержимого (пустая схема — без тела).
+type responseSpec struct {
+	Status      int
+	Schema      string
+	ContentType string
+}
+
+func pathParam(name, description string) parameter {
+	return parameter{Name: name, In: "path", Description: description}
+}
+
+func queryParam(name, description string) parameter {
+	return parameter{Name: name, In: "query", Description: description}
+}
+
+func responses(rs ...responseSpec) []responseSpec { return rs }
+
+// ok — успешный ответ со схемой schema в JSON.
+func ok(schema string) responseSpec { return response(http.StatusOK, schema) }
+
+func response(status int, schema string) responseSpec {
+	return responseSpec{Status: status, Schema: schema, ContentType: "application/json"}
+}
+
+// problem — ответ об ошибке в формате RFC 7807.
+func problem(status int) responseSpec {
+	return responseSpec{Status: status, Schema: "Problem", ContentType: middleware.ProblemContentType}
+}
+
+// empty — ответ без тела.
+func empty(status int) responseSpec { return responseSpec{Status: status} }
+
+// openAPIPath переводит путь gin (/metrics/:type) в шаблон OpenAPI (/metrics/{type}).
+func openAPIPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ":") {
+			parts[i] = "{" + p[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func ref(name string) map[string]any { return map[string]any{"$ref": "#/components/schemas/" + name} }
+
+func arrayOf(items map[string]any) map[string]any {
+	return map[string]any{"type": "array", "items": items}
+}
+
+func object(required []string, props map[string]any) map[string]any {
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func mapOf(values map[string]any) map[string]any {
+	return map[string]any{"type": "object", "additionalProperties": values}
+}
+
+var (
+	schemaString  = map[string]any{"type": "string"}
+	schemaNumber  = map[string]any{"type": "number"}
+	schemaInteger = map[string]any{"type": "integer"}
+	schemaBoolean = map[string]any{"type": "boolean"}
+)
+
+// openAPISchemas возвращает схемы тел запросов и ответов.
+func openAPISchemas() map[string]any {
+	metricTypes := append([]string{service.CounterMetric, service.GaugeMetric}, models.CompositeTypes()...)
+	metricProps := func() map[string]any {
+		return map[string]any{
+			"id":        schemaString,
+			"type":      map[string]any{"type": "string", "enum": metricTypes},
+			"delta":     schemaInteger,
+			"value":     schemaNumber,
+			"members":   arrayOf(schemaString),
+			"histogram": ref("Histogram"),
+			"summary":   ref("Summary"),
+			"sketch":    ref("Sketch"),
+			"set":       ref("Set"),
+		}
+	}
+	entryProps := metricProps()
+	entryProps["updated_at"] = map[string]any{"type": "string", "format": "date-time"}
+
+	return map[string]any{
+		"Metric":          object(nil, metricProps()),
+		"MetricList":      arrayOf(ref("Metric")),
+		"MetricEntry":     object([]string{"id", "type", "updated_at"}, entryProps),
+		"MetricEntryList": arrayOf(ref("MetricEntry")),
+		"MetricRef":       object([]string{"id", "type"}, map[string]any{"id": schemaString, "type": schemaString}),
+		"MetricRefList":   arrayOf(ref("MetricRef")),
+		"Histogram": object([]string{"bounds", "counts", "count", "sum"}, map[string]any{
+			"bounds": arrayOf(schemaNumber), "counts": arrayOf(schemaInteger), "count": schemaInteger, "sum": schemaNumber,
+		}),
+		"Summary": object([]string{"count", "sum", "min", "max"}, map[string]any{
+			"count": schemaInteger, "sum": schemaNumber, "min": schemaNumber, "max": schemaNumber,
+		}),
+		"Sketch": object([]string{"alpha", "max_bins", "count"}, map[string]any{
+			"alpha": schemaNumber, "max_bins": schemaInteger,
+			"positive": mapOf(schemaInteger), "negative": mapOf(schemaInteger),
+			"zero": schemaInteger, "count": schemaInteger, "sum": schemaNumber, "min": schemaNumber, "max": schemaNumber,
+		}),
+		"Set": object([]string{"precision", "registers"}, map[string]any{
+			"precision":      schemaInteger,
+			"registers":      map[string]any{"type": "string", "format": "byte"},
+			"estimate":       schemaInteger,
+			"relative_error": schemaNumber,
+		}),
+		"Quantiles": object([]string{"id", "type", "quantiles"}, map[string]any{
+			"id": schemaString, "type": schemaString, "quantiles": mapOf(schemaNumber),
+		}),
+		"BatchError": object([]string{"code", "message"}, map[string]any{"code": schemaString, "message": schemaString}),
+		"BatchItemResult": object([]string{"index", "id", "type", "status"}, map[string]any{
+			"index":  schemaInteger,
+			"id":     schemaString,
+			"type":   schemaString,
+			"status": map[string]any{"type": "string", "enum": []string{service.ItemApplied, service.ItemFailed, service.ItemNotApplied, service.ItemDropped}},
+			"error":  ref("BatchError"),
+			"metric": ref("Metric"),
+		}),
+		"BatchResult": object([]string{"mode", "applied", "failed", "results"}, map[string]any{
+			"mode":    map[string]any{"type": "string", "enum": []string{string(service.BatchAtomic), string(service.BatchPartial)}},
+			"applied": schemaInteger,
+			"failed":  schemaInteger,
+			"dropped": schemaInteger,
+			"error":   ref("BatchError"),
+			"results": arrayOf(ref("BatchItemResult")),
+		}),
+		"Snapshot": object([]string{"gauges", "counters"}, map[string]any{
+			"gauges":                mapOf(schemaString),
+			"counters":              mapOf(schemaInteger),
+			"gauges_updated_at":     mapOf(schemaString),
+			"counters_updated_at":   mapOf(schemaString),
+			"composites":            mapOf(mapOf(map[string]any{"type": "object"})),
+			"composites_updated_at": mapOf(mapOf(schemaString)),
+		}),
+		"DeletedMetrics": object([]string{"deleted"}, map[string]any{"deleted": arrayOf(ref("MetricRef"))}),
+		"ImportResult": object([]string{"gauges", "counters", "composites", "replace"}, map[string]any{
+			"gauges": schemaInteger, "counters": schemaInteger, "composites": schemaInteger, "replace": schemaBoolean,
+		}),
+		"History": object([]string{"id", "type", "resolution_ms", "samples"}, map[string]any{
+			"id": schemaString, "type": schemaString, "resolution_ms": schemaInteger,
+			"samples": arrayOf(object([]string{"t", "v"}, map[string]any{
+				"t": map[string]any{"type": "string", "format": "date-time"}, "v": schemaNumber,
+			})),
+		}),
+		"CounterRate": object([]string{"id", "window", "increase", "rate", "from", "to", "samples"}, map[string]any{
+			"id": schemaString, "window": schemaString, "increase": schemaNumber, "rate": schemaNumber,
+			"from":    map[string]any{"type": "string", "format": "date-time"},
+			"to":      map[string]any{"type": "string", "format": "date-time"},
+			"samples": schemaInteger,
+		}),
+		"QueryResult": object([]string{"expr", "type", "result"}, map[string]any{
+			"expr":  schemaString,
+			"type":  map[string]any{"type": "string", "enum": []string{service.QueryScalar, service.QueryVector}},
+			"value": schemaNumber,
+			"result": arrayOf(object([]string{"metric", "value"}, map[string]any{
+				"metric": schemaString, "labels": mapOf(schemaString), "value": schemaNumber,
+			})),
+		}),
+		// Поле data события потока /stream; номер события передаётся в поле id.
+		"StreamEvent": object([]string{"kind", "metric", "time"}, map[string]any{
+			"kind":   map[string]any{"type": "string", "enum": []string{service.EventUpdate, service.EventDelete, service.EventReset}},
+			"metric": ref("Metric"),
+			"time":   map[string]any{"type": "string", "format": "date-time"},
+		}),
+		"TokenRequest": object([]string{"role"}, map[string]any{
+			"name":     schemaString,
+			"role":     map[string]any{"type": "string", "enum": []string{string(models.RoleReader), string(models.RoleWriter), string(models.RoleAdmin)}},
+			"prefixes": arrayOf(schemaString),
+		}),
+		"Token": object([]string{"id", "name", "role", "created_at"}, map[string]any{
+			"id": schemaString, "name": schemaString, "role": schemaString, "prefixes": arrayOf(schemaString),
+			"created_at": map[string]any{"type": "string", "format": "date-time"},
+		}),
+		"TokenList": arrayOf(ref("Token")),
+		"IssuedToken": object([]string{"id", "name", "role", "created_at", "token"}, map[string]any{
+			"id": schemaString, "name": schemaString, "role": schemaString, "prefixes": arrayOf(schemaString),
+			"created_at": map[string]any{"type": "string", "format": "date-time"},
+			"token":      schemaString,
+		}),
+		"RelabelRule": object(nil, map[string]any{
+			"source_labels": arrayOf(schemaString),
+			"separator":     schemaString,
+			"regex":         schemaString,
+			"target_label":  schemaString,
+			"replacement":   schemaString,
+			"modulus":       schemaInteger,
+			"action": map[string]any{"type": "string", "enum": []string{
+				service.RelabelReplace, service.RelabelKeep, service.RelabelDrop, service.RelabelHashMod,
+			}},
+		}),
+		"RelabelRequest": object([]string{"metrics"}, map[string]any{
+			"rules":   arrayOf(ref("RelabelRule")),
+			"client":  schemaString,
+			"metrics": ref("MetricRefList"),
+		}),
+		"RelabelResultList": arrayOf(object([]string{"id", "type", "dropped"}, map[string]any{
+			"id": schemaString, "type": schemaString, "result": schemaString, "dropped": schemaBoolean,
+		})),
+		"SeriesLimit": object([]string{"pattern", "max"}, map[string]any{"pattern": schemaString, "max": schemaInteger}),
+		"CardinalityReport": object([]string{"series", "limits", "patterns", "clients"}, map[string]any{
+			"series": schemaInteger,
+			"limits": object([]string{"action"}, map[string]any{
+				"max_series":            schemaInteger,
+				"max_series_per_client": schemaInteger,
+				"patterns":              arrayOf(ref("SeriesLimit")),
+				"action":                map[string]any{"type": "string", "enum": []string{service.CardinalityReject, service.CardinalitySample}},
+				"sample_rate":           schemaNumber,
+			}),
+			"patterns": arrayOf(object([]string{"pattern", "max", "series"}, map[string]any{
+				"pattern": schemaString, "max": schemaInteger, "series": schemaInteger,
+			})),
+			"clients": arrayOf(object([]string{"client", "series", "rejected", "dropped"}, map[string]any{
+				"client": schemaString, "series": schemaInteger, "rejected": schemaInteger, "dropped": schemaInteger,
+			})),
+		}),
+		"Matcher": object([]string{"label", "value"}, map[string]any{
+			"label": schemaString, "value": schemaString,
+			"op": map[string]any{"type": "string", "enum": []string{"=", "!=", "=~", "!~"}},
+		}),
+		"Alert": object([]string{"rule", "labels", "value", "state", "active_at", "fired_at"}, map[string]any{
+			"rule": schemaString, "labels": mapOf(schemaString), "value": schemaNumber,
+			"state":        map[string]any{"type": "string", "enum": []string{models.AlertPending, models.AlertFiring}},
+			"active_at":    map[string]any{"type": "string", "format": "date-time"},
+			"fired_at":     map[string]any{"type": "string", "format": "date-time"},
+			"silenced_by":  arrayOf(schemaString),
+			"inhibited_by": arrayOf(schemaString),
+		}),
+		"AlertList": arrayOf(ref("Alert")),
+		"SilenceRequest": object([]string{"matchers"}, map[string]any{
+			"matchers":  arrayOf(ref("Matcher")),
+			"starts_at": map[string]any{"type": "string", "format": "date-time"},
+			"ends_at":   map[string]any{"type": "string", "format": "date-time"},
+			"duration":  schemaString, "created_by": schemaString, "comment": schemaString,
+		}),
+		"Silence": object([]string{"id", "matchers", "starts_at", "ends_at", "created_at"}, map[string]any{
+			"id": schemaString, "matchers": arrayOf(ref("Matcher")),
+			"starts_at":  map[string]any{"type": "string", "format": "date-time"},
+			"ends_at":    map[string]any{"type": "string", "format": "date-time"},
+			"created_at": map[string]any{"type": "string", "format": "date-time"},
+			"created_by": schemaString, "comment": schemaString,
+		}),
+		"SilenceList": arrayOf(ref("Silence")),
+		"Problem": object([]string{"type", "title", "status", "code"}, map[string]any{
+			"type": schemaString, "title": schemaString, "status": schemaInteger,
+			"detail": schemaString, "instance": schemaString, "code": schemaString,
+		}),
+	}
+}
+
+// OpenAPI строит документ OpenAPI 3 для операций /api/v1.
+func (h *Handler) OpenAPI() map[string]any {
+	paths := make(map[string]map[string]any)
+	for _, r := range h.apiRoutes() {
+		op := map[string]any{"operationId": r.op.ID, "summary": r.op.Summary}
+
+		params := make([]map[string]any, 0, len(r.op.Parameters))
+		for _, p := range r.op.Parameters {
+			params = append(params, map[string]any{
+				"name": p.Name, "in": p.In, "description": p.Description,
+				"required": p.In == "path", "schema": schemaString,
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if r.op.RequestBody != "" {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": ref(r.op.RequestBody)}},
+			}
+		}
+		// Ответы, которые формируют middleware всех маршрутов: ограничение частоты запросов,
+		// размера тела и, для операций без ключа администратора, проверка токена.
+		specs := append(r.op.Responses[:len(r.op.Responses):len(r.op.Responses)], problem(http.StatusTooManyRequests))
+		if r.op.RequestBody != "" {
+			specs = append(specs, problem(http.StatusRequestEntityTooLarge))
+		}
+		op["x-required-role"] = r.role
+		if r.role == models.RoleAdmin {
+			op["security"] = []map[string]any{{"bearerAuth": []string{}}, {"apiToken": []string{}}, {"adminKey": []string{}}}
+			op["tags"] = []string{"admin"}
+		} else {
+			// Токен нужен, только если на сервере включена аутентификация по токенам.
+			specs = append(specs, problem(http.StatusUnauthorized), problem(http.StatusForbidden))
+			op["security"] = []map[string]any{{"bearerAuth": []string{}}, {"apiToken": []string{}}, {}}
+			op["tags"] = []string{"metrics"}
+		}
+		op["responses"] = openAPIResponses(specs)
+
+		path := openAPIPath(r.path)
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(r.method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "hobrusmetrics API",
+			"version":     apiVersion(),
+			"description": "Сервер сбора метрик. Ошибки возвращаются в формате application/problem+json (RFC 7807).",
+		},
+		"servers": []map[string]any{{"url": APIPrefix}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": openAPISchemas(),
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+				"apiToken":   map[string]any{"type": "apiKey", "in": "header", "name": middleware.TokenHeader},
+				"adminKey":   map[string]any{"type": "apiKey", "in": "header", "name": middleware.AdminKeyHeader},
+			},
+		},
+		"tags": []map[string]any{
+			{"name": "metrics", "description": "Запись и чтение метрик"},
+			{"name": "admin", "description": "Административные операции; требуют ключа или токена администратора"},
+		},
+	}
+}
+
+// openAPIResponses собирает ответы операции. Несколько схем одного статуса и типа
+// содержимого объединяются через oneOf.
+func openAPIResponses(specs []responseSpec) map[string]any {
+	schemas := make(map[int]map[string][]any)
+	for _, rs := range specs {
+		if schemas[rs.Status] == nil {
+			schemas[rs.Status] = make(map[string][]any)
+		}
+		if rs.Schema != "" {
+			schemas[rs.Status][rs.ContentType] = append(schemas[rs.Status][rs.ContentType], ref(rs.Schema))
+		}
+	}
+
+	resps := make(map[string]any, len(schemas))
+	for status, byType := range schemas {
+		resp := map[string]any{"description": http.StatusText(status)}
+		if len(byType) > 0 {
+			content := make(map[string]any, len(byType))
+			for contentType, refs := range byType {
+				var schema any = refs[0]
+				if len(refs) > 1 {
+					schema = map[string]any{"oneOf": refs}
+				}
+				content[contentType] = map[string]any{"schema": schema}
+			}
+			resp["content"] = content
+		}
+		resps[strconv.Itoa(status)] = resp
+	}
+	return resps
+}
+
+// apiVersion возвращает версию сборки для документа OpenAPI.
+func apiVersion() string {
+	if buildinfo.Version == "" {
+		return "dev"
+	}
+	return buildinfo.Version
+}
+
+// openAPIHandler отдаёт документ OpenAPI. Документ строится один раз.
+func (h *Handler) openAPIHandler(c *gin.Context) {
+	h.openAPIOnce.Do(func() {
+		h.openAPIDoc, h.openAPIErr = json.Marshal(h.OpenAPI())
+	})
+	if h.openAPIErr != nil {
+		middleware.WriteProblem(c, h.openAPIErr)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", h.openAPIDoc)
+}
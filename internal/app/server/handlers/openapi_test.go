@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+func fetchOpenAPI(t *testing.T, router http.Handler) map[string]any {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, APIPrefix+"/openapi.json", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	return doc
+}
+
+func TestOpenAPI_CoversRegisteredRoutes(t *testing.T) {
+	router, _ := setupAdminRouter(testAdminKey)
+	doc := fetchOpenAPI(t, router)
+	assert.Equal(t, "3.0.3", doc["openapi"])
+
+	var registered []string
+	for _, r := range router.Routes() {
+		if !strings.HasPrefix(r.Path, APIPrefix+"/") || r.Path == APIPrefix+"/openapi.json" {
+			continue
+		}
+		registered = append(registered, r.Method+" "+openAPIPath(strings.TrimPrefix(r.Path, APIPrefix)))
+	}
+	var documented []string
+	for path, item := range doc["paths"].(map[string]any) {
+		for method := range item.(map[string]any) {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(registered)
+	sort.Strings(documented)
+	assert.Equal(t, registered, documented)
+}
+
+func TestOpenAPI_RefsResolve(t *testing.T) {
+	router, _ := setupAdminRouter(testAdminKey)
+	doc := fetchOpenAPI(t, router)
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if r, ok := v["$ref"].(string); ok {
+				name := strings.TrimPrefix(r, "#/components/schemas/")
+				assert.Contains(t, schemas, name, "unresolved $ref %s", r)
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(doc)
+}
+
+// TestOpenAPI_ResponsesMatchSpec выполняет запросы ко всем операциям и проверяет, что статус,
+// тип содержимого и тело ответа описаны в документе.
+func TestOpenAPI_ResponsesMatchSpec(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	storage := repository.NewMemStorage()
+	storage.SetConflictPolicy(repository.ConflictReject)
+	guard, err := service.NewCardinalityGuard(service.CardinalityLimits{Patterns: []service.SeriesLimit{{Pattern: "Limited*", Max: 0}}})
+	require.NoError(t, err)
+	ms := &service.MetricsService{Storage: storage, History: service.NewHistory(0, 0), Rates: service.NewCounterRates(0),
+		MaxBatchSize: 3, Cardinality: guard}
+	h := NewHandler(ms)
+	alerting, err := service.NewAlerting(ms, service.AlertingConfig{Rules: []service.AlertRule{{Name: "AllocHigh", Expr: "Alloc > 1"}}},
+		repository.NewMemAlertStore(), time.Second, logrus.New())
+	require.NoError(t, err)
+	h.Alerts = alerting
+	h.SetupRoutes(router)
+	h.SetupAdminRoutes(router, testAdminKey, logrus.New())
+
+	doc := fetchOpenAPI(t, router)
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	paths := doc["paths"].(map[string]any)
+
+	seed := func() {
+		require.NoError(t, ms.UpdateMetric("gauge", "Alloc", "1.5"))
+		require.NoError(t, ms.UpdateMetric("counter", "PollCount", "3"))
+		require.NoError(t, ms.UpdateMetric("sketch", "Latency", "12"))
+	}
+	seed()
+	require.NoError(t, alerting.Evaluate(time.Now()))
+
+	cases := []struct {
+		method, path, body string
+		admin              bool
+		status             int
+	}{
+		{http.MethodGet, "/metrics", "", false, http.StatusOK},
+		{http.MethodGet, "/metrics?sort=size", "", false, http.StatusBadRequest},
+		{http.MethodPost, "/metrics", `[{"id":"Alloc","type":"gauge","value":2}]`, false, http.StatusOK},
+		{http.MethodPost, "/metrics?mode=atomic", `[{"id":"Alloc","type":"gauge","value":3}]`, false, http.StatusOK},
+		{http.MethodPost, "/metrics?mode=partial", `[{"id":"A","type":"gauge","value":1},{"id":"B","type":"gauge"}]`, false, http.StatusMultiStatus},
+		{http.MethodPost, "/metrics?mode=atomic", `[{"id":"B","type":"gauge"}]`, false, http.StatusBadRequest},
+		{http.MethodPost, "/metrics?mode=atomic", `[{"id":"Alloc","type":"counter","delta":1}]`, false, http.StatusConflict},
+		{http.MethodPost, "/metrics", `{`, false, http.StatusBadRequest},
+		{http.MethodPost, "/metrics", `[{"id":"Limited","type":"gauge","value":1}]`, false, http.StatusUnprocessableEntity},
+		{http.MethodPost, "/metrics?mode=atomic", `[{"id":"Limited","type":"gauge","value":1}]`, false, http.StatusUnprocessableEntity},
+		{http.MethodPost, "/metrics", "[" + strings.Repeat(`{"id":"A","type":"gauge","value":1},`, 3) + `{"id":"A","type":"gauge","value":1}]`, false, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/metrics/values", "[" + strings.Repeat(`{"id":"A","type":"gauge"},`, 3) + `{"id":"A","type":"gauge"}]`, false, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/metrics/values", `[{"id":"Alloc","type":"gauge"},{"id":"Nope","type":"gauge"}]`, false, http.StatusOK},
+		{http.MethodPost, "/metrics/values", `{`, false, http.StatusBadRequest},
+		{http.MethodGet, "/metrics/gauge/Alloc", "", false, http.StatusOK},
+		{http.MethodGet, "/metrics/sketch/Latency", "", false, http.StatusOK},
+		{http.MethodGet, "/metrics/gauge/Nope", "", false, http.StatusNotFound},
+		{http.MethodGet, "/metrics/meter/Alloc", "", false, http.StatusBadRequest},
+		{http.MethodPost, "/metrics/counter/PollCount", `{"delta":2}`, false, http.StatusOK},
+		{http.MethodPost, "/metrics/counter/PollCount", `{"id":"Other","delta":2}`, false, http.StatusBadRequest},
+		{http.MethodPost, "/metrics/counter/Alloc", `{"delta":2}`, false, http.StatusConflict},
+		{http.MethodPost, "/metrics/counter/Limited", `{"delta":2}`, false, http.StatusUnprocessableEntity},
+		{http.MethodGet, "/metrics/sketch/Latency/quantiles?q=0.5,0.99", "", false, http.StatusOK},
+		{http.MethodGet, "/metrics/sketch/Latency/quantiles?q=2", "", false, http.StatusBadRequest},
+		{http.MethodGet, "/metrics/sketch/Nope/quantiles?q=0.5", "", false, http.StatusNotFound},
+		{http.MethodGet, "/metrics/gauge/Alloc/history", "", false, http.StatusOK},
+		{http.MethodGet, "/metrics/gauge/Alloc/history?window=soon", "", false, http.StatusBadRequest},
+		{http.MethodGet, "/metrics/sketch/Latency/history", "", false, http.StatusBadRequest},
+		{http.MethodGet, "/metrics/gauge/Nope/history", "", false, http.StatusNotFound},
+		{http.MethodGet, "/metrics/counter/PollCount/rate?window=1m", "", false, http.StatusOK},
+		{http.MethodGet, "/metrics/counter/PollCount/rate?window=2h", "", false, http.StatusBadRequest},
+		{http.MethodGet, "/metrics/gauge/Alloc/rate", "", false, http.StatusBadRequest},
+		{http.MethodGet, "/metrics/counter/Nope/rate", "", false, http.StatusNotFound},
+		{http.MethodGet, "/query?expr=" + url.QueryEscape("Alloc * 2 > 1"), "", false, http.StatusOK},
+		{http.MethodGet, "/query?expr=" + url.QueryEscape("1 + 2"), "", false, http.StatusOK},
+		{http.MethodGet, "/query?expr=" + url.QueryEscape("sum(Alloc"), "", false, http.StatusBadRequest},
+		{http.MethodGet, "/query?expr=" + url.QueryEscape("Alloc / 0"), "", false, http.StatusUnprocessableEntity},
+		{http.MethodPost, "/admin/silences", `{"matchers":[{"label":"alertname","value":"AllocHigh"}],"duration":"1h","comment":"maintenance"}`, true, http.StatusCreated},
+		{http.MethodPost, "/admin/silences", `{"matchers":[],"duration":"1h"}`, true, http.StatusBadRequest},
+		{http.MethodDelete, "/admin/silences/nope", "", true, http.StatusNotFound},
+		{http.MethodGet, "/alerts", "", false, http.StatusOK},
+		{http.MethodGet, "/silences", "", false, http.StatusOK},
+		{http.MethodGet, "/stream?regex=(", "", false, http.StatusBadRequest},
+		{http.MethodGet, "/stream", "", false, http.StatusServiceUnavailable},
+		{http.MethodGet, "/admin/snapshot", "", true, http.StatusOK},
+		{http.MethodGet, "/admin/snapshot", "", false, http.StatusUnauthorized},
+		{http.MethodGet, "/admin/snapshot?format=xml", "", true, http.StatusBadRequest},
+		{http.MethodPost, "/admin/snapshot?mode=merge", `{"gauges":{"Alloc":"4"},"counters":{}}`, true, http.StatusOK},
+		{http.MethodPost, "/admin/snapshot", `{`, true, http.StatusBadRequest},
+		{http.MethodPost, "/admin/counters/PollCount/reset", "", true, http.StatusOK},
+		{http.MethodPost, "/admin/counters/Nope/reset", "", true, http.StatusNotFound},
+		{http.MethodDelete, "/metrics/gauge/Nope", "", true, http.StatusNotFound},
+		{http.MethodDelete, "/metrics/meter/Alloc", "", true, http.StatusBadRequest},
+		{http.MethodDelete, "/metrics/gauge/Alloc", "", true, http.StatusOK},
+		{http.MethodDelete, "/metrics?pattern=Poll*", "", true, http.StatusOK},
+		{http.MethodDelete, "/metrics", "", true, http.StatusBadRequest},
+		{http.MethodGet, "/admin/tokens", "", true, http.StatusServiceUnavailable},
+		{http.MethodPost, "/admin/tokens", `{"role":"reader"}`, true, http.StatusServiceUnavailable},
+		{http.MethodDelete, "/admin/tokens/abc", "", true, http.StatusServiceUnavailable},
+		{http.MethodPost, "/admin/relabel/dry-run", `{"rules":[{"regex":"CPU(\\d+)","target_label":"cpu"},{"action":"drop","regex":"Random.*"}],"metrics":[{"id":"CPU1","type":"gauge"},{"id":"RandomValue","type":"gauge"}]}`, true, http.StatusOK},
+		{http.MethodPost, "/admin/relabel/dry-run", `{"rules":[{"action":"rename"}],"metrics":[]}`, true, http.StatusBadRequest},
+		{http.MethodGet, "/admin/cardinality", "", true, http.StatusOK},
+		{http.MethodGet, "/admin/cardinality?limit=many", "", true, http.StatusBadRequest},
+	}
+
+	covered := make(map[string]bool)
+	for _, tc := range cases {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			var req *http.Request
+			if tc.admin {
+				req = adminRequest(tc.method, APIPrefix+tc.path, []byte(tc.body))
+			} else {
+				req, _ = http.NewRequest(tc.method, APIPrefix+tc.path, strings.NewReader(tc.body))
+			}
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			require.Equal(t, tc.status, w.Code, w.Body.String())
+
+			route := strings.SplitN(tc.path, "?", 2)[0]
+			op := findOperation(t, paths, tc.method, route)
+			covered[op["operationId"].(string)] = true
+
+			resp, ok := op["responses"].(map[string]any)[strconv.Itoa(w.Code)].(map[string]any)
+			require.True(t, ok, "status %d is not documented", w.Code)
+			content, _ := resp["content"].(map[string]any)
+			if w.Body.Len() == 0 {
+				return
+			}
+			contentType := strings.TrimSpace(strings.SplitN(w.Header().Get("Content-Type"), ";", 2)[0])
+			media, ok := content[contentType].(map[string]any)
+			require.True(t, ok, "content type %q is not documented for status %d", contentType, w.Code)
+			var body any
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.NoError(t, validateSchema(schemas, media["schema"], body, "$"))
+		})
+		seed()
+	}
+
+	for path, item := range paths {
+		for _, op := range item.(map[string]any) {
+			id := op.(map[string]any)["operationId"].(string)
+			assert.True(t, covered[id], "operation %s (%s) is not exercised", id, path)
+		}
+	}
+}
+
+// findOperation находит операцию документа по методу и конкретному пути запроса.
+func findOperation(t *testing.T, paths map[string]any, method, path string) map[string]any {
+	t.Helper()
+	segments := strings.Split(path, "/")
+	for template, item := range paths {
+		parts := strings.Split(template, "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		match := true
+		for i, p := range parts {
+			if !strings.HasPrefix(p, "{") && p != segments[i] {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		if op, ok := item.(map[string]any)[strings.ToLower(method)].(map[string]any); ok {
+			return op
+		}
+	}
+	t.Fatalf("operation %s %s is not documented", method, path)
+	return nil
+}
+
+// validateSchema проверяет значение по подмножеству JSON Schema, которое использует документ:
+// $ref, oneOf, type, enum, required, properties, items и additionalProperties.
+func validateSchema(schemas map[string]any, schema any, v any, at string) error {
+	s, _ := schema.(map[string]any)
+	if r, ok := s["$ref"].(string); ok {
+		return validateSchema(schemas, schemas[strings.TrimPrefix(r, "#/components/schemas/")], v, at)
+	}
+	if alts, ok := s["oneOf"].([]any); ok {
+		for _, alt := range alts {
+			if validateSchema(schemas, alt, v, at) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: no oneOf alternative matches", at)
+	}
+	if enum, ok := s["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			found = found || e == v
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not in %v", at, v, enum)
+		}
+	}
+
+	switch s["type"] {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %T", at, v)
+		}
+		for _, r := range asSlice(s["required"]) {
+			if _, ok := obj[r.(string)]; !ok {
+				return fmt.Errorf("%s: missing required field %q", at, r)
+			}
+		}
+		props, _ := s["properties"].(map[string]any)
+		for k, val := range obj {
+			sub, ok := props[k]
+			if !ok {
+				sub, ok = s["additionalProperties"]
+			}
+			if !ok {
+				continue
+			}
+			if err := validateSchema(schemas, sub, val, at+"."+k); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %T", at, v)
+		}
+		for i, item := range arr {
+			if err := validateSchema(schemas, s["items"], item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("%s: expected string, got %T", at, v)
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s: expected number, got %T", at, v)
+		}
+	case "integer":
+		if f, ok := v.(float64); !ok || f != math.Trunc(f) {
+			return fmt.Errorf("%s: expected integer, got %v", at, v)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %T", at, v)
+		}
+	}
+	return nil
+}
+
+func asSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
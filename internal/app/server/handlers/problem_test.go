@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+func decodeProblem(t *testing.T, rr *httptest.ResponseRecorder) middleware.Problem {
+	t.Helper()
+	require.Equal(t, middleware.ProblemContentType, rr.Header().Get("Content-Type"), rr.Body.String())
+	var p middleware.Problem
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+	assert.Equal(t, rr.Code, p.Status)
+	assert.True(t, strings.HasSuffix(p.Type, ":"+p.Code), p.Type)
+	return p
+}
+
+func TestProblemResponsesOnJSONRoutes(t *testing.T) {
+	router, ms := setupRouter()
+	ms.Storage.(*repository.MemStorage).SetConflictPolicy(repository.ConflictReject)
+	require.NoError(t, ms.UpdateMetric("gauge", "Alloc", "1"))
+
+	d := int64(1)
+	tests := []struct {
+		name   string
+		path   string
+		body   any
+		status int
+		code   string
+	}{
+		{"invalid json", "/update/", "not an object", http.StatusBadRequest, middleware.CodeInvalidJSON},
+		{"unsupported type", "/update/", middleware.MetricsJSON{ID: "X", MType: "timer"}, http.StatusBadRequest, service.CodeUnsupportedType},
+		{"missing delta", "/update/", middleware.MetricsJSON{ID: "X", MType: middleware.CounterMetric}, http.StatusBadRequest, service.CodeValueRequired},
+		{"type conflict", "/update/", middleware.MetricsJSON{ID: "Alloc", MType: middleware.CounterMetric, Delta: &d}, http.StatusConflict, service.CodeTypeConflict},
+		{"not found", "/value/", middleware.MetricsJSON{ID: "Missing", MType: middleware.GaugeMetric}, http.StatusNotFound, service.CodeMetricNotFound},
+		{"batch conflict", "/updates/", []middleware.MetricsJSON{{ID: "Alloc", MType: middleware.CounterMetric, Delta: &d}}, http.StatusConflict, service.CodeTypeConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := postJSON(t, router, tt.path, tt.body)
+			require.Equal(t, tt.status, rr.Code, rr.Body.String())
+			p := decodeProblem(t, rr)
+			assert.Equal(t, tt.code, p.Code)
+			assert.Equal(t, tt.path, p.Instance)
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/metrics?regex=(", nil))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, service.CodeInvalidQuery, decodeProblem(t, rr).Code)
+}
+
+func TestPathRoutesKeepLegacyText(t *testing.T) {
+	router, _ := setupRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/update/gauge/Alloc/abc", nil))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.True(t, strings.HasPrefix(rr.Body.String(), "invalid gauge value"), rr.Body.String())
+	assert.NotEqual(t, middleware.ProblemContentType, rr.Header().Get("Content-Type"))
+
+	// Клиент, принимающий JSON, получает problem+json с тем же статусом.
+	req := httptest.NewRequest(http.MethodPost, "/update/gauge/Alloc/abc", nil)
+	req.Header.Set("Accept", middleware.ProblemContentType)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	p := decodeProblem(t, rr)
+	assert.Equal(t, service.CodeInvalidValue, p.Code)
+	assert.Contains(t, p.Detail, "invalid gauge value")
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/value/gauge/Missing", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Empty(t, rr.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/value/timer/Missing", nil)
+	req.Header.Set("Accept", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, service.CodeUnsupportedType, decodeProblem(t, rr).Code)
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+func TestValuesBatchHandler(t *testing.T) {
+	router, ms := setupRouter()
+	require.NoError(t, ms.UpdateMetric("gauge", "Alloc", "1.5"))
+	require.NoError(t, ms.UpdateMetric("counter", "PollCount", "2"))
+	require.NoError(t, ms.UpdateMetric("summary", "Size", "4"))
+
+	rr := postJSON(t, router, "/values/", []service.MetricRef{
+		{ID: "PollCount", MType: "counter"},
+		{ID: "Missing", MType: "gauge"},
+		{ID: "Alloc", MType: "gauge"},
+		{ID: "Size", MType: "summary"},
+		{ID: "Alloc", MType: "unknown"},
+	})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var got []middleware.MetricsJSON
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	require.Len(t, got, 3)
+	assert.Equal(t, int64(2), *got[0].Delta)
+	assert.Equal(t, 1.5, *got[1].Value)
+	assert.Equal(t, uint64(1), got[2].Summary.Count)
+
+	rr = postJSON(t, router, "/values/", []service.MetricRef{})
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, "[]", rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/values/", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func listMetrics(t *testing.T, router http.Handler, query url.Values) ([]models.MetricEntry, string, int) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/metrics?"+query.Encode(), nil))
+	if rr.Code != http.StatusOK {
+		return nil, "", rr.Code
+	}
+	var entries []models.MetricEntry
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &entries))
+	return entries, rr.Header().Get("X-Next-Cursor"), rr.Code
+}
+
+func ids(entries []models.MetricEntry) []string {
+	out := make([]string, len(entries))
+	for i, e := range entries {
+		out[i] = e.MType + "/" + e.ID
+	}
+	return out
+}
+
+func TestListMetricsFilterSortPaginate(t *testing.T) {
+	router, ms := setupRouter()
+	for _, name := range []string{"CPU1", "CPU2", "Alloc", "HeapAlloc"} {
+		require.NoError(t, ms.UpdateMetric("gauge", name, "1"))
+	}
+	require.NoError(t, ms.UpdateMetric("counter", "CPU1", "1"))
+	require.NoError(t, ms.UpdateMetric("counter", "PollCount", "1"))
+
+	entries, _, code := listMetrics(t, router, url.Values{"type": {"gauge"}, "name": {"CPU*"}})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"gauge/CPU1", "gauge/CPU2"}, ids(entries))
+
+	entries, _, _ = listMetrics(t, router, url.Values{"regex": {"Alloc$"}, "sort": {"-name"}})
+	assert.Equal(t, []string{"gauge/HeapAlloc", "gauge/Alloc"}, ids(entries))
+
+	entries, _, _ = listMetrics(t, router, url.Values{"type": {"counter,gauge"}, "name": {"CPU1"}, "sort": {"name"}})
+	assert.Equal(t, []string{"counter/CPU1", "gauge/CPU1"}, ids(entries))
+
+	// Постраничный обход по имени возвращает каждую метрику ровно один раз.
+	var all []string
+	query := url.Values{"sort": {"name"}, "limit": {"4"}}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3, "pagination must terminate")
+		page, next, code := listMetrics(t, router, query)
+		require.Equal(t, http.StatusOK, code)
+		all = append(all, ids(page)...)
+		if next == "" {
+			break
+		}
+		query.Set("cursor", next)
+	}
+	assert.Equal(t, []string{"gauge/Alloc", "counter/CPU1", "gauge/CPU1", "gauge/CPU2", "gauge/HeapAlloc", "counter/PollCount"}, all)
+
+	// Курсор другой сортировки, некорректные фильтры и параметры отклоняются.
+	_, next, _ := listMetrics(t, router, url.Values{"limit": {"1"}})
+	for _, bad := range []url.Values{
+		{"cursor": {next}, "sort": {"name"}},
+		{"cursor": {"???"}},
+		{"type": {"timer"}},
+		{"regex": {"("}},
+		{"name": {"["}},
+		{"sort": {"value"}},
+		{"limit": {"-1"}},
+	} {
+		_, _, code := listMetrics(t, router, bad)
+		assert.Equal(t, http.StatusBadRequest, code, bad.Encode())
+	}
+}
+
+func TestQueryHandler(t *testing.T) {
+	router, ms := setupRouter()
+	require.NoError(t, ms.UpdateMetric("gauge", `CPUutilization1{host="a"}`, "90"))
+	require.NoError(t, ms.UpdateMetric("gauge", `CPUutilization2{host="b"}`, "40"))
+
+	get := func(expr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, APIPrefix+"/query?expr="+url.QueryEscape(expr), nil))
+		return w
+	}
+
+	w := get(`{__name__=~"CPUutilization.*"} > 80`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var res service.QueryResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, service.QueryVector, res.Type)
+	assert.Equal(t, []service.QuerySample{
+		{Metric: `CPUutilization1{host="a"}`, Labels: map[string]string{"host": "a"}, Value: 90},
+	}, res.Result)
+
+	w = get("max(CPUutilization* > 80) by host")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var problem middleware.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, service.CodeInvalidExpression, problem.Code)
+	assert.Contains(t, problem.Detail, "at position 30: expected '(' after by")
+
+	w = get("")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "empty expression")
+}
+
+// scopedReader включает у h аутентификацию по токенам и возвращает секрет токена
+// роли reader с областью действия prefixes.
+func scopedReader(t *testing.T, h *Handler, prefixes ...string) string {
+	t.Helper()
+	store, err := repository.NewFileTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+	tokens := service.NewTokenService(store)
+	h.EnableTokenAuth(tokens, testAdminKey)
+	issued, err := tokens.Issue(service.TokenRequest{Name: "scoped", Role: "reader", Prefixes: prefixes})
+	require.NoError(t, err)
+	return issued.Token
+}
+
+func TestQueryHandler_TokenScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &service.MetricsService{Storage: repository.NewMemStorage()}
+	require.NoError(t, ms.UpdateMetric("gauge", "app.Alloc", "1"))
+	require.NoError(t, ms.UpdateMetric("gauge", "db.Secret", "42"))
+	router := gin.New()
+	h := NewHandler(ms)
+	secret := scopedReader(t, h, "app.")
+	h.SetupRoutes(router)
+
+	query := func(expr string) service.QueryResult {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, APIPrefix+"/query?expr="+url.QueryEscape(expr), nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var res service.QueryResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		return res
+	}
+
+	assert.Empty(t, query("db.Secret").Result)
+	assert.Empty(t, query(`{__name__=~".*"} > 10`).Result)
+	assert.Equal(t, []service.QuerySample{{Value: 1}}, query("sum(*)").Result)
+	assert.Equal(t, []service.QuerySample{{Value: 1}}, query("count(*)").Result)
+	res := query("app.Alloc")
+	require.Len(t, res.Result, 1)
+	assert.Equal(t, "app.Alloc", res.Result[0].Metric)
+}
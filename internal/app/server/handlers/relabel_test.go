@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+func TestRelabelOnUpdate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ops := "ops.$1"
+	p, err := service.NewRelabelPipeline([]service.RelabelRule{
+		{Action: service.RelabelDrop, Regex: "RandomValue"},
+		{Regex: `CPUutilization(\d+)`, TargetLabel: "cpu"},
+		{Regex: `(CPUutilization)\d+`},
+		{SourceLabels: []string{"__client__", "__name__"}, Regex: `ip:.*;(Team.*)`, Replacement: &ops},
+	})
+	require.NoError(t, err)
+	ms := &service.MetricsService{Storage: repository.NewMemStorage(), Relabel: p}
+	router := gin.New()
+	NewHandler(ms).SetupRoutes(router)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Ответ содержит метрику под сохранённым именем.
+	w := post("/update/", `{"id":"CPUutilization2","type":"gauge","value":0.5}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"id":"CPUutilization{cpu=\"2\"}","type":"gauge","value":0.5}`, w.Body.String())
+
+	// Отброшенная метрика не записывается, а ответ повторяет присланную.
+	w = post(APIPrefix+"/metrics/gauge/RandomValue", `{"value":7}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"id":"RandomValue","type":"gauge","value":7}`, w.Body.String())
+	_, ok := ms.Storage.GetGaugeRaw("RandomValue")
+	assert.False(t, ok)
+
+	assert.Equal(t, http.StatusOK, post("/update/gauge/CPUutilization3/1", "").Code)
+	_, ok = ms.Storage.GetGaugeRaw(`CPUutilization{cpu="3"}`)
+	assert.True(t, ok)
+
+	// Правилам доступен клиент запроса (по умолчанию — адрес).
+	w = post("/update/", `{"id":"TeamLoad","type":"gauge","value":1}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"id":"ops.TeamLoad"`)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+// Параметры потока событий.
+const (
+	// DefaultStreamHeartbeat — период пульса, если Handler.StreamHeartbeat не задан.
+	DefaultStreamHeartbeat = 15 * time.Second
+	// streamRetry — пауза перед переподключением, которую сервер советует клиенту.
+	streamRetry = 3 * time.Second
+)
+
+// streamHandler отдаёт изменения метрик как Server-Sent Events.
+//
+// Параметры запроса: type (можно несколько или через запятую), name (glob) и regex —
+// как у списка метрик. Клиент продолжает поток с места обрыва по заголовку Last-Event-ID
+// (или параметру last_event_id). Если пропущенные события уже недоступны, первым
+// приходит событие reset. Пульс-комментарии не дают прокси закрыть простаивающее соединение.
+//
+// Медленный клиент не задерживает запись метрик: при переполнении его буфера сервер
+// закрывает поток, а клиент переподключается и дочитывает пропущенное.
+func (h *Handler) streamHandler(c *gin.Context) {
+	var types []string
+	for _, t := range c.QueryArray("type") {
+		types = append(types, strings.Split(t, ",")...)
+	}
+	match, err := service.EventFilter(types, c.Query("name"), c.Query("regex"))
+	if err != nil {
+		middleware.WriteProblem(c, err)
+		return
+	}
+	broker := h.ms.Events
+	if broker == nil {
+		middleware.WriteProblem(c, service.ErrStreamDisabled)
+		return
+	}
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	sub, replay := broker.Subscribe(allowedEvents(c, match), lastEventID, 0)
+	defer sub.Close()
+
+	heartbeat := h.StreamHeartbeat
+	if heartbeat <= 0 {
+		heartbeat = DefaultStreamHeartbeat
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	w := c.Writer
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds()); err != nil {
+		return
+	}
+	for _, e := range replay {
+		if writeEvent(w, broker, e) != nil {
+			return
+		}
+	}
+	w.Flush()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				// Подписка закрыта: клиент отстал или сервер останавливается.
+				return
+			}
+			if writeEvent(w, broker, e) != nil {
+				return
+			}
+		case now := <-ticker.C:
+			if _, err := fmt.Fprintf(w, ": heartbeat %s\n\n", now.UTC().Format(time.RFC3339)); err != nil {
+				return
+			}
+		}
+		w.Flush()
+	}
+}
+
+// writeEvent записывает событие в формате text/event-stream.
+func writeEvent(w gin.ResponseWriter, broker *service.Broker, e service.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", broker.EventID(e.ID), e.Kind, data)
+	return err
+}
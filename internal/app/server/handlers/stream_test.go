@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+// sseEvent — событие, прочитанное из потока; комментарии собираются в comments.
+type sseEvent struct {
+	id, event, data string
+	comments        []string
+}
+
+// readEvent читает поток до конца очередного события (пустой строки).
+func readEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+	var e sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if e.id != "" || e.event != "" || e.data != "" || len(e.comments) > 0 {
+				return e
+			}
+		case strings.HasPrefix(line, ":"):
+			e.comments = append(e.comments, strings.TrimSpace(line[1:]))
+		case strings.HasPrefix(line, "id: "):
+			e.id = line[len("id: "):]
+		case strings.HasPrefix(line, "event: "):
+			e.event = line[len("event: "):]
+		case strings.HasPrefix(line, "data: "):
+			e.data = line[len("data: "):]
+		}
+	}
+}
+
+// startStreamServer поднимает сервер с подписью и сжатием ответов, как cmd/server:
+// поток должен проходить через буферизующие middleware без задержек.
+func startStreamServer(t *testing.T) (*httptest.Server, *service.MetricsService) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ms := &service.MetricsService{Storage: repository.NewMemStorage(), Events: service.NewBroker(16)}
+	router := gin.New()
+	router.Use(middleware.HashRequestMiddleware("secret"))
+	router.Use(middleware.HashResponseMiddleware("secret"))
+	router.Use(middleware.GzipMiddleware())
+	h := NewHandler(ms)
+	h.StreamHeartbeat = 20 * time.Millisecond
+	h.SetupRoutes(router)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return srv, ms
+}
+
+func openStream(t *testing.T, ctx context.Context, url, lastEventID string) *bufio.Reader {
+	t.Helper()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Accept-Encoding", "gzip")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	r := bufio.NewReader(resp.Body)
+	assert.Equal(t, "retry: 3000\n", mustReadLine(t, r))
+	return r
+}
+
+func mustReadLine(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	return line
+}
+
+func TestStream_FiltersAndResumes(t *testing.T) {
+	srv, ms := startStreamServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := openStream(t, ctx, srv.URL+APIPrefix+"/stream?type=gauge&name=Heap*", "")
+	// Простаивающий поток получает пульс.
+	require.NotEmpty(t, readEvent(t, r).comments)
+
+	require.NoError(t, ms.UpdateMetric("counter", "HeapObjects", "1"))
+	require.NoError(t, ms.UpdateMetric("gauge", "Alloc", "1"))
+	require.NoError(t, ms.UpdateMetric("gauge", "HeapAlloc", "2.5"))
+	require.NoError(t, ms.DeleteMetric("gauge", "HeapAlloc"))
+
+	e := readEvent(t, r)
+	for len(e.comments) > 0 {
+		e = readEvent(t, r)
+	}
+	assert.Equal(t, service.EventUpdate, e.event)
+	var got service.Event
+	require.NoError(t, json.Unmarshal([]byte(e.data), &got))
+	assert.Equal(t, "HeapAlloc", got.Metric.ID)
+	require.NotNil(t, got.Metric.Value)
+	assert.Equal(t, 2.5, *got.Metric.Value)
+	updateID := e.id
+
+	e = readEvent(t, r)
+	for len(e.comments) > 0 {
+		e = readEvent(t, r)
+	}
+	assert.Equal(t, service.EventDelete, e.event)
+	cancel()
+
+	// После переподключения пропущенные события дочитываются из истории.
+	require.NoError(t, ms.UpdateMetric("gauge", "HeapInuse", "7"))
+	r = openStream(t, context.Background(), srv.URL+APIPrefix+"/stream?type=gauge&name=Heap*", updateID)
+	var kinds []string
+	for len(kinds) < 2 {
+		if e := readEvent(t, r); e.event != "" {
+			kinds = append(kinds, e.event+" "+eventMetricID(t, e.data))
+		}
+	}
+	assert.Equal(t, []string{"delete HeapAlloc", "update HeapInuse"}, kinds)
+}
+
+func TestStream_ResetOnUnknownID(t *testing.T) {
+	srv, _ := startStreamServer(t)
+	r := openStream(t, context.Background(), srv.URL+APIPrefix+"/stream", "previous-run-42")
+	e := readEvent(t, r)
+	assert.Equal(t, service.EventReset, e.event)
+	assert.NotEmpty(t, e.id)
+}
+
+func TestStream_EndsOnBrokerClose(t *testing.T) {
+	srv, ms := startStreamServer(t)
+	r := openStream(t, context.Background(), srv.URL+APIPrefix+"/stream", "")
+	ms.Events.Close()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		assert.True(t, line == "\n" || strings.HasPrefix(line, ":"), "unexpected line %q", line)
+	}
+}
+
+func eventMetricID(t *testing.T, data string) string {
+	t.Helper()
+	var e service.Event
+	require.NoError(t, json.Unmarshal([]byte(data), &e))
+	return e.Metric.ID
+}
@@ -35,3 +35,39 @@ func TestUpdateBatchHandler(t *testing.T) {
 		t.Fatalf("status=%d", rr.Code)
 	}
 }
+
+func TestUpdateBatchModes(t *testing.T) {
+	router, _ := setupRouter()
+	d := int64(1)
+	batch := []middleware.MetricsJSON{
+		{ID: "C", MType: middleware.CounterMetric, Delta: &d},
+		{ID: "C", MType: middleware.CounterMetric},
+	}
+
+	rr := postJSON(t, router, "/updates/?mode=partial", batch)
+	if rr.Code != http.StatusMultiStatus {
+		t.Fatalf("partial: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var res service.BatchResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if res.Applied != 1 || res.Results[1].Error.Code != service.CodeValueRequired {
+		t.Fatalf("unexpected result: %s", rr.Body.String())
+	}
+
+	rr = postJSON(t, router, "/updates/?mode=atomic", batch)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("atomic: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = postJSON(t, router, "/updates/?mode=atomic", batch[:1])
+	if rr.Code != http.StatusOK {
+		t.Fatalf("atomic ok: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = postJSON(t, router, "/updates/?mode=best-effort", batch)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("unknown mode: status=%d", rr.Code)
+	}
+}
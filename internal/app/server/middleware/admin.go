@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// AdminKeyHeader — альтернативный заголовок для передачи административного ключа.
+const AdminKeyHeader = "X-Admin-Key"
+
+// AdminAuthMiddleware защищает административные маршруты ключом администратора.
+// Ключ передаётся в заголовке "Authorization: Bearer <key>" или X-Admin-Key.
+// Если ключ на сервере не задан, административный API отключён и отвечает 403.
+func AdminAuthMiddleware(adminKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminKey == "" {
+			WriteProblem(c, errAdminDisabled)
+			return
+		}
+
+		provided := credential(c)
+		if provided == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(adminKey)) != 1 {
+			WriteProblem(c, errUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
+
+// credential возвращает ключ или токен из заголовков X-Admin-Key, X-API-Token
+// или "Authorization: Bearer".
+func credential(c *gin.Context) string {
+	for _, header := range []string{AdminKeyHeader, TokenHeader} {
+		if v := c.GetHeader(header); v != "" {
+			return v
+		}
+	}
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// AdminAuditMiddleware записывает в лог каждую административную операцию,
+// включая отклонённые попытки доступа.
+func AdminAuditMiddleware(logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		logger.WithFields(logrus.Fields{
+			"method": c.Request.Method,
+			"uri":    c.Request.RequestURI,
+			"status": c.Writer.Status(),
+			"client": c.ClientIP(),
+		}).Warn("Admin operation")
+	}
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
+
+// TokenHeader — альтернативный заголовок для передачи API-токена.
+const TokenHeader = "X-API-Token"
+
+// tokenContextKey — ключ gin.Context, под которым сохраняется токен запроса.
+const tokenContextKey = "hobrusmetrics.token"
+
+// Authenticator находит токен по секрету. Его реализует service.TokenService;
+// неизвестный секрет — ошибка со статусом 401.
+type Authenticator interface {
+	Authenticate(secret string) (models.Token, error)
+}
+
+// adminKeyToken — токен, которым считается ключ администратора сервера.
+var adminKeyToken = models.Token{ID: "admin-key", Name: "admin key", Role: models.RoleAdmin}
+
+// TokenAuthMiddleware пропускает запросы с токеном роли не ниже role. Токен передаётся
+// в заголовке "Authorization: Bearer <token>" или X-API-Token; ключ администратора
+// adminKey (если задан) действует как токен роли admin.
+//
+// Если в пути маршрута есть параметр :name, метрика должна входить в область действия токена.
+// Токен сохраняется в контексте запроса (см. TokenFromContext).
+func TokenAuthMiddleware(auth Authenticator, adminKey string, role models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := TokenFromContext(c)
+		if !ok {
+			secret := credential(c)
+			if secret == "" {
+				WriteProblem(c, errTokenRequired)
+				return
+			}
+			var err error
+			if token, err = authenticate(secret, auth, adminKey); err != nil {
+				WriteProblem(c, err)
+				return
+			}
+		}
+		if !token.Role.Includes(role) {
+			WriteProblem(c, NewProblem(http.StatusForbidden, CodeForbidden, "insufficient permissions",
+				fmt.Sprintf("%s role is required", role)))
+			return
+		}
+		if name := c.Param("name"); name != "" && !token.Covers(name) {
+			WriteProblem(c, ScopeError(name))
+			return
+		}
+		c.Set(tokenContextKey, token)
+		c.Next()
+	}
+}
+
+// authenticate находит токен по секрету: ключ администратора adminKey (если задан) — токен
+// роли admin, остальные секреты проверяет auth.
+func authenticate(secret string, auth Authenticator, adminKey string) (models.Token, error) {
+	if adminKey != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(adminKey)) == 1 {
+		return adminKeyToken, nil
+	}
+	if auth == nil {
+		return models.Token{}, errInvalidToken
+	}
+	return auth.Authenticate(secret)
+}
+
+// TokenFromContext возвращает токен, с которым выполнен запрос.
+func TokenFromContext(c *gin.Context) (models.Token, bool) {
+	v, ok := c.Get(tokenContextKey)
+	if !ok {
+		return models.Token{}, false
+	}
+	token, ok := v.(models.Token)
+	return token, ok
+}
+
+// AllowsMetric сообщает, доступна ли метрика name запросу c. Без аутентификации доступно всё.
+func AllowsMetric(c *gin.Context, name string) bool {
+	token, ok := TokenFromContext(c)
+	return !ok || token.Covers(name)
+}
+
+// ScopeError — ошибка обращения к метрике вне области действия токена.
+func ScopeError(name string) error {
+	return NewProblem(http.StatusForbidden, CodeForbidden, "insufficient permissions",
+		fmt.Sprintf("metric %q is outside the token scope", name))
+}
@@ -1,7 +1,6 @@
 package middleware
 
 import (
-	"bytes"
 	"compress/gzip"
 	"io"
 	"mime"
@@ -57,6 +56,12 @@ func (g *gzipWriter) WriteString(s string) (int, error) {
 	return g.writer.Write([]byte(s))
 }
 
+// Flush сбрасывает уже сжатые данные клиенту (нужно потоковым ответам).
+func (g *gzipWriter) Flush() {
+	_ = g.writer.Flush()
+	g.ResponseWriter.Flush()
+}
+
 // isGzipCompatible проверяет, подходит ли ответ для сжатия.
 func isGzipCompatible(c *gin.Context) bool {
 	// Проверяем, что клиент поддерживает gzip
@@ -109,22 +114,10 @@ func GzipMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Если запрос пришёл с заголовком Content-Encoding: gzip – распаковываем тело
 		if strings.Contains(c.Request.Header.Get("Content-Encoding"), "gzip") {
-			reader, err := gzip.NewReader(c.Request.Body)
-			if err != nil {
-				c.AbortWithStatus(http.StatusBadRequest)
-				return
-			}
-			defer reader.Close()
-
-			body, err := io.ReadAll(reader)
-			if err != nil {
-				c.AbortWithStatus(http.StatusBadRequest)
+			if err := gunzipBody(c, c.Request.Body); err != nil {
+				WriteProblem(c, err)
 				return
 			}
-
-			c.Request.Body = io.NopCloser(bytes.NewReader(body))
-			c.Request.Header.Del("Content-Encoding")
-			c.Request.ContentLength = int64(len(body))
 		}
 
 		// Если ответ можно сжать – оборачиваем ResponseWriter в gzipWriter
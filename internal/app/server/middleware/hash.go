@@ -2,7 +2,6 @@ package middleware
 
 import (
 	"bytes"
-	"compress/gzip"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -43,9 +42,9 @@ func HashRequestMiddleware(key string) gin.HandlerFunc {
 			var err error
 
 			// Читаем тело запроса в исходном виде (как оно пришло по сети)
-			bodyBytes, err = io.ReadAll(c.Request.Body)
+			bodyBytes, err = readBody(c)
 			if err != nil {
-				c.AbortWithStatus(http.StatusBadRequest)
+				WriteProblem(c, err)
 				return
 			}
 
@@ -55,28 +54,17 @@ func HashRequestMiddleware(key string) gin.HandlerFunc {
 
 			// Если заголовок присутствует – проверяем корректность; если его нет – пропускаем проверку.
 			if receivedHash != "" && receivedHash != computedHash {
-				c.AbortWithStatus(http.StatusBadRequest)
+				WriteProblem(c, errInvalidHash)
 				return
 			}
 
 			// Если запрос был сжат gzip, распаковываем его для последующих обработчиков
+			// (заголовок Content-Encoding снимается, чтобы последующие middleware не распаковывали тело снова).
 			if c.Request.Header.Get("Content-Encoding") == "gzip" {
-				gr, err := gzip.NewReader(bytes.NewReader(bodyBytes))
-				if err != nil {
-					c.AbortWithStatus(http.StatusBadRequest)
+				if err := gunzipBody(c, bytes.NewReader(bodyBytes)); err != nil {
+					WriteProblem(c, err)
 					return
 				}
-				decompressedData, err := io.ReadAll(gr)
-				gr.Close()
-				if err != nil {
-					c.AbortWithStatus(http.StatusBadRequest)
-					return
-				}
-				// Восстанавливаем тело запроса с распакованными данными
-				c.Request.Body = io.NopCloser(bytes.NewBuffer(decompressedData))
-				// Убираем заголовок, чтобы последующие middleware не пытались снова распаковывать тело
-				c.Request.Header.Del("Content-Encoding")
-				c.Request.ContentLength = int64(len(decompressedData))
 			} else {
 				// Восстанавливаем тело запроса для последующих обработчиков
 				c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
@@ -88,19 +76,40 @@ func HashRequestMiddleware(key string) gin.HandlerFunc {
 
 // hashResponseWriter – обёртка для ResponseWriter, которая буферизует ответ.
 // Используется для вычисления подписи по итоговому телу ответа.
+//
+// Потоковые ответы (обработчик вызывает Flush) подписать нельзя: тело не известно
+// заранее. После первого Flush обёртка сбрасывает накопленное и дальше пишет напрямую.
 type hashResponseWriter struct {
 	gin.ResponseWriter
-	body *bytes.Buffer
+	body      *bytes.Buffer
+	streaming bool
 }
 
 func (w *hashResponseWriter) Write(data []byte) (int, error) {
+	if w.streaming {
+		return w.ResponseWriter.Write(data)
+	}
 	return w.body.Write(data)
 }
 
 func (w *hashResponseWriter) WriteString(s string) (int, error) {
+	if w.streaming {
+		return w.ResponseWriter.WriteString(s)
+	}
 	return w.body.WriteString(s)
 }
 
+// Flush переводит ответ в потоковый режим без подписи.
+func (w *hashResponseWriter) Flush() {
+	if !w.streaming {
+		w.streaming = true
+		w.ResponseWriter.WriteHeaderNow()
+		_, _ = w.ResponseWriter.Write(w.body.Bytes())
+		w.body.Reset()
+	}
+	w.ResponseWriter.Flush()
+}
+
 // HashResponseMiddleware вычисляет HMAC от сформированного ответа и добавляет его в заголовок "HashSHA256".
 func HashResponseMiddleware(key string) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -113,6 +122,9 @@ func HashResponseMiddleware(key string) gin.HandlerFunc {
 
 		c.Next()
 
+		if writer.streaming {
+			return
+		}
 		responseData := writer.body.Bytes()
 		// Генерируем подпись только если ключ задан и не равен "none"
 		if key != "" && key != "none" && len(responseData) > 0 {
@@ -2,32 +2,63 @@ package middleware
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
 )
 
 // MetricType представляет допустимые типы метрик в JSON.
 type MetricType string
 
 const (
-	CounterMetric MetricType = "counter"
-	GaugeMetric   MetricType = "gauge"
+	CounterMetric   MetricType = "counter"
+	GaugeMetric     MetricType = "gauge"
+	HistogramMetric MetricType = models.HistogramType
+	SummaryMetric   MetricType = models.SummaryType
+	SketchMetric    MetricType = models.SketchType
+	SetMetric       MetricType = models.SetType
 )
 
 // MetricsJSON — форма JSON-представления метрики для REST-эндпоинтов.
+// Для histogram, summary и sketch передаётся либо одно наблюдение в value,
+// либо уже агрегированное значение в одноимённом поле; для set — элементы в members
+// или сериализованный скетч в поле set.
 type MetricsJSON struct {
-	ID    string     `json:"id"`
-	MType MetricType `json:"type"`
-	Delta *int64     `json:"delta,omitempty"`
-	Value *float64   `json:"value,omitempty"`
+	ID      string     `json:"id"`
+	MType   MetricType `json:"type"`
+	Delta   *int64     `json:"delta,omitempty"`
+	Value   *float64   `json:"value,omitempty"`
+	Members []string   `json:"members,omitempty"`
+
+	models.CompositeFields
+}
+
+// StoredNamer — сервис, который при записи может переименовать или отбросить метрику
+// (переразметка, выборка новых рядов). Ответ на обновление содержит метрику под
+// сохранённым именем, а для отброшенной — присланную метрику без изменений.
+type StoredNamer interface {
+	StoredName(metricType, metricName string) (string, bool)
+}
+
+// storedName возвращает имя, под которым сохранена метрика, и false, если она отброшена.
+func storedName(metricsService any, metricType, metricName string) (string, bool) {
+	if n, ok := metricsService.(StoredNamer); ok {
+		return n.StoredName(metricType, metricName)
+	}
+	return metricName, true
 }
 
 type MetricService interface {
 	UpdateMetric(metricType, metricName, metricValue string) error
 	GetMetricValue(metricType, metricName string) (string, error)
+	UpdateComposite(metricName string, value models.Composite) error
+	GetComposite(metricType, metricName string) (models.Composite, error)
+	AddSetMembers(metricName string, members []string) error
 }
 
 // JSONUpdateMiddleware обрабатывает POST /update/ для обновления одной метрики.
@@ -36,99 +67,183 @@ func JSONUpdateMiddleware(metricsService MetricService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var metric MetricsJSON
 		if err := json.NewDecoder(c.Request.Body).Decode(&metric); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON format"})
+			WriteProblem(c, ErrInvalidJSON)
 			return
 		}
 		if metric.ID == "" || metric.MType == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "id and type are required"})
+			WriteProblem(c, NewProblem(http.StatusBadRequest, CodeInvalidRequest, "invalid request", "id and type are required"))
 			return
 		}
+		UpdateMetricJSON(c, metricsService, metric)
+	}
+}
 
-		mt := strings.ToLower(string(metric.MType))
-		var value string
-		switch mt {
-		case string(CounterMetric):
-			if metric.Delta == nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "delta is required for counter"})
-				return
-			}
-			value = strconv.FormatInt(*metric.Delta, 10)
-		case string(GaugeMetric):
-			if metric.Value == nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "value is required for gauge"})
-				return
-			}
-			value = strconv.FormatFloat(*metric.Value, 'f', -1, 64)
-		default:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid metric type"})
-			return
-		}
+// UpdateMetricJSON обновляет метрику metric и отвечает её актуальным значением в JSON.
+// Используется маршрутами POST /update/ и POST /api/v1/metrics/:type/:name.
+func UpdateMetricJSON(c *gin.Context, metricsService MetricService, metric MetricsJSON) {
+	if !AllowsMetric(c, metric.ID) {
+		WriteProblem(c, ScopeError(metric.ID))
+		return
+	}
+	mt := strings.ToLower(string(metric.MType))
+	if models.IsComposite(mt) {
+		updateComposite(c, metricsService, metric, mt)
+		return
+	}
 
-		if err := metricsService.UpdateMetric(mt, metric.ID, value); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var value string
+	switch mt {
+	case string(CounterMetric):
+		if metric.Delta == nil {
+			WriteProblem(c, valueRequired("delta is required for counter"))
 			return
 		}
-
-		updatedValue, err := metricsService.GetMetricValue(mt, metric.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get updated value"})
+		value = strconv.FormatInt(*metric.Delta, 10)
+	case string(GaugeMetric):
+		if metric.Value == nil {
+			WriteProblem(c, valueRequired("value is required for gauge"))
 			return
 		}
+		value = strconv.FormatFloat(*metric.Value, 'f', -1, 64)
+	default:
+		WriteProblem(c, NewProblem(http.StatusBadRequest, CodeUnsupportedType, "unsupported metric type", ""))
+		return
+	}
 
-		response := MetricsJSON{
-			ID:    metric.ID,
-			MType: MetricType(mt),
-		}
-		switch mt {
-		case string(CounterMetric):
-			delta, _ := strconv.ParseInt(updatedValue, 10, 64)
-			response.Delta = &delta
-		case string(GaugeMetric):
-			val, _ := strconv.ParseFloat(updatedValue, 64)
-			response.Value = &val
-		}
+	if err := metricsService.UpdateMetric(mt, metric.ID, value); err != nil {
+		WriteProblem(c, err)
+		return
+	}
+	name, stored := storedName(metricsService, mt, metric.ID)
+	if !stored {
+		c.JSON(http.StatusOK, metric)
+		return
+	}
 
-		c.JSON(http.StatusOK, response)
+	updatedValue, err := metricsService.GetMetricValue(mt, name)
+	if err != nil {
+		WriteProblem(c, fmt.Errorf("failed to get updated value: %w", err))
+		return
+	}
+
+	response := MetricsJSON{
+		ID:    name,
+		MType: MetricType(mt),
+	}
+	switch mt {
+	case string(CounterMetric):
+		delta, _ := strconv.ParseInt(updatedValue, 10, 64)
+		response.Delta = &delta
+	case string(GaugeMetric):
+		val, _ := strconv.ParseFloat(updatedValue, 64)
+		response.Value = &val
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// valueRequired — ошибка запроса без значения метрики.
+func valueRequired(detail string) error {
+	return NewProblem(http.StatusBadRequest, CodeValueRequired, "metric value is required", detail)
+}
+
+// updateComposite обновляет составную метрику: агрегированное значение объединяется с сохранённым,
+// одно наблюдение в value передаётся сервису как обычное обновление, элементы set — списком.
+func updateComposite(c *gin.Context, metricsService MetricService, metric MetricsJSON, mt string) {
+	var err error
+	if value, ok := metric.Composite(mt); ok {
+		err = metricsService.UpdateComposite(metric.ID, value)
+	} else if mt == string(SetMetric) && len(metric.Members) > 0 {
+		err = metricsService.AddSetMembers(metric.ID, metric.Members)
+	} else if metric.Value != nil && mt != string(SetMetric) {
+		err = metricsService.UpdateMetric(mt, metric.ID, strconv.FormatFloat(*metric.Value, 'f', -1, 64))
+	} else {
+		WriteProblem(c, valueRequired("a value is required for "+mt))
+		return
+	}
+	if err != nil {
+		WriteProblem(c, err)
+		return
 	}
+
+	name, stored := storedName(metricsService, mt, metric.ID)
+	if !stored {
+		c.JSON(http.StatusOK, metric)
+		return
+	}
+
+	updated, err := metricsService.GetComposite(mt, name)
+	if err != nil {
+		WriteProblem(c, fmt.Errorf("failed to get updated value: %w", err))
+		return
+	}
+	response := MetricsJSON{ID: name, MType: MetricType(mt)}
+	response.SetComposite(updated)
+	c.JSON(http.StatusOK, response)
 }
 
 // JSONValueMiddleware обрабатывает POST /value/ для получения значения метрики.
 // Если в JSON не переданы id или type – возвращает 404 (metric not found).
-func JSONValueMiddleware(metricsService interface {
-	GetMetricValue(metricType, metricName string) (string, error)
-}) gin.HandlerFunc {
+func JSONValueMiddleware(metricsService MetricReader) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var metric MetricsJSON
 		if err := json.NewDecoder(c.Request.Body).Decode(&metric); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON format"})
+			WriteProblem(c, ErrInvalidJSON)
 			return
 		}
 		// Если отсутствуют обязательные поля – возвращаем 404, как того требуют автотесты.
 		if metric.ID == "" || metric.MType == "" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "metric not found"})
+			WriteProblem(c, errNotFound)
 			return
 		}
+		GetMetricJSON(c, metricsService, metric)
+	}
+}
 
-		mt := strings.ToLower(string(metric.MType))
-		value, err := metricsService.GetMetricValue(mt, metric.ID)
+// MetricReader — чтение значений метрик, необходимое для ответов в JSON.
+type MetricReader interface {
+	GetMetricValue(metricType, metricName string) (string, error)
+	GetComposite(metricType, metricName string) (models.Composite, error)
+}
+
+// GetMetricJSON отвечает значением метрики с именем и типом из metric.
+// Используется маршрутами POST /value/ и GET /api/v1/metrics/:type/:name.
+func GetMetricJSON(c *gin.Context, metricsService MetricReader, metric MetricsJSON) {
+	if !AllowsMetric(c, metric.ID) {
+		WriteProblem(c, ScopeError(metric.ID))
+		return
+	}
+	mt := strings.ToLower(string(metric.MType))
+	if models.IsComposite(mt) {
+		value, err := metricsService.GetComposite(mt, metric.ID)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "metric not found"})
+			WriteProblem(c, err)
 			return
 		}
+		response := MetricsJSON{ID: metric.ID, MType: MetricType(mt)}
+		response.SetComposite(value)
+		c.JSON(http.StatusOK, response)
+		return
+	}
 
-		response := MetricsJSON{
-			ID:    metric.ID,
-			MType: MetricType(mt),
-		}
-		switch mt {
-		case string(CounterMetric):
-			delta, _ := strconv.ParseInt(value, 10, 64)
-			response.Delta = &delta
-		case string(GaugeMetric):
-			val, _ := strconv.ParseFloat(value, 64)
-			response.Value = &val
-		}
+	value, err := metricsService.GetMetricValue(mt, metric.ID)
+	if err != nil {
+		WriteProblem(c, err)
+		return
+	}
 
-		c.JSON(http.StatusOK, response)
+	response := MetricsJSON{
+		ID:    metric.ID,
+		MType: MetricType(mt),
+	}
+	switch mt {
+	case string(CounterMetric):
+		delta, _ := strconv.ParseInt(value, 10, 64)
+		response.Delta = &delta
+	case string(GaugeMetric):
+		val, _ := strconv.ParseFloat(value, 64)
+		response.Value = &val
 	}
+
+	c.JSON(http.StatusOK, response)
 }
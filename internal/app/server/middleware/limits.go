@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ограничения размера тела запроса по умолчанию.
+const (
+	// DefaultMaxBodySize — тело запроса в том виде, в котором оно пришло по сети.
+	DefaultMaxBodySize int64 = 10 << 20
+	// DefaultMaxDecompressedSize — тело после распаковки gzip.
+	DefaultMaxDecompressedSize int64 = 50 << 20
+)
+
+// bodyLimitsKey — ключ gin.Context с ограничениями BodyLimitMiddleware.
+const bodyLimitsKey = "hobrusmetrics.body_limits"
+
+// CodeBodyTooLarge — код ответа 413 на слишком большое тело запроса.
+const CodeBodyTooLarge = "body_too_large"
+
+type bodyLimits struct {
+	body, decompressed int64
+}
+
+// BodyLimitMiddleware ограничивает размер тела запроса: maxBody — по сети,
+// maxDecompressed — после распаковки gzip (0 — значения по умолчанию).
+// Должен стоять перед HashRequestMiddleware и GzipMiddleware: они читают тело
+// с учётом этих ограничений и отвечают 413, не дочитывая лишнего.
+func BodyLimitMiddleware(maxBody, maxDecompressed int64) gin.HandlerFunc {
+	if maxBody <= 0 {
+		maxBody = DefaultMaxBodySize
+	}
+	if maxDecompressed <= 0 {
+		maxDecompressed = DefaultMaxDecompressedSize
+	}
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBody {
+			WriteProblem(c, bodyTooLarge(maxBody))
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
+		c.Set(bodyLimitsKey, bodyLimits{body: maxBody, decompressed: maxDecompressed})
+		c.Next()
+	}
+}
+
+// limitsOf возвращает ограничения запроса; без BodyLimitMiddleware — значения по умолчанию.
+func limitsOf(c *gin.Context) bodyLimits {
+	if v, ok := c.Get(bodyLimitsKey); ok {
+		return v.(bodyLimits)
+	}
+	return bodyLimits{body: DefaultMaxBodySize, decompressed: DefaultMaxDecompressedSize}
+}
+
+func bodyTooLarge(limit int64) error {
+	return NewProblem(http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "request body is too large",
+		fmt.Sprintf("request body exceeds %d bytes", limit))
+}
+
+// readAtMost читает r целиком, но не больше limit байт.
+func readAtMost(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxErr):
+		return nil, bodyTooLarge(maxErr.Limit)
+	case err != nil:
+		return nil, errInvalidBody
+	case int64(len(data)) > limit:
+		return nil, bodyTooLarge(limit)
+	}
+	return data, nil
+}
+
+// readBody читает тело запроса в пределах ограничения на размер по сети.
+func readBody(c *gin.Context) ([]byte, error) {
+	return readAtMost(c.Request.Body, limitsOf(c).body)
+}
+
+// gunzipBody распаковывает тело запроса в пределах ограничения на распакованный размер
+// и подставляет результат вместо исходного тела.
+func gunzipBody(c *gin.Context, compressed io.Reader) error {
+	gr, err := gzip.NewReader(compressed)
+	if err != nil {
+		return errInvalidBody
+	}
+	defer gr.Close()
+	data, err := readAtMost(gr, limitsOf(c).decompressed)
+	if err != nil {
+		return err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(data))
+	c.Request.Header.Del("Content-Encoding")
+	c.Request.ContentLength = int64(len(data))
+	return nil
+}
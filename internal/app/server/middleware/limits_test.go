@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestBodyLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newRouter := func(mw ...gin.HandlerFunc) *gin.Engine {
+		router := gin.New()
+		router.Use(BodyLimitMiddleware(4096, 1024))
+		router.Use(mw...)
+		router.POST("/", func(c *gin.Context) {
+			body, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				WriteProblem(c, errInvalidBody)
+				return
+			}
+			c.String(http.StatusOK, "%d", len(body))
+		})
+		return router
+	}
+	post := func(router *gin.Engine, body []byte, compressed bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		if compressed {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	bomb := gzipped(t, make([]byte, 1<<20)) // ~1 КиБ по сети, 1 МиБ после распаковки
+	small := gzipped(t, make([]byte, 512))
+	for name, router := range map[string]*gin.Engine{
+		"gzip": newRouter(GzipMiddleware()),
+		"hash": newRouter(HashRequestMiddleware("key"), GzipMiddleware()),
+	} {
+		if w := post(router, small, true); w.Code != http.StatusOK || w.Body.String() != "512" {
+			t.Fatalf("%s: small body must pass, got %d %s", name, w.Code, w.Body.String())
+		}
+		if w := post(router, bomb, true); w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s: expected 413 for a gzip bomb, got %d %s", name, w.Code, w.Body.String())
+		}
+		if w := post(router, make([]byte, 4097), false); w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s: expected 413 for an oversized body, got %d", name, w.Code)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType — тип содержимого ответов об ошибках (RFC 7807).
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix — префикс URI поля type; к нему добавляется код ошибки.
+const problemTypePrefix = "urn:hobrusmetrics:problem:"
+
+// Коды ошибок, которые формирует транспортный уровень. Коды ошибок предметной области
+// перечислены в каталоге сервисного слоя (service.Code*); общие коды он берёт отсюда.
+const (
+	CodeInvalidJSON      = "invalid_json"
+	CodeInvalidRequest   = "invalid_request"
+	CodeInvalidSignature = "invalid_signature"
+	CodeInvalidEncoding  = "invalid_encoding"
+	CodeUnauthorized     = "unauthorized"
+	CodeAdminDisabled    = "admin_disabled"
+	CodeInvalidToken     = "invalid_token"
+	CodeForbidden        = "forbidden"
+	CodeUnsupportedType  = "unsupported_type"
+	CodeValueRequired    = "value_required"
+	CodeMetricNotFound   = "metric_not_found"
+	CodeInternal         = "internal"
+)
+
+// ProblemError — ошибка с машиночитаемым кодом и HTTP-статусом.
+// Её реализуют ошибки каталога сервисного слоя; middleware зависит только от интерфейса,
+// поэтому не импортирует пакет service.
+type ProblemError interface {
+	error
+	ProblemCode() string
+	ProblemStatus() int
+	ProblemTitle() string
+}
+
+// Problem — тело ответа application/problem+json. Code — стабильный машиночитаемый код,
+// Extensions — дополнительные поля ответа (например, частичный результат операции).
+type Problem struct {
+	Type       string         `json:"type"`
+	Title      string         `json:"title"`
+	Status     int            `json:"status"`
+	Detail     string         `json:"detail,omitempty"`
+	Instance   string         `json:"instance,omitempty"`
+	Code       string         `json:"code"`
+	Extensions map[string]any `json:"-"`
+}
+
+// MarshalJSON добавляет расширения на верхний уровень объекта, как того требует RFC 7807.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type plain Problem
+	raw, err := json.Marshal(plain(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return raw, err
+	}
+	fields := make(map[string]any, len(p.Extensions))
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range p.Extensions {
+		if _, reserved := fields[k]; !reserved {
+			fields[k] = v
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// problemError — ошибка транспортного уровня с кодом и статусом.
+type problemError struct {
+	status int
+	code   string
+	title  string
+	detail string
+}
+
+// NewProblem создаёт ошибку с кодом code и статусом status. detail уточняет title
+// для конкретного случая и может быть пустым.
+func NewProblem(status int, code, title, detail string) error {
+	return &problemError{status: status, code: code, title: title, detail: detail}
+}
+
+func (e *problemError) Error() string {
+	if e.detail != "" {
+		return e.detail
+	}
+	return e.title
+}
+
+func (e *problemError) ProblemCode() string  { return e.code }
+func (e *problemError) ProblemStatus() int   { return e.status }
+func (e *problemError) ProblemTitle() string { return e.title }
+
+// Типовые ошибки транспортного уровня.
+var (
+	ErrInvalidJSON   = NewProblem(http.StatusBadRequest, CodeInvalidJSON, "invalid JSON format", "")
+	errInvalidBody   = NewProblem(http.StatusBadRequest, CodeInvalidEncoding, "request body cannot be read", "")
+	errInvalidHash   = NewProblem(http.StatusBadRequest, CodeInvalidSignature, "request signature mismatch", "")
+	errAdminDisabled = NewProblem(http.StatusForbidden, CodeAdminDisabled, "admin API is disabled", "")
+	errUnauthorized  = NewProblem(http.StatusUnauthorized, CodeUnauthorized, "invalid admin credentials", "")
+	errNotFound      = NewProblem(http.StatusNotFound, CodeMetricNotFound, "metric not found", "")
+	errTokenRequired = NewProblem(http.StatusUnauthorized, CodeInvalidToken, "API token is required", "")
+	errInvalidToken  = NewProblem(http.StatusUnauthorized, CodeInvalidToken, "invalid API token", "")
+)
+
+// NewProblemBody строит тело ответа для ошибки err. Ошибки без кода считаются внутренними.
+func NewProblemBody(c *gin.Context, err error) Problem {
+	p := Problem{
+		Title:    "internal server error",
+		Status:   http.StatusInternalServerError,
+		Code:     CodeInternal,
+		Detail:   err.Error(),
+		Instance: c.Request.URL.Path,
+	}
+	var pe ProblemError
+	if errors.As(err, &pe) {
+		p.Title, p.Status, p.Code = pe.ProblemTitle(), pe.ProblemStatus(), pe.ProblemCode()
+	}
+	if p.Detail == p.Title {
+		p.Detail = ""
+	}
+	p.Type = problemTypePrefix + p.Code
+	return p
+}
+
+// WriteProblemBody отвечает готовым телом application/problem+json и прерывает цепочку обработчиков.
+func WriteProblemBody(c *gin.Context, p Problem) {
+	c.Header("Content-Type", ProblemContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// WriteProblem отвечает на ошибку err телом application/problem+json.
+func WriteProblem(c *gin.Context, err error) {
+	WriteProblemBody(c, NewProblemBody(c, err))
+}
+
+// WantsProblem сообщает, что клиент принимает JSON. Маршруты с параметрами в пути
+// по умолчанию отвечают текстом и переходят на problem+json только по заголовку Accept.
+func WantsProblem(c *gin.Context) bool {
+	accept := c.GetHeader("Accept")
+	return strings.Contains(accept, ProblemContentType) || strings.Contains(accept, "application/json")
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWriteProblem(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/known", func(c *gin.Context) {
+		p := NewProblemBody(c, NewProblem(http.StatusConflict, "some_code", "title", "detail"))
+		p.Extensions = map[string]any{"deleted": []string{"a"}, "status": 200}
+		WriteProblemBody(c, p)
+	})
+	router.GET("/unknown", func(c *gin.Context) { WriteProblem(c, errors.New("boom")) })
+	router.GET("/admin", AdminAuthMiddleware(""), func(c *gin.Context) {})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/known", nil))
+	if rr.Code != http.StatusConflict || rr.Header().Get("Content-Type") != ProblemContentType {
+		t.Fatalf("unexpected response: %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var body map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body["code"] != "some_code" || body["detail"] != "detail" || body["instance"] != "/known" {
+		t.Fatalf("unexpected body: %v", body)
+	}
+	if body["status"] != float64(http.StatusConflict) {
+		t.Fatalf("extensions must not override standard members: %v", body)
+	}
+	if _, ok := body["deleted"]; !ok {
+		t.Fatalf("extension member missing: %v", body)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	var p Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rr.Code != http.StatusInternalServerError || p.Code != CodeInternal || p.Detail != "boom" {
+		t.Fatalf("unknown errors must be internal: %d %+v", rr.Code, p)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin", nil))
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil || p.Code != CodeAdminDisabled || rr.Code != http.StatusForbidden {
+		t.Fatalf("admin disabled: %d %+v %v", rr.Code, p, err)
+	}
+}
@@ -0,0 +1,259 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
+
+// AgentIDHeader — заголовок, которым агент сообщает свой идентификатор.
+const AgentIDHeader = "X-Agent-ID"
+
+// CodeRateLimited — код ответа 429.
+const CodeRateLimited = "rate_limited"
+
+// Способы определить клиента для ограничения частоты запросов.
+const (
+	// ClientByIP — по адресу клиента.
+	ClientByIP = "ip"
+	// ClientByToken — по проверенному API-токену или ключу администратора; остальные
+	// запросы — по адресу.
+	ClientByToken = "token"
+	// ClientByAgent — по заголовку X-Agent-ID в пределах проверенного токена; запросы
+	// без проверенного токена — по адресу, заголовок X-Agent-ID у них не учитывается.
+	ClientByAgent = "agent"
+)
+
+// ClientIdentity возвращает функцию, определяющую клиента запроса способом by
+// (ClientByIP, ClientByToken или ClientByAgent).
+//
+// Клиентом считается только то, что клиент не может подменить: идентификатор токена,
+// проверенного auth (или совпадающего с ключом администратора adminKey), либо адрес.
+// Запрос с неизвестным секретом учитывается по адресу, поэтому новый секрет
+// или X-Agent-ID в каждом запросе не даёт новой корзины. auth равен nil, если
+// аутентификация по токенам выключена.
+//
+// Проверка секрета может идти в базу данных, поэтому проверенные токены запоминаются
+// на TokenCacheTTL, а остальные проверки ограничены корзиной адреса в lookups
+// (nil — без ограничения): поток случайных секретов не превращается в поток запросов
+// к хранилищу. Запомненный токен определяет только клиента; в контекст запроса для
+// TokenAuthMiddleware попадает лишь токен, проверенный в этом запросе, так что отзыв
+// токена действует сразу.
+func ClientIdentity(by string, auth Authenticator, adminKey string, lookups *RateLimiter) (func(c *gin.Context) string, error) {
+	ti := &tokenIdentity{auth: auth, adminKey: adminKey, lookups: lookups, now: time.Now, cache: make(map[string]cachedToken)}
+	byToken := func(c *gin.Context) string {
+		if token, ok := ti.token(c); ok {
+			return "token:" + token.ID
+		}
+		return "ip:" + c.ClientIP()
+	}
+	switch strings.ToLower(by) {
+	case ClientByIP, "":
+		return func(c *gin.Context) string { return "ip:" + c.ClientIP() }, nil
+	case ClientByToken:
+		return byToken, nil
+	case ClientByAgent:
+		return func(c *gin.Context) string {
+			client := byToken(c)
+			if id := c.GetHeader(AgentIDHeader); id != "" && strings.HasPrefix(client, "token:") {
+				return client + "/agent:" + id
+			}
+			return client
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown client identity %q: expected ip, token or agent", by)
+	}
+}
+
+// TokenCacheTTL — время, на которое ClientIdentity запоминает проверенный токен.
+const TokenCacheTTL = 10 * time.Second
+
+// identityContextKey — ключ gin.Context, под которым сохраняется токен, определённый
+// ClientIdentity (пустой — клиент не аутентифицирован), чтобы не проверять секрет дважды.
+const identityContextKey = "hobrusmetrics.identity"
+
+// tokenIdentity определяет токен запроса для ClientIdentity.
+type tokenIdentity struct {
+	auth     Authenticator
+	adminKey string
+	lookups  *RateLimiter
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedToken // по хэшу секрета
+}
+
+type cachedToken struct {
+	token   models.Token
+	expires time.Time
+}
+
+// token возвращает токен запроса; неизвестный секрет, сбой проверки и отказ
+// ограничителя проверок — ok = false.
+func (ti *tokenIdentity) token(c *gin.Context) (models.Token, bool) {
+	if token, ok := TokenFromContext(c); ok {
+		return token, true
+	}
+	if v, ok := c.Get(identityContextKey); ok {
+		token, _ := v.(models.Token)
+		return token, token.ID != ""
+	}
+	token, ok := ti.resolve(c)
+	if !ok {
+		token = models.Token{}
+	}
+	c.Set(identityContextKey, token)
+	return token, ok
+}
+
+func (ti *tokenIdentity) resolve(c *gin.Context) (models.Token, bool) {
+	secret := credential(c)
+	if secret == "" || (ti.auth == nil && ti.adminKey == "") {
+		return models.Token{}, false
+	}
+	if ti.adminKey != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(ti.adminKey)) == 1 {
+		c.Set(tokenContextKey, adminKeyToken)
+		return adminKeyToken, true
+	}
+	if ti.auth == nil {
+		return models.Token{}, false
+	}
+	sum := sha256.Sum256([]byte(secret))
+	key := string(sum[:])
+	now := ti.now()
+	ti.mu.Lock()
+	cached, ok := ti.cache[key]
+	ti.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.token, true
+	}
+	if ti.lookups != nil {
+		if allowed, _ := ti.lookups.Allow("lookup:" + c.ClientIP()); !allowed {
+			return models.Token{}, false
+		}
+	}
+	token, err := ti.auth.Authenticate(secret)
+	if err != nil {
+		return models.Token{}, false
+	}
+	ti.mu.Lock()
+	if len(ti.cache) >= DefaultRateLimitBuckets {
+		for k, v := range ti.cache {
+			if !now.Before(v.expires) {
+				delete(ti.cache, k)
+			}
+		}
+	}
+	ti.cache[key] = cachedToken{token: token, expires: now.Add(TokenCacheTTL)}
+	ti.mu.Unlock()
+	c.Set(tokenContextKey, token)
+	return token, true
+}
+
+// DefaultRateLimitBuckets — наибольшее число корзин ограничителя по умолчанию.
+const DefaultRateLimitBuckets = 100000
+
+// RateLimiter — ограничитель частоты запросов с корзиной токенов на каждого клиента.
+// Корзина вмещает burst запросов и пополняется со скоростью rate запросов в секунду.
+// Корзин не больше maxBuckets: при переполнении новая корзина вытесняет произвольную старую.
+type RateLimiter struct {
+	rate       float64
+	burst      float64
+	maxBuckets int
+	now        func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter создаёт ограничитель на rate запросов в секунду с запасом burst
+// (burst < 1 — запас в одну секунду, но не меньше одного запроса).
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	b := float64(burst)
+	if b < 1 {
+		b = math.Max(1, math.Ceil(rate))
+	}
+	return &RateLimiter{rate: rate, burst: b, maxBuckets: DefaultRateLimitBuckets, now: time.Now, buckets: make(map[string]*tokenBucket)}
+}
+
+// Allow расходует один запрос клиента key. Если корзина пуста, возвращает false
+// и время, через которое запрос будет разрешён.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= l.maxBuckets {
+			l.evict()
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep удаляет корзины, которые успели наполниться: они не отличаются от новых.
+// Выполняется не чаще, чем раз в время полного наполнения корзины.
+func (l *RateLimiter) sweep(now time.Time) {
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < full {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// evict удаляет одну корзину, чтобы освободить место для новой. Порядок обхода map
+// случаен, поэтому вытесняется произвольная корзина за O(1).
+func (l *RateLimiter) evict() {
+	for key := range l.buckets {
+		delete(l.buckets, key)
+		return
+	}
+}
+
+// RateLimitMiddleware отвечает 429 с заголовком Retry-After клиентам, превысившим
+// частоту запросов limiter. Клиента определяет identify (см. ClientIdentity).
+func RateLimitMiddleware(limiter *RateLimiter, identify func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ok, wait := limiter.Allow(identify(c))
+		if !ok {
+			seconds := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			WriteProblem(c, NewProblem(http.StatusTooManyRequests, CodeRateLimited, "too many requests",
+				fmt.Sprintf("retry in %d s", seconds)))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
+
+func TestRateLimiter_TokenBucket(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d must fit into the burst", i)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("expected a refusal with 500ms wait, got %v %v", ok, wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Fatal("clients must have separate buckets")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("the bucket must refill over time")
+	}
+
+	now = now.Add(time.Minute)
+	l.Allow("c")
+	if len(l.buckets) != 1 {
+		t.Fatalf("full buckets must be swept, got %d", len(l.buckets))
+	}
+
+	l.maxBuckets = 2
+	for _, key := range []string{"d", "e", "f", "g"} {
+		if ok, _ := l.Allow(key); !ok {
+			t.Fatalf("a new client %s must be allowed", key)
+		}
+		if len(l.buckets) > 2 {
+			t.Fatalf("expected at most 2 buckets, got %d", len(l.buckets))
+		}
+	}
+}
+
+// tokenAuth — проверка секретов по таблице secret → токен.
+type tokenAuth map[string]models.Token
+
+func (a tokenAuth) Authenticate(secret string) (models.Token, error) {
+	if token, ok := a[secret]; ok {
+		return token, nil
+	}
+	return models.Token{}, errInvalidToken
+}
+
+func TestClientIdentity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	auth := tokenAuth{"s1": {ID: "t1", Role: models.RoleWriter}}
+	if _, err := ClientIdentity("cookie", auth, "", nil); err == nil {
+		t.Fatal("unknown identity must be rejected")
+	}
+	cases := []struct {
+		by, secret, agent, want string
+	}{
+		{ClientByIP, "s1", "a", "ip:192.0.2.1"},
+		{ClientByToken, "s1", "a", "token:t1"},
+		{ClientByToken, "forged", "", "ip:192.0.2.1"},
+		{ClientByToken, "root", "", "token:admin-key"},
+		{ClientByAgent, "s1", "a", "token:t1/agent:a"},
+		{ClientByAgent, "s1", "", "token:t1"},
+		{ClientByAgent, "", "a", "ip:192.0.2.1"},
+		{ClientByAgent, "forged", "a", "ip:192.0.2.1"},
+	}
+	for _, tc := range cases {
+		identify, err := ClientIdentity(tc.by, auth, "root", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.secret != "" {
+			c.Request.Header.Set(TokenHeader, tc.secret)
+		}
+		c.Request.Header.Set(AgentIDHeader, tc.agent)
+		if got := identify(c); got != tc.want {
+			t.Errorf("%s %q %q: expected %s, got %s", tc.by, tc.secret, tc.agent, tc.want, got)
+		}
+	}
+}
+
+// countingAuth считает обращения к проверке секретов.
+type countingAuth struct {
+	tokenAuth
+	calls int
+}
+
+func (a *countingAuth) Authenticate(secret string) (models.Token, error) {
+	a.calls++
+	return a.tokenAuth.Authenticate(secret)
+}
+
+func TestClientIdentity_LimitsLookups(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	auth := &countingAuth{tokenAuth: tokenAuth{"s1": {ID: "t1"}}}
+	identify, err := ClientIdentity(ClientByToken, auth, "", NewRateLimiter(0.001, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(secret string) (*gin.Context, string) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Request.Header.Set(TokenHeader, secret)
+		return c, identify(c)
+	}
+
+	// Проверенный токен запоминается: повторные запросы не обращаются к хранилищу.
+	for i := 0; i < 5; i++ {
+		c, client := request("s1")
+		if client != "token:t1" {
+			t.Fatalf("expected token:t1, got %s", client)
+		}
+		if _, ok := TokenFromContext(c); ok != (i == 0) {
+			t.Fatalf("request %d: only a token checked in this request may be trusted by TokenAuthMiddleware", i)
+		}
+	}
+	if auth.calls != 1 {
+		t.Fatalf("expected one lookup for a repeated token, got %d", auth.calls)
+	}
+
+	// Случайные секреты проверяются не чаще, чем позволяет корзина адреса.
+	for i := 0; i < 10; i++ {
+		if _, client := request(fmt.Sprintf("random-%d", i)); client != "ip:192.0.2.1" {
+			t.Fatalf("expected the address identity, got %s", client)
+		}
+	}
+	if auth.calls != 2 {
+		t.Fatalf("expected lookups to be limited by the address bucket, got %d", auth.calls)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	auth := tokenAuth{"s1": {ID: "t1"}, "s2": {ID: "t2"}}
+	identify, err := ClientIdentity(ClientByAgent, auth, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.Use(RateLimitMiddleware(NewRateLimiter(0.5, 1), identify))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(secret, agent string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(TokenHeader, secret)
+		req.Header.Set(AgentIDHeader, agent)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	if w := get("", "a"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	w := get("", "a")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Fatalf("expected 429 with Retry-After: 2, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w.Header().Get("Content-Type") != ProblemContentType {
+		t.Fatalf("expected a problem response, got %q", w.Header().Get("Content-Type"))
+	}
+	// Без проверенного токена клиент определяется по адресу, что бы он ни прислал.
+	for _, spoofed := range [][2]string{{"", "b"}, {"forged", "a"}, {"forged-2", "c"}} {
+		if w := get(spoofed[0], spoofed[1]); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("%v: spoofed headers must share the address bucket, got %d", spoofed, w.Code)
+		}
+	}
+
+	// Проверенные токены и их агенты ограничиваются отдельно.
+	for _, req := range [][2]string{{"s1", "a"}, {"s1", "b"}, {"s2", "a"}} {
+		if w := get(req[0], req[1]); w.Code != http.StatusOK {
+			t.Fatalf("%v: an authenticated client must not be limited, got %d", req, w.Code)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Состояния оповещения: pending — условие выполняется меньше заданного в правиле времени,
+// firing — оповещение сработало.
+const (
+	AlertPending = "pending"
+	AlertFiring  = "firing"
+)
+
+// Alert — активное оповещение: ряд, для которого выполняется условие правила.
+type Alert struct {
+	Rule string `json:"rule"`
+	// Labels — метки ряда и правила; метка alertname содержит имя правила.
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+	State  string            `json:"state"`
+	// ActiveAt — начало выполнения условия, FiredAt — момент срабатывания (нулевой для pending).
+	ActiveAt time.Time `json:"active_at"`
+	FiredAt  time.Time `json:"fired_at"`
+}
+
+// Fingerprint возвращает ключ оповещения: ряд с его метками.
+func (a Alert) Fingerprint() string {
+	return FormatSeries(a.Rule, a.Labels)
+}
+
+// Matcher — условие на метку оповещения: Op — "=", "!=", "=~" или "!~" (по умолчанию "=").
+// Регулярное выражение проверяется целиком.
+type Matcher struct {
+	Label string `json:"label"`
+	Op    string `json:"op,omitempty"`
+	Value string `json:"value"`
+
+	re *regexp.Regexp
+}
+
+// Compile проверяет условие и подставляет оператор по умолчанию.
+func (m *Matcher) Compile() error {
+	if !ValidLabelName(m.Label) {
+		return fmt.Errorf("invalid label name %q", m.Label)
+	}
+	switch m.Op {
+	case "":
+		m.Op = "="
+	case "=", "!=":
+	case "=~", "!~":
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return fmt.Errorf("label %s: invalid regex %q: %w", m.Label, m.Value, err)
+		}
+		m.re = re
+	default:
+		return fmt.Errorf("label %s: unknown operator %q: expected =, !=, =~ or !~", m.Label, m.Op)
+	}
+	return nil
+}
+
+// Matches сообщает, выполняется ли условие для меток labels. Условие должно быть
+// проверено Compile.
+func (m Matcher) Matches(labels map[string]string) bool {
+	v := labels[m.Label]
+	switch m.Op {
+	case "!=":
+		return v != m.Value
+	case "=~":
+		return m.re.MatchString(v)
+	case "!~":
+		return !m.re.MatchString(v)
+	default:
+		return v == m.Value
+	}
+}
+
+// MatchAll сообщает, выполняются ли для labels все условия matchers.
+func MatchAll(matchers []Matcher, labels map[string]string) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Silence заглушает оповещения, метки которых подходят под все условия Matchers,
+// с StartsAt до EndsAt.
+type Silence struct {
+	ID        string    `json:"id"`
+	Matchers  []Matcher `json:"matchers"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Active сообщает, действует ли заглушка в момент t.
+func (s Silence) Active(t time.Time) bool {
+	return !t.Before(s.StartsAt) && t.Before(s.EndsAt)
+}
+
+// Compile проверяет условия заглушки (см. Matcher.Compile).
+func (s *Silence) Compile() error {
+	for i := range s.Matchers {
+		if err := s.Matchers[i].Compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
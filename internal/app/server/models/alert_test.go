@@ -0,0 +1,43 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatcher(t *testing.T) {
+	labels := map[string]string{"host": "db-1", "severity": "warning"}
+	cases := []struct {
+		m    Matcher
+		want bool
+	}{
+		{Matcher{Label: "host", Value: "db-1"}, true},
+		{Matcher{Label: "host", Op: "!=", Value: "db-1"}, false},
+		{Matcher{Label: "host", Op: "=~", Value: "db-.*"}, true},
+		{Matcher{Label: "host", Op: "=~", Value: "db"}, false}, // выражение проверяется целиком
+		{Matcher{Label: "severity", Op: "!~", Value: "critical|page"}, true},
+		{Matcher{Label: "missing", Value: ""}, true},
+	}
+	for _, tc := range cases {
+		if err := tc.m.Compile(); err != nil {
+			t.Fatal(err)
+		}
+		if got := tc.m.Matches(labels); got != tc.want {
+			t.Errorf("%s%s%q: expected %v, got %v", tc.m.Label, tc.m.Op, tc.m.Value, tc.want, got)
+		}
+	}
+
+	for _, bad := range []Matcher{{Label: "1host", Value: "a"}, {Label: "host", Op: "==", Value: "a"}, {Label: "host", Op: "=~", Value: "("}} {
+		if err := bad.Compile(); err == nil {
+			t.Errorf("%+v: expected an error", bad)
+		}
+	}
+}
+
+func TestSilence_Active(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := Silence{StartsAt: t0, EndsAt: t0.Add(time.Hour)}
+	if s.Active(t0.Add(-time.Second)) || !s.Active(t0) || !s.Active(t0.Add(59*time.Minute)) || s.Active(t0.Add(time.Hour)) {
+		t.Fatal("silence must be active from StartsAt until EndsAt")
+	}
+}
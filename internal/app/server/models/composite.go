@@ -0,0 +1,114 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Composite — значение составной метрики (histogram, summary, sketch, set).
+// В отличие от gauge и counter такие значения хранят несколько чисел
+// и объединяются друг с другом по правилам своего типа.
+type Composite interface {
+	// Type возвращает тип метрики ("histogram", "summary", ...).
+	Type() string
+	// Validate проверяет внутреннюю согласованность значения.
+	Validate() error
+	// Merge добавляет other к текущему значению; other должен быть того же типа.
+	Merge(other Composite) error
+	// Clone возвращает независимую копию значения.
+	Clone() Composite
+	// String возвращает краткое человекочитаемое представление для HTML и текстовых ответов.
+	String() string
+}
+
+// ErrCompositeMismatch возвращается, когда значения составной метрики нельзя объединить
+// (например, у гистограмм разные границы корзин).
+var ErrCompositeMismatch = errors.New("incompatible metric values")
+
+// compositeFactories создаёт пустые значения для каждого составного типа.
+var compositeFactories = map[string]func() Composite{
+	HistogramType: func() Composite { return &Histogram{} },
+	SummaryType:   func() Composite { return &Summary{} },
+	SketchType:    func() Composite { return &Sketch{} },
+	SetType:       func() Composite { return &Set{} },
+}
+
+// IsComposite сообщает, является ли тип метрики составным.
+func IsComposite(mtype string) bool {
+	_, ok := compositeFactories[mtype]
+	return ok
+}
+
+// CompositeTypes возвращает отсортированный список составных типов метрик.
+func CompositeTypes() []string {
+	types := make([]string, 0, len(compositeFactories))
+	for t := range compositeFactories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// DecodeComposite восстанавливает составное значение типа mtype из JSON и проверяет его.
+func DecodeComposite(mtype string, raw []byte) (Composite, error) {
+	factory, ok := compositeFactories[mtype]
+	if !ok {
+		return nil, fmt.Errorf("unsupported composite metric type %q", mtype)
+	}
+	c := factory()
+	if err := json.Unmarshal(raw, c); err != nil {
+		return nil, fmt.Errorf("invalid %s value: %w", mtype, err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// CompositeFields — поля составных метрик в JSON-представлении.
+// Встраивается в Metrics и middleware.MetricsJSON, поэтому поля оказываются на верхнем уровне объекта.
+type CompositeFields struct {
+	Histogram *Histogram `json:"histogram,omitempty"`
+	Summary   *Summary   `json:"summary,omitempty"`
+	Sketch    *Sketch    `json:"sketch,omitempty"`
+	Set       *Set       `json:"set,omitempty"`
+}
+
+// Composite возвращает значение поля, соответствующего типу mtype, если оно задано.
+func (f CompositeFields) Composite(mtype string) (Composite, bool) {
+	switch mtype {
+	case HistogramType:
+		if f.Histogram != nil {
+			return f.Histogram, true
+		}
+	case SummaryType:
+		if f.Summary != nil {
+			return f.Summary, true
+		}
+	case SketchType:
+		if f.Sketch != nil {
+			return f.Sketch, true
+		}
+	case SetType:
+		if f.Set != nil {
+			return f.Set, true
+		}
+	}
+	return nil, false
+}
+
+// SetComposite заполняет поле, соответствующее типу значения c.
+func (f *CompositeFields) SetComposite(c Composite) {
+	switch v := c.(type) {
+	case *Histogram:
+		f.Histogram = v
+	case *Summary:
+		f.Summary = v
+	case *Sketch:
+		f.Sketch = v
+	case *Set:
+		f.Set = v
+	}
+}
@@ -0,0 +1,224 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Названия составных типов метрик распределений.
+const (
+	HistogramType = "histogram"
+	SummaryType   = "summary"
+)
+
+// DefaultHistogramBuckets — границы корзин по умолчанию (секунды, как у типичной латентности запросов).
+var DefaultHistogramBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram — гистограмма с фиксированными границами корзин.
+// Counts[i] — число наблюдений в (Bounds[i-1], Bounds[i]]; последний элемент — корзина +Inf,
+// поэтому len(Counts) == len(Bounds)+1. Корзины не кумулятивные.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Count  uint64    `json:"count"`
+	Sum    float64   `json:"sum"`
+}
+
+// NewHistogram создаёт пустую гистограмму с заданными границами.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		Bounds: append([]float64(nil), bounds...),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// ParseBuckets разбирает список границ корзин вида "0.1,0.5,1".
+func ParseBuckets(s string) ([]float64, error) {
+	var bounds []float64
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket bound %q: %w", part, err)
+		}
+		bounds = append(bounds, v)
+	}
+	if err := validateBounds(bounds); err != nil {
+		return nil, err
+	}
+	return bounds, nil
+}
+
+// validateBounds проверяет, что границы конечны и строго возрастают.
+func validateBounds(bounds []float64) error {
+	for i, b := range bounds {
+		if math.IsNaN(b) || math.IsInf(b, 0) {
+			return errors.New("histogram bounds must be finite")
+		}
+		if i > 0 && b <= bounds[i-1] {
+			return errors.New("histogram bounds must be strictly increasing")
+		}
+	}
+	return nil
+}
+
+// Type возвращает тип метрики.
+func (h *Histogram) Type() string { return HistogramType }
+
+// Observe добавляет одно наблюдение.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.Bounds, v) // первая граница >= v
+	h.Counts[i]++
+	h.Count++
+	h.Sum += v
+}
+
+// Validate проверяет согласованность границ и счётчиков.
+func (h *Histogram) Validate() error {
+	if err := validateBounds(h.Bounds); err != nil {
+		return err
+	}
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("histogram must have %d counts for %d bounds", len(h.Bounds)+1, len(h.Bounds))
+	}
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total != h.Count {
+		return fmt.Errorf("histogram count %d does not match bucket total %d", h.Count, total)
+	}
+	if math.IsNaN(h.Sum) {
+		return errors.New("histogram sum must be a number")
+	}
+	return nil
+}
+
+// Merge складывает счётчики корзин, количество и сумму. Границы должны совпадать.
+func (h *Histogram) Merge(other Composite) error {
+	o, ok := other.(*Histogram)
+	if !ok {
+		return fmt.Errorf("%w: cannot merge %s into histogram", ErrCompositeMismatch, other.Type())
+	}
+	if len(o.Bounds) != len(h.Bounds) {
+		return fmt.Errorf("%w: histogram bounds differ", ErrCompositeMismatch)
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != o.Bounds[i] {
+			return fmt.Errorf("%w: histogram bounds differ", ErrCompositeMismatch)
+		}
+	}
+	for i := range h.Counts {
+		h.Counts[i] += o.Counts[i]
+	}
+	h.Count += o.Count
+	h.Sum += o.Sum
+	return nil
+}
+
+// Clone возвращает копию гистограммы.
+func (h *Histogram) Clone() Composite {
+	return &Histogram{
+		Bounds: append([]float64(nil), h.Bounds...),
+		Counts: append([]uint64(nil), h.Counts...),
+		Count:  h.Count,
+		Sum:    h.Sum,
+	}
+}
+
+// String выводит количество, сумму и кумулятивные значения корзин: "count=3 sum=0.6 le0.1=1 le1=3 +Inf=3".
+func (h *Histogram) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "count=%d sum=%g", h.Count, h.Sum)
+	var cumulative uint64
+	for i, c := range h.Counts {
+		cumulative += c
+		if i < len(h.Bounds) {
+			fmt.Fprintf(&sb, " le%g=%d", h.Bounds[i], cumulative)
+		} else {
+			fmt.Fprintf(&sb, " +Inf=%d", cumulative)
+		}
+	}
+	return sb.String()
+}
+
+// Summary — сводка наблюдений: количество, сумма, минимум и максимум.
+// Все поля объединяются без потерь, поэтому сводки с разных агентов можно складывать.
+type Summary struct {
+	Count uint64  `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+// Type возвращает тип метрики.
+func (s *Summary) Type() string { return SummaryType }
+
+// Observe добавляет одно наблюдение.
+func (s *Summary) Observe(v float64) {
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Count++
+	s.Sum += v
+}
+
+// Validate проверяет согласованность сводки.
+func (s *Summary) Validate() error {
+	if math.IsNaN(s.Sum) || math.IsNaN(s.Min) || math.IsNaN(s.Max) {
+		return errors.New("summary fields must be numbers")
+	}
+	if s.Count > 0 && s.Min > s.Max {
+		return errors.New("summary min must not exceed max")
+	}
+	return nil
+}
+
+// Merge объединяет сводки: количество и сумма складываются, минимум и максимум расширяются.
+func (s *Summary) Merge(other Composite) error {
+	o, ok := other.(*Summary)
+	if !ok {
+		return fmt.Errorf("%w: cannot merge %s into summary", ErrCompositeMismatch, other.Type())
+	}
+	if o.Count == 0 {
+		return nil
+	}
+	if s.Count == 0 {
+		*s = *o
+		return nil
+	}
+	s.Count += o.Count
+	s.Sum += o.Sum
+	s.Min = math.Min(s.Min, o.Min)
+	s.Max = math.Max(s.Max, o.Max)
+	return nil
+}
+
+// Clone возвращает копию сводки.
+func (s *Summary) Clone() Composite {
+	cpy := *s
+	return &cpy
+}
+
+// Mean возвращает среднее значение наблюдений (0 для пустой сводки).
+func (s *Summary) Mean() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Count)
+}
+
+// String выводит сводку в виде "count=3 sum=0.6 min=0.1 max=0.3 avg=0.2".
+func (s *Summary) String() string {
+	return fmt.Sprintf("count=%d sum=%g min=%g max=%g avg=%g", s.Count, s.Sum, s.Min, s.Max, s.Mean())
+}
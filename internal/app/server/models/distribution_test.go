@@ -0,0 +1,68 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHistogramObserveAndMerge(t *testing.T) {
+	h := NewHistogram([]float64{1, 5})
+	for _, v := range []float64{0.5, 1, 3, 10} {
+		h.Observe(v)
+	}
+	if err := h.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if want := []uint64{2, 1, 1}; h.Counts[0] != want[0] || h.Counts[1] != want[1] || h.Counts[2] != want[2] {
+		t.Fatalf("counts: want %v, got %v", want, h.Counts)
+	}
+
+	other := NewHistogram([]float64{1, 5})
+	other.Observe(4)
+	if err := h.Merge(other); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if h.Count != 5 || h.Sum != 18.5 || h.Counts[1] != 2 {
+		t.Fatalf("unexpected merge result: %+v", h)
+	}
+	if got := h.String(); got != "count=5 sum=18.5 le1=2 le5=4 +Inf=5" {
+		t.Fatalf("unexpected string: %q", got)
+	}
+
+	if err := h.Merge(NewHistogram([]float64{2})); !errors.Is(err, ErrCompositeMismatch) {
+		t.Fatalf("expected mismatch, got %v", err)
+	}
+	if err := (&Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 2}).Validate(); err == nil {
+		t.Fatalf("inconsistent count must be rejected")
+	}
+}
+
+func TestSummaryMerge(t *testing.T) {
+	s := &Summary{}
+	if err := s.Merge(&Summary{Count: 2, Sum: 4, Min: 1, Max: 3}); err != nil {
+		t.Fatalf("merge into empty: %v", err)
+	}
+	s.Observe(10)
+	if s.Count != 3 || s.Min != 1 || s.Max != 10 || s.Sum != 14 {
+		t.Fatalf("unexpected summary: %+v", s)
+	}
+	if err := s.Merge(NewHistogram(nil)); !errors.Is(err, ErrCompositeMismatch) {
+		t.Fatalf("expected mismatch, got %v", err)
+	}
+}
+
+func TestParseBuckets(t *testing.T) {
+	bounds, err := ParseBuckets(" 0.1, 1,5 ")
+	if err != nil || len(bounds) != 3 || bounds[2] != 5 {
+		t.Fatalf("unexpected result: %v %v", bounds, err)
+	}
+	if bounds, err := ParseBuckets(""); err != nil || bounds != nil {
+		t.Fatalf("empty list must give nil bounds: %v %v", bounds, err)
+	}
+	if _, err := ParseBuckets("1,1"); err == nil {
+		t.Fatalf("non-increasing bounds must be rejected")
+	}
+	if _, err := ParseBuckets("x"); err == nil {
+		t.Fatalf("invalid bound must be rejected")
+	}
+}
@@ -1,9 +1,31 @@
 package models
 
+import (
+	"errors"
+	"time"
+)
+
 // Metrics описывает единичную метрику для JSON-обмена.
 type Metrics struct {
 	ID    string   `json:"id"`              // metric name
-	MType string   `json:"type"`            // gauge or counter
+	MType string   `json:"type"`            // gauge, counter, histogram or summary
 	Delta *int64   `json:"delta,omitempty"` // counter value
 	Value *float64 `json:"value,omitempty"` // gauge value
+
+	CompositeFields // histogram/summary value
+}
+
+// MetricEntry описывает метрику вместе со временем последнего обновления (для списков).
+type MetricEntry struct {
+	ID        string    `json:"id"`
+	MType     string    `json:"type"`
+	Delta     *int64    `json:"delta,omitempty"`
+	Value     *float64  `json:"value,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	CompositeFields
 }
+
+// ErrTypeConflict возвращается, когда имя метрики уже занято метрикой другого типа,
+// а политика сервера запрещает такие совпадения.
+var ErrTypeConflict = errors.New("metric type conflict")
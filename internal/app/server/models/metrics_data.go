@@ -1,7 +1,127 @@
 package models
 
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // MetricsData описывает снимок всех метрик в удобном для сериализации виде.
 type MetricsData struct {
 	Gauges   map[string]string `json:"gauges"`   // gaugeName -> "123.45"
 	Counters map[string]int64  `json:"counters"` // counterName -> 10
+
+	// Время последнего обновления метрик; в старых снимках может отсутствовать.
+	GaugesUpdatedAt   map[string]time.Time `json:"gauges_updated_at,omitempty"`
+	CountersUpdatedAt map[string]time.Time `json:"counters_updated_at,omitempty"`
+
+	// Составные метрики: тип -> имя -> значение в JSON (histogram, summary, ...).
+	Composites          map[string]map[string]json.RawMessage `json:"composites,omitempty"`
+	CompositesUpdatedAt map[string]map[string]time.Time       `json:"composites_updated_at,omitempty"`
+}
+
+// NewMetricsData создаёт пустой снимок с инициализированными картами.
+func NewMetricsData() MetricsData {
+	return MetricsData{
+		Gauges:   make(map[string]string),
+		Counters: make(map[string]int64),
+
+		Composites:          make(map[string]map[string]json.RawMessage),
+		CompositesUpdatedAt: make(map[string]map[string]time.Time),
+	}
+}
+
+// Items разворачивает снимок в список метрик, отсортированный по типу и имени.
+// Используется для построчного (NDJSON) экспорта.
+func (d MetricsData) Items() ([]Metrics, error) {
+	items := make([]Metrics, 0, len(d.Gauges)+len(d.Counters))
+	for name, c := range d.Counters {
+		delta := c
+		items = append(items, Metrics{ID: name, MType: "counter", Delta: &delta})
+	}
+	for name, raw := range d.Gauges {
+		val, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gauge %q in snapshot: %w", name, err)
+		}
+		items = append(items, Metrics{ID: name, MType: "gauge", Value: &val})
+	}
+	for mtype, values := range d.Composites {
+		for name, raw := range values {
+			c, err := DecodeComposite(mtype, raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q in snapshot: %w", mtype, name, err)
+			}
+			m := Metrics{ID: name, MType: mtype}
+			m.SetComposite(c)
+			items = append(items, m)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].MType != items[j].MType {
+			return items[i].MType < items[j].MType
+		}
+		return items[i].ID < items[j].ID
+	})
+	return items, nil
+}
+
+// Add добавляет единичную метрику в снимок.
+// Для counter значение из снимка заменяет предыдущее, а не суммируется.
+func (d MetricsData) Add(m Metrics) error {
+	if m.ID == "" {
+		return fmt.Errorf("metric id is required")
+	}
+	switch strings.ToLower(m.MType) {
+	case "counter":
+		if m.Delta == nil {
+			return fmt.Errorf("delta is required for counter %q", m.ID)
+		}
+		d.Counters[m.ID] = *m.Delta
+	case "gauge":
+		if m.Value == nil {
+			return fmt.Errorf("value is required for gauge %q", m.ID)
+		}
+		d.Gauges[m.ID] = strconv.FormatFloat(*m.Value, 'f', -1, 64)
+	default:
+		mtype := strings.ToLower(m.MType)
+		if !IsComposite(mtype) {
+			return fmt.Errorf("unsupported metric type %q", m.MType)
+		}
+		c, ok := m.Composite(mtype)
+		if !ok {
+			return fmt.Errorf("%s value is required for %q", mtype, m.ID)
+		}
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("invalid %s %q: %w", mtype, m.ID, err)
+		}
+		return d.SetComposite(m.ID, c, time.Time{})
+	}
+	return nil
+}
+
+// SetComposite записывает составное значение в снимок; нулевое updatedAt не сохраняется.
+// Снимок должен быть создан через NewMetricsData (карты составных метрик инициализированы).
+func (d MetricsData) SetComposite(name string, c Composite, updatedAt time.Time) error {
+	if d.Composites == nil || d.CompositesUpdatedAt == nil {
+		return fmt.Errorf("snapshot is not initialized for composite metrics")
+	}
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if d.Composites[c.Type()] == nil {
+		d.Composites[c.Type()] = make(map[string]json.RawMessage)
+	}
+	d.Composites[c.Type()][name] = raw
+	if !updatedAt.IsZero() {
+		if d.CompositesUpdatedAt[c.Type()] == nil {
+			d.CompositesUpdatedAt[c.Type()] = make(map[string]time.Time)
+		}
+		d.CompositesUpdatedAt[c.Type()][name] = updatedAt
+	}
+	return nil
 }
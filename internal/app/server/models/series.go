@@ -0,0 +1,98 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Метки метрики записываются в её имени в синтаксисе Prometheus: name{key="value",...}.
+// Хранилище не различает метки: ряд — это тип и полное имя с метками в каноническом виде
+// (метки упорядочены по ключу, пустые значения опускаются).
+
+// ErrInvalidSeries — имя с метками не соответствует синтаксису name{key="value",...}.
+var ErrInvalidSeries = errors.New("invalid series name")
+
+// ParseSeries разделяет имя ряда на имя метрики и метки. Для имени без меток
+// labels — nil.
+func ParseSeries(series string) (name string, labels map[string]string, err error) {
+	open := strings.IndexByte(series, '{')
+	if open < 0 {
+		return series, nil, nil
+	}
+	if !strings.HasSuffix(series, "}") {
+		return "", nil, fmt.Errorf("%w %q: missing closing brace", ErrInvalidSeries, series)
+	}
+	name, rest := series[:open], series[open+1:len(series)-1]
+	labels = make(map[string]string)
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		key, tail, ok := strings.Cut(rest, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !ValidLabelName(key) {
+			return "", nil, fmt.Errorf("%w %q: invalid label name %q", ErrInvalidSeries, series, key)
+		}
+		tail = strings.TrimSpace(tail)
+		quoted, err := strconv.QuotedPrefix(tail)
+		if err != nil || quoted[0] != '"' {
+			return "", nil, fmt.Errorf("%w %q: label %s must have a quoted value", ErrInvalidSeries, series, key)
+		}
+		value, _ := strconv.Unquote(quoted)
+		if _, dup := labels[key]; dup {
+			return "", nil, fmt.Errorf("%w %q: duplicate label %s", ErrInvalidSeries, series, key)
+		}
+		labels[key] = value
+		rest = strings.TrimSpace(tail[len(quoted):])
+		if rest != "" {
+			if rest[0] != ',' {
+				return "", nil, fmt.Errorf("%w %q: expected a comma after label %s", ErrInvalidSeries, series, key)
+			}
+			rest = rest[1:]
+		}
+	}
+	return name, labels, nil
+}
+
+// FormatSeries собирает имя ряда из имени метрики и меток в каноническом виде.
+func FormatSeries(name string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k, v := range labels {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return name
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// ValidLabelName сообщает, подходит ли s для имени метки: буквы, цифры и _, не с цифры.
+func ValidLabelName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
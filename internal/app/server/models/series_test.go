@@ -0,0 +1,31 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAndFormatSeries(t *testing.T) {
+	name, labels, err := ParseSeries(`cpu{ mode="idle", core="1\"a"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "cpu" || len(labels) != 2 || labels["core"] != `1"a` || labels["mode"] != "idle" {
+		t.Fatalf("unexpected parse: %q %v", name, labels)
+	}
+	if got := FormatSeries(name, labels); got != `cpu{core="1\"a",mode="idle"}` {
+		t.Fatalf("labels must be sorted and quoted, got %s", got)
+	}
+	if got := FormatSeries("cpu", map[string]string{"core": ""}); got != "cpu" {
+		t.Fatalf("empty labels must be omitted, got %s", got)
+	}
+	if name, labels, err := ParseSeries("Alloc"); err != nil || name != "Alloc" || labels != nil {
+		t.Fatalf("plain names have no labels: %q %v %v", name, labels, err)
+	}
+
+	for _, bad := range []string{`cpu{core="1"`, `cpu{core=1}`, `cpu{1core="1"}`, `cpu{a="1" b="2"}`, `cpu{a="1",a="2"}`} {
+		if _, _, err := ParseSeries(bad); !errors.Is(err, ErrInvalidSeries) {
+			t.Errorf("%s: expected ErrInvalidSeries, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/Hobrus/hobrusmetrics.git/pkg/hll"
+)
+
+// SetType — составной тип метрики для оценки числа уникальных элементов (HyperLogLog).
+const SetType = "set"
+
+// Set — метрика уникальных элементов. В JSON передаётся как сериализованный hll.Sketch;
+// поля estimate и relative_error в ответах вычисляются сервером.
+type Set struct {
+	hll.Sketch
+}
+
+// NewSet создаёт пустое множество заданной точности.
+func NewSet(precision uint8) (*Set, error) {
+	s, err := hll.New(precision)
+	if err != nil {
+		return nil, err
+	}
+	return &Set{Sketch: *s}, nil
+}
+
+// Type возвращает тип метрики.
+func (s *Set) Type() string { return SetType }
+
+// Merge объединяет множества; при разной точности результат получает меньшую.
+func (s *Set) Merge(other Composite) error {
+	o, ok := other.(*Set)
+	if !ok {
+		return fmt.Errorf("%w: cannot merge %s into set", ErrCompositeMismatch, other.Type())
+	}
+	return s.Sketch.Merge(&o.Sketch)
+}
+
+// Clone возвращает копию множества.
+func (s *Set) Clone() Composite {
+	return &Set{Sketch: *s.Sketch.Clone()}
+}
+
+// String выводит оценку мощности и относительную ошибку: "estimate=1234 error=0.81%".
+func (s *Set) String() string {
+	return fmt.Sprintf("estimate=%d error=%.2f%%", s.Estimate(), s.RelativeError()*100)
+}
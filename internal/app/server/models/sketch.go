@@ -0,0 +1,79 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Hobrus/hobrusmetrics.git/pkg/ddsketch"
+)
+
+// SketchType — составной тип метрики для оценки квантилей (DDSketch).
+const SketchType = "sketch"
+
+// Sketch — метрика-скетч квантилей. В JSON передаётся как сериализованный ddsketch.Sketch.
+type Sketch struct {
+	ddsketch.Sketch
+}
+
+// NewSketch создаёт пустой скетч с относительной точностью alpha и ограничением числа корзин.
+func NewSketch(alpha float64, maxBins int) (*Sketch, error) {
+	s, err := ddsketch.New(alpha, maxBins)
+	if err != nil {
+		return nil, err
+	}
+	return &Sketch{Sketch: *s}, nil
+}
+
+// Type возвращает тип метрики.
+func (s *Sketch) Type() string { return SketchType }
+
+// Merge объединяет скетчи; точность должна совпадать.
+func (s *Sketch) Merge(other Composite) error {
+	o, ok := other.(*Sketch)
+	if !ok {
+		return fmt.Errorf("%w: cannot merge %s into sketch", ErrCompositeMismatch, other.Type())
+	}
+	if err := s.Sketch.Merge(&o.Sketch); err != nil {
+		if errors.Is(err, ddsketch.ErrIncompatible) {
+			return fmt.Errorf("%w: %v", ErrCompositeMismatch, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Clone возвращает копию скетча.
+func (s *Sketch) Clone() Composite {
+	return &Sketch{Sketch: *s.Sketch.Clone()}
+}
+
+// Quantiles возвращает оценки квантилей qs в том же порядке.
+func (s *Sketch) Quantiles(qs []float64) ([]float64, error) {
+	values := make([]float64, len(qs))
+	for i, q := range qs {
+		v, err := s.Quantile(q)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// DefaultSketchQuantiles — квантили, которые показываются в кратком представлении скетча.
+var DefaultSketchQuantiles = []float64{0.5, 0.9, 0.99}
+
+// String выводит скетч в виде "count=3 sum=0.6 min=0.1 max=0.3 p50=0.2 p90=0.3 p99=0.3".
+func (s *Sketch) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "count=%d sum=%g min=%g max=%g", s.Count, s.Sum, s.Min, s.Max)
+	if s.Count == 0 {
+		return sb.String()
+	}
+	for _, q := range DefaultSketchQuantiles {
+		v, _ := s.Quantile(q)
+		fmt.Fprintf(&sb, " p%g=%g", q*100, v)
+	}
+	return sb.String()
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Role — роль API-токена. Роли упорядочены: writer может всё, что reader, admin — всё, что writer.
+type Role string
+
+const (
+	// RoleReader читает метрики, историю и поток событий.
+	RoleReader Role = "reader"
+	// RoleWriter дополнительно обновляет метрики (роль агентов).
+	RoleWriter Role = "writer"
+	// RoleAdmin дополнительно выполняет административные операции и управляет токенами.
+	RoleAdmin Role = "admin"
+)
+
+// roleRank задаёт порядок ролей.
+var roleRank = map[Role]int{RoleReader: 1, RoleWriter: 2, RoleAdmin: 3}
+
+// ParseRole проверяет название роли.
+func ParseRole(s string) (Role, error) {
+	r := Role(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := roleRank[r]; !ok {
+		return "", fmt.Errorf("unknown role %q: expected reader, writer or admin", s)
+	}
+	return r, nil
+}
+
+// Includes сообщает, даёт ли роль r права роли required.
+func (r Role) Includes(required Role) bool {
+	return roleRank[r] > 0 && roleRank[r] >= roleRank[required]
+}
+
+// Token — API-токен. Секрет токена не хранится: известен только его хэш.
+type Token struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+	// Prefixes ограничивает доступ метриками с этими префиксами имени (пусто — все метрики).
+	Prefixes  []string  `json:"prefixes,omitempty"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Covers сообщает, входит ли метрика name в область действия токена.
+func (t Token) Covers(name string) bool {
+	if len(t.Prefixes) == 0 {
+		return true
+	}
+	for _, p := range t.Prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,314 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/pkg/retry"
+)
+
+// AlertStore хранит состояние оповещений и заглушки, чтобы после перезапуска сервера
+// сработавшие оповещения не срабатывали заново.
+type AlertStore interface {
+	// ListAlerts возвращает сохранённые активные оповещения.
+	ListAlerts() ([]models.Alert, error)
+	// SaveAlerts заменяет сохранённые оповещения на alerts.
+	SaveAlerts(alerts []models.Alert) error
+	// ListSilences возвращает заглушки в порядке создания.
+	ListSilences() ([]models.Silence, error)
+	CreateSilence(s models.Silence) error
+	// DeleteSilence удаляет заглушку; false — заглушки с таким id нет.
+	DeleteSilence(id string) (bool, error)
+}
+
+// alertState — содержимое хранилища оповещений.
+type alertState struct {
+	Alerts   []models.Alert   `json:"alerts"`
+	Silences []models.Silence `json:"silences"`
+}
+
+// MemAlertStore хранит оповещения в памяти, как и MemStorage — метрики.
+type MemAlertStore struct {
+	mu    sync.RWMutex
+	state alertState
+	// save вызывается с новым состоянием до его применения (nil — только память).
+	save func(alertState) error
+}
+
+// NewMemAlertStore создаёт пустое хранилище оповещений в памяти.
+func NewMemAlertStore() *MemAlertStore {
+	return &MemAlertStore{}
+}
+
+// ListAlerts возвращает копию списка оповещений.
+func (s *MemAlertStore) ListAlerts() ([]models.Alert, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]models.Alert(nil), s.state.Alerts...), nil
+}
+
+// SaveAlerts заменяет список оповещений.
+func (s *MemAlertStore) SaveAlerts(alerts []models.Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := alertState{Alerts: append([]models.Alert(nil), alerts...), Silences: s.state.Silences}
+	return s.apply(next)
+}
+
+// ListSilences возвращает копию списка заглушек.
+func (s *MemAlertStore) ListSilences() ([]models.Silence, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]models.Silence(nil), s.state.Silences...), nil
+}
+
+// CreateSilence добавляет заглушку.
+func (s *MemAlertStore) CreateSilence(silence models.Silence) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.state.Silences {
+		if existing.ID == silence.ID {
+			return fmt.Errorf("silence %s already exists", silence.ID)
+		}
+	}
+	silences := append(s.state.Silences[:len(s.state.Silences):len(s.state.Silences)], silence)
+	return s.apply(alertState{Alerts: s.state.Alerts, Silences: silences})
+}
+
+// DeleteSilence удаляет заглушку.
+func (s *MemAlertStore) DeleteSilence(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	silences := make([]models.Silence, 0, len(s.state.Silences))
+	for _, existing := range s.state.Silences {
+		if existing.ID != id {
+			silences = append(silences, existing)
+		}
+	}
+	if len(silences) == len(s.state.Silences) {
+		return false, nil
+	}
+	return true, s.apply(alertState{Alerts: s.state.Alerts, Silences: silences})
+}
+
+// apply сохраняет next и делает его текущим состоянием. Вызывается под s.mu.
+func (s *MemAlertStore) apply(next alertState) error {
+	if s.save != nil {
+		if err := s.save(next); err != nil {
+			return err
+		}
+	}
+	s.state = next
+	return nil
+}
+
+// FileAlertStore хранит оповещения и заглушки в JSON-файле и держит их копию в памяти.
+// Файл перезаписывается атомарно при каждом изменении.
+type FileAlertStore struct {
+	*MemAlertStore
+	filePath string
+}
+
+// NewFileAlertStore загружает состояние из filePath; отсутствующий файл означает пустое состояние.
+func NewFileAlertStore(filePath string) (*FileAlertStore, error) {
+	s := &FileAlertStore{MemAlertStore: NewMemAlertStore(), filePath: filePath}
+	data, err := os.ReadFile(filePath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read alerts file: %w", err)
+	default:
+		if err := json.Unmarshal(data, &s.state); err != nil {
+			return nil, fmt.Errorf("failed to parse alerts file: %w", err)
+		}
+	}
+	s.save = s.write
+	return s, nil
+}
+
+// write записывает состояние через временный файл.
+func (s *FileAlertStore) write(state alertState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return retry.DoWithRetry(func() error {
+		tempFile := s.filePath + ".tmp"
+		if err := os.WriteFile(tempFile, data, 0644); err != nil {
+			return err
+		}
+		if err := os.Rename(tempFile, s.filePath); err != nil {
+			_ = os.Remove(tempFile)
+			return err
+		}
+		return nil
+	})
+}
+
+// PostgresAlertStore хранит оповещения в таблице alerts, заглушки — в alert_silences.
+// Метки и условия хранятся как JSON.
+type PostgresAlertStore struct {
+	db *DBConnection
+}
+
+// NewPostgresAlertStore создаёт хранилище оповещений и его таблицы, если их нет.
+func NewPostgresAlertStore(dbConn *DBConnection) (*PostgresAlertStore, error) {
+	if dbConn == nil || dbConn.Pool == nil {
+		return nil, fmt.Errorf("database not configured")
+	}
+	_, err := dbConn.Pool.Exec(context.Background(), `
+	CREATE TABLE IF NOT EXISTS alerts (
+		fingerprint TEXT PRIMARY KEY,
+		rule TEXT NOT NULL,
+		labels TEXT NOT NULL,
+		value DOUBLE PRECISION NOT NULL,
+		state TEXT NOT NULL,
+		active_at TIMESTAMPTZ NOT NULL,
+		fired_at TIMESTAMPTZ
+	);
+	CREATE TABLE IF NOT EXISTS alert_silences (
+		id TEXT PRIMARY KEY,
+		matchers TEXT NOT NULL,
+		starts_at TIMESTAMPTZ NOT NULL,
+		ends_at TIMESTAMPTZ NOT NULL,
+		created_by TEXT NOT NULL DEFAULT '',
+		comment TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create alert tables: %w", err)
+	}
+	return &PostgresAlertStore{db: dbConn}, nil
+}
+
+// ListAlerts возвращает сохранённые оповещения.
+func (ps *PostgresAlertStore) ListAlerts() ([]models.Alert, error) {
+	var alerts []models.Alert
+	err := retry.DoWithRetry(func() error {
+		rows, err := ps.db.Pool.Query(context.Background(),
+			`SELECT rule, labels, value, state, active_at, fired_at FROM alerts`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		alerts = alerts[:0]
+		for rows.Next() {
+			var (
+				a      models.Alert
+				labels string
+				fired  *time.Time
+			)
+			if err := rows.Scan(&a.Rule, &labels, &a.Value, &a.State, &a.ActiveAt, &fired); err != nil {
+				return err
+			}
+			if err := json.Unmarshal([]byte(labels), &a.Labels); err != nil {
+				return fmt.Errorf("alert %s: invalid labels: %w", a.Rule, err)
+			}
+			if fired != nil {
+				a.FiredAt = *fired
+			}
+			alerts = append(alerts, a)
+		}
+		return rows.Err()
+	})
+	return alerts, err
+}
+
+// SaveAlerts заменяет сохранённые оповещения в одной транзакции.
+func (ps *PostgresAlertStore) SaveAlerts(alerts []models.Alert) error {
+	return retry.DoWithRetry(func() error {
+		ctx := context.Background()
+		tx, err := ps.db.Pool.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback(ctx) }()
+		if _, err := tx.Exec(ctx, `DELETE FROM alerts;`); err != nil {
+			return err
+		}
+		for _, a := range alerts {
+			labels, err := json.Marshal(a.Labels)
+			if err != nil {
+				return err
+			}
+			var fired *time.Time
+			if !a.FiredAt.IsZero() {
+				fired = &a.FiredAt
+			}
+			if _, err := tx.Exec(ctx, `
+			INSERT INTO alerts (fingerprint, rule, labels, value, state, active_at, fired_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7);
+			`, a.Fingerprint(), a.Rule, string(labels), a.Value, a.State, a.ActiveAt, fired); err != nil {
+				return err
+			}
+		}
+		return tx.Commit(ctx)
+	})
+}
+
+// ListSilences возвращает заглушки в порядке создания.
+func (ps *PostgresAlertStore) ListSilences() ([]models.Silence, error) {
+	var silences []models.Silence
+	err := retry.DoWithRetry(func() error {
+		rows, err := ps.db.Pool.Query(context.Background(),
+			`SELECT id, matchers, starts_at, ends_at, created_by, comment, created_at FROM alert_silences`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		silences = silences[:0]
+		for rows.Next() {
+			var (
+				s        models.Silence
+				matchers string
+			)
+			if err := rows.Scan(&s.ID, &matchers, &s.StartsAt, &s.EndsAt, &s.CreatedBy, &s.Comment, &s.CreatedAt); err != nil {
+				return err
+			}
+			if err := json.Unmarshal([]byte(matchers), &s.Matchers); err != nil {
+				return fmt.Errorf("silence %s: invalid matchers: %w", s.ID, err)
+			}
+			silences = append(silences, s)
+		}
+		return rows.Err()
+	})
+	sort.SliceStable(silences, func(i, j int) bool { return silences[i].CreatedAt.Before(silences[j].CreatedAt) })
+	return silences, err
+}
+
+// CreateSilence сохраняет заглушку.
+func (ps *PostgresAlertStore) CreateSilence(s models.Silence) error {
+	matchers, err := json.Marshal(s.Matchers)
+	if err != nil {
+		return err
+	}
+	return retry.DoWithRetry(func() error {
+		_, err := ps.db.Pool.Exec(context.Background(), `
+		INSERT INTO alert_silences (id, matchers, starts_at, ends_at, created_by, comment, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);
+		`, s.ID, string(matchers), s.StartsAt, s.EndsAt, s.CreatedBy, s.Comment, s.CreatedAt)
+		return err
+	})
+}
+
+// DeleteSilence удаляет заглушку.
+func (ps *PostgresAlertStore) DeleteSilence(id string) (bool, error) {
+	var deleted int64
+	err := retry.DoWithRetry(func() error {
+		tag, err := ps.db.Pool.Exec(context.Background(), `DELETE FROM alert_silences WHERE id = $1;`, id)
+		if err != nil {
+			return err
+		}
+		deleted = tag.RowsAffected()
+		return nil
+	})
+	return deleted > 0, err
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
+
+func TestFileAlertStore_Persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	s, err := NewFileAlertStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	alert := models.Alert{
+		Rule:     "HostDown",
+		Labels:   map[string]string{"alertname": "HostDown", "host": "a"},
+		Value:    0,
+		State:    models.AlertFiring,
+		ActiveAt: now,
+		FiredAt:  now,
+	}
+	if err := s.SaveAlerts([]models.Alert{alert}); err != nil {
+		t.Fatal(err)
+	}
+	silence := models.Silence{
+		ID:        "s1",
+		Matchers:  []models.Matcher{{Label: "host", Op: "=", Value: "a"}},
+		StartsAt:  now,
+		EndsAt:    now.Add(time.Hour),
+		CreatedAt: now,
+	}
+	if err := s.CreateSilence(silence); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateSilence(silence); err == nil {
+		t.Fatal("duplicate id must be rejected")
+	}
+
+	reloaded, err := NewFileAlertStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerts, err := reloaded.ListAlerts()
+	if err != nil || len(alerts) != 1 || alerts[0].Fingerprint() != alert.Fingerprint() || !alerts[0].FiredAt.Equal(now) {
+		t.Fatalf("unexpected alerts after reload: %+v %v", alerts, err)
+	}
+	silences, err := reloaded.ListSilences()
+	if err != nil || len(silences) != 1 || silences[0].ID != "s1" || silences[0].Matchers[0].Value != "a" {
+		t.Fatalf("unexpected silences after reload: %+v %v", silences, err)
+	}
+
+	if deleted, err := reloaded.DeleteSilence("s1"); err != nil || !deleted {
+		t.Fatalf("expected deletion, got %v %v", deleted, err)
+	}
+	if deleted, _ := reloaded.DeleteSilence("s1"); deleted {
+		t.Fatal("second deletion must report false")
+	}
+	if err := reloaded.SaveAlerts(nil); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err = NewFileAlertStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alerts, _ := reloaded.ListAlerts(); len(alerts) != 0 {
+		t.Fatalf("expected no alerts, got %+v", alerts)
+	}
+	if silences, _ := reloaded.ListSilences(); len(silences) != 0 {
+		t.Fatalf("expected no silences, got %+v", silences)
+	}
+}
+
+func TestFileAlertStore_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileAlertStore(path); err == nil {
+		t.Fatal("expected an error for a corrupted file")
+	}
+}
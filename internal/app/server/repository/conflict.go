@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
+
+// ConflictPolicy определяет, что происходит при записи метрики с именем,
+// которое уже занято метрикой другого типа.
+type ConflictPolicy string
+
+const (
+	// ConflictSeparate — gauge и counter живут в независимых пространствах имён (по умолчанию).
+	ConflictSeparate ConflictPolicy = "separate"
+	// ConflictReject — запись отклоняется с ошибкой models.ErrTypeConflict.
+	ConflictReject ConflictPolicy = "reject"
+	// ConflictOverwrite — метрика другого типа удаляется и заменяется новой.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+)
+
+// ParseConflictPolicy разбирает название политики; пустая строка означает separate.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return ConflictSeparate, nil
+	case ConflictSeparate, ConflictReject, ConflictOverwrite:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown type conflict policy %q", s)
+	}
+}
+
+// conflictError оборачивает models.ErrTypeConflict именем и типом занятой метрики.
+func conflictError(name, existingType string) error {
+	return fmt.Errorf("%w: %q already exists as %s", models.ErrTypeConflict, name, existingType)
+}
+
+// metricTypes — все типы метрик, которые может хранить Storage.
+var metricTypes = append([]string{"counter", "gauge"}, models.CompositeTypes()...)
+
+// otherTypes возвращает все типы метрик, кроме mtype.
+func otherTypes(mtype string) []string {
+	others := make([]string, 0, len(metricTypes)-1)
+	for _, t := range metricTypes {
+		if t != mtype {
+			others = append(others, t)
+		}
+	}
+	return others
+}
+
+// batchItem — обновление одной метрики после свёртки пакета.
+type batchItem struct {
+	name      string
+	mtype     string
+	delta     int64            // для counter: сумма всех delta пакета
+	raw       string           // для gauge: последнее значение пакета
+	composite models.Composite // для составных типов: объединение всех значений пакета
+}
+
+// resolveBatch сворачивает пакет одинаково для всех хранилищ:
+// counter суммируются, для gauge остаётся последнее значение, составные значения объединяются,
+// элементы без значения пропускаются.
+// Конфликты типов внутри пакета разрешаются по политике: reject — ошибка,
+// overwrite — побеждает тип последнего элемента с этим именем.
+func resolveBatch(batch []middleware.MetricsJSON, policy ConflictPolicy) ([]batchItem, error) {
+	var (
+		items    []batchItem
+		index    = make(map[metricKey]int)
+		lastType = make(map[string]string)
+	)
+	for _, m := range batch {
+		mtype := strings.ToLower(string(m.MType))
+		var composite models.Composite
+		switch mtype {
+		case "counter":
+			if m.Delta == nil {
+				continue
+			}
+		case "gauge":
+			if m.Value == nil {
+				continue
+			}
+		default:
+			if !models.IsComposite(mtype) {
+				return nil, fmt.Errorf("unsupported metric type in batch: %q", m.MType)
+			}
+			c, ok := m.Composite(mtype)
+			if !ok {
+				continue
+			}
+			if err := c.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid %s %q in batch: %w", mtype, m.ID, err)
+			}
+			composite = c
+		}
+
+		if prev, ok := lastType[m.ID]; ok && prev != mtype && policy == ConflictReject {
+			return nil, conflictError(m.ID, prev)
+		}
+		lastType[m.ID] = mtype
+
+		key := metricKey{mtype, m.ID}
+		i, ok := index[key]
+		if !ok {
+			i = len(items)
+			index[key] = i
+			items = append(items, batchItem{name: m.ID, mtype: mtype})
+		}
+		switch {
+		case mtype == "counter":
+			items[i].delta += *m.Delta
+		case mtype == "gauge":
+			items[i].raw = floatToString(*m.Value)
+		case items[i].composite == nil:
+			items[i].composite = composite.Clone()
+		default:
+			if err := items[i].composite.Merge(composite); err != nil {
+				return nil, fmt.Errorf("metric %q: %w", m.ID, err)
+			}
+		}
+	}
+
+	if policy != ConflictOverwrite {
+		return items, nil
+	}
+	resolved := items[:0]
+	for _, item := range items {
+		if lastType[item.name] == item.mtype {
+			resolved = append(resolved, item)
+		}
+	}
+	return resolved, nil
+}
+
+// snapshotKeys возвращает ключи всех метрик снимка.
+func snapshotKeys(data models.MetricsData) []metricKey {
+	keys := make([]metricKey, 0, len(data.Gauges)+len(data.Counters))
+	for name := range data.Gauges {
+		keys = append(keys, metricKey{"gauge", name})
+	}
+	for name := range data.Counters {
+		keys = append(keys, metricKey{"counter", name})
+	}
+	for mtype, values := range data.Composites {
+		for name := range values {
+			keys = append(keys, metricKey{mtype, name})
+		}
+	}
+	return keys
+}
+
+// decodeSnapshotComposites разбирает и проверяет составные метрики снимка,
+// чтобы хранилища не применяли снимок частично.
+func decodeSnapshotComposites(data models.MetricsData) (map[metricKey]models.Composite, error) {
+	result := make(map[metricKey]models.Composite)
+	for mtype, values := range data.Composites {
+		for name, raw := range values {
+			c, err := models.DecodeComposite(mtype, raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q in snapshot: %w", mtype, name, err)
+			}
+			result[metricKey{mtype, name}] = c
+		}
+	}
+	return result, nil
+}
+
+// checkSnapshotConflicts проверяет, что при несовместных пространствах имён
+// одно имя не встречается в снимке под несколькими типами.
+func checkSnapshotConflicts(data models.MetricsData, policy ConflictPolicy) error {
+	if policy == ConflictSeparate || policy == "" {
+		return nil
+	}
+	seen := make(map[string]string)
+	for _, key := range snapshotKeys(data) {
+		if prev, ok := seen[key.name]; ok {
+			return conflictError(key.name, prev)
+		}
+		seen[key.name] = key.mtype
+	}
+	return nil
+}
@@ -0,0 +1,461 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
+
+// storageFactory создаёт пустое хранилище с заданной политикой конфликтов типов.
+type storageFactory func(t *testing.T, policy ConflictPolicy) Storage
+
+// conformanceBackends перечисляет хранилища, которые обязаны проходить общий набор проверок.
+// PostgreSQL проверяется только при заданной переменной окружения TEST_DATABASE_DSN;
+// каждая проверка работает в собственной временной схеме, данные базы не затрагиваются.
+func conformanceBackends() map[string]storageFactory {
+	return map[string]storageFactory{
+		"memory": func(t *testing.T, policy ConflictPolicy) Storage {
+			s := NewMemStorage()
+			s.SetConflictPolicy(policy)
+			return s
+		},
+		"file": func(t *testing.T, policy ConflictPolicy) Storage {
+			s, err := NewFileBackedStorage(filepath.Join(t.TempDir(), "metrics.json"), 0, false, logrus.New())
+			if err != nil {
+				t.Fatalf("create file storage: %v", err)
+			}
+			s.SetConflictPolicy(policy)
+			return s
+		},
+		"postgres": func(t *testing.T, policy ConflictPolicy) Storage {
+			dsn := os.Getenv("TEST_DATABASE_DSN")
+			if dsn == "" {
+				t.Skip("TEST_DATABASE_DSN is not set")
+			}
+			s, err := NewPostgresStorage(testSchema(t, dsn))
+			if err != nil {
+				t.Fatalf("create postgres storage: %v", err)
+			}
+			s.SetConflictPolicy(policy)
+			return s
+		},
+	}
+}
+
+// testSchema создаёт в базе dsn временную схему и возвращает подключение, в котором
+// она стоит первой в search_path. Схема удаляется по завершении теста.
+func testSchema(t *testing.T, dsn string) *DBConnection {
+	t.Helper()
+	admin, err := NewDBConnection(dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(admin.Close)
+	schema := fmt.Sprintf("hobrusmetrics_test_%d", time.Now().UnixNano())
+	if _, err := admin.Pool.Exec(context.Background(), "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Pool.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("drop schema %s: %v", schema, err)
+		}
+	})
+
+	if strings.Contains(dsn, "://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "search_path=" + schema
+	} else {
+		dsn += " search_path=" + schema
+	}
+	db, err := NewDBConnection(dsn)
+	if err != nil {
+		t.Fatalf("connect to schema %s: %v", schema, err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+func TestStorageConformance(t *testing.T) {
+	for name, factory := range conformanceBackends() {
+		t.Run(name, func(t *testing.T) {
+			t.Run("basic", func(t *testing.T) { checkBasicOperations(t, factory(t, ConflictSeparate)) })
+			t.Run("batch", func(t *testing.T) { checkBatch(t, factory(t, ConflictSeparate)) })
+			t.Run("delete_and_reset", func(t *testing.T) { checkDeleteAndReset(t, factory(t, ConflictSeparate)) })
+			t.Run("restore", func(t *testing.T) { checkRestore(t, factory(t, ConflictSeparate)) })
+			t.Run("policy_separate", func(t *testing.T) { checkPolicySeparate(t, factory(t, ConflictSeparate)) })
+			t.Run("policy_reject", func(t *testing.T) { checkPolicyReject(t, factory(t, ConflictReject)) })
+			t.Run("policy_overwrite", func(t *testing.T) { checkPolicyOverwrite(t, factory(t, ConflictOverwrite)) })
+			t.Run("composites", func(t *testing.T) { checkComposites(t, factory(t, ConflictSeparate)) })
+			t.Run("composites_reject", func(t *testing.T) { checkCompositesReject(t, factory(t, ConflictReject)) })
+		})
+	}
+}
+
+func gaugeItem(id string, v float64) middleware.MetricsJSON {
+	return middleware.MetricsJSON{ID: id, MType: middleware.GaugeMetric, Value: &v}
+}
+
+func counterItem(id string, d int64) middleware.MetricsJSON {
+	return middleware.MetricsJSON{ID: id, MType: middleware.CounterMetric, Delta: &d}
+}
+
+func expectGauge(t *testing.T, s Storage, name, want string) {
+	t.Helper()
+	got, ok := s.GetGaugeRaw(name)
+	if !ok || got != want {
+		t.Fatalf("gauge %s: want %q, got %q (ok=%v)", name, want, got, ok)
+	}
+}
+
+func expectCounter(t *testing.T, s Storage, name string, want Counter) {
+	t.Helper()
+	got, ok := s.GetCounter(name)
+	if !ok || got != want {
+		t.Fatalf("counter %s: want %d, got %d (ok=%v)", name, want, got, ok)
+	}
+}
+
+func expectNoGauge(t *testing.T, s Storage, name string) {
+	t.Helper()
+	if v, ok := s.GetGaugeRaw(name); ok {
+		t.Fatalf("gauge %s must not exist, got %q", name, v)
+	}
+}
+
+func expectNoCounter(t *testing.T, s Storage, name string) {
+	t.Helper()
+	if v, ok := s.GetCounter(name); ok {
+		t.Fatalf("counter %s must not exist, got %d", name, v)
+	}
+}
+
+func expectConflict(t *testing.T, err error) {
+	t.Helper()
+	if !errors.Is(err, models.ErrTypeConflict) {
+		t.Fatalf("expected ErrTypeConflict, got %v", err)
+	}
+}
+
+func checkBasicOperations(t *testing.T, s Storage) {
+	if err := s.UpdateGaugeRaw("G", "1.5"); err != nil {
+		t.Fatalf("update gauge: %v", err)
+	}
+	if err := s.UpdateGaugeRaw("G", "2.5"); err != nil {
+		t.Fatalf("update gauge: %v", err)
+	}
+	if err := s.UpdateGaugeRaw("Bad", "x"); err == nil {
+		t.Fatalf("invalid gauge must be rejected")
+	}
+	if err := s.UpdateCounter("C", 3); err != nil {
+		t.Fatalf("update counter: %v", err)
+	}
+	if err := s.UpdateCounter("C", 4); err != nil {
+		t.Fatalf("update counter: %v", err)
+	}
+
+	expectGauge(t, s, "G", "2.5")
+	expectCounter(t, s, "C", 7)
+	expectNoGauge(t, s, "Bad")
+
+	if g := s.GetAllGauges(); len(g) != 1 || g["G"] != "2.5" {
+		t.Fatalf("unexpected gauges: %v", g)
+	}
+	if c := s.GetAllCounters(); len(c) != 1 || c["C"] != 7 {
+		t.Fatalf("unexpected counters: %v", c)
+	}
+
+	infos := s.ListMetricInfo()
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 metric infos, got %+v", infos)
+	}
+	for _, info := range infos {
+		if info.UpdatedAt.IsZero() {
+			t.Fatalf("updated_at must be set: %+v", info)
+		}
+	}
+}
+
+func checkBatch(t *testing.T, s Storage) {
+	batch := []middleware.MetricsJSON{
+		gaugeItem("G", 1),
+		counterItem("C", 2),
+		counterItem("C", 3),
+		gaugeItem("G", 4),
+		{ID: "Empty", MType: middleware.GaugeMetric},
+	}
+	if err := s.UpdateMetricsBatch(batch); err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	expectGauge(t, s, "G", "4")
+	expectCounter(t, s, "C", 5)
+	expectNoGauge(t, s, "Empty")
+
+	if err := s.UpdateMetricsBatch([]middleware.MetricsJSON{counterItem("C", 1), {ID: "X", MType: "timer"}}); err == nil {
+		t.Fatalf("unsupported type must fail the batch")
+	}
+	expectCounter(t, s, "C", 5)
+}
+
+func checkDeleteAndReset(t *testing.T, s Storage) {
+	_ = s.UpdateGaugeRaw("G", "1")
+	_ = s.UpdateCounter("C", 5)
+
+	if deleted, err := s.DeleteMetric("gauge", "G", time.Now().Add(-time.Hour)); err != nil || deleted {
+		t.Fatalf("fresh metric must survive conditional delete: %v %v", deleted, err)
+	}
+	if deleted, err := s.DeleteMetric("gauge", "G", time.Time{}); err != nil || !deleted {
+		t.Fatalf("delete gauge: %v %v", deleted, err)
+	}
+	expectNoGauge(t, s, "G")
+	if deleted, _ := s.DeleteMetric("gauge", "G", time.Time{}); deleted {
+		t.Fatalf("second delete must report nothing deleted")
+	}
+
+	if reset, err := s.ResetCounter("C"); err != nil || !reset {
+		t.Fatalf("reset: %v %v", reset, err)
+	}
+	expectCounter(t, s, "C", 0)
+	if reset, _ := s.ResetCounter("Missing"); reset {
+		t.Fatalf("missing counter must not be reset")
+	}
+}
+
+func checkRestore(t *testing.T, s Storage) {
+	_ = s.UpdateGaugeRaw("Old", "1")
+	_ = s.UpdateCounter("C", 10)
+
+	stamp := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	snap := models.MetricsData{
+		Gauges:          map[string]string{"G": "2"},
+		Counters:        map[string]int64{"C": 3},
+		GaugesUpdatedAt: map[string]time.Time{"G": stamp},
+	}
+	if err := s.Restore(snap, false); err != nil {
+		t.Fatalf("restore merge: %v", err)
+	}
+	expectGauge(t, s, "Old", "1")
+	expectGauge(t, s, "G", "2")
+	expectCounter(t, s, "C", 3)
+	for _, info := range s.ListMetricInfo() {
+		if info.Name == "G" && !info.UpdatedAt.Equal(stamp) {
+			t.Fatalf("restore must keep updated_at from snapshot, got %s", info.UpdatedAt)
+		}
+	}
+
+	if err := s.Restore(snap, true); err != nil {
+		t.Fatalf("restore replace: %v", err)
+	}
+	expectNoGauge(t, s, "Old")
+
+	if err := s.Restore(models.MetricsData{Gauges: map[string]string{"B": "x"}}, true); err == nil {
+		t.Fatalf("invalid snapshot must be rejected")
+	}
+	expectGauge(t, s, "G", "2")
+}
+
+func checkPolicySeparate(t *testing.T, s Storage) {
+	if err := s.UpdateGaugeRaw("Alloc", "1"); err != nil {
+		t.Fatalf("gauge: %v", err)
+	}
+	if err := s.UpdateCounter("Alloc", 2); err != nil {
+		t.Fatalf("counter with the same name must be allowed: %v", err)
+	}
+	if err := s.UpdateMetricsBatch([]middleware.MetricsJSON{gaugeItem("Alloc", 3), counterItem("Alloc", 4)}); err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	expectGauge(t, s, "Alloc", "3")
+	expectCounter(t, s, "Alloc", 6)
+
+	var types []string
+	for _, info := range s.ListMetricInfo() {
+		types = append(types, info.Type)
+	}
+	sort.Strings(types)
+	if len(types) != 2 || types[0] != "counter" || types[1] != "gauge" {
+		t.Fatalf("both series must be listed, got %v", types)
+	}
+}
+
+func checkPolicyReject(t *testing.T, s Storage) {
+	if err := s.UpdateGaugeRaw("Alloc", "1"); err != nil {
+		t.Fatalf("gauge: %v", err)
+	}
+	expectConflict(t, s.UpdateCounter("Alloc", 2))
+	expectNoCounter(t, s, "Alloc")
+
+	_ = s.UpdateCounter("Hits", 1)
+	expectConflict(t, s.UpdateGaugeRaw("Hits", "5"))
+	expectCounter(t, s, "Hits", 1)
+
+	// Конфликт внутри пакета: пакет не применяется целиком.
+	expectConflict(t, s.UpdateMetricsBatch([]middleware.MetricsJSON{gaugeItem("New", 1), counterItem("New", 1)}))
+	expectNoGauge(t, s, "New")
+
+	// Конфликт с уже сохранённой метрикой: пакет не применяется целиком.
+	expectConflict(t, s.UpdateMetricsBatch([]middleware.MetricsJSON{gaugeItem("Other", 1), counterItem("Alloc", 1)}))
+	expectNoGauge(t, s, "Other")
+
+	expectConflict(t, s.Restore(models.MetricsData{Counters: map[string]int64{"Alloc": 1}}, false))
+	expectConflict(t, s.Restore(models.MetricsData{
+		Gauges:   map[string]string{"Dup": "1"},
+		Counters: map[string]int64{"Dup": 1},
+	}, true))
+	expectGauge(t, s, "Alloc", "1")
+}
+
+func checkPolicyOverwrite(t *testing.T, s Storage) {
+	if err := s.UpdateGaugeRaw("Alloc", "1"); err != nil {
+		t.Fatalf("gauge: %v", err)
+	}
+	if err := s.UpdateCounter("Alloc", 2); err != nil {
+		t.Fatalf("counter must overwrite gauge: %v", err)
+	}
+	expectNoGauge(t, s, "Alloc")
+	expectCounter(t, s, "Alloc", 2)
+
+	if err := s.UpdateMetricsBatch([]middleware.MetricsJSON{counterItem("Mixed", 1), gaugeItem("Mixed", 7)}); err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	expectNoCounter(t, s, "Mixed")
+	expectGauge(t, s, "Mixed", "7")
+
+	if err := s.Restore(models.MetricsData{Gauges: map[string]string{"Alloc": "3"}}, false); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	expectNoCounter(t, s, "Alloc")
+	expectGauge(t, s, "Alloc", "3")
+
+	if len(s.ListMetricInfo()) != 2 {
+		t.Fatalf("each name must map to exactly one series: %+v", s.ListMetricInfo())
+	}
+}
+
+func observedHistogram(values ...float64) *models.Histogram {
+	h := models.NewHistogram([]float64{0.1, 1})
+	for _, v := range values {
+		h.Observe(v)
+	}
+	return h
+}
+
+func expectHistogram(t *testing.T, s Storage, name string, wantCount uint64, wantCounts []uint64) {
+	t.Helper()
+	c, ok := s.GetComposite(models.HistogramType, name)
+	if !ok {
+		t.Fatalf("histogram %s not found", name)
+	}
+	h := c.(*models.Histogram)
+	if h.Count != wantCount || fmt.Sprint(h.Counts) != fmt.Sprint(wantCounts) {
+		t.Fatalf("histogram %s: want count=%d counts=%v, got %+v", name, wantCount, wantCounts, h)
+	}
+}
+
+func checkComposites(t *testing.T, s Storage) {
+	if err := s.UpdateComposite("Latency", observedHistogram(0.05)); err != nil {
+		t.Fatalf("update histogram: %v", err)
+	}
+	if err := s.UpdateComposite("Latency", observedHistogram(0.5, 5)); err != nil {
+		t.Fatalf("merge histogram: %v", err)
+	}
+	expectHistogram(t, s, "Latency", 3, []uint64{1, 1, 1})
+
+	// Гистограмма с другими границами не объединяется и не портит сохранённое значение.
+	err := s.UpdateComposite("Latency", models.NewHistogram([]float64{1, 2}))
+	if !errors.Is(err, models.ErrCompositeMismatch) {
+		t.Fatalf("expected ErrCompositeMismatch, got %v", err)
+	}
+	expectHistogram(t, s, "Latency", 3, []uint64{1, 1, 1})
+
+	summary := &models.Summary{}
+	summary.Observe(2)
+	batch := []middleware.MetricsJSON{
+		{ID: "Latency", MType: middleware.HistogramMetric, CompositeFields: models.CompositeFields{Histogram: observedHistogram(0.01)}},
+		{ID: "Latency", MType: middleware.HistogramMetric, CompositeFields: models.CompositeFields{Histogram: observedHistogram(0.02)}},
+		{ID: "Size", MType: middleware.SummaryMetric, CompositeFields: models.CompositeFields{Summary: summary}},
+		counterItem("Requests", 1),
+	}
+	if err := s.UpdateMetricsBatch(batch); err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	expectHistogram(t, s, "Latency", 5, []uint64{3, 1, 1})
+	if c, ok := s.GetComposite(models.SummaryType, "Size"); !ok || c.(*models.Summary).Count != 1 {
+		t.Fatalf("summary not stored: %v %v", c, ok)
+	}
+
+	// Множества разной точности объединяются с понижением точности.
+	users, _ := models.NewSet(12)
+	users.Add("alice")
+	agent, _ := models.NewSet(10)
+	agent.Add("alice")
+	agent.Add("bob")
+	if err := s.UpdateComposite("Users", users); err != nil {
+		t.Fatalf("update set: %v", err)
+	}
+	if err := s.UpdateComposite("Users", agent); err != nil {
+		t.Fatalf("merge set: %v", err)
+	}
+	if c, ok := s.GetComposite(models.SetType, "Users"); !ok || c.(*models.Set).Precision != 10 || c.(*models.Set).Estimate() != 2 {
+		t.Fatalf("set not merged: %v %v", c, ok)
+	}
+	if _, err := s.DeleteMetric(models.SetType, "Users", time.Time{}); err != nil {
+		t.Fatalf("delete set: %v", err)
+	}
+
+	// Несовместимое значение в пакете отклоняет пакет целиком.
+	bad := []middleware.MetricsJSON{
+		counterItem("Requests", 1),
+		{ID: "Latency", MType: middleware.HistogramMetric, CompositeFields: models.CompositeFields{Histogram: models.NewHistogram([]float64{5})}},
+	}
+	if err := s.UpdateMetricsBatch(bad); !errors.Is(err, models.ErrCompositeMismatch) {
+		t.Fatalf("expected ErrCompositeMismatch, got %v", err)
+	}
+	expectCounter(t, s, "Requests", 1)
+
+	if got := s.GetAllComposites(models.HistogramType); len(got) != 1 {
+		t.Fatalf("unexpected histograms: %v", got)
+	}
+
+	snap := models.NewMetricsData()
+	if err := snap.SetComposite("Restored", observedHistogram(0.5), time.Time{}); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if err := s.Restore(snap, true); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	expectHistogram(t, s, "Restored", 1, []uint64{0, 1, 0})
+	if _, ok := s.GetComposite(models.HistogramType, "Latency"); ok {
+		t.Fatalf("replace must drop composites missing from the snapshot")
+	}
+
+	if deleted, err := s.DeleteMetric(models.HistogramType, "Restored", time.Time{}); err != nil || !deleted {
+		t.Fatalf("delete histogram: %v %v", deleted, err)
+	}
+	if len(s.ListMetricInfo()) != 0 {
+		t.Fatalf("storage must be empty: %+v", s.ListMetricInfo())
+	}
+}
+
+func checkCompositesReject(t *testing.T, s Storage) {
+	_ = s.UpdateGaugeRaw("Latency", "1")
+	expectConflict(t, s.UpdateComposite("Latency", observedHistogram(0.5)))
+
+	if err := s.UpdateComposite("Size", &models.Summary{Count: 1, Sum: 1, Min: 1, Max: 1}); err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	expectConflict(t, s.UpdateComposite("Size", observedHistogram(0.5)))
+	expectConflict(t, s.UpdateCounter("Size", 1))
+}
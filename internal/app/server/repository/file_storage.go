@@ -8,12 +8,13 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
 	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
 	"github.com/Hobrus/hobrusmetrics.git/internal/pkg/retry"
 )
 
 type FileBackedStorage struct {
-	MemStorage
+	*MemStorage
 	filePath      string
 	storeInterval time.Duration
 	stopChan      chan struct{}
@@ -25,7 +26,7 @@ type FileBackedStorage struct {
 // При restore=true выполняет попытку восстановить метрики из файла.
 func NewFileBackedStorage(filePath string, storeInterval time.Duration, restore bool, logger *logrus.Logger) (*FileBackedStorage, error) {
 	storage := &FileBackedStorage{
-		MemStorage:    *NewMemStorage(), // базируемся на памяти
+		MemStorage:    NewMemStorage(), // базируемся на памяти
 		filePath:      filePath,
 		storeInterval: storeInterval,
 		stopChan:      make(chan struct{}),
@@ -65,16 +66,8 @@ func (s *FileBackedStorage) LoadFromFile() error {
 		s.storeMutex.Lock()
 		defer s.storeMutex.Unlock()
 
-		// Восстанавливаем gauges (strings)
-		for name, raw := range metricsData.Gauges {
-			_ = s.MemStorage.UpdateGaugeRaw(name, raw) // можно логировать ошибку
-		}
-		// Восстанавливаем counters
-		for name, cval := range metricsData.Counters {
-			s.MemStorage.UpdateCounter(name, Counter(cval))
-		}
-
-		return nil
+		// Восстанавливаем gauges и counters вместе со временем их обновления
+		return s.MemStorage.Restore(metricsData, false)
 	})
 	if err != nil {
 		loadErr = err
@@ -89,19 +82,7 @@ func (s *FileBackedStorage) SaveToFile() error {
 
 	var saveErr error
 	err := retry.DoWithRetry(func() error {
-		gauges := s.MemStorage.GetAllGauges()     // map[string]string
-		counters := s.MemStorage.GetAllCounters() // map[string]Counter
-
-		// Преобразуем Counters в int64
-		intCounters := make(map[string]int64, len(counters))
-		for k, v := range counters {
-			intCounters[k] = int64(v)
-		}
-
-		metricsData := models.MetricsData{
-			Gauges:   gauges,
-			Counters: intCounters,
-		}
+		metricsData := s.MemStorage.snapshot()
 
 		data, err := json.Marshal(metricsData)
 		if err != nil {
@@ -147,6 +128,43 @@ func (s *FileBackedStorage) Shutdown() error {
 	return s.SaveToFile()
 }
 
+// Restore записывает снимок в память и сразу сохраняет его на диск,
+// независимо от интервала: восстановление — явная административная операция.
+func (s *FileBackedStorage) Restore(data models.MetricsData, replace bool) error {
+	if err := s.MemStorage.Restore(data, replace); err != nil {
+		return err
+	}
+	return s.SaveToFile()
+}
+
+// DeleteMetric удаляет метрику и при нулевом интервале сразу сохраняет изменения на диск.
+func (s *FileBackedStorage) DeleteMetric(mtype, name string, updatedBefore time.Time) (bool, error) {
+	deleted, err := s.MemStorage.DeleteMetric(mtype, name, updatedBefore)
+	if err != nil || !deleted {
+		return deleted, err
+	}
+	if s.storeInterval == 0 {
+		if err := s.SaveToFile(); err != nil {
+			s.logger.Errorf("Failed to save metrics after delete: %v", err)
+		}
+	}
+	return true, nil
+}
+
+// ResetCounter обнуляет counter и при нулевом интервале сразу сохраняет изменения на диск.
+func (s *FileBackedStorage) ResetCounter(name string) (bool, error) {
+	reset, err := s.MemStorage.ResetCounter(name)
+	if err != nil || !reset {
+		return reset, err
+	}
+	if s.storeInterval == 0 {
+		if err := s.SaveToFile(); err != nil {
+			s.logger.Errorf("Failed to save metrics after counter reset: %v", err)
+		}
+	}
+	return true, nil
+}
+
 // UpdateGaugeRaw обновляет gauge и при нулевом интервале сразу сохраняет на диск.
 func (s *FileBackedStorage) UpdateGaugeRaw(name, rawValue string) error {
 	if err := s.MemStorage.UpdateGaugeRaw(name, rawValue); err != nil {
@@ -161,11 +179,40 @@ func (s *FileBackedStorage) UpdateGaugeRaw(name, rawValue string) error {
 }
 
 // UpdateCounter обновляет counter и при нулевом интервале сразу сохраняет на диск.
-func (s *FileBackedStorage) UpdateCounter(name string, value Counter) {
-	s.MemStorage.UpdateCounter(name, value)
+func (s *FileBackedStorage) UpdateCounter(name string, value Counter) error {
+	if err := s.MemStorage.UpdateCounter(name, value); err != nil {
+		return err
+	}
 	if s.storeInterval == 0 {
 		if err := s.SaveToFile(); err != nil {
 			s.logger.Errorf("Failed to save metrics after counter update: %v", err)
 		}
 	}
+	return nil
+}
+
+// UpdateComposite обновляет составную метрику и при нулевом интервале сразу сохраняет на диск.
+func (s *FileBackedStorage) UpdateComposite(name string, value models.Composite) error {
+	if err := s.MemStorage.UpdateComposite(name, value); err != nil {
+		return err
+	}
+	if s.storeInterval == 0 {
+		if err := s.SaveToFile(); err != nil {
+			s.logger.Errorf("Failed to save metrics after %s update: %v", value.Type(), err)
+		}
+	}
+	return nil
+}
+
+// UpdateMetricsBatch применяет пакет и при нулевом интервале сразу сохраняет его на диск.
+func (s *FileBackedStorage) UpdateMetricsBatch(batch []middleware.MetricsJSON) error {
+	if err := s.MemStorage.UpdateMetricsBatch(batch); err != nil {
+		return err
+	}
+	if s.storeInterval == 0 {
+		if err := s.SaveToFile(); err != nil {
+			s.logger.Errorf("Failed to save metrics after batch update: %v", err)
+		}
+	}
+	return nil
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
 	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
 )
 
@@ -78,3 +79,48 @@ func TestFileBackedStorage_ShutdownSaves(t *testing.T) {
 		t.Fatalf("file not present after shutdown: %v", err)
 	}
 }
+
+func TestFileBackedStorage_PersistsUpdatedAt(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "metrics.json")
+	logger := logrus.New()
+
+	stamp := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return stamp }
+	defer func() { timeNow = time.Now }()
+
+	s, err := NewFileBackedStorage(file, 0, false, logger)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_ = s.UpdateGaugeRaw("G", "1")
+
+	timeNow = time.Now
+	s2, err := NewFileBackedStorage(file, 0, true, logger)
+	if err != nil {
+		t.Fatalf("create2: %v", err)
+	}
+	infos := s2.ListMetricInfo()
+	if len(infos) != 1 || !infos[0].UpdatedAt.Equal(stamp) {
+		t.Fatalf("updated_at must survive restart: %+v", infos)
+	}
+}
+
+func TestFileBackedStorage_BatchSavedImmediately(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "metrics.json")
+	s, err := NewFileBackedStorage(file, 0, false, logrus.New())
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := s.UpdateMetricsBatch([]middleware.MetricsJSON{counterItem("C", 2), counterItem("C", 3)}); err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+
+	s2, err := NewFileBackedStorage(file, 0, true, logrus.New())
+	if err != nil {
+		t.Fatalf("create2: %v", err)
+	}
+	if v, ok := s2.GetCounter("C"); !ok || v != 5 {
+		t.Fatalf("batch must be saved with zero interval: %d ok=%v", v, ok)
+	}
+}
@@ -2,47 +2,72 @@ package repository
 
 import (
 	"context"
-	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 
 	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
 	"github.com/Hobrus/hobrusmetrics.git/internal/pkg/retry"
 )
 
 // PostgresStorage — реализация Storage на PostgreSQL.
-// Counter хранится в колонке ivalue, gauge — как строка в grawvalue.
+// Counter хранится в колонке ivalue, gauge — как строка в grawvalue,
+// составные метрики (histogram, summary, ...) — как JSON в payload.
 type PostgresStorage struct {
-	db *DBConnection
-	mu sync.RWMutex
+	db     *DBConnection
+	mu     sync.RWMutex
+	policy ConflictPolicy
 }
 
 // Новая структура таблицы (пример):
 //
 // CREATE TABLE IF NOT EXISTS metrics (
 //
-//	id TEXT PRIMARY KEY,
+//	id TEXT NOT NULL,
 //	mtype TEXT NOT NULL,          -- 'counter' | 'gauge'
 //	ivalue BIGINT DEFAULT 0,      -- для counter
-//	grawvalue TEXT DEFAULT ''     -- для gauge (сырая строка, наподобие "123.45")
+//	grawvalue TEXT DEFAULT '',    -- для gauge (сырая строка, наподобие "123.45")
+//	payload TEXT NOT NULL DEFAULT '', -- для составных метрик (JSON)
+//	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(), -- время последнего обновления
+//	PRIMARY KEY (id, mtype)
 //
 // );
 //
-// (fvalue, если был, можно убрать или оставить неиспользуемым)
+// Таблицы старого формата (PRIMARY KEY (id)) переводятся на составной ключ:
+// политика конфликтов типов применяется в коде, а не схемой.
 func (db *DBConnection) CreateMetricsTable(ctx context.Context) error {
 	if db == nil || db.Pool == nil {
 		return fmt.Errorf("database not configured")
 	}
 	schema := `
 	CREATE TABLE IF NOT EXISTS metrics (
-		id TEXT PRIMARY KEY,
+		id TEXT NOT NULL,
 		mtype TEXT NOT NULL,
 		ivalue BIGINT DEFAULT 0,
-		grawvalue TEXT DEFAULT ''
+		grawvalue TEXT DEFAULT '',
+		payload TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (id, mtype)
 	);
+	ALTER TABLE metrics ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+	ALTER TABLE metrics ADD COLUMN IF NOT EXISTS payload TEXT NOT NULL DEFAULT '';
+	DO $$
+	BEGIN
+		IF (SELECT count(*)
+		      FROM pg_index i
+		      JOIN pg_class c ON c.oid = i.indrelid
+		     WHERE c.relname = 'metrics' AND i.indisprimary AND i.indnatts = 1) > 0 THEN
+			ALTER TABLE metrics DROP CONSTRAINT metrics_pkey;
+			ALTER TABLE metrics ADD PRIMARY KEY (id, mtype);
+		END IF;
+	END $$;
 	`
 	_, err := db.Pool.Exec(ctx, schema)
 	if err != nil {
@@ -60,6 +85,88 @@ func NewPostgresStorage(dbConn *DBConnection) (*PostgresStorage, error) {
 	return ps, nil
 }
 
+// SQL-запросы записи: ключ таблицы — пара (id, mtype).
+const (
+	upsertGaugeSQL = `
+	INSERT INTO metrics (id, mtype, grawvalue, updated_at)
+	VALUES ($1, 'gauge', $2, $3)
+	ON CONFLICT (id, mtype) DO UPDATE
+	  SET grawvalue = EXCLUDED.grawvalue,
+	      updated_at = EXCLUDED.updated_at;
+	`
+	addCounterSQL = `
+	INSERT INTO metrics (id, mtype, ivalue, updated_at)
+	VALUES ($1, 'counter', $2, $3)
+	ON CONFLICT (id, mtype) DO UPDATE
+	  SET ivalue = metrics.ivalue + EXCLUDED.ivalue,
+	      updated_at = EXCLUDED.updated_at;
+	`
+	setCounterSQL = `
+	INSERT INTO metrics (id, mtype, ivalue, updated_at)
+	VALUES ($1, 'counter', $2, $3)
+	ON CONFLICT (id, mtype) DO UPDATE
+	  SET ivalue = EXCLUDED.ivalue,
+	      updated_at = EXCLUDED.updated_at;
+	`
+	upsertCompositeSQL = `
+	INSERT INTO metrics (id, mtype, payload, updated_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (id, mtype) DO UPDATE
+	  SET payload = EXCLUDED.payload,
+	      updated_at = EXCLUDED.updated_at;
+	`
+	deleteOtherTypesSQL = `DELETE FROM metrics WHERE id = $1 AND mtype <> $2;`
+)
+
+// SetConflictPolicy задаёт политику совпадения имён метрик разных типов.
+func (ps *PostgresStorage) SetConflictPolicy(policy ConflictPolicy) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.policy = policy
+}
+
+// withTx выполняет fn в транзакции с повторными попытками при временных ошибках.
+func (ps *PostgresStorage) withTx(fn func(ctx context.Context, tx pgx.Tx) error) error {
+	ctx := context.Background()
+	return retry.DoWithRetry(func() error {
+		tx, err := ps.db.Pool.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = tx.Rollback(ctx) // игнорируем ошибку, если уже закрыт
+		}()
+
+		if err := fn(ctx, tx); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	})
+}
+
+// prepareWriteTx применяет политику конфликтов перед записью метрики типа mtype:
+// при reject возвращает ошибку, при overwrite удаляет метрики других типов с тем же именем.
+func (ps *PostgresStorage) prepareWriteTx(ctx context.Context, tx pgx.Tx, mtype, name string) error {
+	switch ps.policy {
+	case ConflictReject:
+		var other string
+		err := tx.QueryRow(ctx,
+			`SELECT mtype FROM metrics WHERE id = $1 AND mtype <> $2 LIMIT 1;`,
+			name, mtype).Scan(&other)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return conflictError(name, other)
+	case ConflictOverwrite:
+		_, err := tx.Exec(ctx, deleteOtherTypesSQL, name, mtype)
+		return err
+	}
+	return nil
+}
+
 // ========== gauge ==========
 
 // UpdateGaugeRaw обновляет значение gauge, валидируя ввод.
@@ -72,14 +179,13 @@ func (ps *PostgresStorage) UpdateGaugeRaw(name, rawValue string) error {
 		return fmt.Errorf("invalid gauge value: %w", err)
 	}
 
-	query := `
-	INSERT INTO metrics (id, mtype, grawvalue)
-	VALUES ($1, 'gauge', $2)
-	ON CONFLICT (id) DO UPDATE
-	  SET mtype='gauge',
-	      grawvalue = EXCLUDED.grawvalue;
-	`
-	return ps.execWithRetry(context.Background(), query, name, rawValue)
+	return ps.withTx(func(ctx context.Context, tx pgx.Tx) error {
+		if err := ps.prepareWriteTx(ctx, tx, "gauge", name); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, upsertGaugeSQL, name, rawValue, timeNow())
+		return err
+	})
 }
 
 // GetGaugeRaw возвращает строковое значение gauge и признак наличия.
@@ -88,17 +194,12 @@ func (ps *PostgresStorage) GetGaugeRaw(name string) (string, bool) {
 	defer ps.mu.RUnlock()
 
 	var rawValue string
-	var mtype string
-	query := `SELECT mtype, grawvalue FROM metrics WHERE id = $1;`
-	err := ps.db.Pool.QueryRow(context.Background(), query, name).Scan(&mtype, &rawValue)
+	query := `SELECT grawvalue FROM metrics WHERE id = $1 AND mtype = 'gauge';`
+	err := ps.db.Pool.QueryRow(context.Background(), query, name).Scan(&rawValue)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", false
+		if !errors.Is(err, pgx.ErrNoRows) {
+			fmt.Printf("GetGaugeRaw error: %v\n", err)
 		}
-		fmt.Printf("GetGaugeRaw error: %v\n", err)
-		return "", false
-	}
-	if mtype != "gauge" {
 		return "", false
 	}
 	return rawValue, true
@@ -107,21 +208,21 @@ func (ps *PostgresStorage) GetGaugeRaw(name string) (string, bool) {
 // ========== counter ==========
 
 // UpdateCounter накапливает значение counter.
-func (ps *PostgresStorage) UpdateCounter(name string, value Counter) {
+func (ps *PostgresStorage) UpdateCounter(name string, value Counter) error {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
-	query := `
-	INSERT INTO metrics (id, mtype, ivalue)
-	VALUES ($1, 'counter', $2)
-	ON CONFLICT (id) DO UPDATE
-	  SET mtype='counter',
-	      ivalue = metrics.ivalue + EXCLUDED.ivalue;
-	`
-	err := ps.execWithRetry(context.Background(), query, name, int64(value))
-	if err != nil {
+	err := ps.withTx(func(ctx context.Context, tx pgx.Tx) error {
+		if err := ps.prepareWriteTx(ctx, tx, "counter", name); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, addCounterSQL, name, int64(value), timeNow())
+		return err
+	})
+	if err != nil && !errors.Is(err, models.ErrTypeConflict) {
 		fmt.Printf("UpdateCounter error after retries: %v\n", err)
 	}
+	return err
 }
 
 // GetCounter возвращает значение counter и признак наличия.
@@ -130,125 +231,303 @@ func (ps *PostgresStorage) GetCounter(name string) (Counter, bool) {
 	defer ps.mu.RUnlock()
 
 	var iVal int64
-	var mtype string
-	query := `SELECT mtype, ivalue FROM metrics WHERE id = $1;`
-	err := ps.db.Pool.QueryRow(context.Background(), query, name).Scan(&mtype, &iVal)
+	query := `SELECT ivalue FROM metrics WHERE id = $1 AND mtype = 'counter';`
+	err := ps.db.Pool.QueryRow(context.Background(), query, name).Scan(&iVal)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return 0, false
+		if !errors.Is(err, pgx.ErrNoRows) {
+			fmt.Printf("GetCounter error: %v\n", err)
 		}
-		fmt.Printf("GetCounter error: %v\n", err)
-		return 0, false
-	}
-	if mtype != "counter" {
 		return 0, false
 	}
 	return Counter(iVal), true
 }
 
-// ========== batch update ==========
+// ========== composite ==========
+
+// UpdateComposite объединяет значение составной метрики с сохранённым в одной транзакции.
+func (ps *PostgresStorage) UpdateComposite(name string, value models.Composite) error {
+	if err := value.Validate(); err != nil {
+		return err
+	}
 
-// UpdateMetricsBatch выполняет пакетное обновление метрик с дедупликацией в рамках запроса.
-func (ps *PostgresStorage) UpdateMetricsBatch(batch []middleware.MetricsJSON) error {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
-	ctx := context.Background()
-	type dedupKey struct {
-		ID    string
-		MType string
+	return ps.withTx(func(ctx context.Context, tx pgx.Tx) error {
+		if err := ps.prepareWriteTx(ctx, tx, value.Type(), name); err != nil {
+			return err
+		}
+		merged, err := mergeCompositeTx(ctx, tx, name, value)
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(merged)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, upsertCompositeSQL, name, value.Type(), string(payload), timeNow())
+		return err
+	})
+}
+
+// mergeCompositeTx читает сохранённое значение (с блокировкой строки) и объединяет его с value.
+func mergeCompositeTx(ctx context.Context, tx pgx.Tx, name string, value models.Composite) (models.Composite, error) {
+	var payload string
+	err := tx.QueryRow(ctx,
+		`SELECT payload FROM metrics WHERE id = $1 AND mtype = $2 FOR UPDATE;`,
+		name, value.Type()).Scan(&payload)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return value.Clone(), nil
 	}
-	type accumVal struct {
-		iValue   int64
-		gRawVal  string
-		override bool // gauge перезаписываем
+	if err != nil {
+		return nil, err
+	}
+	prev, err := models.DecodeComposite(value.Type(), []byte(payload))
+	if err != nil {
+		return nil, err
 	}
+	if err := prev.Merge(value); err != nil {
+		return nil, err
+	}
+	return prev, nil
+}
 
-	deduped := make(map[dedupKey]*accumVal)
+// GetComposite возвращает значение составной метрики и признак наличия.
+func (ps *PostgresStorage) GetComposite(mtype, name string) (models.Composite, bool) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	var payload string
+	query := `SELECT payload FROM metrics WHERE id = $1 AND mtype = $2;`
+	err := ps.db.Pool.QueryRow(context.Background(), query, name, mtype).Scan(&payload)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			fmt.Printf("GetComposite error: %v\n", err)
+		}
+		return nil, false
+	}
+	c, err := models.DecodeComposite(mtype, []byte(payload))
+	if err != nil {
+		fmt.Printf("GetComposite decode error: %v\n", err)
+		return nil, false
+	}
+	return c, true
+}
+
+// GetAllComposites возвращает все значения составных метрик типа mtype.
+func (ps *PostgresStorage) GetAllComposites(mtype string) map[string]models.Composite {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	result := make(map[string]models.Composite)
+	rows, err := ps.db.Pool.Query(context.Background(), `SELECT id, payload FROM metrics WHERE mtype = $1`, mtype)
+	if err != nil {
+		fmt.Printf("GetAllComposites error: %v\n", err)
+		return result
+	}
+	defer rows.Close()
 
-	for _, m := range batch {
-		key := dedupKey{
-			ID:    m.ID,
-			MType: strings.ToLower(string(m.MType)),
+	for rows.Next() {
+		var id, payload string
+		if err := rows.Scan(&id, &payload); err != nil {
+			fmt.Printf("GetAllComposites scan error: %v\n", err)
+			continue
 		}
-		if _, ok := deduped[key]; !ok {
-			deduped[key] = &accumVal{}
+		c, err := models.DecodeComposite(mtype, []byte(payload))
+		if err != nil {
+			fmt.Printf("GetAllComposites decode error: %v\n", err)
+			continue
 		}
-		switch key.MType {
-		case "counter":
-			if m.Delta != nil {
-				deduped[key].iValue += *m.Delta
+		result[id] = c
+	}
+	return result
+}
+
+// ========== batch update ==========
+
+// UpdateMetricsBatch выполняет пакетное обновление метрик в одной транзакции.
+// Пакет предварительно сворачивается (resolveBatch) так же, как в памяти.
+func (ps *PostgresStorage) UpdateMetricsBatch(batch []middleware.MetricsJSON) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	items, err := resolveBatch(batch, ps.policy)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	err = ps.withTx(func(ctx context.Context, tx pgx.Tx) error {
+		now := timeNow()
+		b := &pgx.Batch{}
+		for _, item := range items {
+			if ps.policy == ConflictReject {
+				if err := ps.prepareWriteTx(ctx, tx, item.mtype, item.name); err != nil {
+					return err
+				}
 			}
-		case "gauge":
-			if m.Value != nil {
-				// Преобразуем float в строку (или можно хранить исходную строку m, если есть)
-				gstr := strconv.FormatFloat(*m.Value, 'f', -1, 64)
-				// Или, если хотите вообще НЕ терять исходную строку,
-				// тогда надо расширять middleware, чтобы она не теряла raw.
-				deduped[key].gRawVal = gstr
-				deduped[key].override = true
+			if ps.policy == ConflictOverwrite {
+				b.Queue(deleteOtherTypesSQL, item.name, item.mtype)
+			}
+			switch item.mtype {
+			case "counter":
+				b.Queue(addCounterSQL, item.name, item.delta, now)
+			case "gauge":
+				b.Queue(upsertGaugeSQL, item.name, item.raw, now)
+			default:
+				merged, err := mergeCompositeTx(ctx, tx, item.name, item.composite)
+				if err != nil {
+					return fmt.Errorf("metric %q: %w", item.name, err)
+				}
+				payload, err := json.Marshal(merged)
+				if err != nil {
+					return err
+				}
+				b.Queue(upsertCompositeSQL, item.name, item.mtype, string(payload), now)
 			}
-		default:
-			return fmt.Errorf("unsupported metric type in batch: %q", m.MType)
 		}
+		return tx.SendBatch(ctx, b).Close()
+	})
+	if err != nil && !errors.Is(err, models.ErrTypeConflict) {
+		fmt.Printf("UpdateMetricsBatch error after retries: %v\n", err)
 	}
+	return err
+}
 
-	if len(deduped) == 0 {
+// ========== snapshot ==========
+
+// Restore записывает снимок метрик в одной транзакции.
+// При replace=true таблица предварительно очищается.
+func (ps *PostgresStorage) Restore(data models.MetricsData, replace bool) error {
+	for name, raw := range data.Gauges {
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return fmt.Errorf("invalid gauge %q in snapshot: %w", name, err)
+		}
+	}
+	composites, err := decodeSnapshotComposites(data)
+	if err != nil {
+		return err
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if err := checkSnapshotConflicts(data, ps.policy); err != nil {
+		return err
+	}
+
+	return ps.withTx(func(ctx context.Context, tx pgx.Tx) error {
+		if replace {
+			if _, err := tx.Exec(ctx, `DELETE FROM metrics;`); err != nil {
+				return err
+			}
+		}
+		now := timeNow()
+		for name, raw := range data.Gauges {
+			if err := ps.prepareWriteTx(ctx, tx, "gauge", name); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, upsertGaugeSQL, name, raw, stampOrNow(data.GaugesUpdatedAt, name, now)); err != nil {
+				return err
+			}
+		}
+		for name, c := range data.Counters {
+			if err := ps.prepareWriteTx(ctx, tx, "counter", name); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, setCounterSQL, name, c, stampOrNow(data.CountersUpdatedAt, name, now)); err != nil {
+				return err
+			}
+		}
+		for key, c := range composites {
+			if err := ps.prepareWriteTx(ctx, tx, key.mtype, key.name); err != nil {
+				return err
+			}
+			payload, err := json.Marshal(c)
+			if err != nil {
+				return err
+			}
+			at := stampOrNow(data.CompositesUpdatedAt[key.mtype], key.name, now)
+			if _, err := tx.Exec(ctx, upsertCompositeSQL, key.name, key.mtype, string(payload), at); err != nil {
+				return err
+			}
+		}
 		return nil
+	})
+}
+
+// ========== metadata ==========
+
+// ListMetricInfo возвращает все метрики с временем последнего обновления.
+func (ps *PostgresStorage) ListMetricInfo() []MetricInfo {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	var infos []MetricInfo
+	rows, err := ps.db.Pool.Query(context.Background(), `SELECT id, mtype, updated_at FROM metrics`)
+	if err != nil {
+		fmt.Printf("ListMetricInfo error: %v\n", err)
+		return infos
 	}
+	defer rows.Close()
 
-	// Собираем VALUES для INSERT
-	var values []string
-	for key, val := range deduped {
-		if key.MType == "counter" {
-			values = append(values, fmt.Sprintf(
-				"('%s','counter',%d,'')",
-				key.ID, val.iValue,
-			))
-		} else {
-			// gauge
-			values = append(values, fmt.Sprintf(
-				"('%s','gauge',0,'%s')",
-				key.ID, val.gRawVal,
-			))
+	for rows.Next() {
+		var info MetricInfo
+		if err := rows.Scan(&info.Name, &info.Type, &info.UpdatedAt); err != nil {
+			fmt.Printf("ListMetricInfo scan error: %v\n", err)
+			continue
 		}
+		infos = append(infos, info)
 	}
+	return infos
+}
 
-	insertQuery := `
-	INSERT INTO metrics (id, mtype, ivalue, grawvalue)
-	VALUES %s
-	ON CONFLICT (id) DO UPDATE
-	  SET mtype = EXCLUDED.mtype,
-	      ivalue = CASE WHEN EXCLUDED.mtype='counter'
-	                    THEN metrics.ivalue + EXCLUDED.ivalue
-	                    ELSE metrics.ivalue
-	               END,
-	      grawvalue = CASE WHEN EXCLUDED.mtype='gauge'
-	                    THEN EXCLUDED.grawvalue
-	                    ELSE metrics.grawvalue
-	               END;
-	`
-	insertQuery = fmt.Sprintf(insertQuery, strings.Join(values, ","))
+// DeleteMetric удаляет метрику; условие updatedBefore проверяется в том же запросе,
+// поэтому метрика, обновлённая после выборки кандидатов, не будет удалена.
+func (ps *PostgresStorage) DeleteMetric(mtype, name string, updatedBefore time.Time) (bool, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
 
+	var before *time.Time
+	if !updatedBefore.IsZero() {
+		before = &updatedBefore
+	}
+	var deleted int64
 	err := retry.DoWithRetry(func() error {
-		tx, beginErr := ps.db.Pool.Begin(ctx)
-		if beginErr != nil {
-			return beginErr
+		tag, err := ps.db.Pool.Exec(context.Background(), `
+		DELETE FROM metrics
+		WHERE id = $1 AND mtype = $2
+		  AND ($3::timestamptz IS NULL OR updated_at < $3);
+		`, name, strings.ToLower(mtype), before)
+		if err != nil {
+			return err
 		}
-		defer func() {
-			_ = tx.Rollback(ctx) // игнорируем ошибку, если уже закрыт
-		}()
+		deleted = tag.RowsAffected()
+		return nil
+	})
+	return deleted > 0, err
+}
 
-		_, execErr := tx.Exec(ctx, insertQuery)
-		if execErr != nil {
-			return execErr
+// ResetCounter обнуляет counter.
+func (ps *PostgresStorage) ResetCounter(name string) (bool, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	var reset int64
+	err := retry.DoWithRetry(func() error {
+		tag, err := ps.db.Pool.Exec(context.Background(), `
+		UPDATE metrics SET ivalue = 0, updated_at = now()
+		WHERE id = $1 AND mtype = 'counter';
+		`, name)
+		if err != nil {
+			return err
 		}
-		return tx.Commit(ctx)
+		reset = tag.RowsAffected()
+		return nil
 	})
-	if err != nil {
-		fmt.Printf("UpdateMetricsBatch error after retries: %v\n", err)
-	}
-	return err
+	return reset > 0, err
 }
 
 // ========== getAll* ==========
@@ -306,11 +585,3 @@ func (ps *PostgresStorage) GetAllCounters() map[string]Counter {
 func (ps *PostgresStorage) Shutdown() error {
 	return nil
 }
-
-// execWithRetry — вспомогательный вызов Exec с повторными попытками.
-func (ps *PostgresStorage) execWithRetry(ctx context.Context, query string, args ...any) error {
-	return retry.DoWithRetry(func() error {
-		_, err := ps.db.Pool.Exec(ctx, query, args...)
-		return err
-	})
-}
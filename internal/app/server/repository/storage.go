@@ -1,11 +1,14 @@
 package repository
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
 )
 
 type Counter int64
@@ -15,14 +18,46 @@ type Counter int64
 type Storage interface {
 	UpdateGaugeRaw(name, rawValue string) error
 	GetGaugeRaw(name string) (string, bool)
-	UpdateCounter(name string, value Counter)
+	UpdateCounter(name string, value Counter) error
 	GetCounter(name string) (Counter, bool)
 	GetAllGauges() map[string]string
 	GetAllCounters() map[string]Counter
+	// UpdateComposite объединяет значение составной метрики (histogram, summary, ...)
+	// с сохранённым под тем же именем; при несовместимых значениях возвращает models.ErrCompositeMismatch.
+	UpdateComposite(name string, value models.Composite) error
+	// GetComposite возвращает копию значения составной метрики и признак наличия.
+	GetComposite(mtype, name string) (models.Composite, bool)
+	// GetAllComposites возвращает копии всех значений составных метрик типа mtype.
+	GetAllComposites(mtype string) map[string]models.Composite
 	UpdateMetricsBatch(batch []middleware.MetricsJSON) error
+	// Restore записывает снимок метрик: значения из снимка перезаписывают текущие
+	// (counter выставляется в значение из снимка, а не прибавляется).
+	// При replace=true все метрики, отсутствующие в снимке, удаляются.
+	Restore(data models.MetricsData, replace bool) error
+	// ListMetricInfo возвращает все метрики с временем их последнего обновления.
+	ListMetricInfo() []MetricInfo
+	// DeleteMetric удаляет метрику указанного типа и сообщает, была ли она удалена.
+	// Если updatedBefore не нулевое, метрика удаляется только при условии,
+	// что её последнее обновление произошло раньше этого момента.
+	DeleteMetric(mtype, name string, updatedBefore time.Time) (bool, error)
+	// ResetCounter обнуляет counter и сообщает, существовал ли он.
+	ResetCounter(name string) (bool, error)
+	// SetConflictPolicy задаёт политику совпадения имён метрик разных типов.
+	// Вызывается при настройке, до начала обслуживания запросов.
+	SetConflictPolicy(policy ConflictPolicy)
 	Shutdown() error
 }
 
+// MetricInfo описывает метрику и время её последнего обновления.
+type MetricInfo struct {
+	Name      string
+	Type      string // "gauge" | "counter" | составной тип
+	UpdatedAt time.Time
+}
+
+// timeNow — источник текущего времени; переменная, чтобы в тестах можно было подменить часы.
+var timeNow = time.Now
+
 // MetricStorage — вспомогательное потокобезопасное хранилище значений int64 по ключу.
 type MetricStorage[T ~int64] struct {
 	mu     sync.RWMutex
@@ -52,6 +87,31 @@ func (m *MetricStorage[T]) Get(name string) (T, bool) {
 	return val, ok
 }
 
+// Set выставляет значение по имени без накопления.
+func (m *MetricStorage[T]) Set(name string, value T) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[name] = value
+}
+
+// Clear удаляет все значения.
+func (m *MetricStorage[T]) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values = make(map[string]T)
+}
+
+// Delete удаляет значение по имени и сообщает, существовало ли оно.
+func (m *MetricStorage[T]) Delete(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.values[name]; !ok {
+		return false
+	}
+	delete(m.values, name)
+	return true
+}
+
 // GetAll возвращает копию всех значений.
 func (m *MetricStorage[T]) GetAll() map[string]T {
 	m.mu.RLock()
@@ -63,18 +123,36 @@ func (m *MetricStorage[T]) GetAll() map[string]T {
 	return cpy
 }
 
+// metricKey — ключ метрики с учётом типа (метрики разных типов живут в разных пространствах имён).
+type metricKey struct {
+	mtype string
+	name  string
+}
+
 // MemStorage — в памяти храним:
 // 1) gauges как map[string]string
 // 2) counters (int64) в MetricStorage
+// 3) составные метрики (histogram, summary, ...)
+// 4) время последнего обновления каждой метрики
 type MemStorage struct {
 	gauges   sync.Map // ключ string -> значение string
 	counters *MetricStorage[Counter]
+
+	// metaMu защищает updated и composites и делает запись значения вместе с отметкой времени
+	// атомарной относительно удаления устаревших метрик.
+	metaMu     sync.Mutex
+	updated    map[metricKey]time.Time
+	composites map[metricKey]models.Composite
+
+	policy ConflictPolicy
 }
 
 // NewMemStorage создаёт хранилище метрик в оперативной памяти.
 func NewMemStorage() *MemStorage {
 	return &MemStorage{
-		counters: NewMetricStorage[Counter](),
+		counters:   NewMetricStorage[Counter](),
+		updated:    make(map[metricKey]time.Time),
+		composites: make(map[metricKey]models.Composite),
 	}
 }
 
@@ -84,7 +162,12 @@ func (m *MemStorage) UpdateGaugeRaw(name, rawValue string) error {
 	if err != nil {
 		return err
 	}
-	m.gauges.Store(name, rawValue)
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+	if err := m.prepareWriteLocked("gauge", name); err != nil {
+		return err
+	}
+	m.storeGaugeLocked(name, rawValue, timeNow())
 	return nil
 }
 
@@ -98,8 +181,138 @@ func (m *MemStorage) GetGaugeRaw(name string) (string, bool) {
 }
 
 // UpdateCounter накапливает значение counter по ключу.
-func (m *MemStorage) UpdateCounter(name string, value Counter) {
+func (m *MemStorage) UpdateCounter(name string, value Counter) error {
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+	if err := m.prepareWriteLocked("counter", name); err != nil {
+		return err
+	}
+	m.addCounterLocked(name, value, timeNow())
+	return nil
+}
+
+// UpdateComposite объединяет значение составной метрики с сохранённым.
+// Сохранённое значение заменяется только при успешном объединении.
+func (m *MemStorage) UpdateComposite(name string, value models.Composite) error {
+	if err := value.Validate(); err != nil {
+		return err
+	}
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+	if err := m.prepareWriteLocked(value.Type(), name); err != nil {
+		return err
+	}
+	merged, err := m.mergeCompositeLocked(name, value)
+	if err != nil {
+		return err
+	}
+	m.storeCompositeLocked(name, merged, timeNow())
+	return nil
+}
+
+// mergeCompositeLocked возвращает новое значение метрики: копию сохранённого, объединённую с value.
+// Вызывается под metaMu.
+func (m *MemStorage) mergeCompositeLocked(name string, value models.Composite) (models.Composite, error) {
+	prev, ok := m.composites[metricKey{value.Type(), name}]
+	if !ok {
+		return value.Clone(), nil
+	}
+	merged := prev.Clone()
+	if err := merged.Merge(value); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// storeCompositeLocked записывает составное значение и время обновления. Вызывается под metaMu.
+func (m *MemStorage) storeCompositeLocked(name string, value models.Composite, at time.Time) {
+	key := metricKey{value.Type(), name}
+	m.composites[key] = value
+	m.updated[key] = at
+}
+
+// GetComposite возвращает копию значения составной метрики.
+func (m *MemStorage) GetComposite(mtype, name string) (models.Composite, bool) {
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+	c, ok := m.composites[metricKey{mtype, name}]
+	if !ok {
+		return nil, false
+	}
+	return c.Clone(), true
+}
+
+// GetAllComposites возвращает копии всех значений составных метрик типа mtype.
+func (m *MemStorage) GetAllComposites(mtype string) map[string]models.Composite {
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+	result := make(map[string]models.Composite)
+	for key, c := range m.composites {
+		if key.mtype == mtype {
+			result[key.name] = c.Clone()
+		}
+	}
+	return result
+}
+
+// SetConflictPolicy задаёт политику совпадения имён метрик разных типов.
+func (m *MemStorage) SetConflictPolicy(policy ConflictPolicy) {
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+	m.policy = policy
+}
+
+// prepareWriteLocked применяет политику конфликтов перед записью метрики типа mtype:
+// при reject возвращает ошибку, при overwrite удаляет метрики других типов с тем же именем.
+// Вызывается под metaMu.
+func (m *MemStorage) prepareWriteLocked(mtype, name string) error {
+	switch m.policy {
+	case ConflictReject:
+		if other, exists := m.conflictingTypeLocked(mtype, name); exists {
+			return conflictError(name, other)
+		}
+	case ConflictOverwrite:
+		for _, other := range otherTypes(mtype) {
+			m.deleteLocked(other, name)
+		}
+	}
+	return nil
+}
+
+// conflictingTypeLocked возвращает тип, под которым имя уже занято метрикой другого типа.
+// Вызывается под metaMu.
+func (m *MemStorage) conflictingTypeLocked(mtype, name string) (string, bool) {
+	for _, other := range otherTypes(mtype) {
+		if _, exists := m.updated[metricKey{other, name}]; exists {
+			return other, true
+		}
+	}
+	return "", false
+}
+
+// storeGaugeLocked записывает gauge и время обновления. Вызывается под metaMu.
+func (m *MemStorage) storeGaugeLocked(name, rawValue string, at time.Time) {
+	m.gauges.Store(name, rawValue)
+	m.updated[metricKey{"gauge", name}] = at
+}
+
+// addCounterLocked накапливает counter и обновляет время. Вызывается под metaMu.
+func (m *MemStorage) addCounterLocked(name string, value Counter, at time.Time) {
 	m.counters.Update(name, value)
+	m.updated[metricKey{"counter", name}] = at
+}
+
+// deleteLocked удаляет метрику вместе с метаданными. Вызывается под metaMu.
+func (m *MemStorage) deleteLocked(mtype, name string) {
+	switch mtype {
+	case "gauge":
+		m.gauges.Delete(name)
+	case "counter":
+		m.counters.Delete(name)
+	default:
+		delete(m.composites, metricKey{mtype, name})
+	}
+	delete(m.updated, metricKey{mtype, name})
 }
 
 // GetCounter возвращает текущее значение counter и признак наличия.
@@ -125,25 +338,180 @@ func (m *MemStorage) GetAllCounters() map[string]Counter {
 }
 
 // UpdateMetricsBatch применяет пакет обновлений к памяти.
+// Пакет применяется целиком: при конфликте типов (политика reject) ничего не записывается.
 func (m *MemStorage) UpdateMetricsBatch(batch []middleware.MetricsJSON) error {
-	for _, metric := range batch {
-		mType := strings.ToLower(string(metric.MType))
-		switch mType {
-		case "counter":
-			if metric.Delta != nil {
-				m.UpdateCounter(metric.ID, Counter(*metric.Delta))
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+
+	items, err := resolveBatch(batch, m.policy)
+	if err != nil {
+		return err
+	}
+	if m.policy == ConflictReject {
+		for _, item := range items {
+			if other, exists := m.conflictingTypeLocked(item.mtype, item.name); exists {
+				return conflictError(item.name, other)
 			}
+		}
+	}
+	// Составные значения объединяются заранее: несовместимое значение отклоняет весь пакет.
+	merged := make(map[int]models.Composite)
+	for i, item := range items {
+		if item.composite == nil {
+			continue
+		}
+		c, err := m.mergeCompositeLocked(item.name, item.composite)
+		if err != nil {
+			return fmt.Errorf("metric %q: %w", item.name, err)
+		}
+		merged[i] = c
+	}
+
+	now := timeNow()
+	for i, item := range items {
+		// Для reject конфликты уже проверены, для overwrite здесь удаляются метрики других типов.
+		_ = m.prepareWriteLocked(item.mtype, item.name)
+		switch item.mtype {
+		case "counter":
+			m.addCounterLocked(item.name, Counter(item.delta), now)
 		case "gauge":
-			if metric.Value != nil {
-				raw := floatToString(*metric.Value)
-				_ = m.UpdateGaugeRaw(metric.ID, raw)
-			}
+			m.storeGaugeLocked(item.name, item.raw, now)
 		default:
+			m.storeCompositeLocked(item.name, merged[i], now)
 		}
 	}
 	return nil
 }
 
+// Restore записывает снимок метрик в память.
+// Gauge и составные метрики из снимка валидируются заранее, чтобы не применить снимок частично.
+// Время обновления берётся из снимка, а при его отсутствии — текущее.
+func (m *MemStorage) Restore(data models.MetricsData, replace bool) error {
+	for name, raw := range data.Gauges {
+		if _, err := parseGaugeOrFail(raw); err != nil {
+			return fmt.Errorf("invalid gauge %q in snapshot: %w", name, err)
+		}
+	}
+	composites, err := decodeSnapshotComposites(data)
+	if err != nil {
+		return err
+	}
+
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+
+	if err := checkSnapshotConflicts(data, m.policy); err != nil {
+		return err
+	}
+	if m.policy == ConflictReject && !replace {
+		for _, key := range snapshotKeys(data) {
+			if other, exists := m.conflictingTypeLocked(key.mtype, key.name); exists {
+				return conflictError(key.name, other)
+			}
+		}
+	}
+
+	if replace {
+		m.gauges.Range(func(key, _ any) bool {
+			m.gauges.Delete(key)
+			return true
+		})
+		m.counters.Clear()
+		m.updated = make(map[metricKey]time.Time)
+		m.composites = make(map[metricKey]models.Composite)
+	}
+	now := timeNow()
+	for name, raw := range data.Gauges {
+		_ = m.prepareWriteLocked("gauge", name)
+		m.storeGaugeLocked(name, raw, stampOrNow(data.GaugesUpdatedAt, name, now))
+	}
+	for name, c := range data.Counters {
+		_ = m.prepareWriteLocked("counter", name)
+		m.counters.Set(name, Counter(c))
+		m.updated[metricKey{"counter", name}] = stampOrNow(data.CountersUpdatedAt, name, now)
+	}
+	for key, c := range composites {
+		_ = m.prepareWriteLocked(key.mtype, key.name)
+		m.storeCompositeLocked(key.name, c, stampOrNow(data.CompositesUpdatedAt[key.mtype], key.name, now))
+	}
+	return nil
+}
+
+// ListMetricInfo возвращает все метрики с временем последнего обновления.
+func (m *MemStorage) ListMetricInfo() []MetricInfo {
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+	infos := make([]MetricInfo, 0, len(m.updated))
+	for key, at := range m.updated {
+		infos = append(infos, MetricInfo{Name: key.name, Type: key.mtype, UpdatedAt: at})
+	}
+	return infos
+}
+
+// DeleteMetric удаляет метрику из памяти (с учётом условия updatedBefore).
+func (m *MemStorage) DeleteMetric(mtype, name string, updatedBefore time.Time) (bool, error) {
+	key := metricKey{strings.ToLower(mtype), name}
+
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+
+	at, ok := m.updated[key]
+	if !ok {
+		return false, nil
+	}
+	if !updatedBefore.IsZero() && !at.Before(updatedBefore) {
+		return false, nil
+	}
+	m.deleteLocked(key.mtype, name)
+	return true, nil
+}
+
+// ResetCounter обнуляет counter в памяти.
+func (m *MemStorage) ResetCounter(name string) (bool, error) {
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+
+	if _, ok := m.counters.Get(name); !ok {
+		return false, nil
+	}
+	m.counters.Set(name, 0)
+	m.updated[metricKey{"counter", name}] = timeNow()
+	return true, nil
+}
+
+// snapshot собирает снимок памяти вместе с временем обновления метрик.
+func (m *MemStorage) snapshot() models.MetricsData {
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+
+	data := models.NewMetricsData()
+	data.GaugesUpdatedAt = make(map[string]time.Time)
+	data.CountersUpdatedAt = make(map[string]time.Time)
+	m.gauges.Range(func(key, value any) bool {
+		name := key.(string)
+		data.Gauges[name] = value.(string)
+		data.GaugesUpdatedAt[name] = m.updated[metricKey{"gauge", name}]
+		return true
+	})
+	for name, c := range m.counters.GetAll() {
+		data.Counters[name] = int64(c)
+		data.CountersUpdatedAt[name] = m.updated[metricKey{"counter", name}]
+	}
+	for key, c := range m.composites {
+		// Значения в памяти всегда сериализуемы; ошибку здесь игнорировать безопасно.
+		_ = data.SetComposite(key.name, c, m.updated[key])
+	}
+	return data
+}
+
+// stampOrNow возвращает время из карты снимка, а при его отсутствии — now.
+func stampOrNow(stamps map[string]time.Time, name string, now time.Time) time.Time {
+	if at, ok := stamps[name]; ok && !at.IsZero() {
+		return at
+	}
+	return now
+}
+
 // Shutdown для памяти ничего не делает.
 func (m *MemStorage) Shutdown() error {
 	return nil
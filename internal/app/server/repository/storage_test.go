@@ -1,6 +1,11 @@
 package repository
 
-import "testing"
+import (
+    "testing"
+    "time"
+
+    "github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
 
 func TestMemStorageGaugeAndCounter(t *testing.T) {
     m := NewMemStorage()
@@ -36,3 +41,84 @@ func TestMemStorageGaugeAndCounter(t *testing.T) {
 }
 
 
+
+func TestMemStorageRestore(t *testing.T) {
+    m := NewMemStorage()
+    _ = m.UpdateGaugeRaw("Old", "1")
+    m.UpdateCounter("C", 10)
+
+    snap := models.MetricsData{
+        Gauges:   map[string]string{"G": "2.5"},
+        Counters: map[string]int64{"C": 3},
+    }
+    if err := m.Restore(snap, false); err != nil {
+        t.Fatalf("restore merge: %v", err)
+    }
+    if v, _ := m.GetCounter("C"); v != 3 {
+        t.Fatalf("restore must set counter, got %d", v)
+    }
+    if _, ok := m.GetGaugeRaw("Old"); !ok {
+        t.Fatalf("merge must keep existing gauges")
+    }
+
+    if err := m.Restore(snap, true); err != nil {
+        t.Fatalf("restore replace: %v", err)
+    }
+    if _, ok := m.GetGaugeRaw("Old"); ok {
+        t.Fatalf("replace must drop metrics missing in snapshot")
+    }
+
+    bad := models.MetricsData{Gauges: map[string]string{"B": "x"}}
+    if err := m.Restore(bad, true); err == nil {
+        t.Fatalf("expected error for invalid gauge in snapshot")
+    }
+    if _, ok := m.GetGaugeRaw("G"); !ok {
+        t.Fatalf("invalid snapshot must not clear storage")
+    }
+}
+
+func TestMemStorageDeleteMetricRespectsUpdatedBefore(t *testing.T) {
+    base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+    timeNow = func() time.Time { return base }
+    defer func() { timeNow = time.Now }()
+
+    m := NewMemStorage()
+    _ = m.UpdateGaugeRaw("G", "1")
+    m.UpdateCounter("C", 1)
+
+    infos := m.ListMetricInfo()
+    if len(infos) != 2 || !infos[0].UpdatedAt.Equal(base) {
+        t.Fatalf("unexpected metric info: %+v", infos)
+    }
+
+    if deleted, _ := m.DeleteMetric("gauge", "G", base); deleted {
+        t.Fatalf("metric updated at the deadline must not be deleted")
+    }
+    if deleted, _ := m.DeleteMetric("gauge", "G", base.Add(time.Second)); !deleted {
+        t.Fatalf("stale metric must be deleted")
+    }
+    if _, ok := m.GetGaugeRaw("G"); ok {
+        t.Fatalf("gauge must be gone")
+    }
+    if deleted, _ := m.DeleteMetric("counter", "C", time.Time{}); !deleted {
+        t.Fatalf("unconditional delete must remove counter")
+    }
+    if len(m.ListMetricInfo()) != 0 {
+        t.Fatalf("metadata must be removed with metrics")
+    }
+}
+
+func TestMemStorageResetCounter(t *testing.T) {
+    m := NewMemStorage()
+    if reset, _ := m.ResetCounter("C"); reset {
+        t.Fatalf("missing counter must not be reset")
+    }
+    m.UpdateCounter("C", 5)
+    if reset, _ := m.ResetCounter("C"); !reset {
+        t.Fatalf("existing counter must be reset")
+    }
+    m.UpdateCounter("C", 2)
+    if v, _ := m.GetCounter("C"); v != 2 {
+        t.Fatalf("counter must accumulate from zero after reset, got %d", v)
+    }
+}
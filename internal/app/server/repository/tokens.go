@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/pkg/retry"
+)
+
+// TokenStore хранит API-токены. Токены хранятся только в виде хэшей секрета.
+type TokenStore interface {
+	// ListTokens возвращает токены в порядке создания.
+	ListTokens() ([]models.Token, error)
+	// TokenByHash ищет токен по хэшу секрета.
+	TokenByHash(hash string) (models.Token, bool, error)
+	CreateToken(t models.Token) error
+	// DeleteToken отзывает токен; false — токена с таким id нет.
+	DeleteToken(id string) (bool, error)
+}
+
+// FileTokenStore хранит токены в JSON-файле и держит их копию в памяти.
+// Файл перезаписывается атомарно при каждом изменении.
+type FileTokenStore struct {
+	filePath string
+
+	mu     sync.RWMutex
+	tokens []models.Token
+}
+
+// NewFileTokenStore загружает токены из filePath; отсутствующий файл означает пустой список.
+func NewFileTokenStore(filePath string) (*FileTokenStore, error) {
+	s := &FileTokenStore{filePath: filePath}
+	data, err := os.ReadFile(filePath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return s, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read tokens file: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse tokens file: %w", err)
+	}
+	return s, nil
+}
+
+// ListTokens возвращает копию списка токенов.
+func (s *FileTokenStore) ListTokens() ([]models.Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]models.Token(nil), s.tokens...), nil
+}
+
+// TokenByHash ищет токен по хэшу секрета.
+func (s *FileTokenStore) TokenByHash(hash string) (models.Token, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.tokens {
+		if t.Hash == hash {
+			return t, true, nil
+		}
+	}
+	return models.Token{}, false, nil
+}
+
+// CreateToken добавляет токен и сохраняет файл.
+func (s *FileTokenStore) CreateToken(t models.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.tokens {
+		if existing.ID == t.ID {
+			return fmt.Errorf("token %s already exists", t.ID)
+		}
+	}
+	tokens := append(s.tokens[:len(s.tokens):len(s.tokens)], t)
+	if err := s.save(tokens); err != nil {
+		return err
+	}
+	s.tokens = tokens
+	return nil
+}
+
+// DeleteToken удаляет токен и сохраняет файл.
+func (s *FileTokenStore) DeleteToken(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := make([]models.Token, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		if t.ID != id {
+			tokens = append(tokens, t)
+		}
+	}
+	if len(tokens) == len(s.tokens) {
+		return false, nil
+	}
+	if err := s.save(tokens); err != nil {
+		return false, err
+	}
+	s.tokens = tokens
+	return true, nil
+}
+
+// save записывает токены через временный файл. Файл доступен только владельцу.
+func (s *FileTokenStore) save(tokens []models.Token) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	return retry.DoWithRetry(func() error {
+		tempFile := s.filePath + ".tmp"
+		if err := os.WriteFile(tempFile, data, 0600); err != nil {
+			return err
+		}
+		if err := os.Rename(tempFile, s.filePath); err != nil {
+			_ = os.Remove(tempFile)
+			return err
+		}
+		return nil
+	})
+}
+
+// PostgresTokenStore хранит токены в таблице api_tokens.
+type PostgresTokenStore struct {
+	db *DBConnection
+}
+
+// NewPostgresTokenStore создаёт хранилище токенов и таблицу api_tokens, если её нет.
+func NewPostgresTokenStore(dbConn *DBConnection) (*PostgresTokenStore, error) {
+	if dbConn == nil || dbConn.Pool == nil {
+		return nil, fmt.Errorf("database not configured")
+	}
+	_, err := dbConn.Pool.Exec(context.Background(), `
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL DEFAULT '',
+		role TEXT NOT NULL,
+		prefixes TEXT[] NOT NULL DEFAULT '{}',
+		hash TEXT NOT NULL UNIQUE,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api_tokens table: %w", err)
+	}
+	return &PostgresTokenStore{db: dbConn}, nil
+}
+
+const selectTokensSQL = `SELECT id, name, role, prefixes, hash, created_at FROM api_tokens`
+
+func scanToken(row pgx.Row) (models.Token, error) {
+	var t models.Token
+	var role string
+	if err := row.Scan(&t.ID, &t.Name, &role, &t.Prefixes, &t.Hash, &t.CreatedAt); err != nil {
+		return t, err
+	}
+	t.Role = models.Role(role)
+	if len(t.Prefixes) == 0 {
+		t.Prefixes = nil
+	}
+	return t, nil
+}
+
+// ListTokens возвращает токены в порядке создания.
+func (ps *PostgresTokenStore) ListTokens() ([]models.Token, error) {
+	var tokens []models.Token
+	err := retry.DoWithRetry(func() error {
+		rows, err := ps.db.Pool.Query(context.Background(), selectTokensSQL)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		tokens = tokens[:0]
+		for rows.Next() {
+			t, err := scanToken(rows)
+			if err != nil {
+				return err
+			}
+			tokens = append(tokens, t)
+		}
+		return rows.Err()
+	})
+	sort.SliceStable(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens, err
+}
+
+// TokenByHash ищет токен по хэшу секрета.
+func (ps *PostgresTokenStore) TokenByHash(hash string) (models.Token, bool, error) {
+	var (
+		t     models.Token
+		found bool
+	)
+	err := retry.DoWithRetry(func() error {
+		var err error
+		t, err = scanToken(ps.db.Pool.QueryRow(context.Background(), selectTokensSQL+` WHERE hash = $1`, hash))
+		if errors.Is(err, pgx.ErrNoRows) {
+			found = false
+			return nil
+		}
+		found = err == nil
+		return err
+	})
+	return t, found, err
+}
+
+// CreateToken сохраняет токен.
+func (ps *PostgresTokenStore) CreateToken(t models.Token) error {
+	prefixes := t.Prefixes
+	if prefixes == nil {
+		prefixes = []string{}
+	}
+	return retry.DoWithRetry(func() error {
+		_, err := ps.db.Pool.Exec(context.Background(), `
+		INSERT INTO api_tokens (id, name, role, prefixes, hash, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6);
+		`, t.ID, t.Name, string(t.Role), prefixes, t.Hash, t.CreatedAt)
+		return err
+	})
+}
+
+// DeleteToken удаляет токен.
+func (ps *PostgresTokenStore) DeleteToken(id string) (bool, error) {
+	var deleted int64
+	err := retry.DoWithRetry(func() error {
+		tag, err := ps.db.Pool.Exec(context.Background(), `DELETE FROM api_tokens WHERE id = $1;`, id)
+		if err != nil {
+			return err
+		}
+		deleted = tag.RowsAffected()
+		return nil
+	})
+	return deleted > 0, err
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
+
+func TestFileTokenStore_Persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	s, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok := models.Token{ID: "a1", Name: "agent", Role: models.RoleWriter, Prefixes: []string{"app."}, Hash: "h1", CreatedAt: time.Now().UTC()}
+	if err := s.CreateToken(tok); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateToken(tok); err == nil {
+		t.Fatal("duplicate id must be rejected")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("tokens file must be private: %v %v", info, err)
+	}
+
+	reloaded, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := reloaded.TokenByHash("h1")
+	if err != nil || !ok || got.ID != "a1" || !got.Covers("app.Alloc") || got.Covers("db.Conns") {
+		t.Fatalf("unexpected token after reload: %+v %v %v", got, ok, err)
+	}
+
+	if deleted, err := reloaded.DeleteToken("a1"); err != nil || !deleted {
+		t.Fatalf("expected deletion, got %v %v", deleted, err)
+	}
+	if deleted, _ := reloaded.DeleteToken("a1"); deleted {
+		t.Fatal("second deletion must report false")
+	}
+	tokens, _ := reloaded.ListTokens()
+	if len(tokens) != 0 {
+		t.Fatalf("expected no tokens, got %+v", tokens)
+	}
+}
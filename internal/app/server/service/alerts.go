@@ -0,0 +1,548 @@
+package service
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+)
+
+// Метки, которые оповещение получает помимо меток ряда и правила.
+const (
+	// AlertNameLabel содержит имя правила.
+	AlertNameLabel = "alertname"
+	// AlertMetricLabel содержит имя ряда, для которого выполнено условие.
+	AlertMetricLabel = "metric"
+)
+
+// AlertRule — правило оповещения: каждый ряд результата Expr (или ненулевой скаляр) —
+// активное оповещение. Оповещение срабатывает, если условие выполняется не меньше For.
+type AlertRule struct {
+	Name string `json:"name"`
+	Expr string `json:"expr"`
+	// For — длительность, например 5m; пусто — оповещение срабатывает сразу.
+	For    string            `json:"for,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// InhibitRule подавляет оповещения, подходящие под TargetMatchers, пока срабатывает
+// оповещение, подходящее под SourceMatchers, с теми же значениями меток Equal.
+// Например, оповещение о недоступности узла подавляет оповещения о его сервисах.
+type InhibitRule struct {
+	SourceMatchers []models.Matcher `json:"source_matchers"`
+	TargetMatchers []models.Matcher `json:"target_matchers"`
+	Equal          []string         `json:"equal,omitempty"`
+}
+
+// AlertingConfig — содержимое файла правил оповещений.
+type AlertingConfig struct {
+	Rules        []AlertRule   `json:"rules"`
+	InhibitRules []InhibitRule `json:"inhibit_rules,omitempty"`
+}
+
+// LoadAlertingConfig читает правила оповещений из JSON-файла {"rules": [...], "inhibit_rules": [...]}.
+func LoadAlertingConfig(path string) (AlertingConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return AlertingConfig{}, fmt.Errorf("read alert rules: %w", err)
+	}
+	var cfg AlertingConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return AlertingConfig{}, fmt.Errorf("parse alert rules %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+type alertRule struct {
+	name   string
+	src    string
+	expr   *Expr
+	hold   time.Duration
+	labels map[string]string
+}
+
+// SilenceRequest — запрос на создание заглушки. Конец задаётся EndsAt или Duration;
+// без StartsAt заглушка действует сразу.
+type SilenceRequest struct {
+	Matchers  []models.Matcher `json:"matchers"`
+	StartsAt  *time.Time       `json:"starts_at,omitempty"`
+	EndsAt    *time.Time       `json:"ends_at,omitempty"`
+	Duration  string           `json:"duration,omitempty"`
+	CreatedBy string           `json:"created_by,omitempty"`
+	Comment   string           `json:"comment,omitempty"`
+}
+
+// AlertView — оповещение в ответе API: SilencedBy — действующие заглушки,
+// InhibitedBy — сработавшие оповещения, которые его подавляют.
+type AlertView struct {
+	models.Alert
+	SilencedBy  []string `json:"silenced_by,omitempty"`
+	InhibitedBy []string `json:"inhibited_by,omitempty"`
+}
+
+// Suppressed сообщает, заглушено или подавлено ли оповещение.
+func (v AlertView) Suppressed() bool {
+	return len(v.SilencedBy) > 0 || len(v.InhibitedBy) > 0
+}
+
+// Alerting вычисляет правила оповещений и хранит активные оповещения и заглушки.
+//
+// Состояние оповещений и заглушки сохраняются в AlertStore: после перезапуска сработавшее
+// оповещение остаётся сработавшим с прежним FiredAt, а у ожидающего продолжается отсчёт For.
+type Alerting struct {
+	ms       *MetricsService
+	rules    []alertRule
+	inhibit  []InhibitRule
+	store    repository.AlertStore
+	interval time.Duration
+	logger   *logrus.Logger
+
+	// evalMu упорядочивает вычисления, чтобы состояние сохранялось в порядке вычисления.
+	evalMu   sync.Mutex
+	mu       sync.Mutex
+	active   map[string]*models.Alert
+	silences []models.Silence
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewAlerting проверяет правила и восстанавливает из store состояние оповещений и заглушки.
+// Оповещения правил, которых больше нет, отбрасываются. Ошибки правил относятся к ErrInvalidAlertRules.
+func NewAlerting(ms *MetricsService, cfg AlertingConfig, store repository.AlertStore, interval time.Duration, logger *logrus.Logger) (*Alerting, error) {
+	rules, err := parseAlertRules(cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+	inhibit, err := parseInhibitRules(cfg.InhibitRules)
+	if err != nil {
+		return nil, err
+	}
+	a := &Alerting{
+		ms:       ms,
+		rules:    rules,
+		inhibit:  inhibit,
+		store:    store,
+		interval: interval,
+		logger:   logger,
+		active:   make(map[string]*models.Alert),
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	known := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		known[r.name] = true
+	}
+	alerts, err := store.ListAlerts()
+	if err != nil {
+		return nil, fmt.Errorf("load alerts: %w", err)
+	}
+	for i := range alerts {
+		if known[alerts[i].Rule] {
+			a.active[alerts[i].Fingerprint()] = &alerts[i]
+		}
+	}
+	silences, err := store.ListSilences()
+	if err != nil {
+		return nil, fmt.Errorf("load silences: %w", err)
+	}
+	for _, s := range silences {
+		if err := s.Compile(); err != nil {
+			logger.Warnf("Alerting: skipping silence %s: %v", s.ID, err)
+			continue
+		}
+		a.silences = append(a.silences, s)
+	}
+	return a, nil
+}
+
+// parseAlertRules проверяет правила: имена заданы и уникальны, выражения разбираются.
+func parseAlertRules(rules []AlertRule) ([]alertRule, error) {
+	parsed := make([]alertRule, len(rules))
+	seen := make(map[string]bool, len(rules))
+	for i, r := range rules {
+		name := strings.TrimSpace(r.Name)
+		switch {
+		case name == "":
+			return nil, ErrInvalidAlertRules.With(fmt.Errorf("rule %d: name is required", i+1))
+		case seen[name]:
+			return nil, ErrInvalidAlertRules.With(fmt.Errorf("rule %q is defined twice", name))
+		}
+		seen[name] = true
+		expr, err := ParseExpr(r.Expr)
+		if err != nil {
+			return nil, ErrInvalidAlertRules.With(fmt.Errorf("rule %q: %w", name, err))
+		}
+		var hold time.Duration
+		if r.For != "" {
+			if hold, err = time.ParseDuration(r.For); err != nil || hold < 0 {
+				return nil, ErrInvalidAlertRules.With(fmt.Errorf("rule %q: invalid for %q", name, r.For))
+			}
+		}
+		for k := range r.Labels {
+			if !models.ValidLabelName(k) || k == AlertNameLabel {
+				return nil, ErrInvalidAlertRules.With(fmt.Errorf("rule %q: invalid label %q", name, k))
+			}
+		}
+		parsed[i] = alertRule{name: name, src: r.Expr, expr: expr, hold: hold, labels: r.Labels}
+	}
+	return parsed, nil
+}
+
+// parseInhibitRules проверяет условия правил подавления.
+func parseInhibitRules(rules []InhibitRule) ([]InhibitRule, error) {
+	parsed := make([]InhibitRule, len(rules))
+	for i, r := range rules {
+		if len(r.SourceMatchers) == 0 || len(r.TargetMatchers) == 0 {
+			return nil, ErrInvalidAlertRules.With(fmt.Errorf("inhibit rule %d: source_matchers and target_matchers are required", i+1))
+		}
+		r.SourceMatchers = append([]models.Matcher(nil), r.SourceMatchers...)
+		r.TargetMatchers = append([]models.Matcher(nil), r.TargetMatchers...)
+		for _, matchers := range [][]models.Matcher{r.SourceMatchers, r.TargetMatchers} {
+			for j := range matchers {
+				if err := matchers[j].Compile(); err != nil {
+					return nil, ErrInvalidAlertRules.With(fmt.Errorf("inhibit rule %d: %w", i+1, err))
+				}
+			}
+		}
+		parsed[i] = r
+	}
+	return parsed, nil
+}
+
+// Len возвращает число правил оповещений.
+func (a *Alerting) Len() int {
+	return len(a.rules)
+}
+
+// Evaluate вычисляет правила в момент now и обновляет оповещения: новое оповещение ожидает
+// (или срабатывает сразу при For = 0), ожидающее срабатывает по истечении For, оповещение,
+// условие которого больше не выполняется, снимается. Оповещения правила, которое не удалось
+// вычислить, остаются прежними; ошибки всех таких правил возвращаются вместе.
+// Истёкшие заглушки удаляются. Хранилище может отвечать долго, поэтому состояние
+// сохраняется уже без a.mu; одновременные вычисления выполняются по очереди.
+func (a *Alerting) Evaluate(now time.Time) error {
+	ctx := a.ms.exprContext()
+	ctx.now = now
+
+	a.evalMu.Lock()
+	defer a.evalMu.Unlock()
+	a.mu.Lock()
+	var errs []error
+	changed := false
+	// Переходы логируются после обновления всех правил: подавление зависит от итогового
+	// набора сработавших оповещений, а не от порядка правил в конфигурации.
+	type transition struct {
+		alert models.Alert
+		kind  string
+	}
+	var transitions []transition
+	for _, r := range a.rules {
+		found, err := r.instances(ctx)
+		if err != nil {
+			errs = append(errs, &RuleError{Rule: r.name, Err: err})
+			continue
+		}
+		for fp, alert := range a.active {
+			if alert.Rule != r.name {
+				continue
+			}
+			if _, ok := found[fp]; !ok {
+				delete(a.active, fp)
+				changed = true
+				if alert.State == models.AlertFiring {
+					transitions = append(transitions, transition{*alert, "resolved"})
+				}
+			}
+		}
+		for fp, inst := range found {
+			alert, ok := a.active[fp]
+			if !ok {
+				alert = &models.Alert{Rule: r.name, Labels: inst.Labels, State: models.AlertPending, ActiveAt: now}
+				a.active[fp] = alert
+				changed = true
+			}
+			alert.Value = inst.Value
+			if alert.State == models.AlertPending && now.Sub(alert.ActiveAt) >= r.hold {
+				alert.State, alert.FiredAt = models.AlertFiring, now
+				changed = true
+				transitions = append(transitions, transition{*alert, "firing"})
+			}
+		}
+	}
+	for _, t := range transitions {
+		a.logTransition(t.alert, t.kind, now)
+	}
+	var snapshot []models.Alert
+	if changed {
+		snapshot = a.alertsLocked()
+	}
+	var expired []string
+	for _, s := range a.silences {
+		if !now.Before(s.EndsAt) {
+			expired = append(expired, s.ID)
+		}
+	}
+	a.mu.Unlock()
+
+	if changed {
+		if err := a.store.SaveAlerts(snapshot); err != nil {
+			errs = append(errs, fmt.Errorf("save alerts: %w", err))
+		}
+	}
+	if err := a.pruneSilences(expired); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// instances вычисляет правило и возвращает найденные оповещения по ключу.
+func (r alertRule) instances(ctx *exprContext) (map[string]models.Alert, error) {
+	res, err := evalQuery(r.expr, r.src, ctx)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]models.Alert)
+	if res.Type == QueryScalar {
+		if *res.Value != 0 {
+			alert := models.Alert{Rule: r.name, Labels: r.alertLabels("", nil), Value: *res.Value}
+			found[alert.Fingerprint()] = alert
+		}
+		return found, nil
+	}
+	for _, s := range res.Result {
+		name, _, _ := models.ParseSeries(s.Metric)
+		alert := models.Alert{Rule: r.name, Labels: r.alertLabels(name, s.Labels), Value: s.Value}
+		fp := alert.Fingerprint()
+		if _, dup := found[fp]; dup {
+			return nil, fmt.Errorf("several series produce the alert %s", fp)
+		}
+		found[fp] = alert
+	}
+	return found, nil
+}
+
+// alertLabels собирает метки оповещения: метки ряда, имя ряда, метки правила и alertname.
+func (r alertRule) alertLabels(metric string, series map[string]string) map[string]string {
+	labels := make(map[string]string, len(series)+len(r.labels)+2)
+	for k, v := range series {
+		labels[k] = v
+	}
+	if metric != "" {
+		labels[AlertMetricLabel] = metric
+	}
+	for k, v := range r.labels {
+		labels[k] = v
+	}
+	labels[AlertNameLabel] = r.name
+	return labels
+}
+
+// logTransition записывает в лог срабатывание или снятие оповещения, если оно
+// не заглушено и не подавлено. Вызывается под a.mu.
+func (a *Alerting) logTransition(alert models.Alert, transition string, now time.Time) {
+	if a.viewLocked(alert, now).Suppressed() {
+		return
+	}
+	a.logger.Warnf("Alert %s %s: value %g", alert.Fingerprint(), transition, alert.Value)
+}
+
+// alertsLocked возвращает копию активных оповещений, упорядоченную по ключу. Вызывается под a.mu.
+func (a *Alerting) alertsLocked() []models.Alert {
+	alerts := make([]models.Alert, 0, len(a.active))
+	for _, alert := range a.active {
+		alerts = append(alerts, *alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Fingerprint() < alerts[j].Fingerprint() })
+	return alerts
+}
+
+// viewLocked определяет заглушки и подавляющие оповещения для alert. Вызывается под a.mu.
+func (a *Alerting) viewLocked(alert models.Alert, now time.Time) AlertView {
+	v := AlertView{Alert: alert}
+	for _, s := range a.silences {
+		if s.Active(now) && models.MatchAll(s.Matchers, alert.Labels) {
+			v.SilencedBy = append(v.SilencedBy, s.ID)
+		}
+	}
+	fp := alert.Fingerprint()
+	for _, r := range a.inhibit {
+		if !models.MatchAll(r.TargetMatchers, alert.Labels) {
+			continue
+		}
+		for sfp, source := range a.active {
+			if sfp == fp || source.State != models.AlertFiring || !models.MatchAll(r.SourceMatchers, source.Labels) {
+				continue
+			}
+			if equalLabels(r.Equal, source.Labels, alert.Labels) {
+				v.InhibitedBy = append(v.InhibitedBy, sfp)
+			}
+		}
+	}
+	sort.Strings(v.InhibitedBy)
+	v.InhibitedBy = slices.Compact(v.InhibitedBy)
+	return v
+}
+
+// equalLabels сообщает, совпадают ли у a и b значения меток names.
+func equalLabels(names []string, a, b map[string]string) bool {
+	for _, name := range names {
+		if a[name] != b[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// Alerts возвращает активные оповещения, упорядоченные по ключу.
+func (a *Alerting) Alerts() []AlertView {
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	alerts := a.alertsLocked()
+	views := make([]AlertView, len(alerts))
+	for i, alert := range alerts {
+		views[i] = a.viewLocked(alert, now)
+	}
+	return views
+}
+
+// Silences возвращает заглушки в порядке создания.
+func (a *Alerting) Silences() []models.Silence {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]models.Silence{}, a.silences...)
+}
+
+// CreateSilence создаёт заглушку. Ошибки запроса относятся к ErrInvalidSilence.
+func (a *Alerting) CreateSilence(req SilenceRequest) (models.Silence, error) {
+	now := time.Now().UTC()
+	s := models.Silence{
+		Matchers:  append([]models.Matcher(nil), req.Matchers...),
+		StartsAt:  now,
+		CreatedBy: strings.TrimSpace(req.CreatedBy),
+		Comment:   strings.TrimSpace(req.Comment),
+		CreatedAt: now,
+	}
+	if len(s.Matchers) == 0 {
+		return models.Silence{}, ErrInvalidSilence.With(errors.New("at least one matcher is required"))
+	}
+	if err := s.Compile(); err != nil {
+		return models.Silence{}, ErrInvalidSilence.With(err)
+	}
+	if req.StartsAt != nil {
+		s.StartsAt = req.StartsAt.UTC()
+	}
+	switch {
+	case req.EndsAt != nil && req.Duration != "":
+		return models.Silence{}, ErrInvalidSilence.With(errors.New("ends_at and duration are mutually exclusive"))
+	case req.EndsAt != nil:
+		s.EndsAt = req.EndsAt.UTC()
+	case req.Duration != "":
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			return models.Silence{}, ErrInvalidSilence.With(fmt.Errorf("invalid duration %q", req.Duration))
+		}
+		s.EndsAt = s.StartsAt.Add(d)
+	default:
+		return models.Silence{}, ErrInvalidSilence.With(errors.New("ends_at or duration is required"))
+	}
+	if !s.EndsAt.After(s.StartsAt) || !s.EndsAt.After(now) {
+		return models.Silence{}, ErrInvalidSilence.With(errors.New("silence must end in the future and after it starts"))
+	}
+
+	id, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return models.Silence{}, err
+	}
+	s.ID = id
+	// Хранилище может отвечать долго, поэтому a.mu берётся только для обновления списка.
+	if err := a.store.CreateSilence(s); err != nil {
+		return models.Silence{}, ErrStorage.With(err)
+	}
+	a.mu.Lock()
+	a.silences = append(a.silences, s)
+	a.mu.Unlock()
+	return s, nil
+}
+
+// DeleteSilence удаляет заглушку; неизвестный id — ErrSilenceNotFound.
+func (a *Alerting) DeleteSilence(id string) error {
+	deleted, err := a.store.DeleteSilence(id)
+	if err != nil {
+		return ErrStorage.With(err)
+	}
+	if !deleted {
+		return ErrSilenceNotFound.With(fmt.Errorf("silence %q not found", id))
+	}
+	a.mu.Lock()
+	a.silences = slices.DeleteFunc(a.silences, func(s models.Silence) bool { return s.ID == id })
+	a.mu.Unlock()
+	return nil
+}
+
+// pruneSilences удаляет истёкшие заглушки ids из хранилища, а затем из памяти.
+// Заглушка, которую не удалось удалить из хранилища, остаётся до следующего вычисления.
+func (a *Alerting) pruneSilences(ids []string) error {
+	var errs []error
+	removed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if _, err := a.store.DeleteSilence(id); err != nil {
+			errs = append(errs, fmt.Errorf("delete expired silence %s: %w", id, err))
+			continue
+		}
+		removed[id] = true
+	}
+	if len(removed) > 0 {
+		a.mu.Lock()
+		a.silences = slices.DeleteFunc(a.silences, func(s models.Silence) bool { return removed[s.ID] })
+		a.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// Start запускает периодическое вычисление правил в отдельной горутине.
+func (a *Alerting) Start() {
+	go func() {
+		defer close(a.done)
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.RunOnce()
+			case <-a.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// RunOnce вычисляет правила один раз и логирует ошибки.
+func (a *Alerting) RunOnce() {
+	if err := a.Evaluate(time.Now()); err != nil {
+		a.logger.Warnf("Alert rules: %v", err)
+	}
+}
+
+// Stop останавливает вычисление и дожидается завершения текущего прохода.
+// Вызывается только после Start.
+func (a *Alerting) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.stopChan)
+	})
+	<-a.done
+}
@@ -0,0 +1,413 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+)
+
+func newAlertingService(t *testing.T, gauges map[string]string) *MetricsService {
+	t.Helper()
+	ms := &MetricsService{Storage: repository.NewMemStorage()}
+	for name, v := range gauges {
+		if err := ms.UpdateMetric(GaugeMetric, name, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ms
+}
+
+func TestNewAlerting_Validation(t *testing.T) {
+	cases := map[string]AlertingConfig{
+		"name is required": {Rules: []AlertRule{{Expr: "1"}}},
+		"defined twice":    {Rules: []AlertRule{{Name: "a", Expr: "1"}, {Name: "a", Expr: "2"}}},
+		"unexpected end":   {Rules: []AlertRule{{Name: "a", Expr: "1 +"}}},
+		"invalid for":      {Rules: []AlertRule{{Name: "a", Expr: "1", For: "soon"}}},
+		"invalid label":    {Rules: []AlertRule{{Name: "a", Expr: "1", Labels: map[string]string{"alertname": "b"}}}},
+		"are required":     {InhibitRules: []InhibitRule{{SourceMatchers: []models.Matcher{{Label: "a", Value: "b"}}}}},
+		"unknown operator": {InhibitRules: []InhibitRule{{
+			SourceMatchers: []models.Matcher{{Label: "a", Op: "~", Value: "b"}},
+			TargetMatchers: []models.Matcher{{Label: "a", Value: "b"}},
+		}}},
+	}
+	for want, cfg := range cases {
+		_, err := NewAlerting(&MetricsService{}, cfg, repository.NewMemAlertStore(), time.Second, logrus.New())
+		if !errors.Is(err, ErrInvalidAlertRules) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: unexpected error %v", want, err)
+		}
+	}
+}
+
+func TestAlerting_Lifecycle(t *testing.T) {
+	ms := newAlertingService(t, map[string]string{`up{host="a"}`: "0", `up{host="b"}`: "1"})
+	cfg := AlertingConfig{Rules: []AlertRule{
+		{Name: "HostDown", Expr: "up == 0", For: "1m", Labels: map[string]string{"severity": "critical"}},
+		{Name: "Broken", Expr: "1 / 0"},
+	}}
+	store := repository.NewMemAlertStore()
+	a, err := NewAlerting(ms, cfg, store, time.Second, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var ruleErr *RuleError
+	if err := a.Evaluate(t0); !errors.As(err, &ruleErr) || ruleErr.Rule != "Broken" {
+		t.Fatalf("expected an error of the broken rule, got %v", err)
+	}
+	alerts := a.Alerts()
+	if len(alerts) != 1 || alerts[0].State != models.AlertPending {
+		t.Fatalf("expected one pending alert, got %+v", alerts)
+	}
+	want := map[string]string{"alertname": "HostDown", "metric": "up", "host": "a", "severity": "critical"}
+	if got := alerts[0].Labels; len(got) != len(want) || got["host"] != "a" || got["metric"] != "up" ||
+		got["alertname"] != "HostDown" || got["severity"] != "critical" {
+		t.Fatalf("expected labels %v, got %v", want, got)
+	}
+
+	_ = a.Evaluate(t0.Add(time.Minute))
+	alerts = a.Alerts()
+	if len(alerts) != 1 || alerts[0].State != models.AlertFiring || !alerts[0].FiredAt.Equal(t0.Add(time.Minute)) {
+		t.Fatalf("expected the alert to fire after 1m, got %+v", alerts)
+	}
+	if saved, _ := store.ListAlerts(); len(saved) != 1 || saved[0].State != models.AlertFiring {
+		t.Fatalf("expected the firing alert to be saved, got %+v", saved)
+	}
+
+	if err := ms.UpdateMetric(GaugeMetric, `up{host="a"}`, "1"); err != nil {
+		t.Fatal(err)
+	}
+	_ = a.Evaluate(t0.Add(2 * time.Minute))
+	if alerts = a.Alerts(); len(alerts) != 0 {
+		t.Fatalf("expected the alert to resolve, got %+v", alerts)
+	}
+	if saved, _ := store.ListAlerts(); len(saved) != 0 {
+		t.Fatalf("expected the resolved alert to be removed from the store, got %+v", saved)
+	}
+}
+
+func TestAlerting_RestartKeepsState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	ms := newAlertingService(t, map[string]string{`up{host="a"}`: "0"})
+	cfg := AlertingConfig{Rules: []AlertRule{{Name: "HostDown", Expr: "up == 0"}}}
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var logs bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&logs)
+
+	store, err := repository.NewFileAlertStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := NewAlerting(ms, cfg, store, time.Second, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := before.Evaluate(t0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := before.CreateSilence(SilenceRequest{Matchers: []models.Matcher{{Label: "host", Value: "b"}}, Duration: "1h"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "firing") {
+		t.Fatalf("expected the alert to be logged as firing, got %q", logs.String())
+	}
+
+	logs.Reset()
+	store, err = repository.NewFileAlertStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := NewAlerting(ms, cfg, store, time.Second, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := after.Evaluate(t0.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	alerts := after.Alerts()
+	if len(alerts) != 1 || alerts[0].State != models.AlertFiring || !alerts[0].FiredAt.Equal(t0) {
+		t.Fatalf("expected the alert to stay firing since before the restart, got %+v", alerts)
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("the alert must not fire again after the restart, got %q", logs.String())
+	}
+	if silences := after.Silences(); len(silences) != 1 || silences[0].Matchers[0].Op != "=" {
+		t.Fatalf("expected the silence to survive the restart, got %+v", silences)
+	}
+
+	// Правило удалено из конфигурации — его оповещения не восстанавливаются.
+	store, _ = repository.NewFileAlertStore(path)
+	other, err := NewAlerting(ms, AlertingConfig{}, store, time.Second, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alerts := other.Alerts(); len(alerts) != 0 {
+		t.Fatalf("expected alerts of removed rules to be dropped, got %+v", alerts)
+	}
+}
+
+func TestAlerting_SilencesAndInhibition(t *testing.T) {
+	ms := newAlertingService(t, map[string]string{
+		`up{host="a"}`:                       "0",
+		`service_up{host="a",service="db"}`:  "0",
+		`service_up{host="b",service="web"}`: "0",
+	})
+	cfg := AlertingConfig{
+		Rules: []AlertRule{
+			{Name: "HostDown", Expr: "up == 0", Labels: map[string]string{"severity": "critical"}},
+			{Name: "ServiceDown", Expr: "service_up == 0", Labels: map[string]string{"severity": "warning"}},
+		},
+		InhibitRules: []InhibitRule{{
+			SourceMatchers: []models.Matcher{{Label: "alertname", Value: "HostDown"}},
+			TargetMatchers: []models.Matcher{{Label: "severity", Op: "=~", Value: "warning|info"}},
+			Equal:          []string{"host"},
+		}},
+	}
+	var logs bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&logs)
+	a, err := NewAlerting(ms, cfg, repository.NewMemAlertStore(), time.Second, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := a.Evaluate(now); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(logs.String(), `service="db"`) {
+		t.Fatalf("inhibited alerts must not be logged, got %q", logs.String())
+	}
+
+	byHost := func() map[string]AlertView {
+		views := make(map[string]AlertView)
+		for _, v := range a.Alerts() {
+			if v.Rule == "ServiceDown" {
+				views[v.Labels["host"]] = v
+			}
+		}
+		return views
+	}
+	views := byHost()
+	if got := views["a"].InhibitedBy; len(got) != 1 || !strings.HasPrefix(got[0], "HostDown{") {
+		t.Fatalf("expected the host a service alert to be inhibited by HostDown, got %+v", views["a"])
+	}
+	if views["b"].Suppressed() {
+		t.Fatalf("host b has no HostDown alert, got %+v", views["b"])
+	}
+
+	silence, err := a.CreateSilence(SilenceRequest{
+		Matchers: []models.Matcher{{Label: "host", Value: "b"}, {Label: "service", Op: "!=", Value: "db"}},
+		Duration: "1h",
+		Comment:  "maintenance",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := byHost()["b"].SilencedBy; len(got) != 1 || got[0] != silence.ID {
+		t.Fatalf("expected the host b alert to be silenced by %s, got %v", silence.ID, got)
+	}
+
+	if err := a.DeleteSilence(silence.ID); err != nil {
+		t.Fatal(err)
+	}
+	if byHost()["b"].Suppressed() {
+		t.Fatal("expected the alert to be active after the silence is deleted")
+	}
+	if err := a.DeleteSilence(silence.ID); !errors.Is(err, ErrSilenceNotFound) {
+		t.Fatalf("expected ErrSilenceNotFound, got %v", err)
+	}
+
+	// Истёкшие заглушки удаляются при вычислении правил.
+	if _, err := a.CreateSilence(SilenceRequest{Matchers: []models.Matcher{{Label: "host", Value: "b"}}, Duration: "1m"}); err != nil {
+		t.Fatal(err)
+	}
+	_ = a.Evaluate(now.Add(time.Hour))
+	if silences := a.Silences(); len(silences) != 0 {
+		t.Fatalf("expected the expired silence to be pruned, got %+v", silences)
+	}
+}
+
+func TestAlerting_InhibitionIgnoresRuleOrder(t *testing.T) {
+	ms := newAlertingService(t, map[string]string{
+		`up{host="a"}`:                      "0",
+		`service_up{host="a",service="db"}`: "0",
+	})
+	// Подавляемое правило идёт раньше подавляющего.
+	cfg := AlertingConfig{
+		Rules: []AlertRule{
+			{Name: "ServiceDown", Expr: "service_up == 0", Labels: map[string]string{"severity": "warning"}},
+			{Name: "HostDown", Expr: "up == 0", Labels: map[string]string{"severity": "critical"}},
+		},
+		InhibitRules: []InhibitRule{{
+			SourceMatchers: []models.Matcher{{Label: "alertname", Value: "HostDown"}},
+			TargetMatchers: []models.Matcher{{Label: "severity", Value: "warning"}},
+			Equal:          []string{"host"},
+		}},
+	}
+	var logs bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&logs)
+	a, err := NewAlerting(ms, cfg, repository.NewMemAlertStore(), time.Second, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := a.Evaluate(now); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "HostDown{") || strings.Contains(logs.String(), "ServiceDown{") {
+		t.Fatalf("expected only HostDown to be logged as firing, got %q", logs.String())
+	}
+
+}
+
+func TestAlerting_CreateSilenceValidation(t *testing.T) {
+	a, err := NewAlerting(&MetricsService{}, AlertingConfig{}, repository.NewMemAlertStore(), time.Second, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := []models.Matcher{{Label: "host", Value: "a"}}
+	past := time.Now().Add(-time.Hour)
+	cases := map[string]SilenceRequest{
+		"at least one matcher":   {Duration: "1h"},
+		"invalid regex":          {Matchers: []models.Matcher{{Label: "host", Op: "=~", Value: "("}}, Duration: "1h"},
+		"ends_at or duration":    {Matchers: host},
+		"mutually exclusive":     {Matchers: host, Duration: "1h", EndsAt: &past},
+		"invalid duration":       {Matchers: host, Duration: "-1h"},
+		"must end in the future": {Matchers: host, EndsAt: &past},
+	}
+	for want, req := range cases {
+		_, err := a.CreateSilence(req)
+		if !errors.Is(err, ErrInvalidSilence) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: unexpected error %v", want, err)
+		}
+	}
+}
+
+// slowSilenceStore задерживает запись заглушки, пока не закрыт release.
+type slowSilenceStore struct {
+	repository.AlertStore
+	entered, release chan struct{}
+}
+
+func (s slowSilenceStore) CreateSilence(silence models.Silence) error {
+	close(s.entered)
+	<-s.release
+	return s.AlertStore.CreateSilence(silence)
+}
+
+func TestAlerting_SilenceStoreOutsideLock(t *testing.T) {
+	store := slowSilenceStore{repository.NewMemAlertStore(), make(chan struct{}), make(chan struct{})}
+	a, err := NewAlerting(&MetricsService{}, AlertingConfig{}, store, time.Second, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := make(chan error)
+	go func() {
+		_, err := a.CreateSilence(SilenceRequest{Matchers: []models.Matcher{{Label: "host", Value: "a"}}, Duration: "1h"})
+		created <- err
+	}()
+	<-store.entered
+
+	// Пока хранилище записывает заглушку, список оповещений и заглушек доступен.
+	listed := make(chan int)
+	go func() { listed <- len(a.Silences()) + len(a.Alerts()) }()
+	select {
+	case n := <-listed:
+		if n != 0 {
+			t.Fatalf("the silence must appear only after it is stored, got %d items", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("listing must not wait for the store")
+	}
+
+	close(store.release)
+	if err := <-created; err != nil {
+		t.Fatal(err)
+	}
+	if silences := a.Silences(); len(silences) != 1 {
+		t.Fatalf("expected the stored silence, got %+v", silences)
+	}
+}
+
+func TestAlerting_PendingResolveIsNotLogged(t *testing.T) {
+	ms := newAlertingService(t, map[string]string{`up{host="a"}`: "0"})
+	cfg := AlertingConfig{Rules: []AlertRule{{Name: "HostDown", Expr: "up == 0", For: "5m"}}}
+	var logs bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&logs)
+	a, err := NewAlerting(ms, cfg, repository.NewMemAlertStore(), time.Second, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := a.Evaluate(now); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.UpdateMetric(GaugeMetric, `up{host="a"}`, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Evaluate(now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if alerts := a.Alerts(); len(alerts) != 0 {
+		t.Fatalf("expected the pending alert to be dropped, got %+v", alerts)
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("an alert that never fired must not be logged as resolved, got %q", logs.String())
+	}
+}
+
+// slowSaveStore задерживает сохранение оповещений, пока не закрыт release.
+type slowSaveStore struct {
+	repository.AlertStore
+	entered, release chan struct{}
+}
+
+func (s slowSaveStore) SaveAlerts(alerts []models.Alert) error {
+	close(s.entered)
+	<-s.release
+	return s.AlertStore.SaveAlerts(alerts)
+}
+
+func TestAlerting_EvaluateSavesOutsideLock(t *testing.T) {
+	ms := newAlertingService(t, map[string]string{`up{host="a"}`: "0"})
+	store := slowSaveStore{repository.NewMemAlertStore(), make(chan struct{}), make(chan struct{})}
+	a, err := NewAlerting(ms, AlertingConfig{Rules: []AlertRule{{Name: "HostDown", Expr: "up == 0"}}}, store, time.Second, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	evaluated := make(chan error)
+	go func() { evaluated <- a.Evaluate(time.Now()) }()
+	<-store.entered
+
+	// Пока хранилище сохраняет состояние, оповещения уже видны.
+	listed := make(chan int)
+	go func() { listed <- len(a.Alerts()) }()
+	select {
+	case n := <-listed:
+		if n != 1 {
+			t.Fatalf("expected the firing alert, got %d alerts", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("listing must not wait for the store")
+	}
+
+	close(store.release)
+	if err := <-evaluated; err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := store.ListAlerts(); len(saved) != 1 {
+		t.Fatalf("expected the alert to be saved, got %+v", saved)
+	}
+}
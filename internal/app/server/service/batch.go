@@ -0,0 +1,190 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
+
+// BatchMode задаёт, как пакет обновлений обрабатывает ошибочные элементы.
+type BatchMode string
+
+const (
+	// BatchAtomic — пакет применяется целиком или не применяется вовсе.
+	BatchAtomic BatchMode = "atomic"
+	// BatchPartial — применяются все корректные элементы, ошибки сообщаются для каждого элемента.
+	BatchPartial BatchMode = "partial"
+)
+
+// ParseBatchMode разбирает режим пакета из параметра запроса.
+func ParseBatchMode(s string) (BatchMode, error) {
+	switch m := BatchMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case BatchAtomic, BatchPartial:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown batch mode %q", s)
+	}
+}
+
+// Статусы элемента пакета.
+const (
+	ItemApplied    = "applied"     // элемент применён
+	ItemFailed     = "failed"      // элемент отклонён из-за собственной ошибки
+	ItemNotApplied = "not_applied" // элемент корректен, но атомарный пакет не применён
+	ItemDropped    = "dropped"     // элемент отброшен правилами переразметки или выборкой новых рядов
+)
+
+// BatchError — код каталога ошибок и описание ошибки элемента или пакета.
+type BatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// BatchItemResult — результат обработки одного элемента пакета.
+// Для применённых элементов Metric содержит сохранённое значение после обновления.
+type BatchItemResult struct {
+	Index  int                     `json:"index"`
+	ID     string                  `json:"id"`
+	MType  string                  `json:"type"`
+	Status string                  `json:"status"`
+	Error  *BatchError             `json:"error,omitempty"`
+	Metric *middleware.MetricsJSON `json:"metric,omitempty"`
+}
+
+// BatchResult — итог обработки пакета. Error заполняется, когда атомарный пакет отклонён
+// ошибкой, которую нельзя отнести к одному элементу.
+type BatchResult struct {
+	Mode    BatchMode         `json:"mode"`
+	Applied int               `json:"applied"`
+	Failed  int               `json:"failed"`
+	Dropped int               `json:"dropped,omitempty"`
+	Error   *BatchError       `json:"error,omitempty"`
+	Results []BatchItemResult `json:"results"`
+}
+
+// CheckBatchSize проверяет число элементов пакета по ограничению MaxBatchSize.
+func (ms *MetricsService) CheckBatchSize(n int) error {
+	if ms.MaxBatchSize > 0 && n > ms.MaxBatchSize {
+		return ErrBatchTooLarge.With(fmt.Errorf("batch has %d items, at most %d are allowed", n, ms.MaxBatchSize))
+	}
+	return nil
+}
+
+// newBatchError переводит ошибку сервиса или хранилища в код ошибки каталога.
+func newBatchError(err error) *BatchError {
+	return &BatchError{Code: Classify(err).Code, Message: err.Error()}
+}
+
+// prepareItem проверяет элемент пакета без обращения к хранилищу и приводит составные
+// значения к агрегированному виду. Одинаково для всех хранилищ: хранилище получает
+// только корректные элементы.
+func (ms *MetricsService) prepareItem(m *middleware.MetricsJSON) error {
+	if m.ID == "" {
+		return ErrNameRequired
+	}
+	mt := strings.ToLower(string(m.MType))
+	switch {
+	case mt == CounterMetric:
+		if m.Delta == nil {
+			return fmt.Errorf("metric %q: %w: delta", m.ID, ErrValueRequired)
+		}
+	case mt == GaugeMetric:
+		if m.Value == nil {
+			return fmt.Errorf("metric %q: %w: value", m.ID, ErrValueRequired)
+		}
+	case models.IsComposite(mt):
+		if err := ms.normalizeComposite(m, mt); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("metric %q: %w %q", m.ID, ErrUnsupportedType, m.MType)
+	}
+	return nil
+}
+
+// ApplyBatch применяет пакет в выбранном режиме и возвращает результат для каждого элемента.
+//
+// В режиме atomic любой ошибочный элемент отклоняет весь пакет. В режиме partial
+// корректные элементы применяются одним пакетом; если хранилище отклоняет его
+// (конфликт типов, несовместимое составное значение), элементы применяются по одному
+// в исходном порядке, и ошибка сообщается только для отклонённых.
+func (ms *MetricsService) ApplyBatch(batch []middleware.MetricsJSON, mode BatchMode) BatchResult {
+	res := BatchResult{Mode: mode, Results: make([]BatchItemResult, len(batch))}
+	valid := make([]middleware.MetricsJSON, 0, len(batch))
+	validIdx := make([]int, 0, len(batch))
+	releases := make([]func(), 0, len(batch))
+	for i, m := range batch {
+		res.Results[i] = BatchItemResult{Index: i, ID: m.ID, MType: string(m.MType)}
+		err := ms.prepareItem(&m)
+		if err == nil {
+			var ok bool
+			var release func()
+			if m.ID, ok, release, err = ms.ingest(string(m.MType), m.ID); ok {
+				valid = append(valid, m)
+				validIdx = append(validIdx, i)
+				releases = append(releases, release)
+				continue
+			}
+		}
+		if err == nil {
+			res.Results[i].Status = ItemDropped
+			res.Dropped++
+			continue
+		}
+		res.Results[i].Status = ItemFailed
+		res.Results[i].Error = newBatchError(err)
+		res.Failed++
+	}
+
+	if mode == BatchAtomic && res.Failed > 0 {
+		releaseAll(releases)
+		res.markNotApplied(validIdx)
+		return res
+	}
+	if len(valid) == 0 {
+		return res
+	}
+
+	err := ms.Storage.UpdateMetricsBatch(valid)
+	switch {
+	case err == nil:
+		for j, i := range validIdx {
+			res.applied(i, ms, valid[j])
+		}
+	case mode == BatchAtomic:
+		releaseAll(releases)
+		res.Error = newBatchError(err)
+		res.markNotApplied(validIdx)
+	default:
+		for j, i := range validIdx {
+			if err := ms.Storage.UpdateMetricsBatch(valid[j : j+1]); err != nil {
+				releases[j]()
+				res.Results[i].Status = ItemFailed
+				res.Results[i].Error = newBatchError(err)
+				res.Failed++
+				continue
+			}
+			res.applied(i, ms, valid[j])
+		}
+	}
+	return res
+}
+
+// applied отмечает элемент i применённым и записывает его текущее значение.
+func (r *BatchResult) applied(i int, ms *MetricsService, m middleware.MetricsJSON) {
+	r.Results[i].Status = ItemApplied
+	r.Applied++
+	if current, ok := ms.currentValue(m); ok {
+		r.Results[i].Metric = &current
+		ms.publish(EventUpdate, current)
+	}
+}
+
+// markNotApplied отмечает корректные элементы отклонённого атомарного пакета.
+func (r *BatchResult) markNotApplied(idx []int) {
+	for _, i := range idx {
+		r.Results[i].Status = ItemNotApplied
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+)
+
+func gaugeItem(name string, v float64) middleware.MetricsJSON {
+	return middleware.MetricsJSON{ID: name, MType: middleware.GaugeMetric, Value: &v}
+}
+
+func counterItem(name string, d int64) middleware.MetricsJSON {
+	return middleware.MetricsJSON{ID: name, MType: middleware.CounterMetric, Delta: &d}
+}
+
+// mixedBatch содержит корректные элементы и по одному элементу на каждый код ошибки.
+func mixedBatch() []middleware.MetricsJSON {
+	return []middleware.MetricsJSON{
+		counterItem("C", 2),                        // 0
+		{ID: "C", MType: middleware.CounterMetric}, // 1: нет delta
+		{ID: "T", MType: "timer"},                  // 2: неизвестный тип
+		gaugeItem("", 1),                           // 3: нет имени
+		gaugeItem("C", 1),                          // 4: конфликт типов (reject)
+		counterItem("C", 3),                        // 5
+		{ID: "S", MType: middleware.SummaryMetric, Value: new(float64)}, // 6
+	}
+}
+
+func statuses(res BatchResult) []string {
+	out := make([]string, len(res.Results))
+	for i, r := range res.Results {
+		out[i] = r.Status
+		if r.Error != nil {
+			out[i] += ":" + r.Error.Code
+		}
+	}
+	return out
+}
+
+func assertStatuses(t *testing.T, res BatchResult, want []string) {
+	t.Helper()
+	got := statuses(res)
+	if len(got) != len(want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("item %d: want %s, got %s (all: %v)", i, want[i], got[i], got)
+		}
+	}
+}
+
+func TestApplyBatchPartial(t *testing.T) {
+	storage := repository.NewMemStorage()
+	storage.SetConflictPolicy(repository.ConflictReject)
+	ms := &MetricsService{Storage: storage}
+
+	res := ms.ApplyBatch(mixedBatch(), BatchPartial)
+	assertStatuses(t, res, []string{
+		ItemApplied,
+		ItemFailed + ":" + CodeValueRequired,
+		ItemFailed + ":" + CodeUnsupportedType,
+		ItemFailed + ":" + CodeNameRequired,
+		ItemFailed + ":" + CodeTypeConflict,
+		ItemApplied,
+		ItemApplied,
+	})
+	if res.Applied != 3 || res.Failed != 4 {
+		t.Fatalf("unexpected totals: %+v", res)
+	}
+	if v, _ := ms.GetMetricValue(CounterMetric, "C"); v != "5" {
+		t.Fatalf("counter must accumulate applied items, got %s", v)
+	}
+	if m := res.Results[5].Metric; m == nil || *m.Delta != 5 {
+		t.Fatalf("applied value must be reported: %+v", res.Results[5])
+	}
+	if _, err := ms.GetComposite(SummaryMetric, "S"); err != nil {
+		t.Fatalf("summary not applied: %v", err)
+	}
+}
+
+func TestApplyBatchAtomic(t *testing.T) {
+	storage := repository.NewMemStorage()
+	storage.SetConflictPolicy(repository.ConflictReject)
+	ms := &MetricsService{Storage: storage}
+
+	res := ms.ApplyBatch(mixedBatch(), BatchAtomic)
+	if res.Applied != 0 || res.Failed != 3 {
+		t.Fatalf("unexpected totals: %+v", statuses(res))
+	}
+	if res.Results[0].Status != ItemNotApplied {
+		t.Fatalf("valid items of a rejected batch must not be applied: %v", statuses(res))
+	}
+	if len(ms.ListMetrics()) != 0 {
+		t.Fatalf("rejected atomic batch must not change storage")
+	}
+
+	// Ошибка хранилища (конфликт внутри пакета) отклоняет весь пакет.
+	res = ms.ApplyBatch([]middleware.MetricsJSON{counterItem("X", 1), gaugeItem("X", 1)}, BatchAtomic)
+	if res.Error == nil || res.Error.Code != CodeTypeConflict || res.Applied != 0 {
+		t.Fatalf("expected batch-level type conflict: %+v", res)
+	}
+	if len(ms.ListMetrics()) != 0 {
+		t.Fatalf("rejected atomic batch must not change storage")
+	}
+
+	res = ms.ApplyBatch([]middleware.MetricsJSON{counterItem("X", 1), gaugeItem("Y", 2)}, BatchAtomic)
+	assertStatuses(t, res, []string{ItemApplied, ItemApplied})
+
+	// Несовместимая гистограмма сообщается кодом composite_mismatch.
+	h := models.NewHistogram([]float64{1})
+	h.Observe(0.5)
+	_ = ms.UpdateComposite("H", h)
+	res = ms.ApplyBatch([]middleware.MetricsJSON{{
+		ID: "H", MType: middleware.HistogramMetric,
+		CompositeFields: models.CompositeFields{Histogram: models.NewHistogram([]float64{2})},
+	}}, BatchPartial)
+	assertStatuses(t, res, []string{ItemFailed + ":" + CodeCompositeMismatch})
+}
+
+func TestUpdateMetricsBatch_MaxBatchSize(t *testing.T) {
+	ms := &MetricsService{Storage: repository.NewMemStorage(), MaxBatchSize: 2}
+	if err := ms.CheckBatchSize(2); err != nil {
+		t.Fatalf("a batch at the limit must pass: %v", err)
+	}
+	_, err := ms.UpdateMetricsBatch([]middleware.MetricsJSON{gaugeItem("A", 1), gaugeItem("B", 2), gaugeItem("C", 3)})
+	if Classify(err) != ErrBatchTooLarge {
+		t.Fatalf("expected ErrBatchTooLarge, got %v", err)
+	}
+	if _, ok := ms.Storage.GetGaugeRaw("A"); ok {
+		t.Fatal("an oversized batch must not be applied")
+	}
+}
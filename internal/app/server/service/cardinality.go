@@ -0,0 +1,390 @@
+package service
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+)
+
+// Действия при превышении лимита числа рядов.
+const (
+	// CardinalityReject — запись нового ряда отклоняется ошибкой ErrCardinalityLimit.
+	CardinalityReject = "reject"
+	// CardinalitySample — сохраняется только детерминированная доля новых рядов
+	// (по хэшу имени), остальные молча отбрасываются.
+	CardinalitySample = "sample"
+)
+
+// SeriesLimit ограничивает число рядов, имя которых соответствует шаблону (синтаксис path.Match).
+type SeriesLimit struct {
+	Pattern string `json:"pattern"`
+	Max     int    `json:"max"`
+}
+
+// CardinalityLimits — ограничения числа рядов (пара тип и имя метрики).
+// Нулевые значения означают отсутствие соответствующего ограничения.
+type CardinalityLimits struct {
+	// MaxSeries — всего рядов на сервере.
+	MaxSeries int `json:"max_series,omitempty"`
+	// MaxSeriesPerClient — рядов, созданных одним клиентом.
+	MaxSeriesPerClient int `json:"max_series_per_client,omitempty"`
+	// Patterns — ограничения по шаблонам имён; действуют все подходящие.
+	Patterns []SeriesLimit `json:"patterns,omitempty"`
+	// Action — CardinalityReject (по умолчанию) или CardinalitySample.
+	Action string `json:"action"`
+	// SampleRate — доля новых рядов сверх лимита, которые сохраняются в режиме sample.
+	SampleRate float64 `json:"sample_rate,omitempty"`
+}
+
+// Enabled сообщает, задано ли хоть одно ограничение.
+func (l CardinalityLimits) Enabled() bool {
+	return l.MaxSeries > 0 || l.MaxSeriesPerClient > 0 || len(l.Patterns) > 0
+}
+
+// ParseSeriesLimits разбирает ограничения вида "app.*=1000,tmp.*=50".
+func ParseSeriesLimits(spec string) ([]SeriesLimit, error) {
+	var limits []SeriesLimit
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pattern, rawMax, ok := strings.Cut(part, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid series limit %q: expected pattern=max", part)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid series limit pattern %q: %w", pattern, err)
+		}
+		max, err := strconv.Atoi(strings.TrimSpace(rawMax))
+		if err != nil || max < 0 {
+			return nil, fmt.Errorf("invalid series limit in %q", part)
+		}
+		limits = append(limits, SeriesLimit{Pattern: pattern, Max: max})
+	}
+	return limits, nil
+}
+
+type seriesKey struct {
+	mtype, name string
+}
+
+type clientUsage struct {
+	series, rejected, dropped int
+}
+
+// CardinalityGuard учитывает ряды и их создателей и решает, можно ли создать новый ряд.
+// Ряды, которые уже были в хранилище при первом обращении (или после восстановления
+// снимка), считаются в общем лимите и лимитах шаблонов, но не принадлежат ни одному клиенту.
+type CardinalityGuard struct {
+	limits CardinalityLimits
+
+	mu       sync.Mutex
+	loaded   bool
+	series   map[seriesKey]string // ряд → клиент, создавший его
+	clients  map[string]*clientUsage
+	patterns []int // число рядов по каждому шаблону limits.Patterns
+}
+
+// NewCardinalityGuard проверяет ограничения и создаёт учёт рядов.
+func NewCardinalityGuard(limits CardinalityLimits) (*CardinalityGuard, error) {
+	switch limits.Action = strings.ToLower(strings.TrimSpace(limits.Action)); limits.Action {
+	case "":
+		limits.Action = CardinalityReject
+	case CardinalityReject, CardinalitySample:
+	default:
+		return nil, fmt.Errorf("unknown series limit action %q: expected reject or sample", limits.Action)
+	}
+	if limits.MaxSeries < 0 || limits.MaxSeriesPerClient < 0 {
+		return nil, fmt.Errorf("series limits must not be negative")
+	}
+	if limits.SampleRate < 0 || limits.SampleRate > 1 {
+		return nil, fmt.Errorf("series sample rate must be within [0, 1], got %v", limits.SampleRate)
+	}
+	for _, l := range limits.Patterns {
+		if _, err := path.Match(l.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid series limit pattern %q: %w", l.Pattern, err)
+		}
+	}
+	return &CardinalityGuard{
+		limits:   limits,
+		series:   make(map[seriesKey]string),
+		clients:  make(map[string]*clientUsage),
+		patterns: make([]int, len(limits.Patterns)),
+	}, nil
+}
+
+// Limits возвращает действующие ограничения.
+func (g *CardinalityGuard) Limits() CardinalityLimits {
+	return g.limits
+}
+
+// load заполняет учёт рядами хранилища при первом обращении.
+func (g *CardinalityGuard) load(list func() []repository.MetricInfo) {
+	if g.loaded {
+		return
+	}
+	for _, info := range list() {
+		g.add(seriesKey{info.Type, info.Name}, "")
+	}
+	g.loaded = true
+}
+
+func (g *CardinalityGuard) usage(client string) *clientUsage {
+	u, ok := g.clients[client]
+	if !ok {
+		u = &clientUsage{}
+		g.clients[client] = u
+	}
+	return u
+}
+
+func (g *CardinalityGuard) add(key seriesKey, client string) {
+	if _, ok := g.series[key]; ok {
+		return
+	}
+	g.series[key] = client
+	if client != "" {
+		g.usage(client).series++
+	}
+	for i, l := range g.limits.Patterns {
+		if ok, _ := path.Match(l.Pattern, key.name); ok {
+			g.patterns[i]++
+		}
+	}
+}
+
+// exceeded возвращает описание первого ограничения, которое нарушит новый ряд, или "".
+func (g *CardinalityGuard) exceeded(key seriesKey, client string) string {
+	if max := g.limits.MaxSeries; max > 0 && len(g.series) >= max {
+		return fmt.Sprintf("server limit of %d series", max)
+	}
+	if max := g.limits.MaxSeriesPerClient; max > 0 && client != "" && g.usage(client).series >= max {
+		return fmt.Sprintf("limit of %d series per client", max)
+	}
+	for i, l := range g.limits.Patterns {
+		if ok, _ := path.Match(l.Pattern, key.name); ok && g.patterns[i] >= l.Max {
+			return fmt.Sprintf("limit of %d series for %q", l.Max, l.Pattern)
+		}
+	}
+	return ""
+}
+
+// sampled детерминированно отбирает долю SampleRate имён: один и тот же ряд
+// либо всегда сохраняется, либо всегда отбрасывается.
+func (g *CardinalityGuard) sampled(name string) bool {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return float64(h.Sum32()%10000) < g.limits.SampleRate*10000
+}
+
+// Admit проверяет запись ряда mtype/name клиентом client. Известные ряды допускаются всегда.
+// created сообщает, что ряд новый и учтён за клиентом. Без ошибки и с admitted == false
+// ряд отброшен выборкой. list возвращает ряды хранилища для первоначального учёта.
+func (g *CardinalityGuard) Admit(client, mtype, name string, list func() []repository.MetricInfo) (admitted, created bool, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.load(list)
+
+	key := seriesKey{mtype, name}
+	if _, ok := g.series[key]; ok {
+		return true, false, nil
+	}
+	reason := g.exceeded(key, client)
+	switch {
+	case reason == "":
+	case g.limits.Action == CardinalitySample && g.sampled(name):
+	case g.limits.Action == CardinalitySample:
+		g.usage(client).dropped++
+		return false, false, nil
+	default:
+		g.usage(client).rejected++
+		return false, false, ErrCardinalityLimit.With(fmt.Errorf("new %s %q exceeds the %s", mtype, name, reason))
+	}
+	g.add(key, client)
+	return true, true, nil
+}
+
+// Known сообщает, учтён ли ряд mtype/name.
+func (g *CardinalityGuard) Known(mtype, name string, list func() []repository.MetricInfo) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.load(list)
+	_, ok := g.series[seriesKey{mtype, name}]
+	return ok
+}
+
+// Forget исключает ряд из учёта (ряд удалён или его запись не удалась).
+func (g *CardinalityGuard) Forget(mtype, name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	key := seriesKey{mtype, name}
+	client, ok := g.series[key]
+	if !ok {
+		return
+	}
+	delete(g.series, key)
+	if u, ok := g.clients[client]; ok && client != "" {
+		u.series--
+	}
+	for i, l := range g.limits.Patterns {
+		if ok, _ := path.Match(l.Pattern, key.name); ok {
+			g.patterns[i]--
+		}
+	}
+}
+
+// Reset сбрасывает учёт рядов: при следующем обращении он заполняется из хранилища заново.
+// Счётчики отклонённых и отброшенных рядов сохраняются.
+func (g *CardinalityGuard) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.loaded = false
+	g.series = make(map[seriesKey]string)
+	g.patterns = make([]int, len(g.limits.Patterns))
+	for _, u := range g.clients {
+		u.series = 0
+	}
+}
+
+// ClientCardinality — ряды, созданные клиентом, и новые ряды, которые он не смог создать.
+type ClientCardinality struct {
+	Client   string `json:"client"`
+	Series   int    `json:"series"`
+	Rejected int    `json:"rejected"`
+	Dropped  int    `json:"dropped"`
+}
+
+// PatternCardinality — заполнение ограничения по шаблону.
+type PatternCardinality struct {
+	SeriesLimit
+	Series int `json:"series"`
+}
+
+// CardinalityReport — состояние учёта рядов: всего рядов, ограничения, их заполнение
+// и клиенты, создавшие больше всего рядов.
+type CardinalityReport struct {
+	Series   int                  `json:"series"`
+	Limits   CardinalityLimits    `json:"limits"`
+	Patterns []PatternCardinality `json:"patterns"`
+	Clients  []ClientCardinality  `json:"clients"`
+}
+
+// Report возвращает состояние учёта и не больше top клиентов (0 — всех), упорядоченных
+// по числу созданных рядов, затем по числу отклонённых и отброшенных.
+func (g *CardinalityGuard) Report(top int, list func() []repository.MetricInfo) CardinalityReport {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.load(list)
+
+	rep := CardinalityReport{
+		Series:   len(g.series),
+		Limits:   g.limits,
+		Patterns: make([]PatternCardinality, len(g.limits.Patterns)),
+		Clients:  make([]ClientCardinality, 0, len(g.clients)),
+	}
+	for i, l := range g.limits.Patterns {
+		rep.Patterns[i] = PatternCardinality{SeriesLimit: l, Series: g.patterns[i]}
+	}
+	for client, u := range g.clients {
+		if u.series == 0 && u.rejected == 0 && u.dropped == 0 {
+			continue
+		}
+		rep.Clients = append(rep.Clients, ClientCardinality{Client: client, Series: u.series, Rejected: u.rejected, Dropped: u.dropped})
+	}
+	sort.Slice(rep.Clients, func(i, j int) bool {
+		a, b := rep.Clients[i], rep.Clients[j]
+		if a.Series != b.Series {
+			return a.Series > b.Series
+		}
+		if a.Rejected+a.Dropped != b.Rejected+b.Dropped {
+			return a.Rejected+a.Dropped > b.Rejected+b.Dropped
+		}
+		return a.Client < b.Client
+	})
+	if top > 0 && len(rep.Clients) > top {
+		rep.Clients = rep.Clients[:top]
+	}
+	return rep
+}
+
+// noRelease — отмена учёта, когда отменять нечего.
+func noRelease() {}
+
+// releaseAll отменяет учёт всех рядов releases.
+func releaseAll(releases []func()) {
+	for _, r := range releases {
+		r()
+	}
+}
+
+// ForClient возвращает сервис, который учитывает новые ряды за клиентом client
+// и передаёт его правилам переразметки. Остальные поля общие с исходным сервисом.
+func (ms *MetricsService) ForClient(client string) *MetricsService {
+	if !ms.clientAware() || client == ms.client {
+		return ms
+	}
+	scoped := *ms
+	scoped.client = client
+	return &scoped
+}
+
+// clientAware сообщает, зависит ли запись от клиента: учёт рядов или переразметка.
+func (ms *MetricsService) clientAware() bool {
+	return ms.Cardinality != nil || ms.Relabel != nil
+}
+
+// admit проверяет ограничения числа рядов перед записью mtype/name. ok == false без ошибки —
+// ряд отброшен выборкой, запись нужно молча пропустить. release отменяет учёт нового ряда,
+// если запись не удалась.
+func (ms *MetricsService) admit(mtype, name string) (ok bool, release func(), err error) {
+	if ms.Cardinality == nil {
+		return true, noRelease, nil
+	}
+	mtype = strings.ToLower(mtype)
+	ok, created, err := ms.Cardinality.Admit(ms.client, mtype, name, ms.Storage.ListMetricInfo)
+	if !ok || !created {
+		return ok, noRelease, err
+	}
+	return true, func() { ms.Cardinality.Forget(mtype, name) }, nil
+}
+
+// CardinalityReport возвращает состояние учёта рядов (см. CardinalityGuard.Report).
+func (ms *MetricsService) CardinalityReport(top int) (CardinalityReport, error) {
+	if ms.Cardinality == nil {
+		return CardinalityReport{}, ErrCardinalityDisabled
+	}
+	return ms.Cardinality.Report(top, ms.Storage.ListMetricInfo), nil
+}
+
+// admitBatch проверяет ограничения числа рядов для элементов пакета и возвращает элементы,
+// которые нужно записать. При отказе учёт новых рядов пакета отменяется; release
+// отменяет его, если не удалась запись.
+func (ms *MetricsService) admitBatch(batch []middleware.MetricsJSON) ([]middleware.MetricsJSON, func(), error) {
+	if ms.Cardinality == nil {
+		return batch, noRelease, nil
+	}
+	admitted := batch[:0:0]
+	var releases []func()
+	release := func() { releaseAll(releases) }
+	for _, m := range batch {
+		ok, r, err := ms.admit(string(m.MType), m.ID)
+		if err != nil {
+			release()
+			return nil, noRelease, err
+		}
+		if ok {
+			admitted = append(admitted, m)
+			releases = append(releases, r)
+		}
+	}
+	return admitted, release, nil
+}
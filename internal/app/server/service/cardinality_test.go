@@ -0,0 +1,167 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+)
+
+func newLimitedService(t *testing.T, limits CardinalityLimits) *MetricsService {
+	t.Helper()
+	guard, err := NewCardinalityGuard(limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &MetricsService{Storage: repository.NewMemStorage(), Cardinality: guard}
+}
+
+func TestParseSeriesLimits(t *testing.T) {
+	limits, err := ParseSeriesLimits(" app.*=10, tmp.*=0 ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limits) != 2 || limits[0] != (SeriesLimit{"app.*", 10}) || limits[1] != (SeriesLimit{"tmp.*", 0}) {
+		t.Fatalf("unexpected limits: %+v", limits)
+	}
+	for _, spec := range []string{"app.*", "=5", "[=5", "app.*=-1", "app.*=x"} {
+		if _, err := ParseSeriesLimits(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+	if _, err := NewCardinalityGuard(CardinalityLimits{Action: "drop"}); err == nil {
+		t.Error("unknown action must be rejected")
+	}
+	if _, err := NewCardinalityGuard(CardinalityLimits{SampleRate: 2}); err == nil {
+		t.Error("sample rate above 1 must be rejected")
+	}
+}
+
+func TestCardinality_Reject(t *testing.T) {
+	ms := newLimitedService(t, CardinalityLimits{
+		MaxSeries:          5,
+		MaxSeriesPerClient: 2,
+		Patterns:           []SeriesLimit{{Pattern: "tmp.*", Max: 1}},
+	})
+	a, b := ms.ForClient("a"), ms.ForClient("b")
+
+	for _, name := range []string{"a1", "a2"} {
+		if err := a.UpdateMetric(GaugeMetric, name, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.UpdateMetric(GaugeMetric, "a3", "1"); !errors.Is(err, ErrCardinalityLimit) {
+		t.Fatalf("per-client limit: expected ErrCardinalityLimit, got %v", err)
+	}
+	// Существующие ряды обновляются без ограничений, в том числе другими клиентами.
+	if err := a.UpdateMetric(GaugeMetric, "a1", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.UpdateMetric(GaugeMetric, "a2", "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.UpdateMetric(CounterMetric, "tmp.x", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.UpdateMetric(CounterMetric, "tmp.y", "1"); !errors.Is(err, ErrCardinalityLimit) {
+		t.Fatalf("pattern limit: expected ErrCardinalityLimit, got %v", err)
+	}
+
+	// Пакет с отклонённым рядом не записывается целиком.
+	batch := []middleware.MetricsJSON{
+		gaugeItem("b1", 1),
+		gaugeItem("tmp.z", 1),
+	}
+	if _, err := b.UpdateMetricsBatch(batch); !errors.Is(err, ErrCardinalityLimit) {
+		t.Fatalf("batch: expected ErrCardinalityLimit, got %v", err)
+	}
+	if _, ok := ms.Storage.GetGaugeRaw("b1"); ok {
+		t.Fatal("rejected batch must not be written")
+	}
+
+	// Частичный пакет отклоняет только ряды сверх лимита.
+	res := b.ApplyBatch(batch, BatchPartial)
+	if res.Applied != 1 || res.Failed != 1 || res.Results[1].Error.Code != CodeCardinalityLimit {
+		t.Fatalf("unexpected partial result: %+v", res)
+	}
+
+	// Общий лимит: a1, a2, tmp.x, b1 и ещё один ряд.
+	if err := ms.ForClient("c").UpdateMetric(GaugeMetric, "c1", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.ForClient("c").UpdateMetric(GaugeMetric, "c2", "1"); !errors.Is(err, ErrCardinalityLimit) {
+		t.Fatalf("server limit: expected ErrCardinalityLimit, got %v", err)
+	}
+
+	// Удаление освобождает место.
+	if err := ms.DeleteMetric(GaugeMetric, "a1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.UpdateMetric(GaugeMetric, "a3", "1"); err != nil {
+		t.Fatalf("deleted series must free the limit: %v", err)
+	}
+
+	rep, err := ms.CardinalityReport(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Series != 5 || len(rep.Clients) != 2 || rep.Patterns[0].Series != 1 {
+		t.Fatalf("unexpected report: %+v", rep)
+	}
+	// При равном числе рядов выше клиент с большим числом отказов.
+	if top := rep.Clients[0]; top.Client != "b" || top.Series != 2 || top.Rejected != 3 {
+		t.Fatalf("unexpected top client: %+v", top)
+	}
+	if second := rep.Clients[1]; second.Client != "a" || second.Series != 2 || second.Rejected != 1 {
+		t.Fatalf("unexpected second client: %+v", second)
+	}
+}
+
+func TestCardinality_Sample(t *testing.T) {
+	ms := newLimitedService(t, CardinalityLimits{MaxSeries: 1, Action: CardinalitySample, SampleRate: 0.5})
+	if err := ms.UpdateMetric(GaugeMetric, "first", "1"); err != nil {
+		t.Fatal(err)
+	}
+	kept := 0
+	for i := 0; i < 200; i++ {
+		name := fmt.Sprintf("s%d", i)
+		if err := ms.UpdateMetric(GaugeMetric, name, "1"); err != nil {
+			t.Fatalf("sampling must not fail writes: %v", err)
+		}
+		if _, ok := ms.Storage.GetGaugeRaw(name); ok {
+			kept++
+		}
+	}
+	if kept < 60 || kept > 140 {
+		t.Fatalf("expected about half of new series, kept %d", kept)
+	}
+
+	batch := []middleware.MetricsJSON{gaugeItem("first", 2), gaugeItem("s0", 2), gaugeItem("s1", 2)}
+	res := ms.ApplyBatch(batch, BatchAtomic)
+	if res.Failed != 0 || res.Applied+res.Dropped != 3 {
+		t.Fatalf("dropped series must not fail an atomic batch: %+v", res)
+	}
+}
+
+func TestCardinality_ExistingSeriesAndRestore(t *testing.T) {
+	ms := newLimitedService(t, CardinalityLimits{MaxSeries: 2})
+	for _, name := range []string{"old1", "old2"} {
+		if err := ms.Storage.UpdateGaugeRaw(name, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ms.UpdateMetric(GaugeMetric, "new", "1"); !errors.Is(err, ErrCardinalityLimit) {
+		t.Fatalf("series present in storage must count, got %v", err)
+	}
+
+	snap := (&MetricsService{Storage: repository.NewMemStorage()}).Snapshot()
+	if err := ms.RestoreSnapshot(snap, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.UpdateMetric(GaugeMetric, "new", "1"); err != nil {
+		t.Fatalf("restoring an empty snapshot must free the limit: %v", err)
+	}
+}
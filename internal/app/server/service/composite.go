@@ -0,0 +1,231 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/pkg/ddsketch"
+	"github.com/Hobrus/hobrusmetrics.git/pkg/hll"
+)
+
+// buckets возвращает границы корзин для новых гистограмм.
+func (ms *MetricsService) buckets() []float64 {
+	if len(ms.HistogramBuckets) > 0 {
+		return ms.HistogramBuckets
+	}
+	return models.DefaultHistogramBuckets
+}
+
+// newSketch создаёт пустой скетч с настройками сервиса.
+func (ms *MetricsService) newSketch() (*models.Sketch, error) {
+	alpha := ms.SketchAccuracy
+	if alpha == 0 {
+		alpha = ddsketch.DefaultRelativeAccuracy
+	}
+	return models.NewSketch(alpha, ms.sketchMaxBins())
+}
+
+// sketchMaxBins возвращает ограничение числа корзин одного скетча.
+func (ms *MetricsService) sketchMaxBins() int {
+	if ms.SketchMaxBins > 0 {
+		return ms.SketchMaxBins
+	}
+	return ddsketch.DefaultMaxBins
+}
+
+// limit ограничивает объём памяти значения, пришедшего от клиента:
+// скетч сжимается до ограничения числа корзин сервера.
+func (ms *MetricsService) limit(c models.Composite) {
+	if s, ok := c.(*models.Sketch); ok {
+		s.LimitBins(ms.sketchMaxBins())
+	}
+}
+
+// newObservation создаёт значение составной метрики из одного наблюдения.
+func (ms *MetricsService) newObservation(mtype string, v float64) (models.Composite, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, invalidValue("invalid %s observation: %v", mtype, v)
+	}
+	switch mtype {
+	case HistogramMetric:
+		h := models.NewHistogram(ms.buckets())
+		h.Observe(v)
+		return h, nil
+	case SummaryMetric:
+		s := &models.Summary{}
+		s.Observe(v)
+		return s, nil
+	case SketchMetric:
+		s, err := ms.newSketch()
+		if err != nil {
+			return nil, err
+		}
+		s.Add(v)
+		return s, nil
+	default:
+		return nil, ErrUnsupportedType
+	}
+}
+
+// newSet создаёт множество из элементов members.
+func (ms *MetricsService) newSet(members []string) (*models.Set, error) {
+	precision := ms.SetPrecision
+	if precision == 0 {
+		precision = hll.DefaultPrecision
+	}
+	s, err := models.NewSet(precision)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		s.Add(m)
+	}
+	return s, nil
+}
+
+// AddSetMembers добавляет элементы в множество name. Сами элементы не сохраняются.
+func (ms *MetricsService) AddSetMembers(name string, members []string) error {
+	if name == "" {
+		return ErrNameRequired
+	}
+	s, err := ms.newSet(members)
+	if err != nil {
+		return err
+	}
+	return ms.storeComposite(name, s)
+}
+
+// observe записывает одно наблюдение составной метрики, заданное строкой (path-маршрут /update/).
+// Для set строка считается элементом множества.
+func (ms *MetricsService) observe(mtype, name, raw string) error {
+	if mtype == SetMetric {
+		return ms.AddSetMembers(name, []string{raw})
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return invalidValue("invalid %s value: %w", mtype, err)
+	}
+	c, err := ms.newObservation(mtype, v)
+	if err != nil {
+		return err
+	}
+	return ms.storeComposite(name, c)
+}
+
+// UpdateComposite объединяет уже агрегированное значение (histogram, summary, sketch) с сохранённым.
+func (ms *MetricsService) UpdateComposite(name string, value models.Composite) error {
+	if name == "" {
+		return ErrNameRequired
+	}
+	if err := value.Validate(); err != nil {
+		return invalidValue("invalid %s value: %w", value.Type(), err)
+	}
+	ms.limit(value)
+	return ms.storeComposite(name, value)
+}
+
+// storeComposite объединяет значение с сохранённым (под именем после переразметки)
+// и сообщает об изменении.
+func (ms *MetricsService) storeComposite(name string, value models.Composite) error {
+	name, ok, release, err := ms.ingest(value.Type(), name)
+	if !ok {
+		return err
+	}
+	if err := ms.Storage.UpdateComposite(name, value); err != nil {
+		release()
+		return storageErr(err)
+	}
+	ms.publishCurrent(value.Type(), name)
+	return nil
+}
+
+// Quantiles возвращает оценки квантилей qs для скетча name.
+func (ms *MetricsService) Quantiles(name string, qs []float64) ([]float64, error) {
+	c, err := ms.GetComposite(SketchMetric, name)
+	if err != nil {
+		return nil, err
+	}
+	values, err := c.(*models.Sketch).Quantiles(qs)
+	if err != nil {
+		return nil, ErrInvalidValue.With(err)
+	}
+	return values, nil
+}
+
+// GetComposite возвращает значение составной метрики.
+func (ms *MetricsService) GetComposite(mtype, name string) (models.Composite, error) {
+	if !models.IsComposite(mtype) {
+		return nil, ErrUnsupportedType
+	}
+	c, ok := ms.Storage.GetComposite(mtype, name)
+	if !ok {
+		return nil, ErrMetricNotFound
+	}
+	return c, nil
+}
+
+// normalizeComposite приводит составную метрику из JSON к агрегированному виду:
+// одно наблюдение в value превращается в значение из одного элемента,
+// а переданные клиентом скетчи сжимаются до ограничения сервера.
+// Элементы с обоими полями или без значения отклоняются.
+func (ms *MetricsService) normalizeComposite(m *middleware.MetricsJSON, mtype string) error {
+	value, hasComposite := m.Composite(mtype)
+	if mtype == SetMetric {
+		return ms.normalizeSet(m, value, hasComposite)
+	}
+	switch {
+	case hasComposite && m.Value != nil:
+		return invalidValue("metric %q: either value or %s must be set, not both", m.ID, mtype)
+	case hasComposite:
+		if err := value.Validate(); err != nil {
+			return invalidValue("metric %q: invalid %s value: %w", m.ID, mtype, err)
+		}
+		// Значение клиента не изменяется: сжимается копия.
+		value = value.Clone()
+		ms.limit(value)
+		m.CompositeFields = models.CompositeFields{}
+		m.SetComposite(value)
+		return nil
+	case m.Value == nil:
+		return fmt.Errorf("metric %q: %w: value or %s", m.ID, ErrValueRequired, mtype)
+	}
+	c, err := ms.newObservation(mtype, *m.Value)
+	if err != nil {
+		return err
+	}
+	m.CompositeFields = models.CompositeFields{}
+	m.SetComposite(c)
+	m.Value = nil
+	return nil
+}
+
+// normalizeSet приводит элемент пакета типа set к скетчу: элементы из members
+// добавляются в новый скетч и объединяются с переданным, если он есть.
+func (ms *MetricsService) normalizeSet(m *middleware.MetricsJSON, value models.Composite, hasSketch bool) error {
+	if !hasSketch && len(m.Members) == 0 {
+		return fmt.Errorf("metric %q: %w: members or set", m.ID, ErrValueRequired)
+	}
+	if m.Value != nil || m.Delta != nil {
+		return invalidValue("metric %q: set accepts only members or a serialized set", m.ID)
+	}
+	s, err := ms.newSet(m.Members)
+	if err != nil {
+		return err
+	}
+	if hasSketch {
+		if err := value.Validate(); err != nil {
+			return invalidValue("metric %q: invalid set value: %w", m.ID, err)
+		}
+		if len(m.Members) == 0 {
+			s = value.Clone().(*models.Set)
+		} else if err := s.Merge(value); err != nil {
+			return storageErr(fmt.Errorf("metric %q: %w", m.ID, err))
+		}
+	}
+	m.CompositeFields = models.CompositeFields{Set: s}
+	m.Members = nil
+	return nil
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
+
+// deletableType сообщает, можно ли удалять метрики типа mt: gauge, counter и составные типы.
+func deletableType(mt string) bool {
+	return mt == GaugeMetric || mt == CounterMetric || models.IsComposite(mt)
+}
+
+// DeleteMetric удаляет одну метрику указанного типа.
+func (ms *MetricsService) DeleteMetric(metricType, metricName string) error {
+	mt := strings.ToLower(metricType)
+	if !deletableType(mt) {
+		return ErrUnsupportedType
+	}
+	deleted, err := ms.Storage.DeleteMetric(mt, metricName, time.Time{})
+	if err != nil {
+		return storageErr(err)
+	}
+	if !deleted {
+		return ErrMetricNotFound
+	}
+	ms.publish(EventDelete, middleware.MetricsJSON{ID: metricName, MType: middleware.MetricType(mt)})
+	return nil
+}
+
+// DeleteMetrics удаляет все метрики, имена которых подходят под шаблон (синтаксис path.Match).
+// Пустой metricType означает метрики любого типа. Возвращает удалённые метрики.
+func (ms *MetricsService) DeleteMetrics(metricType, pattern string) ([]MetricRef, error) {
+	mt := strings.ToLower(metricType)
+	if mt != "" && !deletableType(mt) {
+		return nil, ErrUnsupportedType
+	}
+	if pattern == "" {
+		return nil, ErrInvalidQuery.With(errors.New("pattern is required"))
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, ErrInvalidQuery.With(fmt.Errorf("invalid pattern %q: %w", pattern, err))
+	}
+
+	var removed []MetricRef
+	for _, info := range ms.Storage.ListMetricInfo() {
+		if mt != "" && info.Type != mt {
+			continue
+		}
+		if ok, _ := path.Match(pattern, info.Name); !ok {
+			continue
+		}
+		deleted, err := ms.Storage.DeleteMetric(info.Type, info.Name, time.Time{})
+		if err != nil {
+			return removed, storageErr(err)
+		}
+		if deleted {
+			removed = append(removed, MetricRef{ID: info.Name, MType: info.Type})
+			ms.publish(EventDelete, middleware.MetricsJSON{ID: info.Name, MType: middleware.MetricType(info.Type)})
+		}
+	}
+	return removed, nil
+}
+
+// ResetCounter обнуляет counter.
+func (ms *MetricsService) ResetCounter(metricName string) error {
+	reset, err := ms.Storage.ResetCounter(metricName)
+	if err != nil {
+		return storageErr(err)
+	}
+	if !reset {
+		return ErrMetricNotFound
+	}
+	ms.publishCurrent(CounterMetric, metricName)
+	return nil
+}
+
+// MetricRef — ссылка на метрику по имени и типу.
+type MetricRef struct {
+	ID    string `json:"id"`
+	MType string `json:"type"`
+}
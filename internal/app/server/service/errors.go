@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
+
+// Коды ошибок API. Коды стабильны: клиенты сравнивают их, а не текст ошибки.
+// Коды, которые формирует и транспортный уровень, берутся из middleware.
+const (
+	CodeNameRequired        = "name_required"
+	CodeUnsupportedType     = middleware.CodeUnsupportedType
+	CodeValueRequired       = middleware.CodeValueRequired
+	CodeInvalidValue        = "invalid_value"
+	CodeMetricNotFound      = middleware.CodeMetricNotFound
+	CodeTypeConflict        = "type_conflict"
+	CodeCompositeMismatch   = "composite_mismatch"
+	CodeInvalidQuery        = "invalid_query"
+	CodeInvalidSnapshot     = "invalid_snapshot"
+	CodeStorageError        = "storage_error"
+	CodeStreamDisabled      = "stream_disabled"
+	CodeHistoryDisabled     = "history_disabled"
+	CodeInvalidToken        = middleware.CodeInvalidToken
+	CodeTokenNotFound       = "token_not_found"
+	CodeInvalidTokenRequest = "invalid_token_request"
+	CodeAuthDisabled        = "auth_disabled"
+	CodeBatchTooLarge       = "batch_too_large"
+	CodeCardinalityLimit    = "cardinality_limit"
+	CodeCardinalityDisabled = "cardinality_disabled"
+	CodeInvalidRelabel      = "invalid_relabel_rules"
+	CodeInvalidExpression   = "invalid_expression"
+	CodeInvalidRules        = "invalid_recording_rules"
+	CodeRatesDisabled       = "rates_disabled"
+	CodeInsufficientData    = "insufficient_data"
+	CodeQueryFailed         = "query_failed"
+	CodeAlertsDisabled      = "alerts_disabled"
+	CodeInvalidSilence      = "invalid_silence"
+	CodeSilenceNotFound     = "silence_not_found"
+	CodeInvalidAlertRules   = "invalid_alert_rules"
+)
+
+// Error — запись каталога ошибок: код, HTTP-статус и краткое описание.
+// Подробности конкретного случая добавляются обёрткой (fmt.Errorf с %w или With),
+// при этом errors.Is(err, ErrX) продолжает работать.
+type Error struct {
+	Code   string
+	Status int
+	Title  string
+}
+
+func (e *Error) Error() string { return e.Title }
+
+// ProblemCode, ProblemStatus и ProblemTitle реализуют middleware.ProblemError.
+func (e *Error) ProblemCode() string  { return e.Code }
+func (e *Error) ProblemStatus() int   { return e.Status }
+func (e *Error) ProblemTitle() string { return e.Title }
+
+// With связывает ошибку err с записью каталога, сохраняя текст err.
+func (e *Error) With(err error) error {
+	return &classified{entry: e, err: err}
+}
+
+// classified — ошибка с текстом исходной ошибки и кодом записи каталога.
+type classified struct {
+	entry *Error
+	err   error
+}
+
+func (c *classified) Error() string        { return c.err.Error() }
+func (c *classified) Unwrap() []error      { return []error{c.err, c.entry} }
+func (c *classified) ProblemCode() string  { return c.entry.Code }
+func (c *classified) ProblemStatus() int   { return c.entry.Status }
+func (c *classified) ProblemTitle() string { return c.entry.Title }
+
+// Каталог ошибок сервисного слоя.
+var (
+	ErrMetricNotFound      = &Error{CodeMetricNotFound, http.StatusNotFound, "metric not found"}
+	ErrUnsupportedType     = &Error{CodeUnsupportedType, http.StatusBadRequest, "unsupported metric type"}
+	ErrNameRequired        = &Error{CodeNameRequired, http.StatusBadRequest, "metric name is required"}
+	ErrValueRequired       = &Error{CodeValueRequired, http.StatusBadRequest, "metric value is required"}
+	ErrInvalidValue        = &Error{CodeInvalidValue, http.StatusBadRequest, "invalid metric value"}
+	ErrTypeConflict        = &Error{CodeTypeConflict, http.StatusConflict, "metric type conflict"}
+	ErrCompositeMismatch   = &Error{CodeCompositeMismatch, http.StatusBadRequest, "incompatible composite value"}
+	ErrInvalidQuery        = &Error{CodeInvalidQuery, http.StatusBadRequest, "invalid metrics query"}
+	ErrInvalidSnapshot     = &Error{CodeInvalidSnapshot, http.StatusBadRequest, "invalid snapshot"}
+	ErrStorage             = &Error{CodeStorageError, http.StatusInternalServerError, "storage error"}
+	ErrStreamDisabled      = &Error{CodeStreamDisabled, http.StatusServiceUnavailable, "event stream is disabled"}
+	ErrHistoryDisabled     = &Error{CodeHistoryDisabled, http.StatusServiceUnavailable, "metric history is disabled"}
+	ErrInvalidToken        = &Error{CodeInvalidToken, http.StatusUnauthorized, "invalid API token"}
+	ErrTokenNotFound       = &Error{CodeTokenNotFound, http.StatusNotFound, "token not found"}
+	ErrInvalidTokenRequest = &Error{CodeInvalidTokenRequest, http.StatusBadRequest, "invalid token request"}
+	ErrAuthDisabled        = &Error{CodeAuthDisabled, http.StatusServiceUnavailable, "token authentication is disabled"}
+	ErrBatchTooLarge       = &Error{CodeBatchTooLarge, http.StatusRequestEntityTooLarge, "too many items in batch"}
+	ErrCardinalityLimit    = &Error{CodeCardinalityLimit, http.StatusUnprocessableEntity, "series limit exceeded"}
+	ErrCardinalityDisabled = &Error{CodeCardinalityDisabled, http.StatusServiceUnavailable, "series limits are disabled"}
+	ErrInvalidRelabel      = &Error{CodeInvalidRelabel, http.StatusBadRequest, "invalid relabel rules"}
+	ErrInvalidExpression   = &Error{CodeInvalidExpression, http.StatusBadRequest, "invalid expression"}
+	ErrInvalidRules        = &Error{CodeInvalidRules, http.StatusBadRequest, "invalid recording rules"}
+	ErrRatesDisabled       = &Error{CodeRatesDisabled, http.StatusServiceUnavailable, "counter rates are disabled"}
+	ErrInsufficientData    = &Error{CodeInsufficientData, http.StatusUnprocessableEntity, "not enough counter observations"}
+	ErrQueryFailed         = &Error{CodeQueryFailed, http.StatusUnprocessableEntity, "query evaluation failed"}
+	ErrAlertsDisabled      = &Error{CodeAlertsDisabled, http.StatusServiceUnavailable, "alerting is disabled"}
+	ErrInvalidSilence      = &Error{CodeInvalidSilence, http.StatusBadRequest, "invalid silence"}
+	ErrSilenceNotFound     = &Error{CodeSilenceNotFound, http.StatusNotFound, "silence not found"}
+	ErrInvalidAlertRules   = &Error{CodeInvalidAlertRules, http.StatusBadRequest, "invalid alert rules"}
+)
+
+// invalidValue возвращает ошибку некорректного значения с описанием конкретного случая.
+func invalidValue(format string, args ...any) error {
+	return ErrInvalidValue.With(fmt.Errorf(format, args...))
+}
+
+// storageErr приводит ошибку хранилища к каталогу: конфликт типов и несовместимые
+// составные значения получают свои коды, прочие ошибки считаются сбоем хранилища.
+func storageErr(err error) error {
+	var known *Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &known):
+		return err
+	case errors.Is(err, models.ErrTypeConflict):
+		return ErrTypeConflict.With(err)
+	case errors.Is(err, models.ErrCompositeMismatch):
+		return ErrCompositeMismatch.With(err)
+	default:
+		return ErrStorage.With(err)
+	}
+}
+
+// Classify возвращает запись каталога для ошибки err; ошибки вне каталога
+// считаются сбоем хранилища.
+func Classify(err error) *Error {
+	var known *Error
+	if errors.As(storageErr(err), &known) {
+		return known
+	}
+	return ErrStorage
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
+
+// Виды событий потока изменений.
+const (
+	// EventUpdate — метрика записана; Metric содержит значение после обновления.
+	EventUpdate = "update"
+	// EventDelete — метрика удалена; в Metric заполнены только id и type.
+	EventDelete = "delete"
+	// EventReset — состояние изменилось целиком (восстановлен снимок); подписчику
+	// нужно перечитать метрики.
+	EventReset = "reset"
+)
+
+// Параметры брокера по умолчанию.
+const (
+	DefaultEventHistory     = 1024
+	DefaultSubscriberBuffer = 256
+)
+
+// Event — изменение метрики, применённое сервисом.
+type Event struct {
+	// ID — порядковый номер события; клиенту передаётся через EventID.
+	ID     uint64                 `json:"-"`
+	Kind   string                 `json:"kind"`
+	Metric middleware.MetricsJSON `json:"metric"`
+	Time   time.Time              `json:"time"`
+}
+
+// Broker рассылает события изменений подписчикам и хранит последние события,
+// чтобы отключившийся подписчик мог продолжить с места обрыва.
+//
+// Публикация никогда не ждёт подписчиков: если буфер подписчика переполнен,
+// подписка закрывается (Lagged возвращает true), а клиент переподключается
+// и дочитывает пропущенное из истории. Так медленный клиент не тормозит запись метрик.
+type Broker struct {
+	// epoch отличает события разных запусков сервера: номера событий начинаются заново.
+	epoch string
+
+	mu      sync.Mutex
+	nextID  uint64
+	history []Event
+	head    int // индекс самого старого события в history
+	size    int
+	subs    map[*Subscription]struct{}
+	closed  bool
+}
+
+// NewBroker создаёт брокер, хранящий history последних событий (0 — DefaultEventHistory).
+func NewBroker(history int) *Broker {
+	if history <= 0 {
+		history = DefaultEventHistory
+	}
+	return &Broker{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		history: make([]Event, history),
+		subs:    make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription — подписка на события. Канал Events закрывается при отмене подписки,
+// переполнении буфера (Lagged) или закрытии брокера.
+type Subscription struct {
+	ch     chan Event
+	match  func(Event) bool
+	broker *Broker
+	lagged atomic.Bool
+}
+
+// Events возвращает канал событий подписки.
+func (s *Subscription) Events() <-chan Event { return s.ch }
+
+// Lagged сообщает, что подписка закрыта из-за переполнения буфера.
+func (s *Subscription) Lagged() bool { return s.lagged.Load() }
+
+// Close отменяет подписку.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.removeLocked(s)
+}
+
+// EventID возвращает идентификатор события для клиента: эпоха брокера и номер события.
+func (b *Broker) EventID(id uint64) string {
+	return b.epoch + "-" + strconv.FormatUint(id, 10)
+}
+
+// Subscribe подписывает на события, для которых match возвращает true (nil — на все).
+//
+// Если lastEventID не пуст, возвращаются события истории после него. Если часть событий
+// уже вытеснена из истории или идентификатор выдан другим запуском сервера, вместо них
+// возвращается одно событие reset: подписчику нужно перечитать состояние целиком.
+func (b *Broker) Subscribe(match func(Event) bool, lastEventID string, buffer int) (sub *Subscription, replay []Event) {
+	if buffer <= 0 {
+		buffer = DefaultSubscriberBuffer
+	}
+	sub = &Subscription{ch: make(chan Event, buffer), match: match, broker: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(sub.ch)
+		return sub, nil
+	}
+	b.subs[sub] = struct{}{}
+
+	if lastEventID == "" {
+		return sub, nil
+	}
+	epoch, raw, ok := strings.Cut(lastEventID, "-")
+	last, err := strconv.ParseUint(raw, 10, 64)
+	oldest := b.nextID - uint64(b.size) + 1
+	if !ok || err != nil || epoch != b.epoch || last > b.nextID || last+1 < oldest {
+		return sub, []Event{{ID: b.nextID, Kind: EventReset, Time: time.Now().UTC()}}
+	}
+	for i := 0; i < b.size; i++ {
+		e := b.history[(b.head+i)%len(b.history)]
+		if e.ID > last && (match == nil || match(e)) {
+			replay = append(replay, e)
+		}
+	}
+	return sub, replay
+}
+
+// Recent возвращает события из истории брокера, для которых match возвращает true (nil — все).
+func (b *Broker) Recent(match func(Event) bool) []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var events []Event
+	for i := 0; i < b.size; i++ {
+		e := b.history[(b.head+i)%len(b.history)]
+		if match == nil || match(e) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Publish рассылает событие kind о метрике m.
+func (b *Broker) Publish(kind string, m middleware.MetricsJSON) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.nextID++
+	e := Event{ID: b.nextID, Kind: kind, Metric: m, Time: time.Now().UTC()}
+	if b.size < len(b.history) {
+		b.history[(b.head+b.size)%len(b.history)] = e
+		b.size++
+	} else {
+		b.history[b.head] = e
+		b.head = (b.head + 1) % len(b.history)
+	}
+
+	for sub := range b.subs {
+		if sub.match != nil && !sub.match(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			sub.lagged.Store(true)
+			b.removeLocked(sub)
+		}
+	}
+}
+
+// Close закрывает все подписки; последующие события не рассылаются.
+// Вызывается при остановке сервера, чтобы завершить открытые потоки.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subs {
+		b.removeLocked(sub)
+	}
+}
+
+func (b *Broker) removeLocked(sub *Subscription) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// EventFilter собирает фильтр событий по типам и имени (glob и регулярное выражение).
+// События reset проходят любой фильтр.
+func EventFilter(types []string, name, nameRegex string) (func(Event) bool, error) {
+	match, err := nameMatcher(name, nameRegex)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make(map[string]bool, len(types))
+	for _, t := range types {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if t != GaugeMetric && t != CounterMetric && !models.IsComposite(t) {
+			return nil, fmt.Errorf("%w: unsupported type %q", ErrInvalidQuery, t)
+		}
+		allowed[t] = true
+	}
+	return func(e Event) bool {
+		if e.Kind == EventReset {
+			return true
+		}
+		if len(allowed) > 0 && !allowed[string(e.Metric.MType)] {
+			return false
+		}
+		return match(e.Metric.ID)
+	}, nil
+}
+
+// publish сообщает об изменении метрики подписчикам, истории и учёту рядов.
+func (ms *MetricsService) publish(kind string, m middleware.MetricsJSON) {
+	if ms.Cardinality != nil {
+		switch kind {
+		case EventDelete:
+			ms.Cardinality.Forget(string(m.MType), m.ID)
+		case EventReset:
+			ms.Cardinality.Reset()
+		}
+	}
+	if ms.History != nil {
+		ms.History.record(kind, m, time.Now())
+	}
+	if ms.Rates != nil {
+		ms.Rates.record(kind, m, time.Now(), ms.Storage.GetAllCounters)
+	}
+	if ms.Events != nil {
+		ms.Events.Publish(kind, m)
+	}
+}
+
+// publishCurrent публикует текущее значение метрики после записи.
+func (ms *MetricsService) publishCurrent(mtype, name string) {
+	if ms.Events == nil && ms.History == nil && ms.Rates == nil {
+		return
+	}
+	if current, ok := ms.currentValue(middleware.MetricsJSON{ID: name, MType: middleware.MetricType(mtype)}); ok {
+		ms.publish(EventUpdate, current)
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+)
+
+func TestMetricsService_PublishesEvents(t *testing.T) {
+	ms := &MetricsService{Storage: repository.NewMemStorage(), Events: NewBroker(16)}
+	sub, _ := ms.Events.Subscribe(nil, "", 16)
+	defer sub.Close()
+
+	if err := ms.UpdateMetric("counter", "PollCount", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.UpdateMetric("counter", "PollCount", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.DeleteMetric("counter", "PollCount"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		kind  string
+		delta int64
+	}{{EventUpdate, 2}, {EventUpdate, 5}, {EventDelete, 0}}
+	for i, w := range want {
+		e := <-sub.Events()
+		if e.ID != uint64(i+1) || e.Kind != w.kind || e.Metric.ID != "PollCount" || e.Metric.MType != CounterMetric {
+			t.Fatalf("event %d: unexpected %+v", i, e)
+		}
+		if w.delta != 0 && (e.Metric.Delta == nil || *e.Metric.Delta != w.delta) {
+			t.Fatalf("event %d: expected current delta %d, got %+v", i, w.delta, e.Metric)
+		}
+	}
+}
+
+func TestBroker_Resume(t *testing.T) {
+	b := NewBroker(3)
+	for i := 0; i < 5; i++ {
+		b.Publish(EventUpdate, middleware.MetricsJSON{ID: "m", MType: GaugeMetric})
+	}
+
+	sub, replay := b.Subscribe(nil, b.EventID(3), 0)
+	sub.Close()
+	if len(replay) != 2 || replay[0].ID != 4 || replay[1].ID != 5 {
+		t.Fatalf("expected events 4 and 5, got %+v", replay)
+	}
+
+	// Событие 2 вытеснено из истории: вместо пропуска приходит reset.
+	sub, replay = b.Subscribe(nil, b.EventID(1), 0)
+	sub.Close()
+	if len(replay) != 1 || replay[0].Kind != EventReset || replay[0].ID != 5 {
+		t.Fatalf("expected reset after a gap, got %+v", replay)
+	}
+
+	sub, replay = b.Subscribe(nil, "other-2", 0)
+	sub.Close()
+	if len(replay) != 1 || replay[0].Kind != EventReset {
+		t.Fatalf("expected reset for an id of another run, got %+v", replay)
+	}
+
+	sub, replay = b.Subscribe(nil, b.EventID(5), 0)
+	sub.Close()
+	if len(replay) != 0 {
+		t.Fatalf("nothing to replay after the last event, got %+v", replay)
+	}
+}
+
+func TestBroker_SlowSubscriberIsDropped(t *testing.T) {
+	b := NewBroker(0)
+	slow, _ := b.Subscribe(nil, "", 2)
+	fast, _ := b.Subscribe(nil, "", 10)
+	defer fast.Close()
+
+	for i := 0; i < 5; i++ {
+		b.Publish(EventUpdate, middleware.MetricsJSON{ID: "m", MType: GaugeMetric})
+	}
+	if !slow.Lagged() {
+		t.Fatal("overflowed subscription must be marked lagged")
+	}
+	n := 0
+	for range slow.Events() {
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("lagged subscription must keep buffered events and close, got %d", n)
+	}
+	if fast.Lagged() || len(fast.Events()) != 5 {
+		t.Fatalf("fast subscriber must receive every event, got %d", len(fast.Events()))
+	}
+
+	b.Close()
+	if _, ok := <-fast.Events(); !ok {
+		t.Fatal("buffered events must survive Close")
+	}
+	sub, _ := b.Subscribe(nil, "", 0)
+	if _, ok := <-sub.Events(); ok {
+		t.Fatal("subscription to a closed broker must be closed")
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	match, err := EventFilter([]string{"gauge", ""}, "Heap*", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		e    Event
+		want bool
+	}{
+		{Event{Kind: EventUpdate, Metric: middleware.MetricsJSON{ID: "HeapAlloc", MType: GaugeMetric}}, true},
+		{Event{Kind: EventUpdate, Metric: middleware.MetricsJSON{ID: "HeapAlloc", MType: CounterMetric}}, false},
+		{Event{Kind: EventDelete, Metric: middleware.MetricsJSON{ID: "Alloc", MType: GaugeMetric}}, false},
+		{Event{Kind: EventReset}, true},
+	}
+	for _, tc := range cases {
+		if got := match(tc.e); got != tc.want {
+			t.Errorf("%+v: expected %v, got %v", tc.e, tc.want, got)
+		}
+	}
+
+	if _, err := EventFilter([]string{"meter"}, "", ""); err == nil {
+		t.Fatal("unknown type must be rejected")
+	}
+}
@@ -0,0 +1,1161 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
+
+// Выражения над метриками — арифметика, сравнения, агрегаты и функции над рядами:
+//
+//	TotalMemory - FreeMemory
+//	sum(CPUutilization*) / count(CPUutilization*)
+//	max(CPUutilization*{host=~"web-.*"} > 80)
+//	avg by (host) (cpu*)
+//	rate(requests{code!="200"}[5m])
+//	max(`disk-usage.*`) * 100
+//
+// Селектор — имя метрики и необязательные условия на метки
+// {label="v", label!="v", label=~"re", label!~"re"}. Внутри агрегата вместо имени допустим
+// шаблон (синтаксис path.Match); он сравнивается с именем ряда с метками и без них. Селектор выбирает ряды gauge и counter; если есть и gauge, и counter
+// с одним именем, выбирается gauge. Имена с символами вне [A-Za-z0-9_.:] записываются
+// в обратных кавычках.
+//
+// Значение выражения — число или набор рядов. Операция над набором и числом применяется
+// к каждому ряду; два набора сопоставляются по меткам, а ряд без меток, единственный
+// в своём наборе, считается числом. Сравнение набора оставляет ряды, для которых оно
+// истинно, сравнение чисел даёт 1 или 0. Арифметика отбрасывает имя метрики, оставляя метки.
+//
+// Функции окна принимают селектор с окном [5m]: rate и increase считаются по наблюдениям
+// counter (см. CounterRates), delta и *_over_time — по истории gauge и counter (см. History).
+
+// Агрегаты.
+const (
+	aggSum   = "sum"
+	aggAvg   = "avg"
+	aggMin   = "min"
+	aggMax   = "max"
+	aggCount = "count"
+)
+
+var aggregates = map[string]bool{aggSum: true, aggAvg: true, aggMin: true, aggMax: true, aggCount: true}
+
+// Функции окна.
+const (
+	fnRate        = "rate"
+	fnIncrease    = "increase"
+	fnDelta       = "delta"
+	fnAvgOverTime = "avg_over_time"
+	fnMinOverTime = "min_over_time"
+	fnMaxOverTime = "max_over_time"
+	fnCntOverTime = "count_over_time"
+)
+
+var rangeFuncs = map[string]bool{
+	fnRate: true, fnIncrease: true, fnDelta: true,
+	fnAvgOverTime: true, fnMinOverTime: true, fnMaxOverTime: true, fnCntOverTime: true,
+}
+
+// Операции сравнения и условия на метки.
+var (
+	comparisons = map[string]bool{">": true, "<": true, ">=": true, "<=": true, "==": true, "!=": true}
+	matchOps    = map[string]bool{"=": true, "!=": true, "=~": true, "!~": true}
+)
+
+// Expr — разобранное выражение.
+type Expr struct {
+	src  string
+	root exprNode
+}
+
+// String возвращает исходный текст выражения.
+func (e *Expr) String() string { return e.src }
+
+// exprSample — ряд в значении выражения: имя метрики (пусто после арифметики), метки и значение.
+type exprSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// exprValue — значение выражения: число или набор рядов.
+type exprValue struct {
+	vector  bool
+	scalar  float64
+	samples []exprSample
+}
+
+func scalarValue(v float64) exprValue { return exprValue{scalar: v} }
+
+func vectorValue(samples []exprSample) exprValue {
+	return exprValue{vector: true, samples: samples}
+}
+
+type exprNode interface {
+	eval(ctx *exprContext) (exprValue, error)
+	// vector сообщает, что значение узла — набор рядов.
+	vector() bool
+	// selectors добавляет в out шаблоны имён, от которых зависит узел.
+	selectors(out []string) []string
+}
+
+type numberNode float64
+
+// labelMatcher — условие на метку селектора.
+type labelMatcher struct {
+	label, op, value string
+	re               *regexp.Regexp
+}
+
+func (m labelMatcher) matches(v string) bool {
+	switch m.op {
+	case "=":
+		return v == m.value
+	case "!=":
+		return v != m.value
+	case "=~":
+		return m.re.MatchString(v)
+	default:
+		return !m.re.MatchString(v)
+	}
+}
+
+type selectorNode struct {
+	pattern  string // шаблон имени; пусто — любое имя
+	matchers []labelMatcher
+}
+
+type aggregateNode struct {
+	op string
+	by []string
+	x  exprNode
+}
+
+type rangeNode struct {
+	fn     string
+	sel    selectorNode
+	window time.Duration
+}
+
+type negNode struct{ x exprNode }
+
+type binaryNode struct {
+	op       string
+	lhs, rhs exprNode
+}
+
+func (n numberNode) eval(*exprContext) (exprValue, error) { return scalarValue(float64(n)), nil }
+func (n numberNode) vector() bool                         { return false }
+func (n numberNode) selectors(out []string) []string      { return out }
+
+func (n selectorNode) eval(ctx *exprContext) (exprValue, error) {
+	selected := ctx.selectSeries(n, GaugeMetric, CounterMetric)
+	samples := make([]exprSample, len(selected))
+	for i, s := range selected {
+		samples[i] = exprSample{name: s.base, labels: s.labels, value: s.value}
+	}
+	return vectorValue(samples), nil
+}
+func (n selectorNode) vector() bool { return true }
+func (n selectorNode) selectors(out []string) []string {
+	if n.pattern == "" {
+		return append(out, "*")
+	}
+	return append(out, n.pattern)
+}
+
+// matchesName сообщает, подходит ли ряд с именем full (base — без меток) под шаблон.
+func (n selectorNode) matchesName(full, base string) bool {
+	if n.pattern == "" {
+		return true
+	}
+	if ok, _ := path.Match(n.pattern, full); ok {
+		return true
+	}
+	ok, _ := path.Match(n.pattern, base)
+	return ok
+}
+
+func (n aggregateNode) eval(ctx *exprContext) (exprValue, error) {
+	v, err := n.x.eval(ctx)
+	if err != nil {
+		return exprValue{}, err
+	}
+	type group struct {
+		labels map[string]string
+		values []float64
+	}
+	groups := make(map[string]*group)
+	var order []string
+	if len(n.by) == 0 {
+		groups[""] = &group{}
+		order = append(order, "")
+	}
+	for _, s := range v.samples {
+		var labels map[string]string
+		if len(n.by) > 0 {
+			labels = make(map[string]string, len(n.by))
+			for _, l := range n.by {
+				if lv, ok := s.labels[l]; ok {
+					labels[l] = lv
+				}
+			}
+		}
+		key := models.FormatSeries("", labels)
+		g := groups[key]
+		if g == nil {
+			g = &group{labels: labels}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.values = append(g.values, s.value)
+	}
+
+	samples := make([]exprSample, 0, len(order))
+	for _, key := range order {
+		g := groups[key]
+		if len(g.values) == 0 && n.op != aggSum && n.op != aggCount {
+			continue // min, max и avg пустого набора не определены
+		}
+		samples = append(samples, exprSample{labels: g.labels, value: aggregate(n.op, g.values)})
+	}
+	return vectorValue(samples), nil
+}
+func (n aggregateNode) vector() bool                    { return true }
+func (n aggregateNode) selectors(out []string) []string { return n.x.selectors(out) }
+
+// aggregate вычисляет агрегат op над непустым (кроме sum и count) набором значений.
+func aggregate(op string, values []float64) float64 {
+	switch op {
+	case aggCount:
+		return float64(len(values))
+	case aggSum:
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	}
+	res := values[0]
+	for _, v := range values[1:] {
+		switch op {
+		case aggAvg:
+			res += v
+		case aggMin:
+			res = math.Min(res, v)
+		case aggMax:
+			res = math.Max(res, v)
+		}
+	}
+	if op == aggAvg {
+		res /= float64(len(values))
+	}
+	return res
+}
+
+func (n rangeNode) eval(ctx *exprContext) (exprValue, error) {
+	if n.fn == fnRate || n.fn == fnIncrease {
+		return ctx.counterRange(n)
+	}
+	return ctx.historyRange(n)
+}
+func (n rangeNode) vector() bool                    { return true }
+func (n rangeNode) selectors(out []string) []string { return n.sel.selectors(out) }
+
+func (n negNode) eval(ctx *exprContext) (exprValue, error) {
+	v, err := n.x.eval(ctx)
+	if err != nil || !v.vector {
+		return scalarValue(-v.scalar), err
+	}
+	samples := make([]exprSample, len(v.samples))
+	for i, s := range v.samples {
+		samples[i] = exprSample{labels: s.labels, value: -s.value}
+	}
+	return vectorValue(samples), nil
+}
+func (n negNode) vector() bool                    { return n.x.vector() }
+func (n negNode) selectors(out []string) []string { return n.x.selectors(out) }
+
+func (n binaryNode) eval(ctx *exprContext) (exprValue, error) {
+	l, err := n.lhs.eval(ctx)
+	if err != nil {
+		return exprValue{}, err
+	}
+	r, err := n.rhs.eval(ctx)
+	if err != nil {
+		return exprValue{}, err
+	}
+	switch {
+	case !l.vector && !r.vector:
+		if comparisons[n.op] {
+			if compare(n.op, l.scalar, r.scalar) {
+				return scalarValue(1), nil
+			}
+			return scalarValue(0), nil
+		}
+		v, err := arith(n.op, l.scalar, r.scalar)
+		return scalarValue(v), err
+	case l.vector && r.vector:
+		if one, ok := single(r); ok {
+			return vectorScalar(n.op, l.samples, one, false)
+		}
+		if one, ok := single(l); ok {
+			return vectorScalar(n.op, r.samples, one, true)
+		}
+		return vectorVector(n.op, l.samples, r.samples)
+	case l.vector:
+		return vectorScalar(n.op, l.samples, r.scalar, false)
+	default:
+		return vectorScalar(n.op, r.samples, l.scalar, true)
+	}
+}
+func (n binaryNode) vector() bool { return n.lhs.vector() || n.rhs.vector() }
+func (n binaryNode) selectors(out []string) []string {
+	return n.rhs.selectors(n.lhs.selectors(out))
+}
+
+// single возвращает значение набора из одного ряда без меток: такой набор участвует
+// в операциях как число.
+func single(v exprValue) (float64, bool) {
+	if len(v.samples) == 1 && len(v.samples[0].labels) == 0 {
+		return v.samples[0].value, true
+	}
+	return 0, false
+}
+
+func arith(op string, a, b float64) (float64, error) {
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	default:
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return a / b, nil
+	}
+}
+
+func compare(op string, a, b float64) bool {
+	switch op {
+	case ">":
+		return a > b
+	case "<":
+		return a < b
+	case ">=":
+		return a >= b
+	case "<=":
+		return a <= b
+	case "==":
+		return a == b
+	default:
+		return a != b
+	}
+}
+
+// vectorScalar применяет op к каждому ряду и числу s (s — левый операнд, если scalarLeft).
+func vectorScalar(op string, samples []exprSample, s float64, scalarLeft bool) (exprValue, error) {
+	res := make([]exprSample, 0, len(samples))
+	for _, x := range samples {
+		a, b := x.value, s
+		if scalarLeft {
+			a, b = s, x.value
+		}
+		if comparisons[op] {
+			if compare(op, a, b) {
+				res = append(res, x)
+			}
+			continue
+		}
+		v, err := arith(op, a, b)
+		if err != nil {
+			return exprValue{}, err
+		}
+		res = append(res, exprSample{labels: x.labels, value: v})
+	}
+	return vectorValue(res), nil
+}
+
+// vectorVector применяет op к парам рядов с одинаковыми метками; ряды без пары отбрасываются.
+func vectorVector(op string, lhs, rhs []exprSample) (exprValue, error) {
+	right := make(map[string]float64, len(rhs))
+	for _, x := range rhs {
+		key := models.FormatSeries("", x.labels)
+		if _, dup := right[key]; dup {
+			return exprValue{}, fmt.Errorf("several series with labels %s on the right side of %s", labelsText(key), op)
+		}
+		right[key] = x.value
+	}
+	seen := make(map[string]bool, len(lhs))
+	res := make([]exprSample, 0, len(lhs))
+	for _, x := range lhs {
+		key := models.FormatSeries("", x.labels)
+		if seen[key] {
+			return exprValue{}, fmt.Errorf("several series with labels %s on the left side of %s", labelsText(key), op)
+		}
+		seen[key] = true
+		b, ok := right[key]
+		if !ok {
+			continue
+		}
+		if comparisons[op] {
+			if compare(op, x.value, b) {
+				res = append(res, x)
+			}
+			continue
+		}
+		v, err := arith(op, x.value, b)
+		if err != nil {
+			return exprValue{}, err
+		}
+		res = append(res, exprSample{labels: x.labels, value: v})
+	}
+	return vectorValue(res), nil
+}
+
+func labelsText(key string) string {
+	if key == "" {
+		return "{}"
+	}
+	return key
+}
+
+// eval вычисляет выражение над ctx и приводит результат к одному числу: набор должен
+// состоять ровно из одного ряда. Результат всегда конечен: деление на ноль и переполнение — ошибки.
+func (e *Expr) eval(ctx *exprContext) (float64, error) {
+	res, err := e.root.eval(ctx)
+	if err != nil {
+		return 0, err
+	}
+	v := res.scalar
+	if res.vector {
+		switch len(res.samples) {
+		case 0:
+			return 0, errors.New("no metrics match")
+		case 1:
+			v = res.samples[0].value
+		default:
+			return 0, fmt.Errorf("expression returns %d series, expected one (aggregate them with sum, avg, min, max or count)", len(res.samples))
+		}
+	}
+	if err := finite(v); err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+func finite(v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("result is not a finite number: %v", v)
+	}
+	return nil
+}
+
+// Selectors возвращает шаблоны имён метрик, от которых зависит выражение.
+func (e *Expr) Selectors() []string {
+	return e.root.selectors(nil)
+}
+
+// Лексемы выражения.
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokName
+	tokString
+	tokRange
+	tokOp
+	tokLParen
+	tokRParen
+	tokLBrace
+	tokRBrace
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// isNameChar сообщает, может ли r входить в имя или шаблон без кавычек
+// (вне класса символов [...]).
+func isNameChar(r byte) bool {
+	return r == '_' || r == '.' || r == ':' || r == '*' || r == '?' ||
+		r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+// rangeAt разбирает окно "[5m]", начинающееся в src[i], и возвращает его длину в тексте.
+func rangeAt(src string, i int) (int, bool) {
+	end := strings.IndexByte(src[i:], ']')
+	if end < 2 || src[i+1] < '0' || src[i+1] > '9' {
+		return 0, false
+	}
+	if _, err := time.ParseDuration(src[i+1 : i+end]); err != nil {
+		return 0, false
+	}
+	return end + 1, true
+}
+
+// scanName возвращает конец имени или шаблона, начинающегося в src[i]. Класс символов
+// шаблона [...] входит в имя, окно [5m] после имени — нет.
+func scanName(src string, i int) (int, error) {
+	j := i
+	for j < len(src) {
+		switch c := src[j]; {
+		case c == '[':
+			if _, ok := rangeAt(src, j); ok && j > i {
+				return j, nil
+			}
+			k := j + 1
+			if k < len(src) && (src[k] == '!' || src[k] == '^') {
+				k++
+			}
+			if k < len(src) && src[k] == ']' {
+				k++
+			}
+			for k < len(src) && src[k] != ']' {
+				k++
+			}
+			if k >= len(src) {
+				return 0, syntaxError(j, "unterminated '[' in pattern")
+			}
+			j = k + 1
+		case isNameChar(c):
+			j++
+		default:
+			return j, nil
+		}
+	}
+	return j, nil
+}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.IndexByte("(){},", c) >= 0:
+			kind := map[byte]tokenKind{'(': tokLParen, ')': tokRParen, '{': tokLBrace, '}': tokRBrace, ',': tokComma}[c]
+			tokens = append(tokens, token{kind, string(c), i})
+			i++
+		case i+1 < len(src) && (comparisons[src[i:i+2]] || matchOps[src[i:i+2]]):
+			tokens = append(tokens, token{tokOp, src[i : i+2], i})
+			i += 2
+		case c == '>' || c == '<' || c == '=':
+			tokens = append(tokens, token{tokOp, string(c), i})
+			i++
+		case strings.IndexByte("+-*/", c) >= 0 && !(c == '*' && startsName(tokens)):
+			tokens = append(tokens, token{tokOp, string(c), i})
+			i++
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.' || src[j] == 'e' || src[j] == 'E' ||
+				(src[j] == '+' || src[j] == '-') && (src[j-1] == 'e' || src[j-1] == 'E')) {
+				j++
+			}
+			if j < len(src) && (src[j] == '_' || unicode.IsLetter(rune(src[j]))) {
+				return nil, syntaxError(j, "unexpected %q after number", src[j])
+			}
+			tokens = append(tokens, token{tokNumber, src[i:j], i})
+			i = j
+		case c == '"':
+			quoted, err := strconv.QuotedPrefix(src[i:])
+			if err != nil {
+				return nil, syntaxError(i, "unterminated or invalid string")
+			}
+			value, _ := strconv.Unquote(quoted)
+			tokens = append(tokens, token{tokString, value, i})
+			i += len(quoted)
+		case c == '`':
+			j := strings.IndexByte(src[i+1:], '`')
+			if j < 0 {
+				return nil, syntaxError(i, "unterminated quoted name")
+			}
+			if j == 0 {
+				return nil, syntaxError(i, "empty quoted name")
+			}
+			tokens = append(tokens, token{tokName, src[i+1 : i+1+j], i})
+			i += j + 2
+		case c == '[':
+			if n, ok := rangeAt(src, i); ok && !startsName(tokens) {
+				tokens = append(tokens, token{tokRange, src[i+1 : i+n-1], i})
+				i += n
+				continue
+			}
+			fallthrough
+		case isNameChar(c):
+			j, err := scanName(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokName, src[i:j], i})
+			i = j
+		default:
+			r := []rune(src[i:])[0]
+			if unicode.IsPrint(r) {
+				return nil, syntaxError(i, "unexpected character %q", r)
+			}
+			return nil, syntaxError(i, "unexpected character %U", r)
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(src)}), nil
+}
+
+// startsName сообщает, что '*' или '[' после tokens начинает шаблон, а не умножение
+// или окно: они возможны только после операнда.
+func startsName(tokens []token) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	switch tokens[len(tokens)-1].kind {
+	case tokNumber, tokName, tokRParen, tokRBrace, tokRange:
+		return false
+	default:
+		return true
+	}
+}
+
+// syntaxError — ошибка разбора с позицией (с 1) в тексте выражения.
+func syntaxError(pos int, format string, args ...any) error {
+	return ErrInvalidExpression.With(fmt.Errorf("at position %d: %s", pos+1, fmt.Sprintf(format, args...)))
+}
+
+// parser — разбор методом рекурсивного спуска:
+//
+//	expr      = sum { cmpop sum }
+//	sum       = term { ("+" | "-") term }
+//	term      = unary { ("*" | "/") unary }
+//	unary     = "-" unary | primary
+//	primary   = number | selector | aggregate | rangefunc "(" selector range ")" | "(" expr ")"
+//	aggregate = aggop [ by ] "(" expr ")" [ by ]
+//	by        = "by" "(" [ label { "," label } ] ")"
+//	selector  = name [ matchers ] | matchers
+//	matchers  = "{" [ label matchop string { "," label matchop string } ] "}"
+type parser struct {
+	tokens []token
+	pos    int
+	// aggregated — глубина вложенности в агрегаты: шаблоны имён допустимы только внутри них.
+	aggregated int
+}
+
+// ParseExpr разбирает выражение. Ошибки относятся к ErrInvalidExpression и указывают
+// позицию в тексте.
+func ParseExpr(src string) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, syntaxError(0, "empty expression")
+	}
+	root, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, unexpected(t)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// unexpected — ошибка для лексемы t, которой не может быть в этом месте.
+func unexpected(t token) error {
+	if t.kind == tokOp && t.text == "=" {
+		return syntaxError(t.pos, "unexpected '=': use == to compare")
+	}
+	return syntaxError(t.pos, "unexpected %q", t.text)
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// binary разбирает цепочку операндов operand с левоассоциативными операциями из ops.
+func (p *parser) binary(operand func() (exprNode, error), ops map[string]bool) (exprNode, error) {
+	lhs, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == tokOp && ops[t.text]; t = p.peek() {
+		p.next()
+		rhs, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		lhs = binaryNode{op: t.text, lhs: lhs, rhs: rhs}
+	}
+	return lhs, nil
+}
+
+var (
+	sumOps  = map[string]bool{"+": true, "-": true}
+	termOps = map[string]bool{"*": true, "/": true}
+)
+
+func (p *parser) expr() (exprNode, error) {
+	return p.binary(p.sum, comparisons)
+}
+
+func (p *parser) sum() (exprNode, error) {
+	return p.binary(p.term, sumOps)
+}
+
+func (p *parser) term() (exprNode, error) {
+	return p.binary(p.unary, termOps)
+}
+
+func (p *parser) unary() (exprNode, error) {
+	if t := p.peek(); t.kind == tokOp && t.text == "-" {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negNode{x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (exprNode, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokNumber:
+		p.next()
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, syntaxError(t.pos, "invalid number %q", t.text)
+		}
+		return numberNode(v), nil
+	case tokLParen:
+		p.next()
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokRParen {
+			return nil, syntaxError(c.pos, "expected ')' to close '(' at position %d", t.pos+1)
+		}
+		return x, nil
+	case tokName:
+		if after := p.tokens[p.pos+1]; after.kind == tokLParen || aggregates[strings.ToLower(t.text)] && after.kind == tokName && after.text == "by" {
+			p.next()
+			return p.call(t)
+		}
+		fallthrough
+	case tokLBrace:
+		sel, err := p.selector()
+		if err != nil {
+			return nil, err
+		}
+		if r := p.peek(); r.kind == tokRange {
+			return nil, syntaxError(r.pos, "range [%s] is allowed only as an argument of rate, increase, delta or *_over_time", r.text)
+		}
+		return sel, nil
+	case tokEOF:
+		return nil, syntaxError(t.pos, "unexpected end of expression")
+	default:
+		return nil, unexpected(t)
+	}
+}
+
+func (p *parser) selector() (selectorNode, error) {
+	var sel selectorNode
+	if t := p.peek(); t.kind == tokName {
+		p.next()
+		if _, err := path.Match(t.text, ""); err != nil {
+			return sel, syntaxError(t.pos, "invalid pattern %q", t.text)
+		}
+		if p.aggregated == 0 && strings.ContainsAny(t.text, "*?[") {
+			hint := ""
+			if strings.Contains(t.text, "*") {
+				hint = " (put spaces around * to multiply)"
+			}
+			return sel, syntaxError(t.pos, "pattern %q must be aggregated with sum, avg, min, max or count%s", t.text, hint)
+		}
+		sel.pattern = t.text
+	}
+	if p.peek().kind != tokLBrace {
+		return sel, nil
+	}
+	p.next()
+	for {
+		t := p.next()
+		if t.kind == tokRBrace {
+			return sel, nil
+		}
+		if t.kind != tokName || !validQueryLabel(t.text) {
+			return sel, syntaxError(t.pos, "expected a label name, got %q", t.text)
+		}
+		op := p.next()
+		if op.kind != tokOp || !matchOps[op.text] {
+			return sel, syntaxError(op.pos, "expected =, !=, =~ or !~ after label %s", t.text)
+		}
+		v := p.next()
+		if v.kind != tokString {
+			return sel, syntaxError(v.pos, "label %s: expected a quoted value", t.text)
+		}
+		m := labelMatcher{label: t.text, op: op.text, value: v.text}
+		if op.text == "=~" || op.text == "!~" {
+			re, err := regexp.Compile("^(?:" + v.text + ")$")
+			if err != nil {
+				return sel, syntaxError(v.pos, "invalid regex %q: %v", v.text, err)
+			}
+			m.re = re
+		}
+		sel.matchers = append(sel.matchers, m)
+		switch sep := p.next(); sep.kind {
+		case tokComma:
+		case tokRBrace:
+			return sel, nil
+		default:
+			return sel, syntaxError(sep.pos, "expected ',' or '}' after label %s", t.text)
+		}
+	}
+}
+
+func validQueryLabel(s string) bool {
+	return s == LabelName || models.ValidLabelName(s)
+}
+
+// call разбирает вызов функции fn (имя уже прочитано).
+func (p *parser) call(fn token) (exprNode, error) {
+	name := strings.ToLower(fn.text)
+	switch {
+	case aggregates[name]:
+		return p.aggregate(fn, name)
+	case rangeFuncs[name]:
+		return p.rangeCall(fn, name)
+	default:
+		return nil, syntaxError(fn.pos, "unknown function %q: expected sum, avg, min, max, count, "+
+			"rate, increase, delta, avg_over_time, min_over_time, max_over_time or count_over_time", fn.text)
+	}
+}
+
+func (p *parser) aggregate(fn token, op string) (exprNode, error) {
+	var by []string
+	var err error
+	if t := p.peek(); t.kind == tokName && t.text == "by" {
+		if by, err = p.grouping(); err != nil {
+			return nil, err
+		}
+	}
+	open := p.next()
+	if open.kind != tokLParen {
+		return nil, syntaxError(open.pos, "expected '(' after %s", op)
+	}
+	argPos := p.peek().pos
+	p.aggregated++
+	x, err := p.expr()
+	p.aggregated--
+	if err != nil {
+		return nil, err
+	}
+	if !x.vector() {
+		return nil, syntaxError(argPos, "%s expects metrics, not a number", op)
+	}
+	if c := p.next(); c.kind != tokRParen {
+		return nil, syntaxError(c.pos, "expected ')' after %s argument", op)
+	}
+	if t := p.peek(); t.kind == tokName && t.text == "by" {
+		if by != nil {
+			return nil, syntaxError(t.pos, "%s already has a by clause", op)
+		}
+		if by, err = p.grouping(); err != nil {
+			return nil, err
+		}
+	}
+	return aggregateNode{op: op, by: by, x: x}, nil
+}
+
+// grouping разбирает "by (label, ...)".
+func (p *parser) grouping() ([]string, error) {
+	p.next() // by
+	if t := p.next(); t.kind != tokLParen {
+		return nil, syntaxError(t.pos, "expected '(' after by")
+	}
+	by := []string{}
+	for {
+		t := p.next()
+		if t.kind == tokRParen {
+			return by, nil
+		}
+		if t.kind != tokName || !models.ValidLabelName(t.text) {
+			return nil, syntaxError(t.pos, "expected a label name in by, got %q", t.text)
+		}
+		by = append(by, t.text)
+		switch sep := p.next(); sep.kind {
+		case tokComma:
+		case tokRParen:
+			return by, nil
+		default:
+			return nil, syntaxError(sep.pos, "expected ',' or ')' in by")
+		}
+	}
+}
+
+func (p *parser) rangeCall(fn token, name string) (exprNode, error) {
+	p.next() // "("
+	arg := p.peek()
+	if arg.kind != tokName && arg.kind != tokLBrace {
+		return nil, syntaxError(arg.pos, "%s expects a selector with a range, e.g. %s(requests[5m])", name, name)
+	}
+	sel, err := p.selector()
+	if err != nil {
+		return nil, err
+	}
+	r := p.next()
+	if r.kind != tokRange {
+		return nil, syntaxError(r.pos, "%s expects a range after the selector, e.g. [5m]", name)
+	}
+	window, _ := time.ParseDuration(r.text)
+	if window <= 0 {
+		return nil, syntaxError(r.pos, "range must be positive")
+	}
+	if c := p.next(); c.kind != tokRParen {
+		return nil, syntaxError(c.pos, "expected ')' after %s argument", name)
+	}
+	return rangeNode{fn: name, sel: sel, window: window}, nil
+}
+
+// metricValues — снимок значений gauge и counter для вычисления выражений.
+type metricValues struct {
+	gauges   map[string]float64
+	counters map[string]float64
+}
+
+// currentValues читает текущие значения gauge и counter из хранилища.
+func (ms *MetricsService) currentValues() *metricValues {
+	gauges := ms.Storage.GetAllGauges()
+	counters := ms.Storage.GetAllCounters()
+	v := &metricValues{
+		gauges:   make(map[string]float64, len(gauges)),
+		counters: make(map[string]float64, len(counters)),
+	}
+	for name, raw := range gauges {
+		if f, err := strconv.ParseFloat(raw, 64); err == nil {
+			v.gauges[name] = f
+		}
+	}
+	for name, c := range counters {
+		v.counters[name] = float64(c)
+	}
+	return v
+}
+
+// exprContext — данные, над которыми вычисляется выражение.
+type exprContext struct {
+	values  *metricValues
+	history *History
+	rates   *CounterRates
+	now     time.Time
+	// allow — фильтр имён рядов, доступных выражению (nil — все ряды).
+	allow func(name string) bool
+}
+
+func (ms *MetricsService) exprContext() *exprContext {
+	return &exprContext{values: ms.currentValues(), history: ms.History, rates: ms.Rates, now: time.Now()}
+}
+
+// selectedSeries — ряд, выбранный селектором.
+type selectedSeries struct {
+	mtype, name, base string
+	labels            map[string]string
+	value             float64
+}
+
+// selectSeries возвращает ряды типов types, подходящие под селектор и фильтр ctx.allow.
+// Counter с именем выбранного gauge пропускается.
+func (ctx *exprContext) selectSeries(sel selectorNode, types ...string) []selectedSeries {
+	var res []selectedSeries
+	for _, mtype := range types {
+		values := ctx.values.gauges
+		if mtype == CounterMetric {
+			values = ctx.values.counters
+		}
+		for name, v := range values {
+			if ctx.allow != nil && !ctx.allow(name) {
+				continue
+			}
+			if mtype == CounterMetric && len(types) > 1 {
+				if _, shadowed := ctx.values.gauges[name]; shadowed {
+					continue
+				}
+			}
+			base, labels, err := models.ParseSeries(name)
+			if err != nil {
+				base, labels = name, nil
+			}
+			if !sel.matchesName(name, base) || !matchLabels(sel.matchers, base, labels) {
+				continue
+			}
+			res = append(res, selectedSeries{mtype: mtype, name: name, base: base, labels: labels, value: v})
+		}
+	}
+	return res
+}
+
+func matchLabels(matchers []labelMatcher, base string, labels map[string]string) bool {
+	for _, m := range matchers {
+		v := labels[m.label]
+		if m.label == LabelName {
+			v = base
+		}
+		if !m.matches(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// counterRange вычисляет rate или increase по наблюдениям counter.
+func (ctx *exprContext) counterRange(n rangeNode) (exprValue, error) {
+	if ctx.rates == nil {
+		return exprValue{}, ErrRatesDisabled
+	}
+	if n.window > ctx.rates.Window() {
+		return exprValue{}, ErrInvalidQuery.With(fmt.Errorf("%s: range %s exceeds the tracked %s", n.fn, n.window, ctx.rates.Window()))
+	}
+	samples := []exprSample{}
+	for _, s := range ctx.selectSeries(n.sel, CounterMetric) {
+		res, ok, err := ctx.rates.Rate(s.name, n.window, ctx.now)
+		if !ok || errors.Is(err, ErrInsufficientData) {
+			continue
+		}
+		if err != nil {
+			return exprValue{}, err
+		}
+		v := res.Rate
+		if n.fn == fnIncrease {
+			v = res.Increase
+		}
+		samples = append(samples, exprSample{labels: s.labels, value: v})
+	}
+	return vectorValue(samples), nil
+}
+
+// historyRange вычисляет delta или *_over_time по истории gauge и counter.
+func (ctx *exprContext) historyRange(n rangeNode) (exprValue, error) {
+	if ctx.history == nil {
+		return exprValue{}, ErrHistoryDisabled
+	}
+	since := ctx.now.Add(-n.window)
+	samples := []exprSample{}
+	for _, s := range ctx.selectSeries(n.sel, GaugeMetric, CounterMetric) {
+		points, _ := ctx.history.Samples(s.mtype, s.name, since)
+		if len(points) == 0 || n.fn == fnDelta && len(points) < 2 {
+			continue
+		}
+		var v float64
+		switch n.fn {
+		case fnDelta:
+			v = points[len(points)-1].Value - points[0].Value
+		case fnCntOverTime:
+			v = float64(len(points))
+		default:
+			values := make([]float64, len(points))
+			for i, pt := range points {
+				values[i] = pt.Value
+			}
+			v = aggregate(strings.TrimSuffix(n.fn, "_over_time"), values)
+		}
+		samples = append(samples, exprSample{labels: s.labels, value: v})
+	}
+	return vectorValue(samples), nil
+}
+
+// EvalExpr вычисляет выражение над текущими значениями метрик и приводит результат к числу.
+func (ms *MetricsService) EvalExpr(e *Expr) (float64, error) {
+	return e.eval(ms.exprContext())
+}
+
+// Типы результата запроса.
+const (
+	QueryScalar = "scalar"
+	QueryVector = "vector"
+)
+
+// QuerySample — ряд в результате запроса. Metric — имя ряда с метками; после арифметики
+// имя метрики отбрасывается и остаются только метки.
+type QuerySample struct {
+	Metric string            `json:"metric"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// QueryResult — результат запроса: число (Value) или набор рядов (Result).
+type QueryResult struct {
+	Expr   string        `json:"expr"`
+	Type   string        `json:"type"`
+	Value  *float64      `json:"value,omitempty"`
+	Result []QuerySample `json:"result"`
+}
+
+// Query разбирает и вычисляет выражение над текущими значениями метрик. Выражению доступны
+// только ряды, имена которых пропускает allow (например, по области действия токена; nil — все).
+// Ряды результата упорядочены по имени. Ошибки разбора относятся к ErrInvalidExpression,
+// ошибки вычисления без своей записи каталога (деление на ноль) — к ErrQueryFailed.
+func (ms *MetricsService) Query(src string, allow func(name string) bool) (QueryResult, error) {
+	e, err := ParseExpr(src)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	ctx := ms.exprContext()
+	ctx.allow = allow
+	return evalQuery(e, src, ctx)
+}
+
+// evalQuery вычисляет разобранное выражение e в контексте ctx.
+func evalQuery(e *Expr, src string, ctx *exprContext) (QueryResult, error) {
+	v, err := e.root.eval(ctx)
+	if err == nil && !v.vector {
+		err = finite(v.scalar)
+	}
+	for i := 0; err == nil && i < len(v.samples); i++ {
+		err = finite(v.samples[i].value)
+	}
+	if err != nil {
+		var known *Error
+		if errors.As(err, &known) {
+			return QueryResult{}, err
+		}
+		return QueryResult{}, ErrQueryFailed.With(err)
+	}
+
+	res := QueryResult{Expr: src, Type: QueryVector, Result: make([]QuerySample, 0, len(v.samples))}
+	if !v.vector {
+		res.Type, res.Value = QueryScalar, &v.scalar
+		return res, nil
+	}
+	for _, s := range v.samples {
+		sample := QuerySample{Metric: models.FormatSeries(s.name, s.labels), Value: s.value}
+		if len(s.labels) > 0 {
+			sample.Labels = s.labels
+		}
+		res.Result = append(res.Result, sample)
+	}
+	sort.Slice(res.Result, func(i, j int) bool { return res.Result[i].Metric < res.Result[j].Metric })
+	return res, nil
+}
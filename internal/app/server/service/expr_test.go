@@ -0,0 +1,200 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+)
+
+func TestParseExpr_Eval(t *testing.T) {
+	ms := &MetricsService{Storage: repository.NewMemStorage()}
+	for name, v := range map[string]string{"TotalMemory": "100", "FreeMemory": "40", "CPUutilization1": "10", "CPUutilization2": "30", "disk-usage": "0.5"} {
+		if err := ms.UpdateMetric(GaugeMetric, name, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ms.UpdateMetric(CounterMetric, "PollCount", "7"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]float64{
+		"TotalMemory - FreeMemory":                        60,
+		"sum(CPUutilization*)":                            40,
+		"avg(CPUutilization*) * 2":                        40,
+		"min(CPUutilization*) + max(CPUutilization*) / 2": 25,
+		"count(CPUutilization*) - count(Nothing*)":        2,
+		"-(TotalMemory - FreeMemory) / -2e1":              3,
+		"PollCount * 2":                                   14,
+		"2*PollCount":                                     14,
+		"`disk-usage` * 100":                              50,
+		"(1 + 2) * (3 - 1) / .5":                          12,
+		"sum(*Memory)":                                    140,
+	}
+	for src, want := range cases {
+		e, err := ParseExpr(src)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if got, err := ms.EvalExpr(e); err != nil || got != want {
+			t.Errorf("%s: want %v, got %v (%v)", src, want, got, err)
+		}
+	}
+
+	for _, src := range []string{"Missing + 1", "TotalMemory / (FreeMemory - 40)", "max(Nothing*)"} {
+		e, err := ParseExpr(src)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		if _, err := ms.EvalExpr(e); err == nil {
+			t.Errorf("%s: expected an evaluation error", src)
+		}
+	}
+}
+
+func TestParseExpr_SyntaxErrors(t *testing.T) {
+	cases := map[string]string{
+		"":                  "empty expression",
+		"1 +":               "at position 4: unexpected end of expression",
+		"(1 + 2":            "expected ')'",
+		"PollCount*2":       "put spaces around * to multiply",
+		"CPU*":              "must be aggregated",
+		"median(CPU*)":      `unknown function "median"`,
+		"sum(1)":            "sum expects metrics, not a number",
+		"CPU[5m]":           "range [5m] is allowed only as an argument",
+		"rate(CPU)":         "expects a range after the selector",
+		"rate(1)":           "expects a selector with a range",
+		"CPU{host=a}":       "label host: expected a quoted value",
+		"CPU{1=\"a\"}":      `expected a label name, got "1"`,
+		"CPU{host~\"a\"}":   "unexpected character '~'",
+		"CPU{host=~\"(\"}":  "invalid regex",
+		"CPU = 1":           "use == to compare",
+		"sum by host (CPU)": "expected '(' after by",
+		"CPU[ab":            "unterminated '['",
+		"TotalMemory % 2":   `at position 13: unexpected character '%'`,
+		"2x":                "after number",
+		"`unterminated":     "unterminated quoted name",
+		"TotalMemory Free":  `unexpected "Free"`,
+	}
+	for src, want := range cases {
+		_, err := ParseExpr(src)
+		if !errors.Is(err, ErrInvalidExpression) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestQuery_Vectors(t *testing.T) {
+	ms := &MetricsService{Storage: repository.NewMemStorage()}
+	for name, v := range map[string]string{
+		`cpu{host="web-1",dc="a"}`: "90",
+		`cpu{host="web-2",dc="a"}`: "70",
+		`cpu{host="db-1",dc="b"}`:  "85",
+		`mem{host="web-1",dc="a"}`: "0.5",
+		`mem{host="web-2",dc="a"}`: "0.25",
+		"TotalMemory":              "100",
+	} {
+		if err := ms.UpdateMetric(GaugeMetric, name, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vector := func(src string) map[string]float64 {
+		t.Helper()
+		res, err := ms.Query(src, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		if res.Type != QueryVector {
+			t.Fatalf("%s: expected a vector, got %+v", src, res)
+		}
+		got := make(map[string]float64, len(res.Result))
+		for _, s := range res.Result {
+			got[s.Metric] = s.Value
+		}
+		return got
+	}
+	equal := func(src string, want map[string]float64) {
+		t.Helper()
+		got := vector(src)
+		if len(got) != len(want) {
+			t.Fatalf("%s: want %v, got %v", src, want, got)
+		}
+		for k, v := range want {
+			if got[k] != v {
+				t.Fatalf("%s: want %v, got %v", src, want, got)
+			}
+		}
+	}
+
+	equal(`cpu{host=~"web-.*"} > 80`, map[string]float64{`cpu{dc="a",host="web-1"}`: 90})
+	equal(`max(cpu > 80)`, map[string]float64{"": 90})
+	equal(`max(cpu > 95)`, map[string]float64{})
+	equal(`count(cpu > 95)`, map[string]float64{"": 0})
+	equal(`sum by (dc) (cpu)`, map[string]float64{`{dc="a"}`: 160, `{dc="b"}`: 85})
+	equal(`avg(cpu) by (dc, missing)`, map[string]float64{`{dc="a"}`: 80, `{dc="b"}`: 85})
+	equal(`cpu * mem`, map[string]float64{`{dc="a",host="web-1"}`: 45, `{dc="a",host="web-2"}`: 17.5})
+	equal(`cpu{dc!="a"} / TotalMemory`, map[string]float64{`{dc="b",host="db-1"}`: 0.85})
+	equal(`{__name__="mem", host!~"web-1"}`, map[string]float64{`mem{dc="a",host="web-2"}`: 0.25})
+	equal(`sum by (host) (c[p]u{dc="b"})`, map[string]float64{`{host="db-1"}`: 85})
+
+	res, err := ms.Query("(TotalMemory > 50) + (2 < 1)", nil)
+	if err != nil || res.Type != QueryVector || len(res.Result) != 1 || res.Result[0].Value != 100 {
+		t.Fatalf("unexpected result %+v (%v)", res, err)
+	}
+	res, err = ms.Query("2 >= 1", nil)
+	if err != nil || res.Type != QueryScalar || *res.Value != 1 {
+		t.Fatalf("expected scalar 1, got %+v (%v)", res, err)
+	}
+
+	for src, want := range map[string]error{
+		"cpu / 0":                    ErrQueryFailed,
+		"cpu{dc=\"a\"} + {dc=\"a\"}": ErrQueryFailed, // несколько рядов с одинаковыми метками
+		"rate(cpu[1m])":              ErrRatesDisabled,
+		"avg_over_time(cpu[1m])":     ErrHistoryDisabled,
+		"cpu +":                      ErrInvalidExpression,
+	} {
+		if _, err := ms.Query(src, nil); !errors.Is(err, want) {
+			t.Errorf("%s: expected %v, got %v", src, want, err)
+		}
+	}
+}
+
+func TestQuery_RangeFunctions(t *testing.T) {
+	ms := &MetricsService{
+		Storage: repository.NewMemStorage(),
+		History: NewHistory(0, time.Nanosecond),
+		Rates:   NewCounterRates(time.Hour),
+	}
+	for _, v := range []string{"10", "30", "20"} {
+		if err := ms.UpdateMetric(GaugeMetric, `temp{room="a"}`, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, v := range []string{"5", "7"} {
+		if err := ms.UpdateMetric(CounterMetric, `requests{code="200"}`, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for src, want := range map[string]float64{
+		"max_over_time(temp[5m])":         30,
+		"min_over_time(temp[5m])":         10,
+		"avg_over_time(temp[5m])":         20,
+		"count_over_time(temp[5m])":       3,
+		"delta(temp[5m])":                 10,
+		"increase(requests[5m])":          12,
+		`sum(increase({code="200"}[1h]))`: 12,
+	} {
+		res, err := ms.Query(src, nil)
+		if err != nil || len(res.Result) != 1 || res.Result[0].Value != want {
+			t.Errorf("%s: want %v, got %+v (%v)", src, want, res, err)
+		}
+	}
+	if _, err := ms.Query("rate(requests[2h])", nil); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("expected ErrInvalidQuery for a range over the tracked window, got %v", err)
+	}
+}
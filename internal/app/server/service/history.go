@@ -0,0 +1,167 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+)
+
+// Параметры истории по умолчанию: 360 точек по 10 секунд — последний час.
+const (
+	DefaultHistorySize       = 360
+	DefaultHistoryResolution = 10 * time.Second
+)
+
+// Sample — значение метрики в момент времени.
+type Sample struct {
+	Time  time.Time `json:"t"`
+	Value float64   `json:"v"`
+}
+
+// History хранит в памяти последние значения gauge и counter для графиков.
+//
+// Для каждой метрики хранится не больше size точек; обновления внутри одного интервала
+// resolution схлопываются в одну точку с последним значением, поэтому частые отправки
+// не вытесняют историю. История не сохраняется между запусками сервера.
+type History struct {
+	size       int
+	resolution time.Duration
+
+	mu     sync.RWMutex
+	series map[historyKey]*historySeries
+}
+
+type historyKey struct{ mtype, name string }
+
+// historySeries — кольцевой буфер точек одной метрики. Буфер растёт по мере записи
+// и становится кольцом, только заполнившись до size точек: метрика, записанная
+// несколько раз, не занимает память под всю историю.
+type historySeries struct {
+	samples []Sample
+	head    int // индекс самой старой точки; до заполнения буфера — 0
+}
+
+// NewHistory создаёт историю на size точек с шагом resolution для каждой метрики
+// (0 — значения по умолчанию).
+func NewHistory(size int, resolution time.Duration) *History {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	if resolution <= 0 {
+		resolution = DefaultHistoryResolution
+	}
+	return &History{size: size, resolution: resolution, series: make(map[historyKey]*historySeries)}
+}
+
+// Resolution возвращает шаг истории.
+func (h *History) Resolution() time.Duration { return h.resolution }
+
+// Add добавляет значение метрики в момент t.
+func (h *History) Add(mtype, name string, t time.Time, v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := historyKey{mtype, name}
+	s := h.series[key]
+	if s == nil {
+		s = &historySeries{}
+		h.series[key] = s
+	}
+	n := len(s.samples)
+	if n > 0 {
+		last := &s.samples[(s.head+n-1)%n]
+		if !t.Before(last.Time) && t.Truncate(h.resolution).Equal(last.Time.Truncate(h.resolution)) {
+			last.Time, last.Value = t, v
+			return
+		}
+	}
+	if n < h.size {
+		if n == cap(s.samples) {
+			// Растим буфер сами: append мог бы выделить больше size точек.
+			grown := make([]Sample, n, min(max(2*n, 4), h.size))
+			copy(grown, s.samples)
+			s.samples = grown
+		}
+		s.samples = append(s.samples, Sample{Time: t, Value: v})
+		return
+	}
+	s.samples[s.head] = Sample{Time: t, Value: v}
+	s.head = (s.head + 1) % n
+}
+
+// Samples возвращает точки метрики не старше since в порядке времени; ok = false,
+// если истории метрики нет.
+func (h *History) Samples(mtype, name string, since time.Time) (samples []Sample, ok bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	s := h.series[historyKey{mtype, name}]
+	if s == nil {
+		return nil, false
+	}
+	n := len(s.samples)
+	samples = make([]Sample, 0, n)
+	for i := 0; i < n; i++ {
+		if sample := s.samples[(s.head+i)%n]; !sample.Time.Before(since) {
+			samples = append(samples, sample)
+		}
+	}
+	return samples, true
+}
+
+// Remove удаляет историю метрики.
+func (h *History) Remove(mtype, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.series, historyKey{mtype, name})
+}
+
+// Clear удаляет всю историю.
+func (h *History) Clear() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.series = make(map[historyKey]*historySeries)
+}
+
+// record переносит изменение метрики в историю. Составные метрики в истории не хранятся.
+func (h *History) record(kind string, m middleware.MetricsJSON, t time.Time) {
+	mtype := strings.ToLower(string(m.MType))
+	switch kind {
+	case EventReset:
+		h.Clear()
+	case EventDelete:
+		h.Remove(mtype, m.ID)
+	case EventUpdate:
+		switch {
+		case mtype == GaugeMetric && m.Value != nil:
+			h.Add(mtype, m.ID, t, *m.Value)
+		case mtype == CounterMetric && m.Delta != nil:
+			h.Add(mtype, m.ID, t, float64(*m.Delta))
+		}
+	}
+}
+
+// MetricHistory возвращает точки истории метрики за последние window (0 — вся история).
+// Для метрики без истории возвращается ErrMetricNotFound, если метрики нет и в хранилище.
+func (ms *MetricsService) MetricHistory(mtype, name string, window time.Duration) ([]Sample, error) {
+	if ms.History == nil {
+		return nil, ErrHistoryDisabled
+	}
+	mtype = strings.ToLower(mtype)
+	if mtype != GaugeMetric && mtype != CounterMetric {
+		return nil, ErrUnsupportedType.With(errors.New("history is kept only for gauge and counter metrics"))
+	}
+	var since time.Time
+	if window > 0 {
+		since = time.Now().Add(-window)
+	}
+	samples, ok := ms.History.Samples(mtype, name, since)
+	if !ok {
+		if _, err := ms.GetMetricValue(mtype, name); err != nil {
+			return nil, err
+		}
+		return []Sample{}, nil
+	}
+	return samples, nil
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+)
+
+func TestHistory_RingAndResolution(t *testing.T) {
+	h := NewHistory(3, 10*time.Second)
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	h.Add(GaugeMetric, "m", t0, 1)
+	h.Add(GaugeMetric, "m", t0.Add(5*time.Second), 2) // тот же интервал: заменяет точку
+	for i := 1; i <= 3; i++ {
+		h.Add(GaugeMetric, "m", t0.Add(time.Duration(i)*10*time.Second), float64(10+i))
+	}
+
+	samples, ok := h.Samples(GaugeMetric, "m", time.Time{})
+	if !ok || len(samples) != 3 {
+		t.Fatalf("expected 3 samples, got %+v", samples)
+	}
+	for i, want := range []float64{11, 12, 13} {
+		if samples[i].Value != want {
+			t.Fatalf("sample %d: expected %g, got %g", i, want, samples[i].Value)
+		}
+	}
+
+	samples, _ = h.Samples(GaugeMetric, "m", t0.Add(25*time.Second))
+	if len(samples) != 1 || samples[0].Value != 13 {
+		t.Fatalf("expected only the last sample, got %+v", samples)
+	}
+	if _, ok := h.Samples(CounterMetric, "m", time.Time{}); ok {
+		t.Fatal("history is kept per type")
+	}
+}
+
+func TestHistory_GrowsLazily(t *testing.T) {
+	h := NewHistory(DefaultHistorySize, time.Second)
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.Add(GaugeMetric, "once", t0, 1)
+	if c := cap(h.series[historyKey{GaugeMetric, "once"}].samples); c >= DefaultHistorySize {
+		t.Fatalf("a metric written once must not allocate the whole ring, got capacity %d", c)
+	}
+
+	h = NewHistory(5, time.Second)
+	for i := 0; i < 12; i++ {
+		h.Add(GaugeMetric, "m", t0.Add(time.Duration(i)*time.Second), float64(i))
+		if c := cap(h.series[historyKey{GaugeMetric, "m"}].samples); c > 5 {
+			t.Fatalf("the ring must not grow beyond its size, got capacity %d", c)
+		}
+	}
+	samples, _ := h.Samples(GaugeMetric, "m", time.Time{})
+	if len(samples) != 5 || samples[0].Value != 7 || samples[4].Value != 11 {
+		t.Fatalf("expected the last 5 samples in order, got %+v", samples)
+	}
+}
+
+func TestMetricsService_MetricHistory(t *testing.T) {
+	ms := &MetricsService{Storage: repository.NewMemStorage()}
+	if _, err := ms.MetricHistory(GaugeMetric, "Alloc", 0); !errors.Is(err, ErrHistoryDisabled) {
+		t.Fatalf("expected ErrHistoryDisabled, got %v", err)
+	}
+
+	ms.History = NewHistory(0, time.Nanosecond)
+	for _, v := range []string{"2", "3"} {
+		if err := ms.UpdateMetric(CounterMetric, "PollCount", v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	samples, err := ms.MetricHistory(CounterMetric, "PollCount", time.Minute)
+	if err != nil || len(samples) != 2 || samples[1].Value != 5 {
+		t.Fatalf("expected cumulative counter samples, got %+v (%v)", samples, err)
+	}
+
+	if err := ms.DeleteMetric(CounterMetric, "PollCount"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.MetricHistory(CounterMetric, "PollCount", 0); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatalf("history of a deleted metric must be dropped, got %v", err)
+	}
+	if _, err := ms.MetricHistory(HistogramMetric, "Latency", 0); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("expected ErrUnsupportedType for composites, got %v", err)
+	}
+}
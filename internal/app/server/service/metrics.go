@@ -3,29 +3,62 @@ package service
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
 	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
 )
 
 // Допустимые типы метрик в сервисном слое.
 const (
-	GaugeMetric   = "gauge"
-	CounterMetric = "counter"
+	GaugeMetric     = "gauge"
+	CounterMetric   = "counter"
+	HistogramMetric = models.HistogramType
+	SummaryMetric   = models.SummaryType
+	SketchMetric    = models.SketchType
+	SetMetric       = models.SetType
 )
 
 type MetricsService struct {
 	Storage repository.Storage
+	// HistogramBuckets — границы корзин для гистограмм, создаваемых из отдельных наблюдений
+	// (пусто — models.DefaultHistogramBuckets).
+	HistogramBuckets []float64
+	// SketchAccuracy — относительная точность скетчей, создаваемых из отдельных наблюдений
+	// (0 — ddsketch.DefaultRelativeAccuracy).
+	SketchAccuracy float64
+	// SketchMaxBins — ограничение числа корзин одного скетча (0 — ddsketch.DefaultMaxBins).
+	SketchMaxBins int
+	// SetPrecision — точность HyperLogLog для множеств, создаваемых из элементов (0 — hll.DefaultPrecision).
+	SetPrecision uint8
+	// Events получает события изменений метрик (nil — поток событий отключён).
+	Events *Broker
+	// History хранит последние значения gauge и counter (nil — история не ведётся).
+	History *History
+	// Rates хранит наблюдения counter для rate и increase (nil — не ведутся).
+	Rates *CounterRates
+	// MaxBatchSize ограничивает число элементов одного пакета (0 — без ограничения).
+	MaxBatchSize int
+	// Relabel переименовывает и отбрасывает метрики при записи (nil — метрики пишутся как есть).
+	Relabel *RelabelPipeline
+	// Cardinality ограничивает число рядов (nil — без ограничений).
+	Cardinality *CardinalityGuard
+
+	// client — клиент, за которым учитываются новые ряды (см. ForClient).
+	client string
 }
 
 // MetricsService реализует бизнес-логику обновления и чтения метрик.
 // UpdateMetric обрабатывает обновление одной метрики по типу и имени.
-// Для counter значения накапливаются, для gauge значение перезаписывается.
+// Для counter значения накапливаются, для gauge значение перезаписывается,
+// для histogram, summary и sketch значение считается одним наблюдением, для set — элементом множества.
 func (ms *MetricsService) UpdateMetric(metricType, metricName, metricValue string) error {
 	if metricName == "" {
-		return errors.New("metric name is required")
+		return ErrNameRequired
 	}
 	mt := strings.ToLower(metricType)
 
@@ -33,61 +66,115 @@ func (ms *MetricsService) UpdateMetric(metricType, metricName, metricValue strin
 	case GaugeMetric:
 		// Проверим, что metricValue действительно float
 		if _, err := strconv.ParseFloat(metricValue, 64); err != nil {
-			return fmt.Errorf("invalid gauge value: %w", err)
+			return invalidValue("invalid gauge value: %w", err)
+		}
+		metricName, ok, release, err := ms.ingest(mt, metricName)
+		if !ok {
+			return err
 		}
 		// Сохраняем как «сырую» строку (но позже будем возвращать в каноническом формате)
-		return ms.Storage.UpdateGaugeRaw(metricName, metricValue)
+		if err := ms.Storage.UpdateGaugeRaw(metricName, metricValue); err != nil {
+			release()
+			return storageErr(err)
+		}
+		ms.publishCurrent(mt, metricName)
+		return nil
 
 	case CounterMetric:
 		val, err := strconv.ParseInt(metricValue, 10, 64)
 		if err != nil {
-			return fmt.Errorf("invalid counter value: %w", err)
+			return invalidValue("invalid counter value: %w", err)
 		}
-		ms.Storage.UpdateCounter(metricName, repository.Counter(val))
+		metricName, ok, release, err := ms.ingest(mt, metricName)
+		if !ok {
+			return err
+		}
+		if err := ms.Storage.UpdateCounter(metricName, repository.Counter(val)); err != nil {
+			release()
+			return storageErr(err)
+		}
+		ms.publishCurrent(mt, metricName)
 		return nil
 
 	default:
-		return errors.New("unsupported metric type")
+		if !models.IsComposite(mt) {
+			return ErrUnsupportedType
+		}
+		return ms.observe(mt, metricName, metricValue)
 	}
 }
 
 // UpdateMetricsBatch обрабатывает пакетное обновление метрик.
 // Возвращает уже «актуальные» значения метрик после обновления.
+// Наблюдения histogram/summary, переданные в value, предварительно превращаются в агрегированные значения.
 func (ms *MetricsService) UpdateMetricsBatch(batch []middleware.MetricsJSON) ([]middleware.MetricsJSON, error) {
-	if err := ms.Storage.UpdateMetricsBatch(batch); err != nil {
+	if err := ms.CheckBatchSize(len(batch)); err != nil {
+		return nil, err
+	}
+	normalized := make([]middleware.MetricsJSON, len(batch))
+	copy(normalized, batch)
+	for i := range normalized {
+		mt := strings.ToLower(string(normalized[i].MType))
+		if !models.IsComposite(mt) {
+			continue
+		}
+		if err := ms.normalizeComposite(&normalized[i], mt); err != nil {
+			return nil, err
+		}
+	}
+	batch, release, err := ms.admitBatch(ms.relabelItems(normalized))
+	if err != nil {
 		return nil, err
 	}
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
+	if err := ms.Storage.UpdateMetricsBatch(batch); err != nil {
+		release()
+		return nil, storageErr(err)
+	}
 
 	// Формируем ответ с актуальными значениями.
 	var result []middleware.MetricsJSON
 	for _, m := range batch {
-		mt := strings.ToLower(string(m.MType))
-		switch mt {
-		case CounterMetric:
-			val, ok := ms.Storage.GetCounter(m.ID)
-			if ok {
-				delta := int64(val)
-				result = append(result, middleware.MetricsJSON{
-					ID:    m.ID,
-					MType: m.MType,
-					Delta: &delta,
-				})
-			}
-		case GaugeMetric:
-			raw, ok := ms.Storage.GetGaugeRaw(m.ID)
-			if ok {
-				fv, _ := strconv.ParseFloat(raw, 64) // не ожидается ошибка, т.к. ранее проверяли
-				result = append(result, middleware.MetricsJSON{
-					ID:    m.ID,
-					MType: m.MType,
-					Value: &fv,
-				})
-			}
+		if current, ok := ms.currentValue(m); ok {
+			result = append(result, current)
+			ms.publish(EventUpdate, current)
 		}
 	}
 	return result, nil
 }
 
+// currentValue возвращает сохранённое значение метрики m (после применения обновления).
+func (ms *MetricsService) currentValue(m middleware.MetricsJSON) (middleware.MetricsJSON, bool) {
+	mt := strings.ToLower(string(m.MType))
+	current := middleware.MetricsJSON{ID: m.ID, MType: m.MType}
+	switch mt {
+	case CounterMetric:
+		val, ok := ms.Storage.GetCounter(m.ID)
+		if !ok {
+			return current, false
+		}
+		delta := int64(val)
+		current.Delta = &delta
+	case GaugeMetric:
+		raw, ok := ms.Storage.GetGaugeRaw(m.ID)
+		if !ok {
+			return current, false
+		}
+		fv, _ := strconv.ParseFloat(raw, 64) // не ожидается ошибка, т.к. ранее проверяли
+		current.Value = &fv
+	default:
+		c, ok := ms.Storage.GetComposite(mt, m.ID)
+		if !ok {
+			return current, false
+		}
+		current.SetComposite(c)
+	}
+	return current, true
+}
+
 // GetMetricValue возвращает текущее значение одной метрики (в виде строки).
 // Для gauge мы теперь приводим число к каноническому формату через %g, чтобы убрать лишние ".0".
 func (ms *MetricsService) GetMetricValue(metricType, metricName string) (string, error) {
@@ -97,11 +184,11 @@ func (ms *MetricsService) GetMetricValue(metricType, metricName string) (string,
 	case GaugeMetric:
 		raw, ok := ms.Storage.GetGaugeRaw(metricName)
 		if !ok {
-			return "", errors.New("metric not found")
+			return "", ErrMetricNotFound
 		}
 		val, err := strconv.ParseFloat(raw, 64)
 		if err != nil {
-			return "", fmt.Errorf("invalid stored gauge value: %w", err)
+			return "", ErrStorage.With(fmt.Errorf("invalid stored gauge value: %w", err))
 		}
 		// Используем %g, чтобы "42.0" форматировать как "42".
 		return fmt.Sprintf("%g", val), nil
@@ -109,34 +196,179 @@ func (ms *MetricsService) GetMetricValue(metricType, metricName string) (string,
 	case CounterMetric:
 		value, ok := ms.Storage.GetCounter(metricName)
 		if !ok {
-			return "", errors.New("metric not found")
+			return "", ErrMetricNotFound
 		}
 		return strconv.FormatInt(int64(value), 10), nil
 
 	default:
-		return "", errors.New("unsupported metric type")
+		c, err := ms.GetComposite(mt, metricName)
+		if err != nil {
+			return "", err
+		}
+		return c.String(), nil
 	}
 }
 
 // GetAllMetrics возвращает все метрики в виде "имя -> строковое представление".
-// Для gauge аналогично используем канонический формат через %g, чтобы убрать ненужные ".0".
+// Для gauge аналогично используем канонический формат через %g, чтобы убрать ненужные ".0",
+// составные метрики выводятся кратко (count, sum, ...).
+// Если имя занято метриками нескольких типов (политика separate), ключи дополняются типом:
+// "Alloc [gauge]" и "Alloc [counter]", чтобы одно значение не затирало другое.
 func (ms *MetricsService) GetAllMetrics() map[string]string {
-	result := make(map[string]string)
+	type rendered struct {
+		mtype string
+		value string
+	}
+	byName := make(map[string][]rendered)
 
 	// Обрабатываем gauges
 	for name, raw := range ms.Storage.GetAllGauges() {
+		value := raw // если вдруг парсинг не удался, вернём как есть — но в норме такое не должно происходить
 		if val, err := strconv.ParseFloat(raw, 64); err == nil {
-			result[name] = fmt.Sprintf("%g", val)
-		} else {
-			// Если вдруг парсинг не удался, вернём как есть — но в норме такое не должно происходить
-			result[name] = raw
+			value = fmt.Sprintf("%g", val)
 		}
+		byName[name] = append(byName[name], rendered{GaugeMetric, value})
 	}
 
 	// Обрабатываем counters
 	for name, c := range ms.Storage.GetAllCounters() {
-		result[name] = strconv.FormatInt(int64(c), 10)
+		byName[name] = append(byName[name], rendered{CounterMetric, strconv.FormatInt(int64(c), 10)})
+	}
+
+	// Обрабатываем составные метрики
+	for _, mtype := range models.CompositeTypes() {
+		for name, c := range ms.Storage.GetAllComposites(mtype) {
+			byName[name] = append(byName[name], rendered{mtype, c.String()})
+		}
 	}
 
+	result := make(map[string]string)
+	for name, values := range byName {
+		if len(values) == 1 {
+			result[name] = values[0].value
+			continue
+		}
+		for _, v := range values {
+			result[name+" ["+v.mtype+"]"] = v.value
+		}
+	}
 	return result
 }
+
+// Snapshot возвращает полный снимок состояния хранилища в формате models.MetricsData.
+func (ms *MetricsService) Snapshot() models.MetricsData {
+	data := models.NewMetricsData()
+	data.GaugesUpdatedAt = make(map[string]time.Time)
+	data.CountersUpdatedAt = make(map[string]time.Time)
+	for name, raw := range ms.Storage.GetAllGauges() {
+		data.Gauges[name] = raw
+	}
+	for name, c := range ms.Storage.GetAllCounters() {
+		data.Counters[name] = int64(c)
+	}
+	for _, mtype := range models.CompositeTypes() {
+		for name, c := range ms.Storage.GetAllComposites(mtype) {
+			// Значения из хранилища уже проверены и сериализуемы.
+			_ = data.SetComposite(name, c, time.Time{})
+		}
+	}
+	for _, info := range ms.Storage.ListMetricInfo() {
+		switch info.Type {
+		case GaugeMetric:
+			if _, ok := data.Gauges[info.Name]; ok {
+				data.GaugesUpdatedAt[info.Name] = info.UpdatedAt
+			}
+		case CounterMetric:
+			if _, ok := data.Counters[info.Name]; ok {
+				data.CountersUpdatedAt[info.Name] = info.UpdatedAt
+			}
+		default:
+			if _, ok := data.Composites[info.Type][info.Name]; ok {
+				if data.CompositesUpdatedAt[info.Type] == nil {
+					data.CompositesUpdatedAt[info.Type] = make(map[string]time.Time)
+				}
+				data.CompositesUpdatedAt[info.Type][info.Name] = info.UpdatedAt
+			}
+		}
+	}
+	return data
+}
+
+// RestoreSnapshot записывает снимок в хранилище.
+// В режиме merge метрики из снимка перезаписывают одноимённые, остальные сохраняются;
+// в режиме replace состояние хранилища полностью заменяется снимком.
+func (ms *MetricsService) RestoreSnapshot(data models.MetricsData, replace bool) error {
+	for name := range data.Gauges {
+		if name == "" {
+			return ErrNameRequired
+		}
+	}
+	for name := range data.Counters {
+		if name == "" {
+			return ErrNameRequired
+		}
+	}
+	for _, values := range data.Composites {
+		if _, ok := values[""]; ok {
+			return ErrNameRequired
+		}
+	}
+	if err := ms.Storage.Restore(data, replace); err != nil {
+		// Ошибки восстановления, кроме конфликта типов, вызваны содержимым снимка.
+		if errors.Is(err, models.ErrTypeConflict) {
+			return ErrTypeConflict.With(err)
+		}
+		return ErrInvalidSnapshot.With(err)
+	}
+	ms.publish(EventReset, middleware.MetricsJSON{})
+	return nil
+}
+
+// ListMetrics возвращает все метрики с типизированными значениями и временем
+// последнего обновления, отсортированные по типу и имени.
+func (ms *MetricsService) ListMetrics() []models.MetricEntry {
+	gauges := ms.Storage.GetAllGauges()
+	counters := ms.Storage.GetAllCounters()
+	composites := make(map[string]map[string]models.Composite)
+	for _, mtype := range models.CompositeTypes() {
+		composites[mtype] = ms.Storage.GetAllComposites(mtype)
+	}
+
+	entries := make([]models.MetricEntry, 0, len(gauges)+len(counters))
+	for _, info := range ms.Storage.ListMetricInfo() {
+		entry := models.MetricEntry{ID: info.Name, MType: info.Type, UpdatedAt: info.UpdatedAt}
+		switch info.Type {
+		case GaugeMetric:
+			raw, ok := gauges[info.Name]
+			if !ok {
+				continue
+			}
+			val, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				continue
+			}
+			entry.Value = &val
+		case CounterMetric:
+			c, ok := counters[info.Name]
+			if !ok {
+				continue
+			}
+			delta := int64(c)
+			entry.Delta = &delta
+		default:
+			c, ok := composites[info.Type][info.Name]
+			if !ok {
+				continue
+			}
+			entry.SetComposite(c)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].MType != entries[j].MType {
+			return entries[i].MType < entries[j].MType
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
+
+// Поля сортировки списка метрик.
+const (
+	SortByType    = "type"
+	SortByName    = "name"
+	SortByUpdated = "updated"
+)
+
+// ListOptions задаёт фильтрацию, сортировку и постраничный вывод списка метрик.
+type ListOptions struct {
+	// Types — допустимые типы метрик (пусто — все типы).
+	Types []string
+	// Name — шаблон имени (синтаксис path.Match), NameRegex — регулярное выражение для имени.
+	Name      string
+	NameRegex string
+	// Sort — поле сортировки (type, name, updated); префикс "-" задаёт обратный порядок.
+	// Пусто — по типу и имени.
+	Sort string
+	// Limit — размер страницы (0 — без ограничения).
+	Limit int
+	// Cursor — значение NextCursor предыдущей страницы.
+	Cursor string
+	// Allow — дополнительный фильтр имён, например по области действия токена (nil — все имена).
+	Allow func(name string) bool
+}
+
+// MetricsPage — страница списка метрик. NextCursor пуст на последней странице.
+type MetricsPage struct {
+	Items      []models.MetricEntry
+	NextCursor string
+}
+
+// listCursor — позиция последней выданной метрики. Курсор указывает на ключ, а не на номер
+// строки, поэтому добавление и удаление метрик между запросами не сдвигает страницы.
+type listCursor struct {
+	Sort      string    `json:"s"`
+	Type      string    `json:"t"`
+	ID        string    `json:"i"`
+	UpdatedAt time.Time `json:"u"`
+}
+
+// QueryMetrics возвращает отфильтрованную и отсортированную страницу списка метрик.
+func (ms *MetricsService) QueryMetrics(opts ListOptions) (MetricsPage, error) {
+	match, err := nameMatcher(opts.Name, opts.NameRegex)
+	if err != nil {
+		return MetricsPage{}, err
+	}
+	types := make(map[string]bool, len(opts.Types))
+	for _, t := range opts.Types {
+		t = strings.ToLower(t)
+		if t != GaugeMetric && t != CounterMetric && !models.IsComposite(t) {
+			return MetricsPage{}, fmt.Errorf("%w: unsupported type %q", ErrInvalidQuery, t)
+		}
+		types[t] = true
+	}
+	less, err := entryOrder(opts.Sort)
+	if err != nil {
+		return MetricsPage{}, err
+	}
+	if opts.Limit < 0 {
+		return MetricsPage{}, fmt.Errorf("%w: limit must not be negative", ErrInvalidQuery)
+	}
+
+	var entries []models.MetricEntry
+	for _, e := range ms.ListMetrics() {
+		if len(types) > 0 && !types[e.MType] {
+			continue
+		}
+		if !match(e.ID) || (opts.Allow != nil && !opts.Allow(e.ID)) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return less(entries[i], entries[j]) })
+
+	if opts.Cursor != "" {
+		cur, err := decodeCursor(opts.Cursor, opts.Sort)
+		if err != nil {
+			return MetricsPage{}, err
+		}
+		last := models.MetricEntry{ID: cur.ID, MType: cur.Type, UpdatedAt: cur.UpdatedAt}
+		start := sort.Search(len(entries), func(i int) bool { return less(last, entries[i]) })
+		entries = entries[start:]
+	}
+
+	page := MetricsPage{Items: entries}
+	if opts.Limit > 0 && len(entries) > opts.Limit {
+		page.Items = entries[:opts.Limit]
+		page.NextCursor = encodeCursor(opts.Sort, page.Items[opts.Limit-1])
+	}
+	if page.Items == nil {
+		page.Items = []models.MetricEntry{}
+	}
+	return page, nil
+}
+
+// nameMatcher собирает фильтр по имени из glob-шаблона и регулярного выражения (оба необязательны).
+func nameMatcher(glob, expr string) (func(string) bool, error) {
+	if glob != "" {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("%w: invalid name pattern %q: %v", ErrInvalidQuery, glob, err)
+		}
+	}
+	var re *regexp.Regexp
+	if expr != "" {
+		var err error
+		if re, err = regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("%w: invalid name regex: %v", ErrInvalidQuery, err)
+		}
+	}
+	return func(name string) bool {
+		if glob != "" {
+			if ok, _ := path.Match(glob, name); !ok {
+				return false
+			}
+		}
+		return re == nil || re.MatchString(name)
+	}, nil
+}
+
+// entryOrder возвращает строгий порядок списка для поля сортировки.
+// Пара (тип, имя) уникальна, поэтому порядок полный и курсор однозначен.
+func entryOrder(field string) (func(a, b models.MetricEntry) bool, error) {
+	desc := strings.HasPrefix(field, "-")
+	field = strings.TrimPrefix(field, "-")
+
+	byTypeName := func(a, b models.MetricEntry) bool {
+		if a.MType != b.MType {
+			return a.MType < b.MType
+		}
+		return a.ID < b.ID
+	}
+	var less func(a, b models.MetricEntry) bool
+	switch field {
+	case "", SortByType:
+		less = byTypeName
+	case SortByName:
+		less = func(a, b models.MetricEntry) bool {
+			if a.ID != b.ID {
+				return a.ID < b.ID
+			}
+			return a.MType < b.MType
+		}
+	case SortByUpdated:
+		less = func(a, b models.MetricEntry) bool {
+			if !a.UpdatedAt.Equal(b.UpdatedAt) {
+				return a.UpdatedAt.Before(b.UpdatedAt)
+			}
+			return byTypeName(a, b)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported sort field %q", ErrInvalidQuery, field)
+	}
+	if desc {
+		return func(a, b models.MetricEntry) bool { return less(b, a) }, nil
+	}
+	return less, nil
+}
+
+// encodeCursor кодирует позицию последней метрики страницы.
+func encodeCursor(sortField string, last models.MetricEntry) string {
+	raw, _ := json.Marshal(listCursor{Sort: sortField, Type: last.MType, ID: last.ID, UpdatedAt: last.UpdatedAt})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCursor разбирает курсор; курсор другой сортировки отклоняется.
+func decodeCursor(s, sortField string) (listCursor, error) {
+	var cur listCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(raw, &cur)
+	}
+	if err != nil {
+		return listCursor{}, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if cur.Sort != sortField {
+		return listCursor{}, fmt.Errorf("%w: cursor was issued for another sort order", ErrInvalidQuery)
+	}
+	return cur, nil
+}
+
+// GetMetrics возвращает значения запрошенных метрик в порядке запроса.
+// Ненайденные метрики и метрики неизвестных типов пропускаются.
+func (ms *MetricsService) GetMetrics(refs []MetricRef) []middleware.MetricsJSON {
+	found := make([]middleware.MetricsJSON, 0, len(refs))
+	for _, ref := range refs {
+		mt := strings.ToLower(ref.MType)
+		m := middleware.MetricsJSON{ID: ref.ID, MType: middleware.MetricType(mt)}
+		if models.IsComposite(mt) {
+			c, ok := ms.Storage.GetComposite(mt, ref.ID)
+			if !ok {
+				continue
+			}
+			m.SetComposite(c)
+			found = append(found, m)
+			continue
+		}
+		value, err := ms.GetMetricValue(mt, ref.ID)
+		if err != nil {
+			continue
+		}
+		switch mt {
+		case CounterMetric:
+			delta, _ := strconv.ParseInt(value, 10, 64)
+			m.Delta = &delta
+		case GaugeMetric:
+			val, _ := strconv.ParseFloat(value, 64)
+			m.Value = &val
+		default:
+			continue
+		}
+		found = append(found, m)
+	}
+	return found
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+)
+
+// Параметры учёта скорости counter по умолчанию: наблюдения за последний час,
+// не больше ratePoints точек на counter.
+const (
+	DefaultRateWindow = time.Hour
+	DefaultRateQuery  = 5 * time.Minute
+	ratePoints        = 720
+)
+
+// CounterRate — прирост и средняя скорость counter за окно.
+type CounterRate struct {
+	ID     string `json:"id"`
+	Window string `json:"window"`
+	// Increase — прирост за окно с учётом сбросов counter.
+	Increase float64 `json:"increase"`
+	// Rate — средний прирост в секунду за наблюдаемую часть окна.
+	Rate float64 `json:"rate"`
+	// From и To — границы наблюдаемой части окна.
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Samples — число наблюдений, по которым посчитан прирост.
+	Samples int `json:"samples"`
+}
+
+// ratePoint — наблюдение counter: Raw — значение в хранилище, Total — накопленный прирост
+// с начала учёта, не убывающий при сбросах и перезапусках.
+type ratePoint struct {
+	Time  time.Time `json:"t"`
+	Raw   int64     `json:"raw"`
+	Total float64   `json:"total"`
+}
+
+// CounterRates хранит наблюдения counter для вычисления rate и increase.
+//
+// Уменьшение значения между наблюдениями считается сбросом counter: прирост после сброса —
+// новое значение целиком. Значения, восстановленные из снимка или файла хранилища при
+// запуске, — новая точка отсчёта (см. Seed): расхождение с последним наблюдением до перезапуска
+// не считается ни приростом, ни сбросом. Наблюдения внутри одного интервала window/720
+// схлопываются в одну точку.
+type CounterRates struct {
+	window     time.Duration
+	resolution time.Duration
+
+	mu     sync.Mutex
+	series map[string][]ratePoint
+}
+
+// NewCounterRates создаёт учёт наблюдений за последние window (0 — DefaultRateWindow).
+func NewCounterRates(window time.Duration) *CounterRates {
+	if window <= 0 {
+		window = DefaultRateWindow
+	}
+	return &CounterRates{
+		window:     window,
+		resolution: window / ratePoints,
+		series:     make(map[string][]ratePoint),
+	}
+}
+
+// Window возвращает наибольшее окно, за которое хранятся наблюдения.
+func (r *CounterRates) Window() time.Duration { return r.window }
+
+// Observe добавляет наблюдение counter name со значением raw в момент t. Для нового counter
+// предыдущим значением считается 0: он создан этой записью.
+func (r *CounterRates) Observe(name string, raw int64, t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	points := r.series[name]
+	if len(points) == 0 {
+		r.series[name] = []ratePoint{{Time: t, Raw: 0}, {Time: t, Raw: raw, Total: float64(raw)}}
+		return
+	}
+	last := points[len(points)-1]
+	inc := float64(raw - last.Raw)
+	if raw < last.Raw {
+		inc = float64(raw)
+	}
+	r.series[name] = r.add(points, ratePoint{Time: t, Raw: raw, Total: last.Total + inc})
+}
+
+// Seed задаёт точку отсчёта для всех counter: текущие значения counters записываются
+// без прироста. Вызывается при запуске и после восстановления снимка. Наблюдения counter,
+// которых нет в counters, удаляются.
+func (r *CounterRates) Seed(counters map[string]repository.Counter, t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name := range r.series {
+		if _, ok := counters[name]; !ok {
+			delete(r.series, name)
+		}
+	}
+	for name, v := range counters {
+		points := r.series[name]
+		var total float64
+		if len(points) > 0 {
+			total = points[len(points)-1].Total
+		}
+		r.series[name] = r.add(points, ratePoint{Time: t, Raw: int64(v), Total: total})
+	}
+}
+
+// add дописывает точку p, схлопывая её с последней точкой того же интервала,
+// и отбрасывает точки старше окна. Последняя точка до начала окна остаётся точкой отсчёта.
+func (r *CounterRates) add(points []ratePoint, p ratePoint) []ratePoint {
+	if n := len(points); n > 1 && !p.Time.Before(points[n-1].Time) &&
+		p.Time.Truncate(r.resolution).Equal(points[n-1].Time.Truncate(r.resolution)) {
+		points[n-1] = p
+	} else {
+		points = append(points, p)
+	}
+	cutoff := p.Time.Add(-r.window)
+	drop := 0
+	for drop+1 < len(points) && !points[drop+1].Time.After(cutoff) {
+		drop++
+	}
+	if drop > 0 {
+		points = append(points[:0], points[drop:]...)
+	}
+	return points
+}
+
+// Remove удаляет наблюдения counter.
+func (r *CounterRates) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.series, name)
+}
+
+// Rate возвращает прирост counter за window до момента now; ok = false, если наблюдений
+// counter нет. Если в окне меньше двух наблюдений, а counter менялся в окне, возвращается
+// ErrInsufficientData.
+func (r *CounterRates) Rate(name string, window time.Duration, now time.Time) (res CounterRate, ok bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	points := r.series[name]
+	if len(points) == 0 {
+		return res, false, nil
+	}
+	cutoff := now.Add(-window)
+	first, end := 0, len(points)-1
+	for i := end; i >= 0; i-- {
+		if !points[i].Time.After(cutoff) {
+			first = i
+			break
+		}
+	}
+	from := points[first].Time
+	if from.Before(cutoff) {
+		from = cutoff
+	}
+	span := now.Sub(from)
+	if span <= 0 || (first == end && points[end].Time.After(cutoff)) {
+		return res, true, ErrInsufficientData.With(fmt.Errorf("counter %q has one observation in the last %s", name, window))
+	}
+	res = CounterRate{
+		ID:       name,
+		Window:   window.String(),
+		Increase: points[end].Total - points[first].Total,
+		From:     from,
+		To:       now,
+		Samples:  end - first + 1,
+	}
+	res.Rate = res.Increase / span.Seconds()
+	return res, true, nil
+}
+
+// rateFile — формат файла наблюдений.
+type rateFile struct {
+	Window   string                 `json:"window"`
+	Counters map[string][]ratePoint `json:"counters"`
+}
+
+// Save записывает наблюдения в файл path, чтобы после перезапуска окна rate и increase
+// охватывали время до него.
+func (r *CounterRates) Save(path string) error {
+	r.mu.Lock()
+	data, err := json.Marshal(rateFile{Window: r.window.String(), Counters: r.series})
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encode counter rates: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write counter rates: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("write counter rates: %w", err)
+	}
+	return nil
+}
+
+// Load читает наблюдения, сохранённые Save. Точки старше окна отбрасываются.
+// После загрузки нужно вызвать Seed с восстановленными значениями хранилища.
+func (r *CounterRates) Load(path string, now time.Time) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read counter rates: %w", err)
+	}
+	var f rateFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("parse counter rates %s: %w", path, err)
+	}
+	cutoff := now.Add(-r.window)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series = make(map[string][]ratePoint, len(f.Counters))
+	for name, points := range f.Counters {
+		first := 0
+		for first+1 < len(points) && !points[first+1].Time.After(cutoff) {
+			first++
+		}
+		if len(points) > 0 {
+			r.series[name] = points[first:]
+		}
+	}
+	return nil
+}
+
+// record переносит изменение counter в наблюдения.
+func (r *CounterRates) record(kind string, m middleware.MetricsJSON, t time.Time, counters func() map[string]repository.Counter) {
+	switch kind {
+	case EventReset:
+		r.Seed(counters(), t)
+	case EventDelete:
+		if strings.EqualFold(string(m.MType), CounterMetric) {
+			r.Remove(m.ID)
+		}
+	case EventUpdate:
+		if strings.EqualFold(string(m.MType), CounterMetric) && m.Delta != nil {
+			r.Observe(m.ID, *m.Delta, t)
+		}
+	}
+}
+
+// CounterRate возвращает прирост и скорость counter name за последние window
+// (0 — DefaultRateQuery, но не больше окна учёта).
+func (ms *MetricsService) CounterRate(name string, window time.Duration) (CounterRate, error) {
+	if ms.Rates == nil {
+		return CounterRate{}, ErrRatesDisabled
+	}
+	if window <= 0 {
+		window = min(DefaultRateQuery, ms.Rates.Window())
+	}
+	if window > ms.Rates.Window() {
+		return CounterRate{}, ErrInvalidQuery.With(fmt.Errorf("window %s exceeds the tracked %s", window, ms.Rates.Window()))
+	}
+	res, ok, err := ms.Rates.Rate(name, window, time.Now())
+	if !ok {
+		if _, err := ms.GetMetricValue(CounterMetric, name); err != nil {
+			return CounterRate{}, err
+		}
+		return CounterRate{}, ErrInsufficientData.With(errors.New("counter has no observations yet"))
+	}
+	return res, err
+}
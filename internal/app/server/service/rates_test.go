@@ -0,0 +1,153 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+)
+
+func TestCounterRates_IncreaseAndResets(t *testing.T) {
+	r := NewCounterRates(time.Hour)
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.Seed(map[string]repository.Counter{"c": 100}, t0)
+
+	r.Observe("c", 160, t0.Add(time.Minute))
+	r.Observe("c", 40, t0.Add(2*time.Minute)) // сброс: прирост 40
+	r.Observe("c", 100, t0.Add(3*time.Minute))
+
+	res, ok, err := r.Rate("c", 10*time.Minute, t0.Add(4*time.Minute))
+	if !ok || err != nil {
+		t.Fatalf("unexpected result: ok=%v err=%v", ok, err)
+	}
+	if res.Increase != 160 || res.Samples != 4 {
+		t.Fatalf("expected increase 160 over 4 samples, got %+v", res)
+	}
+	if want := 160.0 / 240; res.Rate != want {
+		t.Fatalf("expected rate %g over the observed 4m, got %g", want, res.Rate)
+	}
+
+	// Окно начинается между наблюдениями: точка отсчёта — последнее наблюдение до окна.
+	res, _, _ = r.Rate("c", 90*time.Second, t0.Add(3*time.Minute))
+	if res.Increase != 100 || !res.From.Equal(t0.Add(90*time.Second)) {
+		t.Fatalf("expected increase 100 since 1m30s, got %+v", res)
+	}
+
+	// Counter не менялся всё окно — прирост 0.
+	res, _, err = r.Rate("c", time.Minute, t0.Add(30*time.Minute))
+	if err != nil || res.Increase != 0 || res.Rate != 0 {
+		t.Fatalf("expected zero rate for an idle counter, got %+v (%v)", res, err)
+	}
+
+	if _, ok, _ := r.Rate("other", time.Minute, t0); ok {
+		t.Fatal("unknown counter must not have observations")
+	}
+}
+
+func TestCounterRates_NewCounterAndInsufficientData(t *testing.T) {
+	r := NewCounterRates(time.Hour)
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.Seed(map[string]repository.Counter{"old": 5}, t0)
+	if _, _, err := r.Rate("old", time.Minute, t0.Add(time.Second)); !errors.Is(err, ErrInsufficientData) {
+		t.Fatalf("expected ErrInsufficientData for a single observation, got %v", err)
+	}
+
+	// Counter, созданный записью, растёт от нуля.
+	r.Observe("new", 7, t0)
+	res, _, err := r.Rate("new", time.Minute, t0.Add(10*time.Second))
+	if err != nil || res.Increase != 7 {
+		t.Fatalf("expected increase 7 for a new counter, got %+v (%v)", res, err)
+	}
+}
+
+func TestCounterRates_CollapseAndTrim(t *testing.T) {
+	r := NewCounterRates(12 * time.Minute) // шаг 1s
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.Seed(map[string]repository.Counter{"c": 0}, t0)
+	r.Observe("c", 1, t0.Add(time.Second))
+	r.Observe("c", 0, t0.Add(time.Second+100*time.Millisecond)) // сброс в том же интервале
+	r.Observe("c", 3, t0.Add(time.Second+200*time.Millisecond))
+	if n := len(r.series["c"]); n != 2 {
+		t.Fatalf("expected observations of one interval to collapse, got %d points", n)
+	}
+	res, _, _ := r.Rate("c", time.Minute, t0.Add(2*time.Second))
+	if res.Increase != 4 {
+		t.Fatalf("collapsing must keep the reset: expected increase 4, got %g", res.Increase)
+	}
+
+	r.Observe("c", 5, t0.Add(time.Hour))
+	if n := len(r.series["c"]); n != 2 {
+		t.Fatalf("expected old points to be trimmed down to the anchor, got %d points", n)
+	}
+}
+
+func TestCounterRates_RestartFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	before := NewCounterRates(time.Hour)
+	before.Seed(map[string]repository.Counter{"c": 0}, t0)
+	before.Observe("c", 50, t0.Add(time.Minute))
+	before.Observe("c", 80, t0.Add(2*time.Minute))
+	if err := before.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Хранилище сохранилось раньше последнего наблюдения: восстановлено 50, а не 80.
+	after := NewCounterRates(time.Hour)
+	if err := after.Load(path, t0.Add(3*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	after.Seed(map[string]repository.Counter{"c": 50}, t0.Add(3*time.Minute))
+	after.Observe("c", 60, t0.Add(4*time.Minute))
+
+	res, _, err := after.Rate("c", 10*time.Minute, t0.Add(5*time.Minute))
+	if err != nil || res.Increase != 90 {
+		t.Fatalf("expected increase 80 before and 10 after the restart, got %+v (%v)", res, err)
+	}
+
+	if err := after.Load(filepath.Join(t.TempDir(), "missing.json"), t0); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
+
+func TestMetricsService_CounterRate(t *testing.T) {
+	ms := &MetricsService{Storage: repository.NewMemStorage()}
+	if _, err := ms.CounterRate("PollCount", 0); !errors.Is(err, ErrRatesDisabled) {
+		t.Fatalf("expected ErrRatesDisabled, got %v", err)
+	}
+
+	ms.Rates = NewCounterRates(time.Minute)
+	if _, err := ms.CounterRate("PollCount", 0); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatalf("expected ErrMetricNotFound, got %v", err)
+	}
+	for _, v := range []string{"2", "3"} {
+		if err := ms.UpdateMetric(CounterMetric, "PollCount", v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := ms.CounterRate("PollCount", 0)
+	if err != nil || res.Increase != 5 || res.Window != "1m0s" {
+		t.Fatalf("expected increase 5 over the default window, got %+v (%v)", res, err)
+	}
+	if _, err := ms.CounterRate("PollCount", time.Hour); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("expected ErrInvalidQuery for a window over the tracked one, got %v", err)
+	}
+
+	// Обнуление — сброс counter, а не отрицательный прирост.
+	if err := ms.ResetCounter("PollCount"); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ = ms.CounterRate("PollCount", 0); res.Increase != 5 {
+		t.Fatalf("expected increase to survive the reset, got %+v", res)
+	}
+
+	if err := ms.DeleteMetric(CounterMetric, "PollCount"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.CounterRate("PollCount", 0); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatalf("expected ErrMetricNotFound after delete, got %v", err)
+	}
+}
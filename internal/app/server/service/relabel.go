@@ -0,0 +1,318 @@
+package service
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
+
+// Действия правил переразметки (по образцу relabel_configs Prometheus).
+const (
+	// RelabelReplace записывает в TargetLabel замену Replacement, если значение подходит под Regex.
+	RelabelReplace = "replace"
+	// RelabelKeep отбрасывает метрику, если значение не подходит под Regex.
+	RelabelKeep = "keep"
+	// RelabelDrop отбрасывает метрику, если значение подходит под Regex.
+	RelabelDrop = "drop"
+	// RelabelHashMod записывает в TargetLabel остаток от деления хэша значения на Modulus.
+	RelabelHashMod = "hashmod"
+)
+
+// Служебные метки, доступные правилам. Метки с префиксом "__", кроме __name__,
+// после переразметки удаляются; их можно использовать как временные.
+const (
+	// LabelName — имя метрики без меток.
+	LabelName = "__name__"
+	// LabelType — тип метрики (только для чтения).
+	LabelType = "__type__"
+	// LabelClient — клиент, приславший метрику (только для чтения, см. ForClient).
+	LabelClient = "__client__"
+)
+
+// RelabelRule — правило переразметки. Значение для проверки — метки SourceLabels,
+// соединённые через Separator. Regex проверяется целиком (якоря ^ и $ добавляются).
+type RelabelRule struct {
+	// SourceLabels — метки-источники (по умолчанию __name__).
+	SourceLabels []string `json:"source_labels,omitempty"`
+	// Separator — разделитель значений меток-источников (по умолчанию ";").
+	Separator *string `json:"separator,omitempty"`
+	// Regex — регулярное выражение RE2 (по умолчанию "(.*)").
+	Regex string `json:"regex,omitempty"`
+	// TargetLabel — метка, которую записывают replace и hashmod (по умолчанию для replace — __name__).
+	TargetLabel string `json:"target_label,omitempty"`
+	// Replacement — шаблон замены с группами $1, ${name} (по умолчанию "$1"). Пустой результат
+	// удаляет метку.
+	Replacement *string `json:"replacement,omitempty"`
+	// Modulus — делитель для hashmod.
+	Modulus uint64 `json:"modulus,omitempty"`
+	// Action — replace (по умолчанию), keep, drop или hashmod.
+	Action string `json:"action,omitempty"`
+}
+
+// relabelRule — проверенное правило со значениями по умолчанию.
+type relabelRule struct {
+	source      []string
+	separator   string
+	re          *regexp.Regexp
+	target      string
+	replacement string
+	modulus     uint64
+	action      string
+}
+
+// RelabelPipeline — последовательность правил переразметки, применяемая к каждой записи
+// метрики до проверки ограничений числа рядов и записи в хранилище.
+type RelabelPipeline struct {
+	rules []relabelRule
+}
+
+// NewRelabelPipeline проверяет правила и подставляет значения по умолчанию.
+// Ошибки относятся к ErrInvalidRelabel и указывают номер правила.
+func NewRelabelPipeline(rules []RelabelRule) (*RelabelPipeline, error) {
+	p := &RelabelPipeline{rules: make([]relabelRule, 0, len(rules))}
+	for i, r := range rules {
+		compiled, err := compileRelabelRule(r)
+		if err != nil {
+			return nil, ErrInvalidRelabel.With(fmt.Errorf("rule %d: %w", i+1, err))
+		}
+		p.rules = append(p.rules, compiled)
+	}
+	return p, nil
+}
+
+func compileRelabelRule(r RelabelRule) (relabelRule, error) {
+	c := relabelRule{
+		source:      r.SourceLabels,
+		separator:   ";",
+		replacement: "$1",
+		target:      r.TargetLabel,
+		modulus:     r.Modulus,
+		action:      strings.ToLower(strings.TrimSpace(r.Action)),
+	}
+	if len(c.source) == 0 {
+		c.source = []string{LabelName}
+	}
+	for _, l := range c.source {
+		if !models.ValidLabelName(l) {
+			return c, fmt.Errorf("invalid source label %q", l)
+		}
+	}
+	if r.Separator != nil {
+		c.separator = *r.Separator
+	}
+	if r.Replacement != nil {
+		c.replacement = *r.Replacement
+	}
+	expr := r.Regex
+	if expr == "" {
+		expr = "(.*)"
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return c, fmt.Errorf("invalid regex %q: %w", r.Regex, err)
+	}
+	c.re = re
+
+	switch c.action {
+	case "":
+		c.action = RelabelReplace
+		fallthrough
+	case RelabelReplace:
+		if c.target == "" {
+			c.target = LabelName
+		}
+	case RelabelHashMod:
+		if c.target == "" || c.modulus == 0 {
+			return c, errors.New("hashmod requires target_label and a positive modulus")
+		}
+	case RelabelKeep, RelabelDrop:
+		return c, nil
+	default:
+		return c, fmt.Errorf("unknown action %q: expected replace, keep, drop or hashmod", r.Action)
+	}
+	if !models.ValidLabelName(c.target) {
+		return c, fmt.Errorf("invalid target label %q", c.target)
+	}
+	if c.target == LabelType || c.target == LabelClient {
+		return c, fmt.Errorf("label %s is read-only", c.target)
+	}
+	return c, nil
+}
+
+// LoadRelabelRules читает правила переразметки из JSON-файла с массивом правил.
+func LoadRelabelRules(path string) ([]RelabelRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read relabel rules: %w", err)
+	}
+	var rules []RelabelRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse relabel rules %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Len возвращает число правил.
+func (p *RelabelPipeline) Len() int {
+	return len(p.rules)
+}
+
+// Apply применяет правила к метрике mtype/name, присланной клиентом client.
+// Возвращает новое имя ряда или false, если метрика отброшена. Метки в имени
+// разбираются из синтаксиса name{key="value"}; имя с некорректными метками
+// целиком считается именем метрики.
+func (p *RelabelPipeline) Apply(mtype, name, client string) (string, bool) {
+	base, labels, err := models.ParseSeries(name)
+	if err != nil || labels == nil {
+		base, labels = name, make(map[string]string)
+	}
+	labels[LabelName] = base
+	labels[LabelType] = mtype
+	labels[LabelClient] = client
+
+	values := make([]string, 0, 4)
+	for _, r := range p.rules {
+		values = values[:0]
+		for _, l := range r.source {
+			values = append(values, labels[l])
+		}
+		value := strings.Join(values, r.separator)
+
+		switch r.action {
+		case RelabelKeep:
+			if !r.re.MatchString(value) {
+				return "", false
+			}
+		case RelabelDrop:
+			if r.re.MatchString(value) {
+				return "", false
+			}
+		case RelabelReplace:
+			match := r.re.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+			res := string(r.re.ExpandString(nil, r.replacement, value, match))
+			if res == "" {
+				delete(labels, r.target)
+			} else {
+				labels[r.target] = res
+			}
+		case RelabelHashMod:
+			sum := md5.Sum([]byte(value))
+			labels[r.target] = strconv.FormatUint(binary.BigEndian.Uint64(sum[8:])%r.modulus, 10)
+		}
+	}
+
+	base = labels[LabelName]
+	if base == "" {
+		return "", false
+	}
+	for l := range labels {
+		if strings.HasPrefix(l, "__") {
+			delete(labels, l)
+		}
+	}
+	return models.FormatSeries(base, labels), true
+}
+
+// relabel применяет правила переразметки сервиса к метрике mtype/name.
+func (ms *MetricsService) relabel(mtype, name string) (string, bool) {
+	if ms.Relabel == nil {
+		return name, true
+	}
+	return ms.Relabel.Apply(strings.ToLower(mtype), name, ms.client)
+}
+
+// ingest готовит запись метрики mtype/name: применяет правила переразметки и проверяет
+// ограничения числа рядов. ok == false без ошибки — метрика отброшена, запись нужно молча
+// пропустить. release отменяет учёт нового ряда, если запись не удалась (см. admit).
+func (ms *MetricsService) ingest(mtype, name string) (stored string, ok bool, release func(), err error) {
+	stored, ok = ms.relabel(mtype, name)
+	if !ok {
+		return "", false, noRelease, nil
+	}
+	ok, release, err = ms.admit(mtype, stored)
+	return stored, ok, release, err
+}
+
+// StoredName возвращает имя, под которым сохранена метрика mtype/name после записи,
+// и false, если запись была отброшена правилами переразметки или выборкой новых рядов.
+func (ms *MetricsService) StoredName(mtype, name string) (string, bool) {
+	stored, ok := ms.relabel(mtype, name)
+	if !ok {
+		return "", false
+	}
+	if ms.Cardinality != nil && !ms.Cardinality.Known(strings.ToLower(mtype), stored, ms.Storage.ListMetricInfo) {
+		return "", false
+	}
+	return stored, true
+}
+
+// RelabelResult — результат проверки правил переразметки на одной метрике.
+type RelabelResult struct {
+	ID      string `json:"id"`
+	MType   string `json:"type"`
+	Result  string `json:"result,omitempty"`
+	Dropped bool   `json:"dropped"`
+}
+
+// RelabelRequest — пробный прогон правил: Rules (пусто — правила сервиса) применяются
+// к метрикам Metrics так, как если бы их прислал клиент Client.
+type RelabelRequest struct {
+	Rules   []RelabelRule `json:"rules,omitempty"`
+	Client  string        `json:"client,omitempty"`
+	Metrics []MetricRef   `json:"metrics"`
+}
+
+// RelabelDryRun применяет правила к метрикам запроса, ничего не записывая.
+func (ms *MetricsService) RelabelDryRun(req RelabelRequest) ([]RelabelResult, error) {
+	p := ms.Relabel
+	if req.Rules != nil {
+		var err error
+		if p, err = NewRelabelPipeline(req.Rules); err != nil {
+			return nil, err
+		}
+	}
+	if err := ms.CheckBatchSize(len(req.Metrics)); err != nil {
+		return nil, err
+	}
+	results := make([]RelabelResult, len(req.Metrics))
+	for i, m := range req.Metrics {
+		if m.ID == "" {
+			return nil, fmt.Errorf("metric %d: %w", i+1, ErrNameRequired)
+		}
+		results[i] = RelabelResult{ID: m.ID, MType: m.MType, Result: m.ID}
+		if p == nil {
+			continue
+		}
+		stored, ok := p.Apply(strings.ToLower(m.MType), m.ID, req.Client)
+		results[i].Result, results[i].Dropped = stored, !ok
+	}
+	return results, nil
+}
+
+// relabelItems применяет правила переразметки к элементам пакета и возвращает
+// сохраняемые элементы; исходный пакет не меняется.
+func (ms *MetricsService) relabelItems(batch []middleware.MetricsJSON) []middleware.MetricsJSON {
+	if ms.Relabel == nil {
+		return batch
+	}
+	kept := make([]middleware.MetricsJSON, 0, len(batch))
+	for _, m := range batch {
+		if name, ok := ms.relabel(string(m.MType), m.ID); ok {
+			m.ID = name
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
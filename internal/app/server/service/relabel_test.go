@@ -0,0 +1,122 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestRelabelPipeline_Apply(t *testing.T) {
+	p, err := NewRelabelPipeline([]RelabelRule{
+		{Action: RelabelDrop, Regex: "RandomValue"},
+		// CPUutilization1..N → CPUutilization{cpu="N"}.
+		{Regex: `CPUutilization(\d+)`, TargetLabel: "cpu"},
+		{Regex: `(CPUutilization)\d+`},
+		// Префикс команды по клиенту.
+		{SourceLabels: []string{"__client__", "__name__"}, Regex: `agent:team-(\w+);(.*)`, Replacement: strPtr("$1.$2")},
+		{Action: RelabelHashMod, SourceLabels: []string{"__name__"}, TargetLabel: "__shard", Modulus: 4},
+		{Action: RelabelKeep, SourceLabels: []string{"__type__"}, Regex: "gauge|counter"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		mtype, name, client string
+		want                string
+		kept                bool
+	}{
+		{GaugeMetric, "RandomValue", "", "", false},
+		{GaugeMetric, "CPUutilization3", "", `CPUutilization{cpu="3"}`, true},
+		{GaugeMetric, "Alloc", "agent:team-db", "db.Alloc", true},
+		{GaugeMetric, `Alloc{host="a"}`, "", `Alloc{host="a"}`, true},
+		{SketchMetric, "Latency", "", "", false},
+	}
+	for _, tc := range cases {
+		got, kept := p.Apply(tc.mtype, tc.name, tc.client)
+		if got != tc.want || kept != tc.kept {
+			t.Errorf("%s %s: want %q %v, got %q %v", tc.mtype, tc.name, tc.want, tc.kept, got, kept)
+		}
+	}
+}
+
+func TestRelabelPipeline_Invalid(t *testing.T) {
+	for _, r := range []RelabelRule{
+		{Action: "rename"},
+		{Regex: "("},
+		{Action: RelabelHashMod, TargetLabel: "shard"},
+		{TargetLabel: "__type__"},
+		{SourceLabels: []string{"bad-label"}},
+	} {
+		if _, err := NewRelabelPipeline([]RelabelRule{r}); !errors.Is(err, ErrInvalidRelabel) {
+			t.Errorf("%+v: expected ErrInvalidRelabel, got %v", r, err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "relabel.json")
+	if err := os.WriteFile(path, []byte(`[{"action":"drop","regex":"Tmp.*"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRelabelRules(path)
+	if err != nil || len(rules) != 1 || rules[0].Action != RelabelDrop {
+		t.Fatalf("unexpected rules: %+v %v", rules, err)
+	}
+}
+
+func TestRelabel_AppliedBeforeStorage(t *testing.T) {
+	p, err := NewRelabelPipeline([]RelabelRule{
+		{Action: RelabelDrop, Regex: "Random.*"},
+		{Regex: "(.*)", Replacement: strPtr("app.$1")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := repository.NewMemStorage()
+	ms := &MetricsService{Storage: storage, Relabel: p}
+
+	if err := ms.UpdateMetric(GaugeMetric, "Alloc", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.UpdateMetric(CounterMetric, "RandomValue", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.UpdateMetric(SketchMetric, "Latency", "5"); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := ms.UpdateMetricsBatch([]middleware.MetricsJSON{gaugeItem("Frees", 2), gaugeItem("RandomX", 1)})
+	if err != nil || len(updated) != 1 || updated[0].ID != "app.Frees" {
+		t.Fatalf("unexpected batch result: %+v %v", updated, err)
+	}
+	res := ms.ApplyBatch([]middleware.MetricsJSON{counterItem("Polls", 1), counterItem("RandomY", 1)}, BatchAtomic)
+	if res.Applied != 1 || res.Dropped != 1 || res.Results[0].Metric.ID != "app.Polls" || res.Results[1].Status != ItemDropped {
+		t.Fatalf("unexpected apply result: %+v", res)
+	}
+
+	var names []string
+	for _, info := range storage.ListMetricInfo() {
+		names = append(names, info.Type+":"+info.Name)
+	}
+	want := map[string]bool{"gauge:app.Alloc": true, "gauge:app.Frees": true, "counter:app.Polls": true, "sketch:app.Latency": true}
+	if len(names) != len(want) {
+		t.Fatalf("unexpected stored metrics: %v", names)
+	}
+	for _, n := range names {
+		if !want[n] {
+			t.Fatalf("unexpected stored metric %s in %v", n, names)
+		}
+	}
+	if name, ok := ms.StoredName(GaugeMetric, "Alloc"); !ok || name != "app.Alloc" {
+		t.Fatalf("unexpected stored name %q %v", name, ok)
+	}
+
+	results, err := ms.RelabelDryRun(RelabelRequest{Metrics: []MetricRef{{ID: "RandomValue", MType: GaugeMetric}, {ID: "Alloc", MType: GaugeMetric}}})
+	if err != nil || !results[0].Dropped || results[1].Result != "app.Alloc" {
+		t.Fatalf("unexpected dry run: %+v %v", results, err)
+	}
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+)
+
+// RetentionRule задаёт TTL для метрик, имя которых соответствует шаблону (синтаксис path.Match).
+// Нулевой TTL означает, что подходящие метрики не устаревают.
+type RetentionRule struct {
+	Pattern string
+	TTL     time.Duration
+}
+
+// RetentionPolicy описывает срок жизни gauge без обновлений:
+// сначала проверяются правила по шаблонам (первое совпадение), затем общий TTL.
+type RetentionPolicy struct {
+	DefaultTTL time.Duration
+	Rules      []RetentionRule
+}
+
+// ParseRetentionRules разбирает правила вида "CPUutilization*=1h,Tmp*=5m".
+func ParseRetentionRules(spec string) ([]RetentionRule, error) {
+	var rules []RetentionRule
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pattern, rawTTL, ok := strings.Cut(part, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid retention rule %q: expected pattern=ttl", part)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid retention pattern %q: %w", pattern, err)
+		}
+		ttl, err := time.ParseDuration(strings.TrimSpace(rawTTL))
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("invalid retention ttl in %q", part)
+		}
+		rules = append(rules, RetentionRule{Pattern: pattern, TTL: ttl})
+	}
+	return rules, nil
+}
+
+// TTLFor возвращает срок жизни для метрики с указанным именем (0 — без ограничения).
+func (p RetentionPolicy) TTLFor(name string) time.Duration {
+	for _, rule := range p.Rules {
+		if ok, _ := path.Match(rule.Pattern, name); ok {
+			return rule.TTL
+		}
+	}
+	return p.DefaultTTL
+}
+
+// Enabled сообщает, может ли политика хоть что-то удалить.
+func (p RetentionPolicy) Enabled() bool {
+	if p.DefaultTTL > 0 {
+		return true
+	}
+	for _, rule := range p.Rules {
+		if rule.TTL > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpireStale удаляет gauge, не обновлявшиеся дольше срока жизни по политике.
+// Counter накапливаются и не устаревают. Возвращает имена удалённых gauge.
+func (ms *MetricsService) ExpireStale(policy RetentionPolicy, now time.Time) ([]string, error) {
+	var expired []string
+	for _, info := range ms.Storage.ListMetricInfo() {
+		if info.Type != GaugeMetric {
+			continue
+		}
+		ttl := policy.TTLFor(info.Name)
+		if ttl <= 0 {
+			continue
+		}
+		deadline := now.Add(-ttl)
+		if !info.UpdatedAt.Before(deadline) {
+			continue
+		}
+		// Повторная проверка времени внутри хранилища защищает от гонки с новым обновлением.
+		deleted, err := ms.Storage.DeleteMetric(GaugeMetric, info.Name, deadline)
+		if err != nil {
+			return expired, err
+		}
+		if deleted {
+			expired = append(expired, info.Name)
+			ms.publish(EventDelete, middleware.MetricsJSON{ID: info.Name, MType: GaugeMetric})
+		}
+	}
+	return expired, nil
+}
+
+// Janitor периодически удаляет устаревшие метрики согласно политике хранения.
+type Janitor struct {
+	ms       *MetricsService
+	policy   RetentionPolicy
+	interval time.Duration
+	logger   *logrus.Logger
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewJanitor создаёт фоновый процесс очистки; запускается методом Start.
+func NewJanitor(ms *MetricsService, policy RetentionPolicy, interval time.Duration, logger *logrus.Logger) *Janitor {
+	return &Janitor{
+		ms:       ms,
+		policy:   policy,
+		interval: interval,
+		logger:   logger,
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start запускает периодическую очистку в отдельной горутине.
+func (j *Janitor) Start() {
+	go func() {
+		defer close(j.done)
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				j.RunOnce(time.Now())
+			case <-j.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// RunOnce выполняет один проход очистки и логирует результат.
+func (j *Janitor) RunOnce(now time.Time) {
+	expired, err := j.ms.ExpireStale(j.policy, now)
+	if err != nil {
+		j.logger.Errorf("Retention janitor failed: %v", err)
+	}
+	if len(expired) > 0 {
+		j.logger.WithField("metrics", expired).Infof("Expired %d stale gauges", len(expired))
+	}
+}
+
+// Stop останавливает очистку и дожидается завершения текущего прохода.
+// Вызывается только после Start.
+func (j *Janitor) Stop() {
+	j.stopOnce.Do(func() {
+		close(j.stopChan)
+	})
+	<-j.done
+}
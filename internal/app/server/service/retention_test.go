@@ -0,0 +1,101 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+)
+
+func TestParseRetentionRules(t *testing.T) {
+	rules, err := ParseRetentionRules("CPUutilization*=1h, Tmp*=5m,Keep*=0s")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 3 || rules[0].TTL != time.Hour || rules[1].Pattern != "Tmp*" {
+		t.Fatalf("unexpected rules: %+v", rules)
+	}
+
+	policy := RetentionPolicy{DefaultTTL: time.Minute, Rules: rules}
+	if ttl := policy.TTLFor("CPUutilization8"); ttl != time.Hour {
+		t.Fatalf("expected rule ttl, got %s", ttl)
+	}
+	if ttl := policy.TTLFor("KeepMe"); ttl != 0 {
+		t.Fatalf("zero ttl rule must disable expiry, got %s", ttl)
+	}
+	if ttl := policy.TTLFor("Alloc"); ttl != time.Minute {
+		t.Fatalf("expected default ttl, got %s", ttl)
+	}
+
+	for _, bad := range []string{"noequals", "=1h", "A=abc", "[=1h"} {
+		if _, err := ParseRetentionRules(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestExpireStale(t *testing.T) {
+	ms := &MetricsService{Storage: repository.NewMemStorage()}
+	if err := ms.UpdateMetric("gauge", "CPUutilization8", "10"); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := ms.UpdateMetric("gauge", "Alloc", "1"); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := ms.UpdateMetric("counter", "PollCount", "1"); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	policy := RetentionPolicy{Rules: []RetentionRule{{Pattern: "CPUutilization*", TTL: time.Minute}}}
+
+	expired, err := ms.ExpireStale(policy, time.Now())
+	if err != nil || len(expired) != 0 {
+		t.Fatalf("fresh metrics must not expire: %v %v", expired, err)
+	}
+
+	expired, err = ms.ExpireStale(policy, time.Now().Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("expire: %v", err)
+	}
+	if len(expired) != 1 || expired[0] != "CPUutilization8" {
+		t.Fatalf("expected CPUutilization8 to expire, got %v", expired)
+	}
+	if _, err := ms.GetMetricValue("gauge", "CPUutilization8"); err == nil {
+		t.Fatalf("expired gauge must be removed")
+	}
+	if _, err := ms.GetMetricValue("gauge", "Alloc"); err != nil {
+		t.Fatalf("gauge without matching rule must stay: %v", err)
+	}
+
+	// Counter не устаревают даже при общем TTL.
+	janitor := NewJanitor(ms, RetentionPolicy{DefaultTTL: time.Second}, time.Hour, logrus.New())
+	janitor.RunOnce(time.Now().Add(time.Hour))
+	if _, err := ms.GetMetricValue("counter", "PollCount"); err != nil {
+		t.Fatalf("counter must not expire: %v", err)
+	}
+	if _, err := ms.GetMetricValue("gauge", "Alloc"); err == nil {
+		t.Fatalf("gauge must expire by default ttl")
+	}
+}
+
+func TestListMetrics(t *testing.T) {
+	ms := &MetricsService{Storage: repository.NewMemStorage()}
+	_ = ms.UpdateMetric("gauge", "G", "2.5")
+	_ = ms.UpdateMetric("counter", "C", "3")
+
+	list := ms.ListMetrics()
+	if len(list) != 2 {
+		t.Fatalf("expected 2 metrics, got %d", len(list))
+	}
+	if list[0].ID != "C" || list[0].Delta == nil || *list[0].Delta != 3 {
+		t.Fatalf("unexpected counter entry: %+v", list[0])
+	}
+	if list[1].ID != "G" || list[1].Value == nil || *list[1].Value != 2.5 {
+		t.Fatalf("unexpected gauge entry: %+v", list[1])
+	}
+	if list[1].UpdatedAt.IsZero() {
+		t.Fatalf("updated_at must be set")
+	}
+}
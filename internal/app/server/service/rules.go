@@ -0,0 +1,231 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+)
+
+// RulesClient — клиент, от имени которого записываются результаты правил
+// (см. ForClient и метку __client__ правил переразметки).
+const RulesClient = "rules"
+
+// RecordingRule — правило записи: значение выражения Expr периодически сохраняется
+// как gauge Name.
+type RecordingRule struct {
+	Name string `json:"name"`
+	Expr string `json:"expr"`
+}
+
+type recordingRule struct {
+	name string
+	expr *Expr
+}
+
+// RecordingRules — проверенный набор правил в порядке вычисления: правило вычисляется
+// после правил, результаты которых оно использует.
+type RecordingRules struct {
+	rules []recordingRule
+}
+
+// LoadRecordingRules читает правила из JSON-файла с массивом {"name", "expr"}.
+func LoadRecordingRules(path string) ([]RecordingRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read recording rules: %w", err)
+	}
+	var rules []RecordingRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse recording rules %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// NewRecordingRules проверяет правила: имена заданы, уникальны и не содержат символов
+// шаблона, выражения разбираются, а правила не зависят друг от друга по кругу.
+// Ошибки относятся к ErrInvalidRules.
+func NewRecordingRules(rules []RecordingRule) (*RecordingRules, error) {
+	parsed := make([]recordingRule, len(rules))
+	seen := make(map[string]bool, len(rules))
+	for i, r := range rules {
+		name := strings.TrimSpace(r.Name)
+		switch {
+		case name == "":
+			return nil, ErrInvalidRules.With(fmt.Errorf("rule %d: name is required", i+1))
+		case strings.ContainsAny(name, "*?[\\"):
+			return nil, ErrInvalidRules.With(fmt.Errorf("rule %q: name must not contain pattern characters", name))
+		case seen[name]:
+			return nil, ErrInvalidRules.With(fmt.Errorf("rule %q is defined twice", name))
+		}
+		if _, _, err := models.ParseSeries(name); err != nil {
+			return nil, ErrInvalidRules.With(fmt.Errorf("rule %q: %w", name, err))
+		}
+		seen[name] = true
+		expr, err := ParseExpr(r.Expr)
+		if err != nil {
+			return nil, ErrInvalidRules.With(fmt.Errorf("rule %q: %w", name, err))
+		}
+		parsed[i] = recordingRule{name: name, expr: expr}
+	}
+
+	ordered, err := orderRules(parsed)
+	if err != nil {
+		return nil, ErrInvalidRules.With(err)
+	}
+	return &RecordingRules{rules: ordered}, nil
+}
+
+// orderRules упорядочивает правила так, чтобы результаты вычислялись раньше
+// использующих их правил, и отклоняет циклические зависимости.
+func orderRules(rules []recordingRule) ([]recordingRule, error) {
+	deps := make([][]int, len(rules))
+	for i, r := range rules {
+		for _, sel := range r.expr.Selectors() {
+			for j, other := range rules {
+				if ok, _ := path.Match(sel, other.name); ok {
+					deps[i] = append(deps[i], j)
+				}
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(rules))
+	ordered := make([]recordingRule, 0, len(rules))
+	var visit func(i int, chain []string) error
+	visit = func(i int, chain []string) error {
+		chain = append(chain, rules[i].name)
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("rules depend on each other in a cycle: %s", strings.Join(chain, " -> "))
+		case done:
+			return nil
+		}
+		state[i] = visiting
+		for _, j := range deps[i] {
+			if err := visit(j, chain); err != nil {
+				return err
+			}
+		}
+		state[i] = done
+		ordered = append(ordered, rules[i])
+		return nil
+	}
+	for i := range rules {
+		if err := visit(i, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// Len возвращает число правил.
+func (r *RecordingRules) Len() int {
+	return len(r.rules)
+}
+
+// RuleError — ошибка вычисления или записи результата одного правила.
+type RuleError struct {
+	Rule string
+	Err  error
+}
+
+func (e *RuleError) Error() string { return fmt.Sprintf("rule %q: %v", e.Rule, e.Err) }
+func (e *RuleError) Unwrap() error { return e.Err }
+
+// EvaluateRules вычисляет правила над текущими значениями метрик и записывает результаты
+// как gauge от имени клиента RulesClient. Правило, которое не удалось вычислить (нет метрики,
+// деление на ноль), пропускается; ошибки всех таких правил возвращаются вместе.
+// Возвращает число записанных результатов.
+func (ms *MetricsService) EvaluateRules(rules *RecordingRules) (int, error) {
+	writer := ms.ForClient(RulesClient)
+	ctx := ms.exprContext()
+	var errs []error
+	written := 0
+	for _, r := range rules.rules {
+		v, err := r.expr.eval(ctx)
+		if err == nil {
+			err = writer.UpdateMetric(GaugeMetric, r.name, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		if err != nil {
+			errs = append(errs, &RuleError{Rule: r.name, Err: err})
+			continue
+		}
+		// Зависимые правила видят свежий результат, даже если переразметка сохранила его под другим именем.
+		ctx.values.gauges[r.name] = v
+		written++
+	}
+	return written, errors.Join(errs...)
+}
+
+// RuleEvaluator периодически вычисляет правила записи.
+type RuleEvaluator struct {
+	ms       *MetricsService
+	rules    *RecordingRules
+	interval time.Duration
+	logger   *logrus.Logger
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewRuleEvaluator создаёт фоновое вычисление правил; запускается методом Start.
+func NewRuleEvaluator(ms *MetricsService, rules *RecordingRules, interval time.Duration, logger *logrus.Logger) *RuleEvaluator {
+	return &RuleEvaluator{
+		ms:       ms,
+		rules:    rules,
+		interval: interval,
+		logger:   logger,
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start запускает периодическое вычисление в отдельной горутине.
+func (e *RuleEvaluator) Start() {
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.RunOnce()
+			case <-e.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// RunOnce вычисляет все правила один раз и логирует ошибки.
+func (e *RuleEvaluator) RunOnce() {
+	written, err := e.ms.EvaluateRules(e.rules)
+	if err != nil {
+		e.logger.Warnf("Recording rules: %d of %d evaluated: %v", written, e.rules.Len(), err)
+	}
+}
+
+// Stop останавливает вычисление и дожидается завершения текущего прохода.
+// Вызывается только после Start.
+func (e *RuleEvaluator) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.stopChan)
+	})
+	<-e.done
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+)
+
+func TestNewRecordingRules_Validation(t *testing.T) {
+	cases := map[string][]RecordingRule{
+		"name is required":       {{Expr: "1"}},
+		"defined twice":          {{Name: "a", Expr: "1"}, {Name: "a", Expr: "2"}},
+		"pattern characters":     {{Name: "a*", Expr: "1"}},
+		"unexpected end":         {{Name: "a", Expr: "1 +"}},
+		"a -> b -> a":            {{Name: "a", Expr: "b + 1"}, {Name: "b", Expr: "a + 1"}},
+		"cpu.total -> cpu.total": {{Name: "cpu.total", Expr: "sum(cpu*)"}},
+	}
+	for want, rules := range cases {
+		_, err := NewRecordingRules(rules)
+		if !errors.Is(err, ErrInvalidRules) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: unexpected error %v", want, err)
+		}
+	}
+}
+
+func TestEvaluateRules(t *testing.T) {
+	ms := &MetricsService{Storage: repository.NewMemStorage()}
+	for name, v := range map[string]string{"TotalMemory": "100", "FreeMemory": "40", "CPUutilization1": "10", "CPUutilization2": "30"} {
+		if err := ms.UpdateMetric(GaugeMetric, name, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "rules.json")
+	// Правило memory.used_ratio использует результат memory.used, объявленного ниже.
+	spec := `[
+		{"name": "memory.used_ratio", "expr": "memory.used / TotalMemory"},
+		{"name": "memory.used", "expr": "TotalMemory - FreeMemory"},
+		{"name": "cpu.total", "expr": "sum(CPUutilization*)"},
+		{"name": "broken", "expr": "Missing * 2"}
+	]`
+	if err := os.WriteFile(path, []byte(spec), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadRecordingRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := NewRecordingRules(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := ms.EvaluateRules(rules)
+	var ruleErr *RuleError
+	if written != 3 || !errors.As(err, &ruleErr) || ruleErr.Rule != "broken" {
+		t.Fatalf("expected 3 results and an error for the broken rule, got %d %v", written, err)
+	}
+	for name, want := range map[string]string{"memory.used": "60", "memory.used_ratio": "0.6", "cpu.total": "40"} {
+		if got, err := ms.GetMetricValue(GaugeMetric, name); err != nil || got != want {
+			t.Errorf("%s: want %s, got %s (%v)", name, want, got, err)
+		}
+	}
+}
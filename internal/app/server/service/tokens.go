@@ -0,0 +1,148 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+)
+
+// tokenSecretPrefix отличает секреты токенов от прочих ключей в конфигурации и логах.
+const tokenSecretPrefix = "hm_"
+
+// TokenService выдаёт, проверяет и отзывает API-токены. Секрет токена показывается
+// один раз при выдаче; в хранилище попадает только его SHA-256.
+type TokenService struct {
+	Store repository.TokenStore
+}
+
+// NewTokenService создаёт сервис токенов поверх хранилища store.
+func NewTokenService(store repository.TokenStore) *TokenService {
+	return &TokenService{Store: store}
+}
+
+// TokenRequest — параметры нового токена.
+type TokenRequest struct {
+	Name     string   `json:"name"`
+	Role     string   `json:"role"`
+	Prefixes []string `json:"prefixes,omitempty"`
+}
+
+// TokenInfo — описание токена без хэша секрета.
+type TokenInfo struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	Role      models.Role `json:"role"`
+	Prefixes  []string    `json:"prefixes,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// IssuedToken — только что выданный токен вместе с секретом.
+type IssuedToken struct {
+	TokenInfo
+	Token string `json:"token"`
+}
+
+func newTokenInfo(t models.Token) TokenInfo {
+	return TokenInfo{ID: t.ID, Name: t.Name, Role: t.Role, Prefixes: t.Prefixes, CreatedAt: t.CreatedAt}
+}
+
+// HashToken возвращает хэш секрета, под которым токен хранится. Секреты случайны и длинны,
+// поэтому соль и медленный хэш не нужны.
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Issue создаёт токен и возвращает его вместе с секретом.
+func (s *TokenService) Issue(req TokenRequest) (IssuedToken, error) {
+	role, err := models.ParseRole(req.Role)
+	if err != nil {
+		return IssuedToken{}, ErrInvalidTokenRequest.With(err)
+	}
+	var prefixes []string
+	for _, p := range req.Prefixes {
+		if p = strings.TrimSpace(p); p != "" {
+			prefixes = append(prefixes, p)
+		}
+	}
+	if role == models.RoleAdmin && len(prefixes) > 0 {
+		return IssuedToken{}, ErrInvalidTokenRequest.With(errors.New("admin tokens cannot be scoped to name prefixes"))
+	}
+
+	id, err := randomString(6, hex.EncodeToString)
+	if err != nil {
+		return IssuedToken{}, err
+	}
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return IssuedToken{}, err
+	}
+	secret = tokenSecretPrefix + secret
+
+	t := models.Token{
+		ID:        id,
+		Name:      strings.TrimSpace(req.Name),
+		Role:      role,
+		Prefixes:  prefixes,
+		Hash:      HashToken(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.Store.CreateToken(t); err != nil {
+		return IssuedToken{}, ErrStorage.With(err)
+	}
+	return IssuedToken{TokenInfo: newTokenInfo(t), Token: secret}, nil
+}
+
+// Authenticate находит токен по секрету. Неизвестный секрет — ErrInvalidToken.
+func (s *TokenService) Authenticate(secret string) (models.Token, error) {
+	t, ok, err := s.Store.TokenByHash(HashToken(secret))
+	switch {
+	case err != nil:
+		return models.Token{}, ErrStorage.With(err)
+	case !ok:
+		return models.Token{}, ErrInvalidToken
+	}
+	return t, nil
+}
+
+// List возвращает описания всех токенов.
+func (s *TokenService) List() ([]TokenInfo, error) {
+	tokens, err := s.Store.ListTokens()
+	if err != nil {
+		return nil, ErrStorage.With(err)
+	}
+	infos := make([]TokenInfo, 0, len(tokens))
+	for _, t := range tokens {
+		infos = append(infos, newTokenInfo(t))
+	}
+	return infos, nil
+}
+
+// Revoke отзывает токен id.
+func (s *TokenService) Revoke(id string) error {
+	deleted, err := s.Store.DeleteToken(id)
+	switch {
+	case err != nil:
+		return ErrStorage.With(err)
+	case !deleted:
+		return ErrTokenNotFound.With(fmt.Errorf("token %s not found", id))
+	}
+	return nil
+}
+
+// randomString возвращает n случайных байт в кодировке encode.
+func randomString(n int, encode func([]byte) string) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return encode(buf), nil
+}
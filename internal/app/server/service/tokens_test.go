@@ -0,0 +1,56 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/models"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+)
+
+func TestTokenService(t *testing.T) {
+	store, err := repository.NewFileTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewTokenService(store)
+
+	issued, err := s.Issue(TokenRequest{Name: "agent", Role: "Writer", Prefixes: []string{" app.", ""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(issued.Token, tokenSecretPrefix) || issued.Role != models.RoleWriter {
+		t.Fatalf("unexpected token: %+v", issued)
+	}
+	if len(issued.Prefixes) != 1 || issued.Prefixes[0] != "app." {
+		t.Fatalf("prefixes must be trimmed, got %q", issued.Prefixes)
+	}
+
+	stored, _ := store.ListTokens()
+	if len(stored) != 1 || stored[0].Hash == issued.Token || stored[0].Hash != HashToken(issued.Token) {
+		t.Fatalf("only the hash of the secret must be stored: %+v", stored)
+	}
+
+	tok, err := s.Authenticate(issued.Token)
+	if err != nil || tok.ID != issued.ID {
+		t.Fatalf("authentication failed: %+v %v", tok, err)
+	}
+	if _, err := s.Authenticate(issued.Token + "x"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken, got %v", err)
+	}
+	if _, err := s.Issue(TokenRequest{Role: "admin", Prefixes: []string{"app."}}); !errors.Is(err, ErrInvalidTokenRequest) {
+		t.Fatalf("scoped admin tokens must be rejected, got %v", err)
+	}
+
+	if err := s.Revoke(issued.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Revoke(issued.ID); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("expected ErrTokenNotFound, got %v", err)
+	}
+	if _, err := s.Authenticate(issued.Token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("revoked token must not authenticate, got %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Административные операции. Требуют ключа администратора сервера в Options.Token.
+
+// MetricRef — ссылка на метрику по имени и типу.
+type MetricRef struct {
+	ID    string `json:"id"`
+	MType string `json:"type"`
+}
+
+// Delete удаляет метрику. Для отсутствующей метрики ошибка удовлетворяет
+// errors.Is(err, ErrNotFound).
+func (c *Client) Delete(ctx context.Context, metricType, name string) error {
+	return c.do(ctx, http.MethodDelete, metricPath(metricType, name), nil, nil, nil)
+}
+
+// DeleteMatching удаляет метрики, имена которых подходят под шаблон (glob).
+// Пустой metricType означает метрики любого типа. Возвращает удалённые метрики.
+func (c *Client) DeleteMatching(ctx context.Context, metricType, pattern string) ([]MetricRef, error) {
+	query := url.Values{"pattern": {pattern}}
+	setNonEmpty(query, "type", metricType)
+	var resp struct {
+		Deleted []MetricRef `json:"deleted"`
+	}
+	if err := c.do(ctx, http.MethodDelete, apiPrefix+"/metrics", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Deleted, nil
+}
+
+// Форматы снимка.
+const (
+	SnapshotJSON   = "json"
+	SnapshotNDJSON = "ndjson"
+)
+
+// Export записывает в w снимок всех метрик в формате format (SnapshotJSON или SnapshotNDJSON).
+// Снимок восстанавливается на сервере или копируется утилитой metricsctl copy.
+func (c *Client) Export(ctx context.Context, format string, w io.Writer) error {
+	query := url.Values{}
+	setNonEmpty(query, "format", format)
+	return c.do(ctx, http.MethodGet, apiPrefix+"/admin/snapshot", query, nil, w)
+}
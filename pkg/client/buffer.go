@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultFlushInterval — период отправки буфера по умолчанию.
+const DefaultFlushInterval = 10 * time.Second
+
+// BufferOptions — настройки буфера.
+type BufferOptions struct {
+	// FlushInterval — период отправки; 0 — DefaultFlushInterval.
+	FlushInterval time.Duration
+	// MaxSize — число разных метрик, при котором буфер отправляется, не дожидаясь
+	// периода; 0 — без ограничения.
+	MaxSize int
+	// OnError получает ошибки фоновой отправки, в том числе об отброшенных пакетах;
+	// nil — ошибки не сообщаются.
+	OnError func(error)
+}
+
+// Buffer накапливает метрики в памяти и периодически отправляет их одним пакетом.
+// Повторные значения gauge заменяют друг друга, приращения counter суммируются.
+// Если отправка не удалась из-за сети, ошибки сервера (5xx) или ограничения частоты (429),
+// значения возвращаются в буфер и уходят со следующим пакетом. Пакет, который сервер
+// отклонил по существу (прочие ответы 4xx), отбрасывается: повтор получил бы тот же ответ.
+type Buffer struct {
+	client *Client
+	opts   BufferOptions
+
+	mu       sync.Mutex
+	gauges   map[string]float64
+	counters map[string]int64
+
+	kick   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewBuffer создаёт буфер клиента c и запускает периодическую отправку.
+// Буфер нужно закрыть методом Close, чтобы отправить остаток.
+func NewBuffer(c *Client, opts BufferOptions) *Buffer {
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Buffer{
+		client:   c,
+		opts:     opts,
+		gauges:   make(map[string]float64),
+		counters: make(map[string]int64),
+		kick:     make(chan struct{}, 1),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go b.loop(ctx)
+	return b
+}
+
+// Gauge запоминает значение gauge.
+func (b *Buffer) Gauge(name string, value float64) {
+	b.mu.Lock()
+	b.gauges[name] = value
+	full := b.fullLocked()
+	b.mu.Unlock()
+	if full {
+		b.flushSoon()
+	}
+}
+
+// Counter добавляет приращение counter.
+func (b *Buffer) Counter(name string, delta int64) {
+	b.mu.Lock()
+	b.counters[name] += delta
+	full := b.fullLocked()
+	b.mu.Unlock()
+	if full {
+		b.flushSoon()
+	}
+}
+
+func (b *Buffer) fullLocked() bool {
+	return b.opts.MaxSize > 0 && len(b.gauges)+len(b.counters) >= b.opts.MaxSize
+}
+
+// flushSoon будит цикл отправки, не блокируясь.
+func (b *Buffer) flushSoon() {
+	select {
+	case b.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Flush отправляет накопленные метрики. Ошибка об отброшенном пакете содержит *APIError.
+func (b *Buffer) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	gauges, counters := b.gauges, b.counters
+	b.gauges, b.counters = make(map[string]float64), make(map[string]int64)
+	b.mu.Unlock()
+	if len(gauges) == 0 && len(counters) == 0 {
+		return nil
+	}
+
+	batch := make([]Metric, 0, len(gauges)+len(counters))
+	for name, v := range gauges {
+		batch = append(batch, Gauge(name, v))
+	}
+	for name, d := range counters {
+		batch = append(batch, Counter(name, d))
+	}
+	sort.Slice(batch, func(i, j int) bool {
+		if batch[i].MType != batch[j].MType {
+			return batch[i].MType < batch[j].MType
+		}
+		return batch[i].ID < batch[j].ID
+	})
+
+	if _, err := b.client.Batch(ctx, batch); err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && !retriableStatus(apiErr.Status) {
+			return fmt.Errorf("batch of %d metrics dropped: %w", len(batch), err)
+		}
+		b.restore(gauges, counters)
+		return err
+	}
+	return nil
+}
+
+// restore возвращает неотправленные значения в буфер. Более новые значения gauge,
+// записанные во время отправки, сохраняются.
+func (b *Buffer) restore(gauges map[string]float64, counters map[string]int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for name, v := range gauges {
+		if _, ok := b.gauges[name]; !ok {
+			b.gauges[name] = v
+		}
+	}
+	for name, d := range counters {
+		b.counters[name] += d
+	}
+}
+
+func (b *Buffer) loop(ctx context.Context) {
+	defer close(b.done)
+	ticker := time.NewTicker(b.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-b.kick:
+		}
+		if err := b.Flush(ctx); err != nil && ctx.Err() == nil && b.opts.OnError != nil {
+			b.opts.OnError(err)
+		}
+	}
+}
+
+// Close останавливает периодическую отправку и отправляет остаток буфера.
+// Повторный вызов только отправляет то, что накопилось после закрытия.
+func (b *Buffer) Close(ctx context.Context) error {
+	b.once.Do(func() {
+		b.cancel()
+		<-b.done
+	})
+	return b.Flush(ctx)
+}
@@ -0,0 +1,357 @@
+// Package client — Go-клиент сервера метрик hobrusmetrics.
+//
+// Клиент работает с версионированным API /api/v1: записывает gauge и counter по одной
+// и пакетами, читает значения и список метрик. Тела запросов подписываются HMAC-SHA256
+// (заголовок HashSHA256) и сжимаются gzip, временные ошибки повторяются с паузами,
+// которые прерываются отменой контекста. Доставку запроса выполняет Transport:
+// по умолчанию HTTP, но клиент можно подключить и к любому другому транспорту сервера,
+// например к обработчику в том же процессе (NewHandlerTransport).
+//
+// Для отправки из горячего кода есть буфер (NewBuffer): он накапливает значения
+// в памяти и периодически отправляет их одним пакетом.
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Типы метрик.
+const (
+	GaugeType   = "gauge"
+	CounterType = "counter"
+)
+
+// apiPrefix — префикс версионированного API сервера.
+const apiPrefix = "/api/v1"
+
+// hashHeader — заголовок с подписью тела запроса и ответа.
+const hashHeader = "HashSHA256"
+
+// DefaultRetryIntervals — паузы между повторными попытками по умолчанию (как у агента).
+var DefaultRetryIntervals = []time.Duration{1 * time.Second, 3 * time.Second, 5 * time.Second}
+
+// Metric — значение метрики: Delta для counter, Value для gauge.
+type Metric struct {
+	ID    string   `json:"id"`
+	MType string   `json:"type"`
+	Delta *int64   `json:"delta,omitempty"`
+	Value *float64 `json:"value,omitempty"`
+}
+
+// Gauge возвращает метрику gauge.
+func Gauge(name string, value float64) Metric {
+	return Metric{ID: name, MType: GaugeType, Value: &value}
+}
+
+// Counter возвращает приращение counter.
+func Counter(name string, delta int64) Metric {
+	return Metric{ID: name, MType: CounterType, Delta: &delta}
+}
+
+// Entry — элемент списка метрик со временем последнего обновления.
+type Entry struct {
+	Metric
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Options — настройки клиента.
+type Options struct {
+	// Transport доставляет запросы; nil — HTTP к адресу сервера.
+	Transport Transport
+	// Key — ключ подписи HMAC-SHA256. Если задан, подпись ответа тоже проверяется.
+	Key string
+	// Token передаётся в заголовке Authorization: Bearer (нужен для административных операций).
+	Token string
+	// Gzip включает сжатие тел запросов.
+	Gzip bool
+	// RetryIntervals — паузы между повторными попытками; nil — DefaultRetryIntervals,
+	// пустой срез отключает повторы.
+	RetryIntervals []time.Duration
+}
+
+// Client — клиент сервера метрик. Безопасен для одновременного использования.
+type Client struct {
+	transport Transport
+	key       string
+	token     string
+	gzip      bool
+	retries   []time.Duration
+}
+
+// New создаёт клиент сервера по адресу address ("localhost:8080" или URL с схемой).
+// При заданном opts.Transport адрес не используется и может быть пустым.
+func New(address string, opts Options) (*Client, error) {
+	transport := opts.Transport
+	if transport == nil {
+		if address == "" {
+			return nil, errors.New("server address is required")
+		}
+		var err error
+		if transport, err = NewHTTPTransport(address, nil); err != nil {
+			return nil, err
+		}
+	}
+	retries := opts.RetryIntervals
+	if retries == nil {
+		retries = DefaultRetryIntervals
+	}
+	return &Client{
+		transport: transport,
+		key:       opts.Key,
+		token:     opts.Token,
+		gzip:      opts.Gzip,
+		retries:   retries,
+	}, nil
+}
+
+// Gauge записывает значение gauge.
+func (c *Client) Gauge(ctx context.Context, name string, value float64) error {
+	return c.update(ctx, Gauge(name, value))
+}
+
+// Counter увеличивает counter на delta.
+func (c *Client) Counter(ctx context.Context, name string, delta int64) error {
+	return c.update(ctx, Counter(name, delta))
+}
+
+func (c *Client) update(ctx context.Context, m Metric) error {
+	return c.do(ctx, http.MethodPost, metricPath(m.MType, m.ID), nil, m, nil)
+}
+
+// Batch записывает метрики одним запросом и возвращает их значения после обновления.
+func (c *Client) Batch(ctx context.Context, metrics []Metric) ([]Metric, error) {
+	if len(metrics) == 0 {
+		return nil, nil
+	}
+	var updated []Metric
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/metrics", nil, metrics, &updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Get возвращает значение метрики. Для отсутствующей метрики ошибка удовлетворяет
+// errors.Is(err, ErrNotFound).
+func (c *Client) Get(ctx context.Context, metricType, name string) (Metric, error) {
+	var m Metric
+	err := c.do(ctx, http.MethodGet, metricPath(metricType, name), nil, nil, &m)
+	return m, err
+}
+
+// ListOptions — фильтры и постраничный вывод списка метрик.
+type ListOptions struct {
+	// Types — допустимые типы (пусто — все).
+	Types []string
+	// Name — шаблон имени (glob), Regex — регулярное выражение для имени.
+	Name  string
+	Regex string
+	// Sort — поле сортировки: type, name, updated; префикс "-" — по убыванию.
+	Sort string
+	// Limit — размер страницы (0 — без ограничения).
+	Limit int
+	// Cursor — NextCursor предыдущей страницы.
+	Cursor string
+}
+
+// Page — страница списка метрик. NextCursor пуст на последней странице.
+type Page struct {
+	Items      []Entry
+	NextCursor string
+}
+
+// List возвращает страницу списка метрик.
+func (c *Client) List(ctx context.Context, opts ListOptions) (Page, error) {
+	query := url.Values{}
+	if len(opts.Types) > 0 {
+		query.Set("type", strings.Join(opts.Types, ","))
+	}
+	setNonEmpty(query, "name", opts.Name)
+	setNonEmpty(query, "regex", opts.Regex)
+	setNonEmpty(query, "sort", opts.Sort)
+	setNonEmpty(query, "cursor", opts.Cursor)
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	var page Page
+	resp, err := c.send(ctx, http.MethodGet, apiPrefix+"/metrics", query, nil, &page.Items)
+	if err != nil {
+		return Page{}, err
+	}
+	page.NextCursor = resp.Header.Get("X-Next-Cursor")
+	return page, nil
+}
+
+func setNonEmpty(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
+
+func metricPath(metricType, name string) string {
+	return apiPrefix + "/metrics/" + url.PathEscape(metricType) + "/" + url.PathEscape(name)
+}
+
+// do выполняет запрос с телом in и декодирует ответ в out (если out не nil).
+// Если out — io.Writer, тело ответа записывается в него как есть.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	_, err := c.send(ctx, method, path, query, in, out)
+	return err
+}
+
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, in, out any) (*Response, error) {
+	req := &Request{Method: method, Path: path, Query: query, Header: make(http.Header)}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept-Encoding", "gzip")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if in != nil {
+		body, err := json.Marshal(in)
+		if err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+		if c.gzip {
+			if body, err = compress(body); err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if c.key != "" {
+			req.Header.Set(hashHeader, sign(body, c.key))
+		}
+		req.Body = body
+	}
+
+	resp, err := c.roundTrip(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status >= http.StatusBadRequest {
+		return nil, newAPIError(resp.Status, resp.Header, body)
+	}
+	if w, ok := out.(io.Writer); ok {
+		if _, err := w.Write(body); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+	if out != nil && len(body) > 0 {
+		if err := json.Unmarshal(body, out); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// roundTrip отправляет запрос, повторяя попытку при сетевой ошибке, 5xx и 429.
+// Заголовок Retry-After ответа 429 и 503 заменяет очередную паузу.
+func (c *Client) roundTrip(ctx context.Context, req *Request) (*Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.transport.RoundTrip(ctx, req)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if err == nil && !retriableStatus(resp.Status) {
+			return resp, nil
+		}
+		if attempt >= len(c.retries) {
+			if err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+
+		wait := c.retries[attempt]
+		if err == nil {
+			if after, ok := retryAfter(resp.Header); ok {
+				wait = after
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func retriableStatus(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+}
+
+// retryAfter разбирает заголовок Retry-After в секундах или в формате HTTP-даты.
+func retryAfter(h http.Header) (time.Duration, bool) {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// readBody проверяет подпись ответа и распаковывает его тело.
+func (c *Client) readBody(resp *Response) ([]byte, error) {
+	body := resp.Body
+	if c.key != "" && len(body) > 0 {
+		if got := resp.Header.Get(hashHeader); got != "" && !hmac.Equal([]byte(got), []byte(sign(body, c.key))) {
+			return nil, ErrInvalidSignature
+		}
+	}
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") && len(body) > 0 {
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("decompress response: %w", err)
+		}
+		defer gr.Close()
+		if body, err = io.ReadAll(gr); err != nil {
+			return nil, fmt.Errorf("decompress response: %w", err)
+		}
+	}
+	return body, nil
+}
+
+// sign вычисляет HMAC-SHA256 от data и возвращает шестнадцатеричную строку (как сервер).
+func sign(data []byte, key string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to write to gzip: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close gzip: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,317 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/handlers"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/middleware"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/repository"
+	"github.com/Hobrus/hobrusmetrics.git/internal/app/server/service"
+)
+
+const testKey = "secret"
+
+// newServer собирает сервер с тем же порядком middleware, что и cmd/server.
+func newServer(key string) (*gin.Engine, *service.MetricsService) {
+	gin.SetMode(gin.TestMode)
+	ms := &service.MetricsService{Storage: repository.NewMemStorage()}
+	router := gin.New()
+	if key != "" {
+		router.Use(middleware.HashRequestMiddleware(key))
+		router.Use(middleware.HashResponseMiddleware(key))
+	}
+	router.Use(middleware.GzipMiddleware())
+	h := handlers.NewHandler(ms)
+	h.SetupRoutes(router)
+	h.SetupAdminRoutes(router, "", logrus.New())
+	return router, ms
+}
+
+func newClient(t *testing.T, transport Transport, opts Options) *Client {
+	t.Helper()
+	opts.Transport = transport
+	if opts.RetryIntervals == nil {
+		opts.RetryIntervals = []time.Duration{}
+	}
+	c, err := New("", opts)
+	require.NoError(t, err)
+	return c
+}
+
+func TestClient_SignedGzipRoundTrip(t *testing.T) {
+	router, ms := newServer(testKey)
+	c := newClient(t, NewHandlerTransport(router), Options{Key: testKey, Gzip: true})
+	ctx := context.Background()
+
+	require.NoError(t, c.Gauge(ctx, "Alloc", 1.5))
+	require.NoError(t, c.Counter(ctx, "PollCount", 2))
+	require.NoError(t, c.Counter(ctx, "PollCount", 3))
+
+	value, err := ms.GetMetricValue("counter", "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, "5", value)
+
+	m, err := c.Get(ctx, GaugeType, "Alloc")
+	require.NoError(t, err)
+	require.NotNil(t, m.Value)
+	assert.Equal(t, 1.5, *m.Value)
+
+	updated, err := c.Batch(ctx, []Metric{Gauge("Alloc", 2), Counter("PollCount", 1)})
+	require.NoError(t, err)
+	require.Len(t, updated, 2)
+
+	m, err = c.Get(ctx, CounterType, "PollCount")
+	require.NoError(t, err)
+	require.NotNil(t, m.Delta)
+	assert.Equal(t, int64(6), *m.Delta)
+}
+
+func TestClient_Errors(t *testing.T) {
+	router, _ := newServer(testKey)
+	ctx := context.Background()
+
+	c := newClient(t, NewHandlerTransport(router), Options{Key: testKey})
+	_, err := c.Get(ctx, GaugeType, "Missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	wrongKey := newClient(t, NewHandlerTransport(router), Options{Key: "other", Gzip: true})
+	err = wrongKey.Gauge(ctx, "Alloc", 1)
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+	assert.Equal(t, middleware.CodeInvalidSignature, apiErr.Code)
+
+	require.NoError(t, c.Gauge(ctx, "Alloc", 1))
+	_, err = wrongKey.Get(ctx, GaugeType, "Alloc")
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestClient_ListPages(t *testing.T) {
+	router, ms := newServer("")
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, ms.UpdateMetric("gauge", name, "1"))
+	}
+	require.NoError(t, ms.UpdateMetric("counter", "d", "1"))
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	c, err := New(srv.URL, Options{})
+	require.NoError(t, err)
+
+	var names []string
+	opts := ListOptions{Types: []string{GaugeType}, Sort: "name", Limit: 2}
+	for {
+		page, err := c.List(context.Background(), opts)
+		require.NoError(t, err)
+		for _, e := range page.Items {
+			names = append(names, e.ID)
+			assert.False(t, e.UpdatedAt.IsZero())
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+}
+
+func TestClient_EscapesMetricNames(t *testing.T) {
+	type seen struct{ method, path, escaped string }
+	var requests []seen
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, seen{r.Method, r.URL.Path, r.URL.EscapedPath()})
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"a b/c","type":"gauge","value":1}`))
+	}))
+	defer srv.Close()
+	c, err := New(srv.URL+"/base/", Options{RetryIntervals: []time.Duration{}})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, c.Gauge(ctx, "a b/c", 1))
+	m, err := c.Get(ctx, GaugeType, "a b/c")
+	require.NoError(t, err)
+	assert.Equal(t, "a b/c", m.ID)
+	require.NoError(t, c.Delete(ctx, GaugeType, "a b/c"))
+
+	require.Len(t, requests, 3)
+	for i, method := range []string{http.MethodPost, http.MethodGet, http.MethodDelete} {
+		assert.Equal(t, method, requests[i].method)
+		assert.Equal(t, "/base/api/v1/metrics/gauge/a b/c", requests[i].path)
+		assert.Equal(t, "/base/api/v1/metrics/gauge/a%20b%2Fc", requests[i].escaped)
+	}
+}
+
+func TestClient_Retries(t *testing.T) {
+	var calls atomic.Int32
+	flaky := TransportFunc(func(ctx context.Context, req *Request) (*Response, error) {
+		switch calls.Add(1) {
+		case 1:
+			return nil, errors.New("connection reset")
+		case 2:
+			return &Response{Status: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": {"0"}}}, nil
+		default:
+			return &Response{Status: http.StatusOK, Header: http.Header{}}, nil
+		}
+	})
+	c := newClient(t, flaky, Options{RetryIntervals: []time.Duration{time.Millisecond, time.Hour}})
+	require.NoError(t, c.Gauge(context.Background(), "Alloc", 1))
+	assert.Equal(t, int32(3), calls.Load())
+
+	calls.Store(0)
+	c = newClient(t, flaky, Options{RetryIntervals: []time.Duration{}})
+	assert.Error(t, c.Gauge(context.Background(), "Alloc", 1))
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestClient_RetryStopsOnContext(t *testing.T) {
+	failing := TransportFunc(func(ctx context.Context, req *Request) (*Response, error) {
+		return &Response{Status: http.StatusBadGateway, Header: http.Header{}}, nil
+	})
+	c := newClient(t, failing, Options{RetryIntervals: []time.Duration{time.Hour}})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := c.Counter(ctx, "PollCount", 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestBuffer_PeriodicFlush(t *testing.T) {
+	router, ms := newServer("")
+	c := newClient(t, NewHandlerTransport(router), Options{})
+	b := NewBuffer(c, BufferOptions{FlushInterval: 10 * time.Millisecond})
+
+	b.Counter("PollCount", 2)
+	b.Counter("PollCount", 3)
+	b.Gauge("Alloc", 1)
+	b.Gauge("Alloc", 7)
+
+	assert.Eventually(t, func() bool {
+		v, err := ms.GetMetricValue("counter", "PollCount")
+		return err == nil && v == "5"
+	}, time.Second, 5*time.Millisecond)
+	v, err := ms.GetMetricValue("gauge", "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, "7", v)
+
+	b.Counter("PollCount", 1)
+	require.NoError(t, b.Close(context.Background()))
+	v, err = ms.GetMetricValue("counter", "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, "6", v)
+}
+
+func TestBuffer_KeepsValuesOnFailure(t *testing.T) {
+	router, ms := newServer("")
+	handler := NewHandlerTransport(router)
+	var down atomic.Bool
+	down.Store(true)
+	transport := TransportFunc(func(ctx context.Context, req *Request) (*Response, error) {
+		if down.Load() {
+			return nil, errors.New("connection refused")
+		}
+		return handler.RoundTrip(ctx, req)
+	})
+	c := newClient(t, transport, Options{})
+	b := NewBuffer(c, BufferOptions{FlushInterval: time.Hour})
+	defer b.Close(context.Background())
+
+	b.Counter("PollCount", 2)
+	require.Error(t, b.Flush(context.Background()))
+	b.Counter("PollCount", 3)
+
+	down.Store(false)
+	require.NoError(t, b.Flush(context.Background()))
+	v, err := ms.GetMetricValue("counter", "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, "5", v)
+}
+
+func TestBuffer_RetriesOnlyTransientFailures(t *testing.T) {
+	for status, restored := range map[int]bool{
+		http.StatusTooManyRequests:       true,
+		http.StatusServiceUnavailable:    true,
+		http.StatusBadRequest:            false,
+		http.StatusForbidden:             false,
+		http.StatusUnprocessableEntity:   false,
+		http.StatusInternalServerError:   true,
+		http.StatusRequestEntityTooLarge: false,
+	} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			var sent []int
+			transport := TransportFunc(func(ctx context.Context, req *Request) (*Response, error) {
+				var batch []Metric
+				require.NoError(t, json.Unmarshal(req.Body, &batch))
+				sent = append(sent, len(batch))
+				if len(sent) == 1 {
+					return &Response{Status: status, Header: http.Header{}}, nil
+				}
+				return &Response{Status: http.StatusOK, Header: http.Header{}, Body: []byte("[]")}, nil
+			})
+			c := newClient(t, transport, Options{RetryIntervals: []time.Duration{}})
+			b := NewBuffer(c, BufferOptions{FlushInterval: time.Hour})
+			defer b.Close(context.Background())
+
+			b.Gauge("a", 1)
+			b.Gauge("b", 2)
+			err := b.Flush(context.Background())
+			var apiErr *APIError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, status, apiErr.Status)
+
+			b.Gauge("c", 3)
+			require.NoError(t, b.Flush(context.Background()))
+			if restored {
+				assert.Equal(t, []int{2, 3}, sent, "the failed batch must be sent again")
+			} else {
+				assert.Equal(t, []int{2, 1}, sent, "the rejected batch must be dropped")
+			}
+		})
+	}
+}
+
+func TestBuffer_ReportsDroppedBatches(t *testing.T) {
+	rejecting := TransportFunc(func(ctx context.Context, req *Request) (*Response, error) {
+		return &Response{Status: http.StatusUnprocessableEntity, Header: http.Header{}}, nil
+	})
+	c := newClient(t, rejecting, Options{RetryIntervals: []time.Duration{}})
+	errs := make(chan error, 1)
+	b := NewBuffer(c, BufferOptions{FlushInterval: time.Hour, MaxSize: 1, OnError: func(err error) { errs <- err }})
+
+	b.Counter("PollCount", 1)
+	select {
+	case err := <-errs:
+		assert.Contains(t, err.Error(), "dropped")
+	case <-time.After(time.Second):
+		t.Fatal("expected the dropped batch to be reported")
+	}
+	require.NoError(t, b.Close(context.Background()), "nothing is left to send")
+}
+
+func TestBuffer_MaxSizeTriggersFlush(t *testing.T) {
+	router, ms := newServer("")
+	c := newClient(t, NewHandlerTransport(router), Options{})
+	b := NewBuffer(c, BufferOptions{FlushInterval: time.Hour, MaxSize: 2})
+	defer b.Close(context.Background())
+
+	b.Gauge("a", 1)
+	b.Gauge("b", 2)
+	assert.Eventually(t, func() bool {
+		_, err := ms.GetMetricValue("gauge", "b")
+		return err == nil
+	}, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrNotFound — метрика не найдена (ответ 404).
+	ErrNotFound = errors.New("metric not found")
+	// ErrInvalidSignature — подпись ответа не совпала с вычисленной по ключу клиента.
+	ErrInvalidSignature = errors.New("invalid response signature")
+)
+
+// APIError — ответ сервера с кодом ошибки. Поля Code, Title и Detail заполняются
+// из тела application/problem+json; для ответов в другом формате Detail — текст тела.
+type APIError struct {
+	Status int
+	Code   string
+	Title  string
+	Detail string
+}
+
+func (e *APIError) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Title
+	}
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Code != "" {
+		return fmt.Sprintf("server responded with %d (%s): %s", e.Status, e.Code, msg)
+	}
+	return fmt.Sprintf("server responded with %d: %s", e.Status, msg)
+}
+
+// Is позволяет сравнивать ответ 404 с ErrNotFound через errors.Is.
+func (e *APIError) Is(target error) bool {
+	return target == ErrNotFound && e.Status == http.StatusNotFound
+}
+
+// newAPIError разбирает тело ответа с ошибкой.
+func newAPIError(status int, header http.Header, body []byte) *APIError {
+	e := &APIError{Status: status}
+	contentType := header.Get("Content-Type")
+	if strings.Contains(contentType, "json") && json.Unmarshal(body, e) == nil {
+		return e
+	}
+	e.Detail = strings.TrimSpace(string(body))
+	return e
+}
+
+// UnmarshalJSON разбирает problem+json: {"type", "title", "status", "detail", "code"}.
+func (e *APIError) UnmarshalJSON(data []byte) error {
+	var p struct {
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+		Code   string `json:"code"`
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	e.Code, e.Title, e.Detail = p.Code, p.Title, p.Detail
+	return nil
+}
@@ -0,0 +1,40 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Hobrus/hobrusmetrics.git/pkg/client"
+)
+
+// Example showing direct reporting and buffered reporting with periodic flush.
+func Example() {
+	c, err := client.New("localhost:8080", client.Options{Key: "secret", Gzip: true})
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Gauge(ctx, "QueueLength", 12); err != nil {
+		log.Print(err)
+	}
+
+	buf := client.NewBuffer(c, client.BufferOptions{
+		FlushInterval: 10 * time.Second,
+		OnError:       func(err error) { log.Print(err) },
+	})
+	for i := 0; i < 100; i++ {
+		buf.Counter("RequestsServed", 1)
+	}
+	if err := buf.Close(ctx); err != nil {
+		log.Print(err)
+	}
+
+	m, err := c.Get(ctx, client.CounterType, "RequestsServed")
+	if err == nil {
+		fmt.Println(*m.Delta)
+	}
+}
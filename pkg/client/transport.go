@@ -0,0 +1,155 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Request — запрос к серверу в виде, не зависящем от транспорта. Body уже сжат
+// и подписан клиентом; транспорт передаёт его без изменений.
+type Request struct {
+	Method string
+	// Path — путь в экранированном виде: сегменты уже обработаны url.PathEscape.
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// Response — ответ сервера. Body — тело в том виде, в котором оно пришло
+// (возможно, сжатое): подпись ответа проверяется по нему.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Transport доставляет запрос до сервера. Клиент повторяет запрос при ошибке
+// транспорта, поэтому RoundTrip не должен изменять req.
+type Transport interface {
+	RoundTrip(ctx context.Context, req *Request) (*Response, error)
+}
+
+// TransportFunc позволяет использовать функцию как Transport.
+type TransportFunc func(ctx context.Context, req *Request) (*Response, error)
+
+// RoundTrip вызывает f(ctx, req).
+func (f TransportFunc) RoundTrip(ctx context.Context, req *Request) (*Response, error) {
+	return f(ctx, req)
+}
+
+// HTTPTransport отправляет запросы по HTTP.
+type HTTPTransport struct {
+	BaseURL *url.URL
+	Client  *http.Client
+}
+
+// NewHTTPTransport создаёт HTTP-транспорт к серверу address. Адрес без схемы
+// дополняется "http://". nil httpClient заменяется клиентом по умолчанию.
+func NewHTTPTransport(address string, httpClient *http.Client) (*HTTPTransport, error) {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	base, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server address %q: %w", address, err)
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	return &HTTPTransport{BaseURL: base, Client: httpClient}, nil
+}
+
+// RoundTrip выполняет HTTP-запрос. Заголовок Accept-Encoding задаёт клиент,
+// поэтому net/http не распаковывает ответ сам и тело возвращается как есть.
+func (t *HTTPTransport) RoundTrip(ctx context.Context, req *Request) (*Response, error) {
+	httpReq, err := newHTTPRequest(ctx, t.BaseURL, req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.Client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Status: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
+
+// HandlerTransport передаёт запросы http.Handler в том же процессе, без сети.
+// Подходит для приложений, которые встраивают сервер метрик, и для тестов.
+type HandlerTransport struct {
+	Handler http.Handler
+}
+
+// NewHandlerTransport создаёт транспорт к обработчику handler.
+func NewHandlerTransport(handler http.Handler) *HandlerTransport {
+	return &HandlerTransport{Handler: handler}
+}
+
+// RoundTrip вызывает обработчик и собирает его ответ.
+func (t *HandlerTransport) RoundTrip(ctx context.Context, req *Request) (*Response, error) {
+	httpReq, err := newHTTPRequest(ctx, &url.URL{Scheme: "http", Host: "localhost"}, req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.RemoteAddr = "127.0.0.1:0"
+	w := &responseRecorder{header: make(http.Header)}
+	t.Handler.ServeHTTP(w, httpReq)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return &Response{Status: w.status, Header: w.header, Body: w.body.Bytes()}, nil
+}
+
+// newHTTPRequest собирает *http.Request из запроса клиента относительно base.
+func newHTTPRequest(ctx context.Context, base *url.URL, req *Request) (*http.Request, error) {
+	u := *base
+	// Путь экранирован клиентом: RawPath сохраняет экранирование сегментов (например, %2F
+	// в имени метрики), чтобы url.URL не экранировал путь повторно.
+	u.RawPath = strings.TrimSuffix(base.EscapedPath(), "/") + req.Path
+	path, err := url.PathUnescape(u.RawPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request path %q: %w", req.Path, err)
+	}
+	u.Path = path
+	if len(req.Query) > 0 {
+		u.RawQuery = req.Query.Encode()
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, u.String(), bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range req.Header {
+		httpReq.Header[k] = append([]string(nil), v...)
+	}
+	return httpReq, nil
+}
+
+// responseRecorder — минимальный http.ResponseWriter для HandlerTransport.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header { return r.header }
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(data)
+}
@@ -0,0 +1,281 @@
+// Package ddsketch реализует DDSketch — объединяемый скетч для оценки квантилей
+// с гарантированной относительной точностью и ограниченным объёмом памяти.
+//
+// Положительные и отрицательные значения раскладываются по логарифмическим корзинам:
+// значение v попадает в корзину ceil(log_gamma(|v|)), где gamma = (1+alpha)/(1-alpha).
+// Любой квантиль оценивается с относительной ошибкой не более alpha, пока число корзин
+// не превышает MaxBins; при превышении сливаются корзины с наименьшими по модулю значениями,
+// так что точность теряется только у значений, близких к нулю.
+package ddsketch
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Параметры скетча по умолчанию.
+const (
+	DefaultRelativeAccuracy = 0.01
+	DefaultMaxBins          = 2048
+)
+
+// minIndexableValue — значения меньше по модулю считаются нулём.
+const minIndexableValue = 1e-9
+
+// ErrIncompatible возвращается при объединении скетчей с разной точностью.
+var ErrIncompatible = errors.New("sketches have different relative accuracy")
+
+// Sketch — DDSketch. Нулевое значение непригодно, используйте New.
+// Поля экспортированы для сериализации в JSON; меняйте их только через методы.
+type Sketch struct {
+	Alpha    float64        `json:"alpha"`
+	MaxBins  int            `json:"max_bins"`
+	Positive map[int]uint64 `json:"positive,omitempty"` // индекс корзины |v| -> число наблюдений
+	Negative map[int]uint64 `json:"negative,omitempty"`
+	Zero     uint64         `json:"zero"`
+	Count    uint64         `json:"count"`
+	Sum      float64        `json:"sum"`
+	Min      float64        `json:"min"`
+	Max      float64        `json:"max"`
+}
+
+// New создаёт пустой скетч с относительной точностью alpha (0 < alpha < 1)
+// и ограничением числа корзин maxBins (maxBins <= 0 — DefaultMaxBins).
+func New(alpha float64, maxBins int) (*Sketch, error) {
+	if !(alpha > 0 && alpha < 1) {
+		return nil, fmt.Errorf("relative accuracy must be in (0, 1), got %v", alpha)
+	}
+	if maxBins <= 0 {
+		maxBins = DefaultMaxBins
+	}
+	return &Sketch{
+		Alpha:    alpha,
+		MaxBins:  maxBins,
+		Positive: make(map[int]uint64),
+		Negative: make(map[int]uint64),
+	}, nil
+}
+
+// logGamma возвращает ln(gamma).
+func (s *Sketch) logGamma() float64 {
+	return math.Log((1 + s.Alpha) / (1 - s.Alpha))
+}
+
+// index возвращает номер корзины для положительного значения v.
+func (s *Sketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma()))
+}
+
+// value возвращает оценку значения в корзине i: середину корзины в смысле относительной ошибки.
+func (s *Sketch) value(i int) float64 {
+	g := math.Exp(s.logGamma())
+	return 2 * math.Pow(g, float64(i)) / (g + 1)
+}
+
+// Add добавляет наблюдение. NaN и бесконечности игнорируются.
+func (s *Sketch) Add(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	switch {
+	case v > minIndexableValue:
+		s.Positive[s.index(v)]++
+	case v < -minIndexableValue:
+		s.Negative[s.index(-v)]++
+	default:
+		s.Zero++
+	}
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Count++
+	s.Sum += v
+	s.collapse()
+}
+
+// Merge добавляет к скетчу все наблюдения other. Точность скетчей должна совпадать;
+// ограничение числа корзин результата — меньшее из двух.
+func (s *Sketch) Merge(other *Sketch) error {
+	if s.Alpha != other.Alpha {
+		return ErrIncompatible
+	}
+	if other.Count == 0 {
+		return nil
+	}
+	for i, c := range other.Positive {
+		s.Positive[i] += c
+	}
+	for i, c := range other.Negative {
+		s.Negative[i] += c
+	}
+	s.Zero += other.Zero
+	if s.Count == 0 || other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if s.Count == 0 || other.Max > s.Max {
+		s.Max = other.Max
+	}
+	s.Count += other.Count
+	s.Sum += other.Sum
+	if other.MaxBins < s.MaxBins {
+		s.MaxBins = other.MaxBins
+	}
+	s.collapse()
+	return nil
+}
+
+// LimitBins уменьшает ограничение числа корзин до maxBins (если оно больше) и сжимает скетч.
+func (s *Sketch) LimitBins(maxBins int) {
+	if maxBins > 0 && (s.MaxBins <= 0 || s.MaxBins > maxBins) {
+		s.MaxBins = maxBins
+	}
+	s.collapse()
+}
+
+// collapse сливает корзины с наименьшими по модулю значениями, пока их число превышает MaxBins.
+// Сначала сжимаются корзины отрицательных значений, затем положительных.
+func (s *Sketch) collapse() {
+	excess := len(s.Positive) + len(s.Negative) - s.MaxBins
+	if excess <= 0 {
+		return
+	}
+	excess = collapseLowest(s.Negative, excess)
+	collapseLowest(s.Positive, excess)
+}
+
+// collapseLowest сливает excess корзин с наименьшими индексами в следующую за ними
+// и возвращает, сколько корзин ещё нужно убрать.
+func collapseLowest(bins map[int]uint64, excess int) int {
+	if excess <= 0 || len(bins) < 2 {
+		return excess
+	}
+	n := excess
+	if n > len(bins)-1 {
+		n = len(bins) - 1
+	}
+	indexes := sortedIndexes(bins)
+	target := indexes[n]
+	for _, i := range indexes[:n] {
+		bins[target] += bins[i]
+		delete(bins, i)
+	}
+	return excess - n
+}
+
+// sortedIndexes возвращает индексы корзин по возрастанию.
+func sortedIndexes(bins map[int]uint64) []int {
+	indexes := make([]int, 0, len(bins))
+	for i := range bins {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// Quantile возвращает оценку квантиля q (0 <= q <= 1).
+func (s *Sketch) Quantile(q float64) (float64, error) {
+	if !(q >= 0 && q <= 1) {
+		return 0, fmt.Errorf("quantile must be in [0, 1], got %v", q)
+	}
+	if s.Count == 0 {
+		return 0, errors.New("sketch is empty")
+	}
+	switch q {
+	case 0:
+		return s.Min, nil
+	case 1:
+		return s.Max, nil
+	}
+
+	rank := uint64(q * float64(s.Count-1))
+	var seen uint64
+
+	// Отрицательные значения: от наибольших по модулю к наименьшим.
+	neg := sortedIndexes(s.Negative)
+	for k := len(neg) - 1; k >= 0; k-- {
+		seen += s.Negative[neg[k]]
+		if seen > rank {
+			return s.clamp(-s.value(neg[k])), nil
+		}
+	}
+	seen += s.Zero
+	if seen > rank {
+		return 0, nil
+	}
+	for _, i := range sortedIndexes(s.Positive) {
+		seen += s.Positive[i]
+		if seen > rank {
+			return s.clamp(s.value(i)), nil
+		}
+	}
+	return s.Max, nil
+}
+
+// clamp ограничивает оценку точными минимумом и максимумом.
+func (s *Sketch) clamp(v float64) float64 {
+	return math.Max(s.Min, math.Min(s.Max, v))
+}
+
+// Validate проверяет согласованность скетча, полученного извне (например, из JSON),
+// и инициализирует отсутствующие карты корзин.
+func (s *Sketch) Validate() error {
+	if !(s.Alpha > 0 && s.Alpha < 1) {
+		return fmt.Errorf("relative accuracy must be in (0, 1), got %v", s.Alpha)
+	}
+	if s.MaxBins <= 0 {
+		return errors.New("max_bins must be positive")
+	}
+	if len(s.Positive)+len(s.Negative) > s.MaxBins {
+		return fmt.Errorf("sketch has more than %d bins", s.MaxBins)
+	}
+	total := s.Zero
+	for _, c := range s.Positive {
+		total += c
+	}
+	for _, c := range s.Negative {
+		total += c
+	}
+	if total != s.Count {
+		return fmt.Errorf("sketch count %d does not match bin total %d", s.Count, total)
+	}
+	if math.IsNaN(s.Sum) || math.IsNaN(s.Min) || math.IsNaN(s.Max) {
+		return errors.New("sketch fields must be numbers")
+	}
+	if s.Count > 0 && s.Min > s.Max {
+		return errors.New("sketch min must not exceed max")
+	}
+	if s.Positive == nil {
+		s.Positive = make(map[int]uint64)
+	}
+	if s.Negative == nil {
+		s.Negative = make(map[int]uint64)
+	}
+	return nil
+}
+
+// Clone возвращает независимую копию скетча.
+func (s *Sketch) Clone() *Sketch {
+	cpy := &Sketch{
+		Alpha:    s.Alpha,
+		MaxBins:  s.MaxBins,
+		Positive: make(map[int]uint64, len(s.Positive)),
+		Negative: make(map[int]uint64, len(s.Negative)),
+		Zero:     s.Zero,
+		Count:    s.Count,
+		Sum:      s.Sum,
+		Min:      s.Min,
+		Max:      s.Max,
+	}
+	for i, c := range s.Positive {
+		cpy.Positive[i] = c
+	}
+	for i, c := range s.Negative {
+		cpy.Negative[i] = c
+	}
+	return cpy
+}
@@ -0,0 +1,135 @@
+package ddsketch
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// exactQuantile возвращает квантиль отсортированной выборки тем же правилом ранга, что и скетч.
+func exactQuantile(sorted []float64, q float64) float64 {
+	return sorted[int(q*float64(len(sorted)-1))]
+}
+
+func TestQuantileRelativeAccuracy(t *testing.T) {
+	const alpha = 0.01
+	s, err := New(alpha, 0)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	values := make([]float64, 10000)
+	for i := range values {
+		values[i] = math.Exp(rnd.NormFloat64()) // логнормальное распределение, как у латентности
+		s.Add(values[i])
+	}
+	sort.Float64s(values)
+
+	for _, q := range []float64{0.01, 0.25, 0.5, 0.9, 0.99, 0.999} {
+		got, err := s.Quantile(q)
+		if err != nil {
+			t.Fatalf("quantile %v: %v", q, err)
+		}
+		want := exactQuantile(values, q)
+		if rel := math.Abs(got-want) / want; rel > alpha {
+			t.Errorf("q=%v: want %v, got %v (relative error %v)", q, want, got, rel)
+		}
+	}
+	if s.Count != uint64(len(values)) {
+		t.Fatalf("count: want %d, got %d", len(values), s.Count)
+	}
+}
+
+func TestMergeEqualsCombinedStream(t *testing.T) {
+	a, _ := New(0.02, 0)
+	b, _ := New(0.02, 0)
+	all, _ := New(0.02, 0)
+	for i := 1; i <= 1000; i++ {
+		v := float64(i) - 100 // есть отрицательные значения и ноль
+		if i%2 == 0 {
+			a.Add(v)
+		} else {
+			b.Add(v)
+		}
+		all.Add(v)
+	}
+	if err := a.Merge(b); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	for _, q := range []float64{0, 0.05, 0.1, 0.5, 0.99, 1} {
+		got, _ := a.Quantile(q)
+		want, _ := all.Quantile(q)
+		if got != want {
+			t.Errorf("q=%v: merged %v, combined %v", q, got, want)
+		}
+	}
+
+	other, _ := New(0.05, 0)
+	other.Add(1)
+	if err := a.Merge(other); !errors.Is(err, ErrIncompatible) {
+		t.Fatalf("expected ErrIncompatible, got %v", err)
+	}
+}
+
+func TestBinsAreBounded(t *testing.T) {
+	s, _ := New(0.01, 64)
+	for i := 0; i < 100000; i++ {
+		s.Add(math.Pow(1.001, float64(i)))
+	}
+	if n := len(s.Positive) + len(s.Negative); n > 64 {
+		t.Fatalf("expected at most 64 bins, got %d", n)
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("collapsed sketch must stay valid: %v", err)
+	}
+	// Высокие квантили сохраняют точность после сжатия.
+	got, _ := s.Quantile(0.99)
+	want := math.Pow(1.001, 0.99*99999)
+	if rel := math.Abs(got-want) / want; rel > 0.011 {
+		t.Fatalf("p99 after collapse: want %v, got %v", want, got)
+	}
+
+	s.LimitBins(8)
+	if n := len(s.Positive) + len(s.Negative); n > 8 {
+		t.Fatalf("LimitBins must shrink the sketch, got %d bins", n)
+	}
+}
+
+func TestJSONRoundTripAndValidate(t *testing.T) {
+	s, _ := New(0.01, 128)
+	for _, v := range []float64{-3, 0, 0.5, 2, 2, 100} {
+		s.Add(v)
+	}
+	raw, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded Sketch
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if err := decoded.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	for _, q := range []float64{0, 0.3, 0.5, 1} {
+		want, _ := s.Quantile(q)
+		got, _ := decoded.Quantile(q)
+		if got != want {
+			t.Errorf("q=%v: want %v, got %v", q, want, got)
+		}
+	}
+
+	decoded.Count++
+	if err := decoded.Validate(); err == nil {
+		t.Fatalf("inconsistent count must be rejected")
+	}
+	if _, err := New(1, 0); err == nil {
+		t.Fatalf("alpha=1 must be rejected")
+	}
+	if _, err := s.Quantile(1.5); err == nil {
+		t.Fatalf("quantile out of range must be rejected")
+	}
+}
@@ -0,0 +1,180 @@
+// Package hll реализует HyperLogLog — объединяемый скетч для оценки числа уникальных элементов.
+//
+// Скетч точности p занимает 2^p байт и оценивает мощность множества с относительной
+// стандартной ошибкой около 1.04/sqrt(2^p). Скетчи разной точности объединяются
+// с понижением точности до меньшей из двух.
+package hll
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// Допустимая точность и точность по умолчанию.
+const (
+	MinPrecision     = 4
+	MaxPrecision     = 16
+	DefaultPrecision = 14
+)
+
+// Sketch — скетч HyperLogLog. Нулевое значение непригодно, используйте New.
+type Sketch struct {
+	Precision uint8  `json:"precision"`
+	Registers []byte `json:"registers"` // в JSON кодируется в base64
+}
+
+// New создаёт пустой скетч точности precision.
+func New(precision uint8) (*Sketch, error) {
+	if precision < MinPrecision || precision > MaxPrecision {
+		return nil, fmt.Errorf("precision must be in [%d, %d], got %d", MinPrecision, MaxPrecision, precision)
+	}
+	return &Sketch{Precision: precision, Registers: make([]byte, 1<<precision)}, nil
+}
+
+// hash64 хэширует элемент: FNV-1a с финальным перемешиванием (splitmix64),
+// чтобы старшие биты, по которым выбирается регистр, были распределены равномерно.
+func hash64(member string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(member))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Add добавляет элемент множества.
+func (s *Sketch) Add(member string) {
+	x := hash64(member)
+	p := s.Precision
+	idx := x >> (64 - p)
+	w := x<<p | 1<<(p-1) // сторожевой бит ограничивает ранг значением 64-p+1
+	rank := uint8(bits.LeadingZeros64(w)) + 1
+	if rank > s.Registers[idx] {
+		s.Registers[idx] = rank
+	}
+}
+
+// Merge объединяет скетчи. При разной точности результат получает меньшую из двух.
+func (s *Sketch) Merge(other *Sketch) error {
+	if err := other.Validate(); err != nil {
+		return err
+	}
+	src := other
+	if other.Precision > s.Precision {
+		src = other.reduce(s.Precision)
+	} else if other.Precision < s.Precision {
+		*s = *s.reduce(other.Precision)
+	}
+	for i, r := range src.Registers {
+		if r > s.Registers[i] {
+			s.Registers[i] = r
+		}
+	}
+	return nil
+}
+
+// reduce возвращает копию скетча с меньшей точностью p.
+// Отброшенные биты индекса регистра становятся старшими битами хэша, поэтому ранг пересчитывается.
+func (s *Sketch) reduce(p uint8) *Sketch {
+	shift := s.Precision - p
+	out := &Sketch{Precision: p, Registers: make([]byte, 1<<p)}
+	for i, r := range s.Registers {
+		if r == 0 {
+			continue
+		}
+		low := uint64(i) & (1<<shift - 1)
+		rank := r + shift
+		if low != 0 {
+			rank = uint8(bits.LeadingZeros64(low<<(64-shift))) + 1
+		}
+		j := i >> shift
+		if rank > out.Registers[j] {
+			out.Registers[j] = rank
+		}
+	}
+	return out
+}
+
+// Estimate возвращает оценку числа уникальных элементов.
+func (s *Sketch) Estimate() uint64 {
+	if len(s.Registers) == 0 {
+		return 0
+	}
+	m := float64(len(s.Registers))
+	var sum float64
+	zeros := 0
+	for _, r := range s.Registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := alpha(m) * m * m / sum
+	// Поправка для малых мощностей: линейный подсчёт по пустым регистрам.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+// alpha — поправочный коэффициент HyperLogLog для m регистров.
+func alpha(m float64) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/m)
+	}
+}
+
+// RelativeError возвращает относительную стандартную ошибку оценки: 1.04/sqrt(2^p).
+func (s *Sketch) RelativeError() float64 {
+	if len(s.Registers) == 0 {
+		return 0
+	}
+	return 1.04 / math.Sqrt(float64(len(s.Registers)))
+}
+
+// Validate проверяет скетч, полученный извне (например, из JSON).
+func (s *Sketch) Validate() error {
+	if s.Precision < MinPrecision || s.Precision > MaxPrecision {
+		return fmt.Errorf("precision must be in [%d, %d], got %d", MinPrecision, MaxPrecision, s.Precision)
+	}
+	if len(s.Registers) != 1<<s.Precision {
+		return fmt.Errorf("precision %d requires %d registers, got %d", s.Precision, 1<<s.Precision, len(s.Registers))
+	}
+	maxRank := byte(64 - s.Precision + 1)
+	for _, r := range s.Registers {
+		if r > maxRank {
+			return errors.New("register value out of range")
+		}
+	}
+	return nil
+}
+
+// Clone возвращает независимую копию скетча.
+func (s *Sketch) Clone() *Sketch {
+	return &Sketch{Precision: s.Precision, Registers: append([]byte(nil), s.Registers...)}
+}
+
+// MarshalJSON дополняет сериализованный скетч оценкой мощности и её ошибкой.
+// При разборе эти поля игнорируются: они всегда вычисляются по регистрам.
+func (s Sketch) MarshalJSON() ([]byte, error) {
+	type plain Sketch
+	return json.Marshal(struct {
+		plain
+		Estimate      uint64  `json:"estimate"`
+		RelativeError float64 `json:"relative_error"`
+	}{plain(s), s.Estimate(), s.RelativeError()})
+}
@@ -0,0 +1,94 @@
+package hll
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func withinError(t *testing.T, s *Sketch, want int) {
+	t.Helper()
+	got := float64(s.Estimate())
+	// Допускаем три стандартные ошибки: тест не должен быть хрупким.
+	if math.Abs(got-float64(want)) > 3*s.RelativeError()*float64(want)+1 {
+		t.Fatalf("estimate %v is too far from %d (error bound %.4f)", got, want, s.RelativeError())
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	for _, n := range []int{0, 10, 1000, 100000} {
+		s, err := New(DefaultPrecision)
+		if err != nil {
+			t.Fatalf("new: %v", err)
+		}
+		for i := 0; i < n; i++ {
+			s.Add("user-" + strconv.Itoa(i))
+			s.Add("user-" + strconv.Itoa(i)) // повторы не влияют на оценку
+		}
+		withinError(t, s, n)
+	}
+}
+
+func TestMergeDifferentPrecision(t *testing.T) {
+	a, _ := New(14)
+	b, _ := New(10)
+	for i := 0; i < 20000; i++ {
+		a.Add("ip-" + strconv.Itoa(i))
+	}
+	for i := 10000; i < 30000; i++ {
+		b.Add("ip-" + strconv.Itoa(i))
+	}
+	if err := a.Merge(b); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if a.Precision != 10 {
+		t.Fatalf("merged sketch must take the lower precision, got %d", a.Precision)
+	}
+	withinError(t, a, 30000)
+
+	// Понижение точности эквивалентно построению скетча сразу с меньшей точностью.
+	hi, _ := New(12)
+	lo, _ := New(8)
+	for i := 0; i < 5000; i++ {
+		hi.Add(strconv.Itoa(i))
+		lo.Add(strconv.Itoa(i))
+	}
+	reduced := hi.reduce(8)
+	for i := range lo.Registers {
+		if reduced.Registers[i] != lo.Registers[i] {
+			t.Fatalf("register %d: reduced %d, direct %d", i, reduced.Registers[i], lo.Registers[i])
+		}
+	}
+}
+
+func TestJSONAndValidate(t *testing.T) {
+	s, _ := New(8)
+	s.Add("a")
+	s.Add("b")
+	raw, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded struct {
+		Sketch
+		Estimate uint64 `json:"estimate"`
+	}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if err := decoded.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if decoded.Estimate != 2 || decoded.Sketch.Estimate() != 2 {
+		t.Fatalf("unexpected estimate: %d / %d", decoded.Estimate, decoded.Sketch.Estimate())
+	}
+
+	if _, err := New(20); err == nil {
+		t.Fatalf("precision 20 must be rejected")
+	}
+	bad := &Sketch{Precision: 8, Registers: make([]byte, 10)}
+	if err := bad.Validate(); err == nil {
+		t.Fatalf("wrong register count must be rejected")
+	}
+}